@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// AbortMoveResponse is the Response for /abort-move
+type AbortMoveResponse struct {
+	Response
+	Actions []string `json:"actions"` // what was done, in order: "escape", "clear_premoves", "click_off_board"
+}
+
+// handleAbortMove puts the board back in a clean interaction state between
+// decisions: Escape drops a selected piece or a drag in progress, a right
+// click on the board cancels premoves (both lichess and chess.com treat it
+// so) with -abort-clear-premoves, and a click at -abort-click, an empty
+// area off the board, deselects on sites that ignore Escape.
+func (c *Controller) handleAbortMove(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "Only POST method is allowed")
+		return
+	}
+
+	var center point
+	if c.cfg.AbortClearPremoves {
+		cal, ok := c.calibration()
+		if !ok {
+			writeErrorCode(w, http.StatusConflict, codeCalibrationMissing, "Board is not calibrated; -abort-clear-premoves right-clicks the board")
+			return
+		}
+		center = point{X: cal.X + cal.Width/2, Y: cal.Y + cal.Height/2}
+	}
+
+	var actions []string
+	err := c.focusCommand(r, func() error {
+		if err := focusFirefox(r.Context()); err != nil {
+			return err
+		}
+		if err := pressKey(r.Context(), "Escape"); err != nil {
+			return err
+		}
+		actions = append(actions, "escape")
+		if c.cfg.AbortClearPremoves {
+			if err := mouseClick(r.Context(), center, buttonRight); err != nil {
+				return fmt.Errorf("failed to clear premoves: %v", err)
+			}
+			actions = append(actions, "clear_premoves")
+		}
+		if c.cfg.AbortClick != (point{}) {
+			if err := mouseClick(r.Context(), c.cfg.AbortClick, buttonLeft); err != nil {
+				return fmt.Errorf("failed to click off the board: %v", err)
+			}
+			actions = append(actions, "click_off_board")
+		}
+		return nil
+	})
+	if err != nil {
+		writeJSON(w, commandStatus(err), AbortMoveResponse{
+			Response: Response{Success: false, Message: fmt.Sprintf("Failed to abort the move: %v", err), ErrorCode: errorCode(err)},
+			Actions:  actions,
+		})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, AbortMoveResponse{
+		Response: Response{Success: true, Message: "Reset the board interaction: " + strings.Join(actions, ", ")},
+		Actions:  actions,
+	})
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// defaultVerifyRetries is how many times an action is repeated when its
+// verify read doesn't match
+const defaultVerifyRetries = 2
+
+// Reads a verify block can check
+const (
+	verifyReadTitle = "title"
+	verifyReadText  = "text"
+	verifyReadFEN   = "fen"
+)
+
+// VerifyBlock is the "verify" object a mutating request may carry: after
+// the action, read is taken and compared with equals or contains, and the
+// action repeated while it doesn't match. A boolean "verify", as /move
+// takes, is the endpoint's own check and left to it. A "fen" read is
+// replayed from the move list: it has no move counters, and names the en
+// passant square after every double pawn step.
+type VerifyBlock struct {
+	Read     string  `json:"read"`               // "title", "text" or "fen"
+	Selector string  `json:"selector,omitempty"` // the element "text" reads
+	Equals   *string `json:"equals,omitempty"`   // a FEN compares without its move counters
+	Contains string  `json:"contains,omitempty"`
+	Retries  *int    `json:"retries,omitempty"`   // defaults to 2
+	SettleMs *int    `json:"settle_ms,omitempty"` // waited before reading; defaults to -batch-settle
+}
+
+// Verification is the outcome of a verify block, added to the response
+type Verification struct {
+	Read     string `json:"read"`
+	Value    string `json:"value"` // what was read after the last attempt
+	Matched  bool   `json:"matched"`
+	Attempts int    `json:"attempts"`
+}
+
+// check reports whether the block's read and expectation are usable here
+func (v *VerifyBlock) check(marionette bool) error {
+	switch v.Read {
+	case verifyReadTitle:
+	case verifyReadText:
+		if v.Selector == "" {
+			return fmt.Errorf("verify read %q needs a selector", v.Read)
+		}
+		fallthrough
+	case verifyReadFEN:
+		if !marionette {
+			return fmt.Errorf("verify read %q requires the marionette backend", v.Read)
+		}
+	default:
+		return fmt.Errorf("unknown verify read %q; use %s, %s or %s", v.Read, verifyReadTitle, verifyReadText, verifyReadFEN)
+	}
+	switch {
+	case v.Equals == nil && v.Contains == "":
+		return fmt.Errorf("verify needs equals or contains")
+	case v.Retries != nil && *v.Retries < 0:
+		return fmt.Errorf("verify retries cannot be negative")
+	case v.SettleMs != nil && (*v.SettleMs < 0 || time.Duration(*v.SettleMs)*time.Millisecond > maxRequestDelay):
+		return fmt.Errorf("verify settle_ms must be between 0 and %d", maxRequestDelay.Milliseconds())
+	}
+	return nil
+}
+
+// matches reports whether value meets the block's expectation
+func (v *VerifyBlock) matches(value string) bool {
+	if v.Contains != "" && !strings.Contains(value, v.Contains) {
+		return false
+	}
+	if v.Equals == nil {
+		return true
+	}
+	want := strings.TrimSpace(*v.Equals)
+	if v.Read == verifyReadFEN {
+		if fields := strings.Fields(want); len(fields) > 4 {
+			want = strings.Join(fields[:4], " ")
+		}
+	}
+	return value == want
+}
+
+// readForVerify takes the block's read from the browser
+func (c *Controller) readForVerify(ctx context.Context, v *VerifyBlock) (string, error) {
+	switch v.Read {
+	case verifyReadTitle:
+		if c.marionette != nil {
+			return c.marionette.Title(ctx)
+		}
+		return firefoxWindowTitle(ctx)
+	case verifyReadText:
+		var result *struct {
+			Text  string `json:"text"`
+			Error string `json:"error"`
+		}
+		if err := c.marionette.ExecuteScript(ctx, getTextScript, []interface{}{v.Selector}, &result); err != nil {
+			return "", fmt.Errorf("failed to read %s: %v", v.Selector, err)
+		}
+		if result == nil {
+			return "", nil
+		}
+		if result.Error != "" {
+			return "", fmt.Errorf("invalid selector %q: %s", v.Selector, result.Error)
+		}
+		return result.Text, nil
+	}
+	pos, err := c.sanPosition(ctx, "")
+	if err != nil {
+		return "", err
+	}
+	return pos.fen(), nil
+}
+
+// verifiable handles a "verify" object on POST requests: the command
+// mutex is held across the action and the read after it, so nothing runs
+// in between, and the action is repeated up to the block's retries while
+// the read doesn't match. The response gets a "verification" field; when
+// no attempt matched it is a 422 with ACTION_UNVERIFIED.
+func (c *Controller) verifiable(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			h(w, r)
+			return
+		}
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "Failed to read request body")
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		var fields map[string]json.RawMessage
+		if json.Unmarshal(body, &fields) != nil || !bytes.HasPrefix(bytes.TrimSpace(fields["verify"]), []byte("{")) {
+			h(w, r)
+			return
+		}
+
+		var v VerifyBlock
+		if err := json.Unmarshal(fields["verify"], &v); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("Invalid verify: %v", err))
+			return
+		}
+		if err := v.check(c.marionette != nil); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("Invalid verify: %v", err))
+			return
+		}
+		retries := defaultVerifyRetries
+		if v.Retries != nil {
+			retries = *v.Retries
+		}
+		settle := c.cfg.BatchSettle
+		if v.SettleMs != nil {
+			settle = time.Duration(*v.SettleMs) * time.Millisecond
+		}
+		// The endpoint sees its own fields only
+		delete(fields, "verify")
+		body, _ = json.Marshal(fields)
+
+		var rec *bufferedResponse
+		result := Verification{Read: v.Read}
+		err = c.command(r, func() error {
+			ctx := r.Context()
+			inner := r.Clone(context.WithValue(ctx, lockHeldKey{}, true))
+			for {
+				result.Attempts++
+				rec = &bufferedResponse{header: http.Header{}, status: http.StatusOK}
+				inner.Body = io.NopCloser(bytes.NewReader(body))
+				inner.ContentLength = int64(len(body))
+				h(rec, inner)
+				if rec.status < 200 || rec.status > 299 {
+					return nil
+				}
+
+				select {
+				case <-time.After(settle):
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+				value, err := c.readForVerify(ctx, &v)
+				if err != nil {
+					return fmt.Errorf("action succeeded but the verify read failed: %v", err)
+				}
+				result.Value = value
+				if result.Matched = v.matches(value); result.Matched || result.Attempts > retries {
+					return nil
+				}
+				log.Printf("verify: %s after %s is %q; repeating the action", v.Read, r.URL.Path, redact(value))
+			}
+		})
+		if err != nil {
+			writeCommandError(w, err, fmt.Sprintf("Failed to verify %s: %v", r.URL.Path, err))
+			return
+		}
+
+		for k, vals := range rec.header {
+			w.Header()[k] = vals
+		}
+		w.Header().Del("Content-Length")
+		status := rec.status
+		out := rec.body.Bytes()
+		if status >= 200 && status <= 299 {
+			verification, _ := json.Marshal(result)
+			out, _ = addJSONField(rec, "verification", verification)
+			if !result.Matched {
+				// The action's own fields are kept, with the outcome overridden
+				var resp map[string]json.RawMessage
+				if json.Unmarshal(out, &resp) == nil {
+					resp["success"] = json.RawMessage("false")
+					resp["message"], _ = json.Marshal(fmt.Sprintf("Verify read %s as %q after %d attempts, not the expected value", v.Read, result.Value, result.Attempts))
+					resp["error_code"], _ = json.Marshal(codeActionUnverified)
+					out, _ = json.Marshal(resp)
+				}
+				status = http.StatusUnprocessableEntity
+			}
+		}
+		w.WriteHeader(status)
+		w.Write(out)
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// AddressBarRequest is the request body for /set-addressbar
+type AddressBarRequest struct {
+	Text string `json:"text"`
+}
+
+// AddressBarResponse is the Response for /set-addressbar and /get-addressbar
+type AddressBarResponse struct {
+	Response
+	Value *string `json:"value,omitempty"` // the address bar's text, when it could be read
+}
+
+// appleScriptEscaper quotes text for an AppleScript string literal
+var appleScriptEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+
+// sendKeysEscaper escapes the characters SendKeys treats as modifiers or groups
+var sendKeysEscaper = strings.NewReplacer(
+	"+", "{+}", "^", "{^}", "%", "{%}", "~", "{~}",
+	"(", "{(}", ")", "{)}", "[", "{[}", "]", "{]}", "{", "{{}", "}", "{}}",
+)
+
+// setAddressBar focuses the address bar and replaces its text with text,
+// leaving it unsubmitted. It is the first half of updateFirefoxURL, without
+// the launch: the browser must already be running.
+func setAddressBar(ctx context.Context, text string) error {
+	if !firefoxRunning(ctx) {
+		return fmt.Errorf("%s is not running", targetBrowser.app)
+	}
+
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "linux":
+		if err := focusFirefox(ctx); err != nil {
+			return err
+		}
+		if err := linuxInput(ctx).key(ctx, "ctrl+l"); err != nil {
+			return fmt.Errorf("failed to select address bar: %v", err)
+		}
+		if err := linuxInput(ctx).typeText(ctx, text); err != nil {
+			// From here on the address bar is mid-edit, so failures back out of it
+			abortAddressBarEdit(ctx, "typing the text")
+			return fmt.Errorf("failed to type %q: %v", text, err)
+		}
+		return nil
+
+	case "darwin":
+		cmd = newCommand(ctx, "osascript", "-e", fmt.Sprintf(`
+		tell application "`+targetBrowser.app+`"
+			activate
+			tell application "System Events"
+				tell process "`+targetBrowser.app+`"
+					keystroke "l" using command down
+					delay 0.1
+					keystroke "a" using command down
+					delay 0.1
+					keystroke "%s"
+				end tell
+			end tell
+		end tell`, appleScriptEscaper.Replace(text)))
+
+	case "windows":
+		cmd = newCommand(ctx, "powershell", "-Command", psWindowType+psForegroundGuard+fmt.Sprintf(`
+		Add-Type -AssemblyName System.Windows.Forms
+		$firefox = Get-Process `+targetBrowser.process+` | Where-Object {$_.MainWindowHandle -ne 0} | Select-Object -First 1
+		if (-not $firefox) { exit 1 }
+		[void][System.Reflection.Assembly]::LoadWithPartialName('Microsoft.VisualBasic')
+		$hwnd = $firefox.MainWindowHandle
+		[Microsoft.VisualBasic.Interaction]::AppActivate($hwnd)
+		Start-Sleep -Milliseconds 100
+		Assert-Foreground $hwnd
+		[System.Windows.Forms.SendKeys]::SendWait("^l")
+		Start-Sleep -Milliseconds 100
+		Assert-Foreground $hwnd
+		[System.Windows.Forms.SendKeys]::SendWait("^a")
+		Start-Sleep -Milliseconds 100
+		Assert-Foreground $hwnd
+		[System.Windows.Forms.SendKeys]::SendWait('%s')`, strings.ReplaceAll(sendKeysEscaper.Replace(text), "'", "''")))
+
+	default:
+		return fmt.Errorf("unsupported operating system: %s", runtime.GOOS)
+	}
+	output, err := cmd.CombinedOutput()
+	if err = checkForegroundExit(err); err != nil && err != errFocusStolen {
+		return fmt.Errorf("%v %s", err, strings.TrimSpace(string(output)))
+	}
+	return err
+}
+
+// handleSetAddressBar types text into the address bar without pressing
+// Enter, so what was typed can be checked before navigating with /key Return.
+// With the marionette backend the response includes the text read back.
+func (c *Controller) handleSetAddressBar(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "Only POST method is allowed")
+		return
+	}
+
+	var req AddressBarRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid JSON payload")
+		return
+	}
+	if req.Text == "" {
+		writeError(w, http.StatusBadRequest, "Text cannot be empty")
+		return
+	}
+	if c.cfg.Kiosk {
+		writeError(w, http.StatusConflict, "The address bar is hidden in kiosk mode; start the server with -kiosk=false to edit it")
+		return
+	}
+
+	var value *string
+	err := c.focusCommand(r, func() error {
+		if err := setAddressBar(r.Context(), req.Text); err != nil {
+			return err
+		}
+		if c.marionette != nil {
+			if v, err := c.marionette.AddressBarValue(r.Context()); err == nil {
+				value = &v
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		writeCommandError(w, err, fmt.Sprintf("Failed to set the address bar: %v", err))
+		return
+	}
+
+	message := "Typed the text into the address bar without navigating"
+	if value != nil && *value != req.Text {
+		message += fmt.Sprintf("; the address bar shows %q", *value)
+	}
+	writeJSON(w, http.StatusOK, AddressBarResponse{
+		Response: Response{Success: true, Message: message},
+		Value:    value,
+	})
+}
+
+// handleGetAddressBar returns the address bar's text, which can differ from
+// the current URL while it is being edited
+func (c *Controller) handleGetAddressBar(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "Only GET method is allowed")
+		return
+	}
+	if c.marionette == nil {
+		writeError(w, http.StatusNotImplemented, "Reading the address bar requires the marionette backend")
+		return
+	}
+
+	var value string
+	err := c.command(r, func() error {
+		var err error
+		value, err = c.marionette.AddressBarValue(r.Context())
+		return err
+	})
+	if err != nil {
+		writeCommandError(w, err, fmt.Sprintf("Failed to read the address bar: %v", err))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, AddressBarResponse{
+		Response: Response{Success: true, Message: "Read the address bar"},
+		Value:    &value,
+	})
+}
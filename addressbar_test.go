@@ -0,0 +1,13 @@
+package main
+
+import "testing"
+
+func TestAddressBarEscapers(t *testing.T) {
+	url := `https://lichess.org/?q=$(calc)&x=%20"+^~(a)[b]{c}`
+	if got, want := appleScriptEscaper.Replace(url), `https://lichess.org/?q=$(calc)&x=%20\"+^~(a)[b]{c}`; got != want {
+		t.Errorf("appleScriptEscaper = %s, want %s", got, want)
+	}
+	if got, want := sendKeysEscaper.Replace(url), `https://lichess.org/?q=${(}calc{)}&x={%}20"{+}{^}{~}{(}a{)}{[}b{]}{{}c{}}`; got != want {
+		t.Errorf("sendKeysEscaper = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// loadAfterNavigate reads the -after-navigate-file JSON object mapping site
+// names or domains to the steps run after each /open to them
+func loadAfterNavigate(path string) (map[string][]sequenceStep, error) {
+	sequences, err := loadSequenceFile(path)
+	if err != nil {
+		return nil, err
+	}
+	normalized := make(map[string][]sequenceStep, len(sequences))
+	for key, steps := range sequences {
+		key = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(key), "."))
+		if !strings.Contains(key, ".") && siteByName(key) == nil {
+			return nil, fmt.Errorf("%q is neither a site name nor a domain", key)
+		}
+		normalized[key] = steps
+	}
+	return normalized, nil
+}
+
+// afterNavigateSteps returns the sequence for target and the key it was
+// configured under. The most specific matching domain wins over the site name.
+func (c *Controller) afterNavigateSteps(target string) ([]sequenceStep, string) {
+	host := strings.ToLower(urlHost(target))
+	best := ""
+	for key := range c.cfg.AfterNavigate {
+		if !strings.Contains(key, ".") {
+			continue
+		}
+		if (host == key || strings.HasSuffix(host, "."+key)) && len(key) > len(best) {
+			best = key
+		}
+	}
+	if best != "" {
+		return c.cfg.AfterNavigate[best], best
+	}
+	if site := c.siteFor(target); site != nil {
+		if steps, ok := c.cfg.AfterNavigate[site.Name]; ok {
+			return steps, site.Name
+		}
+	}
+	return nil, ""
+}
+
+// settleAfterNavigate runs the after-navigate sequence for target, if one is
+// configured, to get past cookie banners and interstitials. The caller holds
+// the command lock with Firefox focused.
+func (c *Controller) settleAfterNavigate(ctx context.Context, target string) (int, string, error) {
+	steps, key := c.afterNavigateSteps(target)
+	if len(steps) == 0 {
+		return 0, "", nil
+	}
+	completed, err := c.runSequence(ctx, steps)
+	if err != nil {
+		return completed, key, withCode(errorCode(err), fmt.Errorf("after-navigate sequence for %s stopped: %v", key, err))
+	}
+	return completed, key, nil
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// parseDomainList parses a comma-separated list of domains such as
+// "lichess.org,*.chess.com" into their lowercase ASCII form
+func parseDomainList(s string) ([]string, error) {
+	var domains []string
+	for _, d := range strings.Split(s, ",") {
+		d = strings.ToLower(strings.TrimSpace(d))
+		if d == "" {
+			continue
+		}
+		wildcard := strings.HasPrefix(d, "*.")
+		host, err := toASCIIHost(strings.TrimPrefix(d, "*."))
+		if err != nil {
+			return nil, fmt.Errorf("invalid domain %q: %v", d, err)
+		}
+		// A fully qualified name's trailing dot is dropped, as allowedDomain
+		// drops it from hosts
+		host = strings.TrimSuffix(host, ".")
+		if host == "" || strings.Contains(host, "..") || strings.HasPrefix(host, ".") || strings.ContainsAny(host, "*/:") {
+			return nil, fmt.Errorf("invalid domain %q", d)
+		}
+		if wildcard {
+			host = "*." + host
+		}
+		domains = append(domains, host)
+	}
+	return domains, nil
+}
+
+// urlHost returns the lowercase host of a URL as normalizeURL returns it
+func urlHost(target string) string {
+	toParse := target
+	if !strings.Contains(target, "://") {
+		toParse = "//" + target
+	}
+	u, err := url.Parse(toParse)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Hostname())
+}
+
+// allowedDomain returns the -allowed-domains entry that host matches. An
+// entry "*.example.org" matches example.org and all of its subdomains.
+func (c *Controller) allowedDomain(host string) (string, bool) {
+	host = strings.TrimSuffix(host, ".")
+	for _, d := range c.cfg.AllowedDomains {
+		if base, ok := strings.CutPrefix(d, "*."); ok {
+			if host == base || strings.HasSuffix(host, "."+base) {
+				return d, true
+			}
+		} else if host == d {
+			return d, true
+		}
+	}
+	return "", false
+}
+
+// pageNotAllowedError is returned by checkPageAllowed when the current tab
+// is on a host outside -allowed-domains
+type pageNotAllowedError struct {
+	url string
+}
+
+func (e *pageNotAllowedError) Error() string {
+	return fmt.Sprintf("the current page %s is not in the allowed domains", e.url)
+}
+
+// checkPageAllowed fails when -allowed-domains is set and the current tab's
+// host isn't in it, so scripts and form fills only run on trusted sites even
+// if the browser has drifted elsewhere. It needs the marionette backend.
+func (c *Controller) checkPageAllowed(ctx context.Context) error {
+	if len(c.cfg.AllowedDomains) == 0 {
+		return nil
+	}
+	current, err := c.marionette.CurrentURL(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to read current URL: %v", err)
+	}
+	if _, ok := c.allowedDomain(urlHost(current)); !ok {
+		return &pageNotAllowedError{url: current}
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseDomainList(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string // nil for an error
+	}{
+		{"lichess.org", []string{"lichess.org"}},
+		{" Lichess.ORG , *.Chess.com ", []string{"lichess.org", "*.chess.com"}},
+		{"lichess.org.", []string{"lichess.org"}},
+		{"*.lichess.org.", []string{"*.lichess.org"}},
+		{"bücher.de,*.MÜNCHEN.de", []string{"xn--bcher-kva.de", "*.xn--mnchen-3ya.de"}},
+		{"lichess.org,,", []string{"lichess.org"}},
+		{"*.", nil},
+		{".", nil},
+		{"*", nil},
+		{"*.*.lichess.org", nil},
+		{"lichess.*", nil},
+		{"lichess.org:443", nil},
+		{"lichess.org/tv", nil},
+	}
+	for _, tt := range tests {
+		got, err := parseDomainList(tt.in)
+		if tt.want == nil {
+			if err == nil {
+				t.Errorf("parseDomainList(%q) = %q, want an error", tt.in, got)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseDomainList(%q) = %q, %v, want %q", tt.in, got, err, tt.want)
+		}
+	}
+}
+
+func TestAllowedDomain(t *testing.T) {
+	domains, err := parseDomainList("*.lichess.org,chess.com,bücher.de")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := newController(&Config{AllowedDomains: domains})
+	tests := []struct {
+		host, want string // want "" when the host isn't allowed
+	}{
+		{"lichess.org", "*.lichess.org"},
+		{"lichess.org.", "*.lichess.org"},
+		{"www.lichess.org", "*.lichess.org"},
+		{"a.b.lichess.org", "*.lichess.org"},
+		{"evil-lichess.org", ""},
+		{"lichess.org.evil.com", ""},
+		{"evillichess.org", ""},
+		{"chess.com", "chess.com"},
+		{"chess.com.", "chess.com"},
+		{"www.chess.com", ""},
+		{"xn--bcher-kva.de", "xn--bcher-kva.de"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		got, ok := c.allowedDomain(tt.host)
+		if ok != (tt.want != "") || got != tt.want {
+			t.Errorf("allowedDomain(%q) = %q, %v, want %q", tt.host, got, ok, tt.want)
+		}
+	}
+}
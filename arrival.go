@@ -0,0 +1,40 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+)
+
+// occupiedFraction is how much of a square's middle must differ from its
+// background for a piece to be on it. A piece covers roughly half of the
+// middle, while an empty square, highlighted or not, is one flat color there.
+const occupiedFraction = 0.15
+
+// squareOccupancy returns the fraction of the middle of square r that
+// differs from the square's own background, sampled from squarePatch, in a
+// PNG screenshot. Coordinate labels sit in the corners, outside the middle.
+func squareOccupancy(shot []byte, r rect) (float64, error) {
+	img, err := png.Decode(bytes.NewReader(shot))
+	if err != nil {
+		return 0, fmt.Errorf("failed to decode screenshot: %v", err)
+	}
+	patch := squarePatch(r).Intersect(img.Bounds())
+	middle := image.Rect(r.X+r.Width/5, r.Y+r.Height/5, r.X+r.Width*4/5, r.Y+r.Height*4/5).Intersect(img.Bounds())
+	if patch.Empty() || middle.Empty() {
+		return 0, fmt.Errorf("square %v is outside the %dx%d screen", r, img.Bounds().Dx(), img.Bounds().Dy())
+	}
+	background := meanColor(img, patch)
+	differing, total := 0, 0
+	for y := middle.Min.Y; y < middle.Max.Y; y++ {
+		for x := middle.Min.X; x < middle.Max.X; x++ {
+			if !colorsClose(color.RGBAModel.Convert(img.At(x, y)).(color.RGBA), background, highlightTolerance) {
+				differing++
+			}
+			total++
+		}
+	}
+	return float64(differing) / float64(total), nil
+}
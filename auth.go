@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// authRealm is the realm named in WWW-Authenticate challenges
+const authRealm = "browser-controller"
+
+// authRequired reports whether requests must carry an API key or basic auth
+// credentials
+func (c *Controller) authRequired() bool {
+	return c.cfg.APIKey != "" || len(c.cfg.BasicAuth) > 0
+}
+
+// withAuth requires credentials on every request except /health and /ready:
+// the -api-key in an X-API-Key header or as an "Authorization: Bearer" token,
+// or a -basic-auth user and password. Either is accepted when both are set.
+// Requests dispatched internally, by /batch, /rpc, replays and startup, carry
+// lockHeldKey, which no client can set, and pass without credentials.
+func (c *Controller) withAuth(h http.Handler) http.Handler {
+	if !c.authRequired() {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/health" || r.URL.Path == "/ready" || r.Context().Value(lockHeldKey{}) != nil {
+			h.ServeHTTP(w, r)
+			return
+		}
+		if c.cfg.APIKey != "" {
+			key := r.Header.Get("X-API-Key")
+			if key == "" {
+				key, _ = strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			}
+			if subtle.ConstantTimeCompare([]byte(key), []byte(c.cfg.APIKey)) == 1 {
+				h.ServeHTTP(w, r)
+				return
+			}
+		}
+		if len(c.cfg.BasicAuth) > 0 {
+			if user, password, ok := r.BasicAuth(); ok && checkPassword(c.cfg.BasicAuth[user], password) {
+				h.ServeHTTP(w, r)
+				return
+			}
+		}
+
+		message := "Missing or invalid API key"
+		if len(c.cfg.BasicAuth) > 0 {
+			// Browsers and standard clients prompt for credentials on this challenge
+			w.Header().Add("WWW-Authenticate", fmt.Sprintf(`Basic realm=%q, charset="UTF-8"`, authRealm))
+			message = "Missing or invalid credentials"
+			if c.cfg.APIKey == "" {
+				message = "Missing or invalid user name or password"
+			}
+		}
+		if c.cfg.APIKey != "" {
+			w.Header().Add("WWW-Authenticate", fmt.Sprintf("Bearer realm=%q", authRealm))
+		}
+		writeErrorCode(w, http.StatusUnauthorized, codeUnauthorized, message)
+	})
+}
+
+// checkPassword reports whether password matches an htpasswd entry, stored
+// in plain text or as {SHA}, the base64 SHA-1 hash htpasswd -s writes. An
+// empty entry, for an unknown user, matches nothing.
+func checkPassword(stored, password string) bool {
+	if stored == "" {
+		return false
+	}
+	if hash, ok := strings.CutPrefix(stored, "{SHA}"); ok {
+		sum := sha1.Sum([]byte(password))
+		password, stored = base64.StdEncoding.EncodeToString(sum[:]), hash
+	}
+	return subtle.ConstantTimeCompare([]byte(password), []byte(stored)) == 1
+}
+
+// parseBasicAuth adds a -basic-auth "user:password" entry to users
+func parseBasicAuth(users map[string]string, entry string) error {
+	user, password, ok := strings.Cut(entry, ":")
+	if !ok || user == "" || password == "" {
+		return fmt.Errorf("want user:password")
+	}
+	// bcrypt ($2y$) and Apache MD5 ($apr1$) need more than the standard library
+	if strings.HasPrefix(password, "$") {
+		return fmt.Errorf("%s: only plain text and {SHA} passwords are supported; create the file with htpasswd -s", user)
+	}
+	users[user] = password
+	return nil
+}
+
+// loadHtpasswd reads a -basic-auth-file of user:password lines, as written
+// by htpasswd -s; blank lines and lines starting with # are skipped
+func loadHtpasswd(path string, users map[string]string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if err := parseBasicAuth(users, line); err != nil {
+			return fmt.Errorf("line %d: %v", n, err)
+		}
+	}
+	return scanner.Err()
+}
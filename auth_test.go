@@ -0,0 +1,53 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const testAPIKey = "secret"
+
+// serveWithKey sends a request through the controller's handler with the test API key
+func serveWithKey(c *Controller, method, path, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-API-Key", testAPIKey)
+	rec := httptest.NewRecorder()
+	c.mux.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestInternalDispatchPassesAuth(t *testing.T) {
+	c := newController(&Config{APIKey: testAPIKey})
+
+	req := httptest.NewRequest(http.MethodGet, "/config", nil)
+	rec := httptest.NewRecorder()
+	c.mux.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("GET /config without a key: status %d, want 401", rec.Code)
+	}
+
+	rec = serveWithKey(c, http.MethodPost, "/rpc", `{"jsonrpc":"2.0","method":"config","id":1}`)
+	var rpc rpcResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &rpc); err != nil {
+		t.Fatalf("/rpc config: %v: %s", err, rec.Body)
+	}
+	if rpc.Error != nil {
+		t.Fatalf("/rpc config failed: %+v", rpc.Error)
+	}
+
+	if rec = serveWithKey(c, http.MethodPost, "/calibrate", `{"x":0,"y":0,"width":800,"height":800}`); rec.Code != http.StatusOK {
+		t.Fatalf("/calibrate: status %d: %s", rec.Code, rec.Body)
+	}
+	rec = serveWithKey(c, http.MethodPost, "/batch", `{"action":"move","params":{"move":"e2e4","dry_run":true}}`)
+	var batch BatchResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &batch); err != nil {
+		t.Fatalf("/batch: %v: %s", err, rec.Body)
+	}
+	if rec.Code != http.StatusOK || !batch.Success {
+		t.Fatalf("/batch move: status %d: %s", rec.Code, rec.Body)
+	}
+}
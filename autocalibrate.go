@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+)
+
+// boardRectScript returns the screen rectangle (in device pixels) of the
+// element matching arguments[0], and whether arguments[1] matches anything.
+// mozInnerScreenX/Y give the viewport's screen position in CSS pixels.
+const boardRectScript = `
+const board = document.querySelector(arguments[0]);
+if (!board) { return null; }
+const r = board.getBoundingClientRect();
+const dpr = window.devicePixelRatio || 1;
+const left = (window.mozInnerScreenX !== undefined) ? window.mozInnerScreenX : window.screenX;
+const top = (window.mozInnerScreenY !== undefined) ? window.mozInnerScreenY : window.screenY + (window.outerHeight - window.innerHeight);
+return {
+	x: (left + r.left) * dpr,
+	y: (top + r.top) * dpr,
+	width: r.width * dpr,
+	height: r.height * dpr,
+	flipped: arguments[1] ? document.querySelector(arguments[1]) !== null : false,
+};`
+
+// boardRect is the result of boardRectScript
+type boardRect struct {
+	X       float64 `json:"x"`
+	Y       float64 `json:"y"`
+	Width   float64 `json:"width"`
+	Height  float64 `json:"height"`
+	Flipped bool    `json:"flipped"`
+}
+
+// readBoardCalibration reads the board element's position and orientation
+// for site from the page. It returns nil if the page has no board.
+func (c *Controller) readBoardCalibration(ctx context.Context, site *siteProfile) (*Calibration, error) {
+	var br *boardRect
+	if err := c.marionette.ExecuteScript(ctx, boardRectScript, []interface{}{site.BoardSelector, site.FlippedSelector}, &br); err != nil {
+		return nil, fmt.Errorf("failed to read board position: %v", err)
+	}
+	if br == nil {
+		return nil, nil
+	}
+	cal := &Calibration{
+		X:           int(math.Round(br.X)),
+		Y:           int(math.Round(br.Y)),
+		Width:       int(math.Round(br.Width)),
+		Height:      int(math.Round(br.Height)),
+		Orientation: orientationWhite,
+		insets:      c.cfg.boardInsets(),
+	}
+	if br.Flipped {
+		cal.Orientation = orientationBlack
+	}
+	return cal, nil
+}
+
+// handleAutoCalibrate sets the calibration from the board element of a recognized site
+func (c *Controller) handleAutoCalibrate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "Only POST method is allowed")
+		return
+	}
+	if c.marionette == nil {
+		writeError(w, http.StatusNotImplemented, "Auto-calibration requires the marionette backend")
+		return
+	}
+
+	site, current, err := c.currentSite(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if site == nil || site.BoardSelector == "" {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("Unsupported site: %s", current))
+		return
+	}
+
+	cal, err := c.readBoardCalibration(r.Context(), site)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if cal == nil {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("No board found on %s", current))
+		return
+	}
+	if err := cal.validate(); err != nil {
+		writeError(w, http.StatusConflict, fmt.Sprintf("Board element has unusable geometry: %v", err))
+		return
+	}
+	c.state.setCalibration(*cal)
+	c.saveCalibration()
+
+	writeJSON(w, http.StatusOK, CalibrationResponse{
+		Response: Response{
+			Success: true,
+			Message: fmt.Sprintf("Calibrated from the %s board (%s at the bottom)", site.Name, cal.Orientation),
+		},
+		Calibration: cal,
+		Warning:     c.orientationWarning(site.Name, cal),
+	})
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// batchActions maps /batch action names to the endpoints that perform them
+var batchActions = map[string]string{
+	"navigate":    "/open",
+	"drag-square": "/drag-square",
+	"move":        "/move",
+}
+
+// BatchRequest represents the JSON payload for /batch
+type BatchRequest struct {
+	Action     string          `json:"action"`
+	Params     json.RawMessage `json:"params"` // the payload of the action's endpoint
+	Screenshot bool            `json:"screenshot"`
+	SettleMs   *int            `json:"settle_ms"` // wait before the screenshot; defaults to -batch-settle
+	// BoardOnly refuses to run the action unless the board is calibrated,
+	// rather than falling back to a screenshot of the whole screen
+	BoardOnly bool `json:"board_only"`
+
+	// ScreenshotFormat is "png", the default, or "jpeg" at ScreenshotQuality
+	ScreenshotFormat  string `json:"screenshot_format"`
+	ScreenshotQuality int    `json:"screenshot_quality"`
+}
+
+// BatchResponse is the Response for /batch
+type BatchResponse struct {
+	Response
+	Result     json.RawMessage `json:"result"`               // the action endpoint's response
+	Screenshot string          `json:"screenshot,omitempty"` // base64 image of the board (or screen if uncalibrated)
+}
+
+// boardScreenshot captures the calibrated board, or the whole screen if the board isn't calibrated
+func (c *Controller) boardScreenshot(ctx context.Context) ([]byte, error) {
+	shot, err := captureScreen(ctx)
+	if err != nil {
+		return nil, err
+	}
+	cal, ok := c.calibration()
+	if !ok {
+		return shot, nil
+	}
+	return cropPNG(shot, rect{X: cal.X, Y: cal.Y, Width: cal.Width, Height: cal.Height})
+}
+
+// handleBatch performs one action and then captures the resulting board,
+// holding the command mutex across both so nothing runs in between
+func (c *Controller) handleBatch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "Only POST method is allowed")
+		return
+	}
+
+	var req BatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid JSON payload")
+		return
+	}
+	path, ok := batchActions[req.Action]
+	if !ok {
+		names := make([]string, 0, len(batchActions))
+		for name := range batchActions {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("Unknown action %q; supported actions: %s", req.Action, strings.Join(names, ", ")))
+		return
+	}
+	format, err := parseImageFormat(req.ScreenshotFormat, req.ScreenshotQuality)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("Invalid screenshot format: %v", err))
+		return
+	}
+	settle := c.cfg.BatchSettle
+	if req.SettleMs != nil {
+		if *req.SettleMs < 0 {
+			writeError(w, http.StatusBadRequest, "settle_ms cannot be negative")
+			return
+		}
+		settle = time.Duration(*req.SettleMs) * time.Millisecond
+	}
+
+	if _, ok := c.calibration(); req.Screenshot && req.BoardOnly && !ok {
+		writeErrorCode(w, http.StatusConflict, codeCalibrationMissing, "Board is not calibrated")
+		return
+	}
+
+	var resp BatchResponse
+	var actionStatus int
+	err = c.command(r, func() error {
+		rec, err := c.dispatchLocked(r.Context(), path, req.Params)
+		if err != nil {
+			return err
+		}
+		actionStatus = rec.status
+		resp.Result = json.RawMessage(rec.body.Bytes())
+		if rec.status < 200 || rec.status > 299 || !req.Screenshot {
+			return nil
+		}
+
+		// Let animations and page updates finish before capturing
+		select {
+		case <-time.After(settle):
+		case <-r.Context().Done():
+			return r.Context().Err()
+		}
+		shot, err := c.boardScreenshot(r.Context())
+		if err != nil {
+			return fmt.Errorf("action succeeded but screenshot failed: %v", err)
+		}
+		if shot, err = format.encode(shot); err != nil {
+			return fmt.Errorf("action succeeded but screenshot failed: %v", err)
+		}
+		resp.Screenshot = base64.StdEncoding.EncodeToString(shot)
+		return nil
+	})
+	if err != nil {
+		resp.Response = Response{Success: false, Message: fmt.Sprintf("Batch %s failed: %v", req.Action, err), ErrorCode: errorCode(err)}
+		writeJSON(w, commandStatus(err), resp)
+		return
+	}
+	if actionStatus < 200 || actionStatus > 299 {
+		var failed Response
+		json.Unmarshal(resp.Result, &failed)
+		resp.Response = Response{Success: false, Message: fmt.Sprintf("Action %s failed", req.Action), ErrorCode: failed.ErrorCode}
+		writeJSON(w, actionStatus, resp)
+		return
+	}
+
+	resp.Response = Response{Success: true, Message: fmt.Sprintf("Performed %s", req.Action)}
+	writeJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image/color"
+	"image/png"
+	"log"
+	"runtime"
+	"time"
+)
+
+// boardLoadPoll is how often /open looks for the board with -verify-board
+const boardLoadPoll = 250 * time.Millisecond
+
+// boardLoaded reports whether the board has rendered. With the marionette
+// backend on a known site the board element must be on the page with a
+// usable size; natively the calibrated region must show two distinct square
+// shades rather than the flat background of a spinner. checked is false when
+// neither applies, so there is nothing to wait for.
+func (c *Controller) boardLoaded(ctx context.Context, target string) (loaded, checked bool, err error) {
+	if c.marionette != nil {
+		site := c.siteFor(target)
+		if site == nil || site.BoardSelector == "" {
+			return false, false, nil
+		}
+		cal, err := c.readBoardCalibration(ctx, site)
+		if err != nil {
+			return false, true, err
+		}
+		return cal != nil && cal.validate() == nil, true, nil
+	}
+
+	cal, ok := c.calibration()
+	if !ok {
+		return false, false, nil
+	}
+	shot, err := captureScreen(ctx)
+	if err != nil {
+		return false, true, err
+	}
+	return checkeredBoard(shot, cal)
+}
+
+// checkeredBoard reports whether the calibrated region of a screenshot
+// alternates between a light and a dark square shade
+func checkeredBoard(shot []byte, cal Calibration) (loaded, checked bool, err error) {
+	img, err := png.Decode(bytes.NewReader(shot))
+	if err != nil {
+		return false, true, fmt.Errorf("failed to decode screenshot: %v", err)
+	}
+	var shades [2][]color.RGBA // dark and light squares
+	for file := 0; file < 8; file++ {
+		for rank := 0; rank < 8; rank++ {
+			r, _ := cal.squareRect(string([]byte{byte('a' + file), byte('1' + rank)}))
+			patch := squarePatch(r).Intersect(img.Bounds())
+			if patch.Empty() {
+				return false, true, fmt.Errorf("the board at %d,%d is outside the screenshot", cal.X, cal.Y)
+			}
+			shade := (file + rank) % 2
+			shades[shade] = append(shades[shade], meanColor(img, patch))
+		}
+	}
+	return colorDistance(medianColor(shades[0]), medianColor(shades[1])) > highlightTolerance, true, nil
+}
+
+// reloadPage reloads the current tab, through marionette when available
+func (c *Controller) reloadPage(ctx context.Context) error {
+	if c.marionette != nil {
+		return c.marionette.Refresh(ctx)
+	}
+	if err := focusFirefox(ctx); err != nil {
+		return err
+	}
+	if runtime.GOOS == "darwin" {
+		return pressKey(ctx, "cmd+r")
+	}
+	return pressKey(ctx, "F5")
+}
+
+// waitForBoard waits up to -board-load-timeout for the board to render
+// after /open navigated to target. A board that doesn't appear gets one
+// reload before failing with BOARD_NOT_LOADED.
+func (c *Controller) waitForBoard(ctx context.Context, target string) error {
+	defer timeStep(ctx, "board")()
+	for attempt := 0; ; attempt++ {
+		deadline := time.Now().Add(c.cfg.BoardLoadTimeout)
+		for {
+			loaded, checked, err := c.boardLoaded(ctx, target)
+			if err != nil {
+				return err
+			}
+			if !checked {
+				log.Printf("verify-board: no board selector or calibration for %s; not checking", redact(target))
+				return nil
+			}
+			if loaded {
+				return nil
+			}
+			if time.Now().After(deadline) {
+				break
+			}
+			select {
+			case <-time.After(boardLoadPoll):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		if attempt == 1 {
+			return withCode(codeBoardNotLoaded, fmt.Errorf("board did not load within %v, even after a reload", c.cfg.BoardLoadTimeout))
+		}
+		log.Printf("verify-board: board did not load within %v; reloading %s", c.cfg.BoardLoadTimeout, redact(target))
+		if err := c.reloadPage(ctx); err != nil {
+			return fmt.Errorf("failed to reload after the board did not load: %v", err)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// BoardSquare is one square of /board-state
+type BoardSquare struct {
+	Square   string  `json:"square"`
+	Occupied bool    `json:"occupied"`
+	Color    string  `json:"color,omitempty"` // "white" or "black", with ?colors=1
+	Fill     float64 `json:"fill"`            // fraction of the square's middle unlike its background
+}
+
+// BoardStateResponse is the Response for /board-state
+type BoardStateResponse struct {
+	Response
+	// Rows are the ranks from 8 to 1, files a to h, whichever way the board
+	// is turned: "." for an empty square, "x" for an occupied one, or with
+	// ?colors=1 "w" and "b" for a white and a black piece
+	Rows      []string      `json:"rows"`
+	Squares   []BoardSquare `json:"squares"` // a1, b1, ... h8
+	Threshold float64       `json:"threshold"`
+	Occupied  int           `json:"occupied"`
+}
+
+// squareFill returns the fraction of a square's middle whose pixels differ
+// from the square's background, sampled in its top right corner, and the
+// mean luminance of the differing pixels, which tells a light piece from a
+// dark one
+func squareFill(img image.Image, r rect) (fill, luminance float64) {
+	background := meanColor(img, squarePatch(r).Intersect(img.Bounds()))
+	middle := image.Rect(r.X+r.Width/4, r.Y+r.Height/4, r.X+r.Width*3/4, r.Y+r.Height*3/4).Intersect(img.Bounds())
+	var differing, total int
+	var sum float64
+	for y := middle.Min.Y; y < middle.Max.Y; y++ {
+		for x := middle.Min.X; x < middle.Max.X; x++ {
+			px := color.RGBAModel.Convert(img.At(x, y)).(color.RGBA)
+			total++
+			if colorDistance(px, background) <= highlightTolerance {
+				continue
+			}
+			differing++
+			sum += 0.299*float64(px.R) + 0.587*float64(px.G) + 0.114*float64(px.B)
+		}
+	}
+	if total == 0 {
+		return 0, 0
+	}
+	if differing > 0 {
+		luminance = sum / float64(differing)
+	}
+	return float64(differing) / float64(total), luminance
+}
+
+// handleBoardState reads which squares of the calibrated board hold a piece
+// from a screenshot, for setups without DOM access. A square counts as
+// occupied when more than ?threshold=, by default -occupancy-threshold, of
+// its middle differs from its background; ?colors=1 also guesses each
+// piece's color from its brightness. It is a rough reading: highlights,
+// arrows, premove markers and coordinate labels can look like pieces,
+// animations catch pieces between squares, and it can't tell which piece
+// stands where. With the marionette backend, /square-info and /move-list
+// read the board from the page instead.
+func (c *Controller) handleBoardState(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "Only GET method is allowed")
+		return
+	}
+	threshold := c.cfg.OccupancyThreshold
+	if q := r.URL.Query().Get("threshold"); q != "" {
+		v, err := strconv.ParseFloat(q, 64)
+		if err != nil || v <= 0 || v >= 1 {
+			writeError(w, http.StatusBadRequest, "threshold must be between 0 and 1")
+			return
+		}
+		threshold = v
+	}
+	guessColors, _ := strconv.ParseBool(r.URL.Query().Get("colors"))
+	cal, ok := c.calibration()
+	if !ok {
+		writeErrorCode(w, http.StatusConflict, codeCalibrationMissing, "Board is not calibrated")
+		return
+	}
+
+	var shot []byte
+	err := c.command(r, func() error {
+		var err error
+		shot, err = captureScreen(r.Context())
+		return err
+	})
+	if err != nil {
+		writeCommandError(w, err, err.Error())
+		return
+	}
+	img, err := png.Decode(bytes.NewReader(shot))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to decode screenshot: %v", err))
+		return
+	}
+	if !image.Rect(cal.X, cal.Y, cal.X+cal.Width, cal.Y+cal.Height).In(img.Bounds()) {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("The board at %d,%d is outside the %dx%d screenshot", cal.X, cal.Y, img.Bounds().Dx(), img.Bounds().Dy()))
+		return
+	}
+
+	resp := BoardStateResponse{Threshold: threshold}
+	rows := make([][]byte, 8)
+	for i := range rows {
+		rows[i] = []byte(strings.Repeat(".", 8))
+	}
+	for rank := 0; rank < 8; rank++ {
+		for file := 0; file < 8; file++ {
+			square := string([]byte{byte('a' + file), byte('1' + rank)})
+			sr, _ := cal.squareRect(square)
+			fill, luminance := squareFill(img, sr)
+			sq := BoardSquare{Square: square, Occupied: fill > threshold, Fill: math.Round(fill*1000) / 1000}
+			if sq.Occupied {
+				resp.Occupied++
+				mark := byte('x')
+				if guessColors {
+					sq.Color, mark = "black", 'b'
+					if luminance >= 128 {
+						sq.Color, mark = "white", 'w'
+					}
+				}
+				rows[7-rank][file] = mark
+			}
+			resp.Squares = append(resp.Squares, sq)
+		}
+	}
+	for _, row := range rows {
+		resp.Rows = append(resp.Rows, string(row))
+	}
+	resp.Response = Response{Success: true, Message: fmt.Sprintf("%d squares look occupied", resp.Occupied)}
+	writeJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// setFirefoxBounds moves and resizes the Firefox window to b
+func setFirefoxBounds(ctx context.Context, b rect) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "linux":
+		cmd = newCommand(ctx, "xdotool", "search", "--onlyvisible", "--class", targetBrowser.class,
+			"windowsize", strconv.Itoa(b.Width), strconv.Itoa(b.Height),
+			"windowmove", strconv.Itoa(b.X), strconv.Itoa(b.Y))
+	case "darwin":
+		cmd = newCommand(ctx, "osascript", "-e", fmt.Sprintf(`tell application "`+targetBrowser.app+`" to set bounds of front window to {%d, %d, %d, %d}`,
+			b.X, b.Y, b.X+b.Width, b.Y+b.Height))
+	case "windows":
+		cmd = newCommand(ctx, "powershell", "-Command", psWindowType+fmt.Sprintf(`
+$firefox = Get-Process `+targetBrowser.process+` | Where-Object {$_.MainWindowHandle -ne 0} | Select-Object -First 1
+if (-not $firefox) { exit 1 }
+if (-not [BrowserControllerWindow]::MoveWindow($firefox.MainWindowHandle, %d, %d, %d, %d, $true)) { exit 2 }`,
+			b.X, b.Y, b.Width, b.Height))
+	default:
+		return fmt.Errorf("unsupported operating system: %s", runtime.GOOS)
+	}
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to set window bounds: %v %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// handleSetWindowBounds snaps the Firefox window to a known rectangle
+func (c *Controller) handleSetWindowBounds(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "Only POST method is allowed")
+		return
+	}
+
+	var b rect
+	if err := json.NewDecoder(r.Body).Decode(&b); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid JSON payload")
+		return
+	}
+	if b.empty() {
+		writeError(w, http.StatusBadRequest, "Width and height must be positive")
+		return
+	}
+
+	err := c.command(r, func() error {
+		return setFirefoxBounds(r.Context(), b)
+	})
+	if err != nil {
+		writeCommandError(w, err, fmt.Sprintf("Failed to set window bounds: %v", err))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, Response{
+		Success: true,
+		Message: fmt.Sprintf("Firefox window set to %v", b),
+	})
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"runtime"
+	"slices"
+	"strings"
+	"time"
+)
+
+// supportedBrowsers are the browsers -browser can target. Brave and Vivaldi
+// are driven like Firefox with the native backend, through their window and
+// process; marionette is Firefox-only.
+var supportedBrowsers = []string{"firefox", "brave", "vivaldi"}
+
+// targetBrowser is the browser the controller launches and focuses, set by
+// configureBrowser
+var targetBrowser = knownBrowsers[0]
+
+// findBrowser returns the known browser called name
+func findBrowser(name string) (knownBrowser, bool) {
+	for _, b := range knownBrowsers {
+		if b.name == name {
+			return b, true
+		}
+	}
+	return knownBrowser{}, false
+}
+
+// configureBrowser sets targetBrowser from -browser
+func configureBrowser(cfg *Config) {
+	if b, ok := findBrowser(cfg.Browser); ok {
+		targetBrowser = b
+	}
+}
+
+// exe returns the browser's executable name on Windows
+func (b knownBrowser) exe() string {
+	return b.process + ".exe"
+}
+
+// pgrepName returns the process name pgrep and pkill match on Linux and macOS
+func (b knownBrowser) pgrepName() string {
+	switch {
+	case runtime.GOOS == "darwin" && b.chromium:
+		return b.app
+	case runtime.GOOS == "linux" && b.linuxProcess != "":
+		return b.linuxProcess
+	}
+	return b.process
+}
+
+// browserInstalled reports whether the target browser can be launched: its
+// binary is on PATH, or its application is registered on macOS and Windows
+func browserInstalled(ctx context.Context, b knownBrowser) bool {
+	switch runtime.GOOS {
+	case "linux":
+		_, err := lookPath(b.bin)
+		return err == nil
+	case "darwin":
+		return newCommand(ctx, "open", "-Ra", b.app).Run() == nil
+	case "windows":
+		if _, err := lookPath(b.exe()); err == nil {
+			return true
+		}
+		// Installers register the executable under App Paths rather than on PATH
+		for _, root := range []string{"HKCU", "HKLM"} {
+			key := root + `\Software\Microsoft\Windows\CurrentVersion\App Paths\` + b.exe()
+			if newCommand(ctx, "reg", "query", key).Run() == nil {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+var windowsEnvPattern = regexp.MustCompile(`%[A-Za-z0-9_()]+%`)
+
+// appPathsExe returns the full path Windows installers register exe under
+// App Paths, which cmd's start and the shell resolve but CreateProcess
+// doesn't, or "" when it isn't registered
+func appPathsExe(ctx context.Context, exe string) string {
+	for _, root := range []string{"HKCU", "HKLM"} {
+		key := root + `\Software\Microsoft\Windows\CurrentVersion\App Paths\` + exe
+		output, err := newCommand(ctx, "reg", "query", key, "/ve").Output()
+		if err != nil {
+			continue
+		}
+		if path := regDefaultValue(string(output)); path != "" {
+			return path
+		}
+	}
+	return ""
+}
+
+// regDefaultValue returns the string value in reg query /ve output, such as
+// "    (Default)    REG_SZ    C:\Program Files\Mozilla Firefox\firefox.exe",
+// with the %variables% of a REG_EXPAND_SZ value expanded
+func regDefaultValue(output string) string {
+	for _, line := range strings.Split(output, "\n") {
+		for _, kind := range []string{"REG_EXPAND_SZ", "REG_SZ"} {
+			_, value, ok := strings.Cut(line, kind)
+			if value = strings.Trim(strings.TrimSpace(value), `"`); !ok || value == "" {
+				continue
+			}
+			return windowsEnvPattern.ReplaceAllStringFunc(value, func(v string) string {
+				return os.Getenv(strings.Trim(v, "%"))
+			})
+		}
+	}
+	return ""
+}
+
+// checkBrowserInstalled fails startup when -browser names a browser that
+// isn't installed. Firefox keeps its old behaviour of failing at launch, and
+// -firefox-bin skips the check since it names the binary explicitly.
+func checkBrowserInstalled(cfg *Config) error {
+	if targetBrowser.name == "firefox" || cfg.FirefoxBin != "" {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if !browserInstalled(ctx, targetBrowser) {
+		where := targetBrowser.bin + " is not on PATH"
+		switch runtime.GOOS {
+		case "darwin":
+			where = "no " + targetBrowser.app + " application was found"
+		case "windows":
+			where = targetBrowser.exe() + " is neither on PATH nor registered under App Paths"
+		}
+		return fmt.Errorf("-browser %s: %s is not installed (%s); install it or set -firefox-bin to its binary", cfg.Browser, targetBrowser.app, where)
+	}
+	return nil
+}
+
+// validateBrowser checks -browser against supportedBrowsers and the backend
+func validateBrowser(cfg *Config) error {
+	b, ok := findBrowser(cfg.Browser)
+	if !ok || !slices.Contains(supportedBrowsers, cfg.Browser) {
+		return fmt.Errorf("unknown -browser %q: must be one of %s", cfg.Browser, strings.Join(supportedBrowsers, ", "))
+	}
+	if b.chromium && cfg.Backend == backendMarionette {
+		return fmt.Errorf("-browser %s needs -backend native: marionette only drives Firefox", cfg.Browser)
+	}
+	if b.chromium && cfg.Prefs != nil {
+		return fmt.Errorf("-automation-prefs and -prefs-file only apply to Firefox profiles, not -browser %s", cfg.Browser)
+	}
+	return nil
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+func TestRegDefaultValue(t *testing.T) {
+	os.Setenv("TEST_PROGRAM_FILES", `C:\Program Files`)
+	tests := []struct {
+		output, want string
+	}{
+		{"\r\nHKEY_LOCAL_MACHINE\\Software\\Microsoft\\Windows\\CurrentVersion\\App Paths\\firefox.exe\r\n    (Default)    REG_SZ    C:\\Program Files\\Mozilla Firefox\\firefox.exe\r\n\r\n", `C:\Program Files\Mozilla Firefox\firefox.exe`},
+		{"    (Default)    REG_SZ    \"C:\\Program Files\\BraveSoftware\\brave.exe\"\r\n", `C:\Program Files\BraveSoftware\brave.exe`},
+		{"    (Default)    REG_EXPAND_SZ    %TEST_PROGRAM_FILES%\\Vivaldi\\vivaldi.exe\r\n", `C:\Program Files\Vivaldi\vivaldi.exe`},
+		{"    (Default)    REG_SZ    \r\n", ""},
+		{"ERROR: The system was unable to find the specified registry key or value.\r\n", ""},
+	}
+	for _, tt := range tests {
+		if got := regDefaultValue(tt.output); got != tt.want {
+			t.Errorf("regDefaultValue(%q) = %q, want %q", tt.output, got, tt.want)
+		}
+	}
+}
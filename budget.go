@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// focusRetryDelay is the pause before focusing again within a retry budget
+const focusRetryDelay = 100 * time.Millisecond
+
+// retryBudget is the retries one logical action, such as a /move, may
+// spend across all of its sub-steps, so retried focusing and retried drags
+// can't multiply into a stall. It also holds the action's deadline: a retry
+// that wouldn't finish by then isn't started.
+type retryBudget struct {
+	mu       sync.Mutex
+	left     int
+	used     int
+	deadline time.Time // zero for none
+}
+
+type retryBudgetKey struct{}
+
+// withRetryBudget returns a copy of ctx whose sub-steps share retries
+// retries before deadline, and the budget to read the retries used from
+func withRetryBudget(ctx context.Context, retries int, deadline time.Time) (context.Context, *retryBudget) {
+	b := &retryBudget{left: retries, deadline: deadline}
+	return context.WithValue(ctx, retryBudgetKey{}, b), b
+}
+
+// budgetFrom returns the retry budget of the action ctx belongs to, or nil
+// when its sub-steps keep their own retry limits
+func budgetFrom(ctx context.Context) *retryBudget {
+	b, _ := ctx.Value(retryBudgetKey{}).(*retryBudget)
+	return b
+}
+
+// spend takes one retry for a sub-step whose last try took took, reporting
+// false when none are left or another try like it would miss the deadline
+func (b *retryBudget) spend(took time.Duration) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.left <= 0 || (!b.deadline.IsZero() && time.Until(b.deadline) < took) {
+		return false
+	}
+	b.left--
+	b.used++
+	return true
+}
+
+// retriesUsed returns how many retries the action's sub-steps took
+func (b *retryBudget) retriesUsed() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.used
+}
+
+// focusFirefoxBudgeted is focusFirefox retrying a failed focus, such as a
+// window that is still mapping, while the action's retry budget lasts.
+// Without a budget a focus failure isn't retried.
+func focusFirefoxBudgeted(ctx context.Context) error {
+	b := budgetFrom(ctx)
+	for {
+		start := time.Now()
+		err := focusFirefox(ctx)
+		if err == nil || b == nil || errorCode(err) != codeFocusFailed || !b.spend(time.Since(start)+focusRetryDelay) {
+			return err
+		}
+		select {
+		case <-time.After(focusRetryDelay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// Board orientations
+const (
+	orientationWhite = "white" // a1 at the bottom left
+	orientationBlack = "black" // h8 at the bottom left
+)
+
+// Calibration locates the board on screen
+type Calibration struct {
+	X           int    `json:"x"`
+	Y           int    `json:"y"`
+	Width       int    `json:"width"`
+	Height      int    `json:"height"`
+	Orientation string `json:"orientation"`
+
+	// insets are the Config's margins, attached by Controller.calibration
+	// and never saved
+	insets boardInsets
+}
+
+// boardInsets are the margins a calibration keeps when aiming at squares
+type boardInsets struct {
+	square     int             // -square-inset, pixels kept clear of each square's edges
+	label      float64         // -label-inset as a fraction of a square
+	labelEdges map[string]bool // -label-edges, the board edges carrying coordinate labels
+}
+
+// boardInsets returns the margins -square-inset, -label-inset and
+// -label-edges set
+func (cfg *Config) boardInsets() boardInsets {
+	return boardInsets{square: cfg.SquareInset, label: float64(cfg.LabelInset) / 100, labelEdges: cfg.LabelEdges}
+}
+
+// calibration returns the board calibration with this controller's insets
+func (c *Controller) calibration() (Calibration, bool) {
+	cal, ok := c.state.calibration()
+	cal.insets = c.cfg.boardInsets()
+	return cal, ok
+}
+
+// CalibrationResponse is the Response for /calibrate
+type CalibrationResponse struct {
+	Response
+	Calibration *Calibration `json:"calibration"`
+	Warning     string       `json:"warning,omitempty"`
+}
+
+// point is a screen position in pixels
+type point struct {
+	X int `json:"x"`
+	Y int `json:"y"`
+}
+
+var squarePattern = regexp.MustCompile(`^[a-h][1-8]$`)
+
+// Board edges, as seen on screen, for -label-edges
+const (
+	edgeLeft   = "left"
+	edgeRight  = "right"
+	edgeTop    = "top"
+	edgeBottom = "bottom"
+)
+
+// parseLabelEdges parses -label-edges, a comma-separated list of board edges
+func parseLabelEdges(s string) (map[string]bool, error) {
+	edges := map[string]bool{}
+	for _, edge := range strings.Split(s, ",") {
+		switch edge = strings.TrimSpace(edge); edge {
+		case "":
+		case edgeLeft, edgeRight, edgeTop, edgeBottom:
+			edges[edge] = true
+		default:
+			return nil, fmt.Errorf("unknown edge %q: use %s, %s, %s or %s", edge, edgeLeft, edgeRight, edgeTop, edgeBottom)
+		}
+	}
+	return edges, nil
+}
+
+// squareBounds returns the exact edges of the square at col, row counting
+// from the top left. Boards whose size isn't a multiple of 8 have fractional
+// squares, so edges are kept in floating point and rounded only at the end.
+func (cal Calibration) squareBounds(col, row int) (left, top, right, bottom float64) {
+	w := float64(cal.Width) / 8
+	h := float64(cal.Height) / 8
+	left = float64(cal.X) + float64(col)*w
+	top = float64(cal.Y) + float64(row)*h
+	return left, top, left + w, top + h
+}
+
+// squareCell returns the column and row, from the top left, of an algebraic square
+func (cal Calibration) squareCell(square string) (int, int, error) {
+	if !squarePattern.MatchString(square) {
+		return 0, 0, fmt.Errorf("invalid square %q", square)
+	}
+	file := int(square[0] - 'a')
+	rank := int(square[1] - '1')
+	if cal.Orientation == orientationBlack {
+		return 7 - file, rank, nil
+	}
+	return file, 7 - rank, nil
+}
+
+// squareCenter returns the screen coordinates clicks on an algebraic square
+// aim at: its center, moved -label-inset of a square away from each labelled
+// board edge it touches, so a click on a1 or h8 misses the rank and file
+// labels some themes draw inside the edge squares. Labels stay on the same
+// screen edges whichever way the board is turned.
+func (cal Calibration) squareCenter(square string) (point, error) {
+	col, row, err := cal.squareCell(square)
+	if err != nil {
+		return point{}, err
+	}
+	left, top, right, bottom := cal.squareBounds(col, row)
+	x, y := (left+right)/2, (top+bottom)/2
+	if label, edges := cal.insets.label, cal.insets.labelEdges; label > 0 {
+		w, h := right-left, bottom-top
+		switch {
+		case col == 0 && edges[edgeLeft]:
+			x += w * label
+		case col == 7 && edges[edgeRight]:
+			x -= w * label
+		}
+		switch {
+		case row == 0 && edges[edgeTop]:
+			y += h * label
+		case row == 7 && edges[edgeBottom]:
+			y -= h * label
+		}
+		// Stay clear of -square-inset, away from the neighboring squares
+		inset := float64(cal.insets.square)
+		x = max(left+inset, min(x, right-inset-1))
+		y = max(top+inset, min(y, bottom-inset-1))
+	}
+	return point{X: int(math.Round(x)), Y: int(math.Round(y))}, nil
+}
+
+// squareRect returns the screen rectangle covered by an algebraic square,
+// less -square-inset on each side. Adjacent squares' rectangles never overlap.
+func (cal Calibration) squareRect(square string) (rect, error) {
+	col, row, err := cal.squareCell(square)
+	if err != nil {
+		return rect{}, err
+	}
+	left, top, right, bottom := cal.squareBounds(col, row)
+	inset := cal.insets.square
+	x0, y0 := int(math.Ceil(left))+inset, int(math.Ceil(top))+inset
+	x1, y1 := int(math.Ceil(right))-inset, int(math.Ceil(bottom))-inset
+	return rect{X: x0, Y: y0, Width: x1 - x0, Height: y1 - y0}, nil
+}
+
+// squareAt returns the square containing p. Points up to half a square
+// outside the board snap to the edge squares; further out is an error, as
+// is a point within -square-inset of the edge between two squares.
+func (cal Calibration) squareAt(p point) (string, error) {
+	w := float64(cal.Width) / 8
+	h := float64(cal.Height) / 8
+	px := float64(p.X) - float64(cal.X)
+	py := float64(p.Y) - float64(cal.Y)
+	if px < -w/2 || px >= 8*w+w/2 || py < -h/2 || py >= 8*h+h/2 {
+		return "", fmt.Errorf("point %d,%d is outside the board", p.X, p.Y)
+	}
+	clamp := func(v int) int {
+		if v < 0 {
+			return 0
+		}
+		if v > 7 {
+			return 7
+		}
+		return v
+	}
+	col := clamp(int(math.Floor(px / w)))
+	row := clamp(int(math.Floor(py / h)))
+
+	if cal.insets.square > 0 {
+		left, top, right, bottom := cal.squareBounds(col, row)
+		inset := float64(cal.insets.square)
+		x, y := float64(p.X), float64(p.Y)
+		if (col > 0 && x < left+inset) || (col < 7 && x >= right-inset) ||
+			(row > 0 && y < top+inset) || (row < 7 && y >= bottom-inset) {
+			return "", fmt.Errorf("point %d,%d is within %dpx of the edge between two squares", p.X, p.Y, cal.insets.square)
+		}
+	}
+
+	file, rank := col, 7-row
+	if cal.Orientation == orientationBlack {
+		file, rank = 7-col, row
+	}
+	return string([]byte{byte('a' + file), byte('1' + rank)}), nil
+}
+
+func (cal Calibration) validate() error {
+	if cal.Width < 8 || cal.Height < 8 {
+		return fmt.Errorf("board must be at least 8x8 pixels")
+	}
+	if 2*cal.insets.square >= min(cal.Width, cal.Height)/8 {
+		return fmt.Errorf("-square-inset %d leaves nothing of the board's %dx%d squares", cal.insets.square, cal.Width/8, cal.Height/8)
+	}
+	if cal.Orientation != orientationWhite && cal.Orientation != orientationBlack {
+		return fmt.Errorf("orientation must be %q or %q", orientationWhite, orientationBlack)
+	}
+	return nil
+}
+
+// handleCalibrate reads (GET) or sets (POST) the board calibration
+func (c *Controller) handleCalibrate(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		cal, ok := c.calibration()
+		if !ok {
+			writeErrorCode(w, http.StatusConflict, codeCalibrationMissing, "Board is not calibrated")
+			return
+		}
+		writeJSON(w, http.StatusOK, CalibrationResponse{
+			Response:    Response{Success: true, Message: "Board is calibrated"},
+			Calibration: &cal,
+		})
+
+	case http.MethodPost:
+		var cal Calibration
+		if err := json.NewDecoder(r.Body).Decode(&cal); err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid JSON payload")
+			return
+		}
+		if cal.Orientation == "" {
+			cal.Orientation = c.defaultOrientation()
+		}
+		cal.insets = c.cfg.boardInsets()
+		if err := cal.validate(); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("Invalid calibration: %v", err))
+			return
+		}
+		c.state.setCalibration(cal)
+		c.saveCalibration()
+		writeJSON(w, http.StatusOK, CalibrationResponse{
+			Response:    Response{Success: true, Message: "Calibration saved"},
+			Calibration: &cal,
+		})
+
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "Only GET and POST methods are allowed")
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+var allEdges = map[string]bool{edgeLeft: true, edgeRight: true, edgeTop: true, edgeBottom: true}
+
+// allSquares returns a1 to h8
+func allSquares() []string {
+	var squares []string
+	for rank := byte('1'); rank <= '8'; rank++ {
+		for file := byte('a'); file <= 'h'; file++ {
+			squares = append(squares, string([]byte{file, rank}))
+		}
+	}
+	return squares
+}
+
+func TestSquareRectTilesOddBoards(t *testing.T) {
+	for _, size := range []struct{ w, h int }{{641, 641}, {643, 643}, {643, 641}, {647, 645}} {
+		for _, orientation := range []string{orientationWhite, orientationBlack} {
+			cal := Calibration{X: 13, Y: 101, Width: size.w, Height: size.h, Orientation: orientation}
+			name := fmt.Sprintf("%dx%d %s", size.w, size.h, orientation)
+			// covered counts how often each board pixel is covered
+			covered := make([]int, cal.Width*cal.Height)
+			for _, square := range allSquares() {
+				r, err := cal.squareRect(square)
+				if err != nil {
+					t.Fatalf("%s: squareRect(%s): %v", name, square, err)
+				}
+				for y := r.Y; y < r.Y+r.Height; y++ {
+					for x := r.X; x < r.X+r.Width; x++ {
+						if x < cal.X || x >= cal.X+cal.Width || y < cal.Y || y >= cal.Y+cal.Height {
+							t.Fatalf("%s: %s covers %d,%d outside the board", name, square, x, y)
+						}
+						covered[(y-cal.Y)*cal.Width+x-cal.X]++
+					}
+				}
+			}
+			for i, n := range covered {
+				if n != 1 {
+					t.Fatalf("%s: pixel %d,%d is covered by %d squares", name, cal.X+i%cal.Width, cal.Y+i/cal.Width, n)
+				}
+			}
+		}
+	}
+}
+
+func TestSquareCenterRoundTrip(t *testing.T) {
+	insets := []boardInsets{
+		{},
+		{square: 3},
+		{square: 3, label: 0.3, labelEdges: allEdges},
+		{label: 0.4, labelEdges: map[string]bool{edgeLeft: true, edgeBottom: true}},
+	}
+	for _, width := range []int{641, 643, 800} {
+		for _, orientation := range []string{orientationWhite, orientationBlack} {
+			for _, in := range insets {
+				cal := Calibration{X: 7, Y: 9, Width: width, Height: width, Orientation: orientation, insets: in}
+				for _, square := range allSquares() {
+					p, err := cal.squareCenter(square)
+					if err != nil {
+						t.Fatalf("squareCenter(%s): %v", square, err)
+					}
+					got, err := cal.squareAt(p)
+					if err != nil || got != square {
+						t.Errorf("%d %s %+v: squareAt(squareCenter(%s) = %v) = %q, %v", width, orientation, in, square, p, got, err)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestSquareCenterLabelInsetCorners(t *testing.T) {
+	in := boardInsets{square: 2, label: 0.25, labelEdges: allEdges}
+	cal := Calibration{X: 100, Y: 200, Width: 640, Height: 640, insets: in}
+	// Squares are 80px; the label inset moves corner clicks 20px in from each labelled edge
+	tests := []struct {
+		orientation, square string
+		want                point
+	}{
+		{orientationWhite, "a1", point{X: 160, Y: 780}}, // bottom left: right and up
+		{orientationWhite, "h8", point{X: 680, Y: 260}}, // top right: left and down
+		{orientationWhite, "a8", point{X: 160, Y: 260}},
+		{orientationWhite, "h1", point{X: 680, Y: 780}},
+		{orientationWhite, "d4", point{X: 380, Y: 560}}, // inner squares keep their centers
+		{orientationBlack, "a1", point{X: 680, Y: 260}}, // top right
+		{orientationBlack, "h8", point{X: 160, Y: 780}}, // bottom left
+		{orientationBlack, "e5", point{X: 380, Y: 560}},
+	}
+	for _, tt := range tests {
+		cal.Orientation = tt.orientation
+		got, err := cal.squareCenter(tt.square)
+		if err != nil {
+			t.Fatalf("squareCenter(%s): %v", tt.square, err)
+		}
+		if got != tt.want {
+			t.Errorf("%s squareCenter(%s) = %v, want %v", tt.orientation, tt.square, got, tt.want)
+		}
+	}
+
+	// Only labelled edges move the click
+	cal.Orientation = orientationWhite
+	cal.insets.labelEdges = map[string]bool{edgeBottom: true}
+	if got, _ := cal.squareCenter("a1"); got != (point{X: 140, Y: 780}) {
+		t.Errorf("a1 with only the bottom edge labelled = %v, want 140,780", got)
+	}
+
+	// A large label inset stays clear of -square-inset
+	cal.insets = boardInsets{square: 30, label: 0.4, labelEdges: allEdges}
+	if got, _ := cal.squareCenter("a1"); got != (point{X: 149, Y: 790}) {
+		t.Errorf("a1 with a 30px square inset = %v, want 149,790", got)
+	}
+}
+
+func TestSquareAtCornersAndOuterEdge(t *testing.T) {
+	cal := Calibration{X: 100, Y: 200, Width: 641, Height: 641, insets: boardInsets{square: 3}}
+	right, bottom := cal.X+cal.Width-1, cal.Y+cal.Height-1
+	tests := []struct {
+		p            point
+		white, black string // "" for an error
+	}{
+		// The board's outer pixels belong to the corner squares, -square-inset notwithstanding
+		{point{X: cal.X, Y: bottom}, "a1", "h8"},
+		{point{X: right, Y: cal.Y}, "h8", "a1"},
+		{point{X: cal.X, Y: cal.Y}, "a8", "h1"},
+		{point{X: right, Y: bottom}, "h1", "a8"},
+		// Up to half a square outside snaps to the edge squares
+		{point{X: cal.X - 30, Y: bottom + 30}, "a1", "h8"},
+		{point{X: right + 30, Y: cal.Y - 30}, "h8", "a1"},
+		// Further out is off the board
+		{point{X: cal.X - 50, Y: bottom}, "", ""},
+		{point{X: right, Y: cal.Y - 50}, "", ""},
+		// Within -square-inset of the edge between a1 and b1
+		{point{X: cal.X + 80, Y: bottom}, "", ""},
+	}
+	for _, tt := range tests {
+		for _, c := range []struct{ orientation, want string }{{orientationWhite, tt.white}, {orientationBlack, tt.black}} {
+			cal.Orientation = c.orientation
+			got, err := cal.squareAt(tt.p)
+			if c.want == "" {
+				if err == nil {
+					t.Errorf("%s squareAt(%v) = %q, want an error", c.orientation, tt.p, got)
+				}
+				continue
+			}
+			if err != nil || got != c.want {
+				t.Errorf("%s squareAt(%v) = %q, %v, want %q", c.orientation, tt.p, got, err, c.want)
+			}
+		}
+	}
+}
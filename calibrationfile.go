@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// With -calibration-file the calibration survives restarts. The file only
+// seeds the calibration at startup: from then on the in-memory calibration
+// is authoritative, and every change to it (/calibrate, /auto-calibrate,
+// /orientation, /clear-calibration) is written back, so the file never
+// overrides a calibration made while the server runs.
+
+// loadCalibrationFile reads a saved calibration, checked against insets; a
+// missing file is no calibration
+func loadCalibrationFile(path string, insets boardInsets) (*Calibration, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	cal := Calibration{insets: insets}
+	if err := json.Unmarshal(data, &cal); err != nil {
+		return nil, err
+	}
+	if err := cal.validate(); err != nil {
+		return nil, err
+	}
+	return &cal, nil
+}
+
+// loadSavedCalibration applies -calibration-file at startup
+func (c *Controller) loadSavedCalibration() {
+	if c.cfg.CalibrationFile == "" {
+		return
+	}
+	cal, err := loadCalibrationFile(c.cfg.CalibrationFile, c.cfg.boardInsets())
+	if err != nil {
+		log.Printf("warning: ignoring calibration file %s: %v", c.cfg.CalibrationFile, err)
+		return
+	}
+	if cal != nil {
+		c.state.setCalibration(*cal)
+		log.Printf("loaded calibration from %s", c.cfg.CalibrationFile)
+	}
+}
+
+// calibrationFileMu keeps concurrent saves from writing an older calibration last
+var calibrationFileMu sync.Mutex
+
+// saveCalibration writes the current calibration to -calibration-file, or
+// removes the file when the board isn't calibrated. The file is replaced
+// with a rename, so a crash can't leave half a calibration behind.
+func (c *Controller) saveCalibration() {
+	path := c.cfg.CalibrationFile
+	if path == "" {
+		return
+	}
+	calibrationFileMu.Lock()
+	defer calibrationFileMu.Unlock()
+	cal, ok := c.calibration()
+	if !ok {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			log.Printf("warning: failed to remove calibration file: %v", err)
+		}
+		return
+	}
+	data, _ := json.MarshalIndent(cal, "", "  ")
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".calibration-*")
+	if err == nil {
+		_, err = tmp.Write(append(data, '\n'))
+		if closeErr := tmp.Close(); err == nil {
+			err = closeErr
+		}
+		if err == nil {
+			err = os.Rename(tmp.Name(), path)
+		}
+		if err != nil {
+			os.Remove(tmp.Name())
+		}
+	}
+	if err != nil {
+		log.Printf("warning: failed to save calibration to %s: %v", path, err)
+	}
+}
+
+// handleClearCalibration forgets the calibration, and deletes
+// -calibration-file so it doesn't come back at the next start
+func (c *Controller) handleClearCalibration(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "Only POST method is allowed")
+		return
+	}
+
+	_, wasCalibrated := c.calibration()
+	c.state.clearCalibration()
+	c.saveCalibration()
+
+	message := "Calibration cleared"
+	if !wasCalibrated {
+		message = "Board was not calibrated"
+	}
+	if c.cfg.CalibrationFile != "" {
+		message += fmt.Sprintf("; removed %s", c.cfg.CalibrationFile)
+	}
+	writeJSON(w, http.StatusOK, Response{Success: true, Message: message})
+}
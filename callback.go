@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const (
+	callbackTimeout = 10 * time.Second // per delivery attempt
+	callbackBackoff = time.Second      // before the first retry, doubling after each
+)
+
+// AcceptedResponse is the Response for a request run asynchronously
+type AcceptedResponse struct {
+	Response
+	JobID string `json:"job_id"`
+}
+
+// CallbackPayload is POSTed to a request's callback_url when its job finishes
+type CallbackPayload struct {
+	JobID    string          `json:"job_id"`
+	Path     string          `json:"path"`
+	Status   int             `json:"status"`
+	Response json.RawMessage `json:"response"`
+}
+
+// newJobID returns a random identifier for an asynchronous job
+func newJobID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// async wraps a mutating handler so a POST whose JSON body has a
+// callback_url is accepted with 202 and a job id, run in the background,
+// and its response POSTed to the callback URL
+func (c *Controller) async(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Context().Value(lockHeldKey{}) != nil {
+			h(w, r)
+			return
+		}
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "Failed to read request body")
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		var fields struct {
+			CallbackURL string `json:"callback_url"`
+		}
+		if json.Unmarshal(body, &fields) != nil || fields.CallbackURL == "" {
+			h(w, r)
+			return
+		}
+		u, err := url.Parse(fields.CallbackURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			writeError(w, http.StatusBadRequest, "callback_url must be an absolute http or https URL")
+			return
+		}
+
+		job := newJobID()
+		// The job outlives the request, so keep only its values; shutdown
+		// cancels it if it runs past -shutdown-timeout
+		ctx, cancel := context.WithCancel(context.WithoutCancel(r.Context()))
+		bg := r.Clone(ctx)
+		bg.Body = io.NopCloser(bytes.NewReader(body))
+		c.jobs.start(job, cancel)
+		go func() {
+			defer c.jobs.done(job)
+			defer cancel()
+			rec := &bufferedResponse{header: http.Header{}, status: http.StatusOK}
+			c.withRecovery(h).ServeHTTP(rec, bg)
+			c.deliverCallback(ctx, fields.CallbackURL, CallbackPayload{
+				JobID:    job,
+				Path:     r.URL.Path,
+				Status:   rec.status,
+				Response: json.RawMessage(bytes.TrimSpace(rec.body.Bytes())),
+			})
+		}()
+
+		writeJSON(w, http.StatusAccepted, AcceptedResponse{
+			Response: Response{Success: true, Message: fmt.Sprintf("Accepted job %s; the result will be sent to the callback URL", job)},
+			JobID:    job,
+		})
+	}
+}
+
+// signPayload returns the hex HMAC-SHA256 of body keyed with the API key
+func (c *Controller) signPayload(body []byte) string {
+	mac := hmac.New(sha256.New, []byte(c.cfg.APIKey))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// deliverCallback POSTs payload to target, retrying with exponential backoff
+// up to -callback-retries times, until ctx is cancelled. With -api-key set, the body is signed in
+// the X-Signature header as "sha256=<hex HMAC>".
+func (c *Controller) deliverCallback(ctx context.Context, target string, payload CallbackPayload) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		log.Printf("callback for job %s: %v", payload.JobID, err)
+		return
+	}
+	client := &http.Client{Timeout: callbackTimeout}
+	backoff := callbackBackoff
+	for attempt := 0; ; attempt++ {
+		err := c.postCallback(ctx, client, target, payload.JobID, body)
+		if err == nil {
+			return
+		}
+		if attempt >= c.cfg.CallbackRetries {
+			log.Printf("callback for job %s to %s failed after %d attempts: %s", payload.JobID, redact(target), attempt+1, redact(err.Error()))
+			return
+		}
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			// Shutdown cancelled the job; don't hold it up with retries
+			log.Printf("callback for job %s to %s abandoned after %d attempts: %s", payload.JobID, redact(target), attempt+1, redact(err.Error()))
+			return
+		}
+		backoff *= 2
+	}
+}
+
+func (c *Controller) postCallback(ctx context.Context, client *http.Client, target, job string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Job-ID", job)
+	if c.cfg.APIKey != "" {
+		req.Header.Set("X-Signature", "sha256="+c.signPayload(body))
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("receiver returned status %d", resp.StatusCode)
+	}
+	return nil
+}
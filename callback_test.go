@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDeliverCallbackStopsRetryingWhenCancelled(t *testing.T) {
+	var attempts atomic.Int64
+	ctx, cancel := context.WithCancel(context.Background())
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		cancel()
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer receiver.Close()
+
+	c := newController(&Config{CallbackRetries: 5})
+	start := time.Now()
+	c.deliverCallback(ctx, receiver.URL, CallbackPayload{JobID: "job"})
+	if elapsed := time.Since(start); elapsed > callbackBackoff/2 {
+		t.Errorf("deliverCallback took %v after its job was cancelled", elapsed)
+	}
+	if n := attempts.Load(); n != 1 {
+		t.Errorf("deliverCallback made %d attempts, want 1", n)
+	}
+}
+
+func TestDeliverCallbackRetries(t *testing.T) {
+	var attempts atomic.Int64
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if attempts.Add(1) < 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer receiver.Close()
+
+	c := newController(&Config{CallbackRetries: 3})
+	c.deliverCallback(context.Background(), receiver.URL, CallbackPayload{JobID: "job"})
+	if n := attempts.Load(); n != 2 {
+		t.Errorf("deliverCallback made %d attempts, want 2", n)
+	}
+}
+
+func TestDeliverCallbackRedactsLog(t *testing.T) {
+	configureCommandLog(&Config{RedactParams: []string{"token"}})
+	defer configureCommandLog(&Config{})
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stderr)
+
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer receiver.Close()
+
+	c := newController(&Config{})
+	c.deliverCallback(context.Background(), receiver.URL+"/hook?token=s3cret", CallbackPayload{JobID: "job"})
+	if out := logged.String(); strings.Contains(out, "s3cret") || !strings.Contains(out, "token=REDACTED") {
+		t.Errorf("callback failure log = %q, want the token redacted", out)
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"net/http"
+	"runtime"
+)
+
+// CapabilitiesResponse is the Response for /capabilities
+type CapabilitiesResponse struct {
+	Response
+	Backend      string          `json:"backend"`
+	OS           string          `json:"os"`
+	Capabilities map[string]bool `json:"capabilities"`
+}
+
+// haveTool reports whether an executable is on PATH
+func haveTool(name string) bool {
+	_, err := lookPath(name)
+	return err == nil
+}
+
+// nativeInputAvailable reports whether keyboard and mouse input can be synthesized
+func (c *Controller) nativeInputAvailable() bool {
+	switch runtime.GOOS {
+	case "linux":
+		return haveTool(c.dev.input.name())
+	case "darwin":
+		return haveTool("osascript") && haveTool("cliclick")
+	case "windows":
+		return haveTool("powershell")
+	}
+	return false
+}
+
+// screenCaptureAvailable reports whether captureScreen can work on this OS
+func (c *Controller) screenCaptureAvailable() bool {
+	switch runtime.GOOS {
+	case "linux":
+		return haveTool(c.dev.screenshot.name)
+	case "darwin":
+		return haveTool("screencapture")
+	case "windows":
+		return haveTool("powershell")
+	}
+	return false
+}
+
+// capabilities maps each feature to whether the backend and environment support it
+func (c *Controller) capabilities() map[string]bool {
+	scripting := c.marionette != nil
+	input := c.nativeInputAvailable()
+	screenshot := c.screenCaptureAvailable()
+	windowTool := runtime.GOOS != "linux" || haveTool("xdotool")
+	return map[string]bool{
+		"navigate":                input,
+		"background_tab":          scripting,
+		"launch":                  haveTool(c.firefoxBin()) || runtime.GOOS == "darwin",
+		"restart":                 true,
+		"delay":                   true,
+		"cookies":                 scripting,
+		"fill":                    scripting,
+		"move_list":               scripting,
+		"clock":                   scripting,
+		"turn":                    scripting,
+		"result":                  scripting || (screenshot && !c.cfg.DialogRegion.empty() && c.cfg.DialogColor != ""),
+		"zoom":                    scripting,
+		"reset_zoom":              input,
+		"pgn":                     scripting,
+		"last_move":               scripting || screenshot,
+		"board_state":             screenshot,
+		"square_info":             scripting,
+		"get_text":                scripting,
+		"recent_screenshots":      screenshot && c.cfg.RecentScreenshots > 0,
+		"metrics":                 true,
+		"config":                  true,
+		"pause":                   true,
+		"console_logs":            scripting,
+		"eval":                    false,
+		"element_screenshot":      scripting,
+		"auto_calibrate":          scripting,
+		"setup":                   scripting,
+		"tabs":                    input || scripting,
+		"tabs_by_id":              scripting,
+		"window_bounds":           windowTool,
+		"focus_restore":           windowTool,
+		"window_input":            c.dev.windowInput,
+		"list_windows":            windowTool,
+		"clipboard":               c.clipboardCapability(),
+		"reset_session":           input,
+		"monitors":                runtime.GOOS != "linux" || haveTool("xrandr"),
+		"display_info":            runtime.GOOS != "linux" || haveTool("xrandr"),
+		"check_challenge":         scripting || windowTool,
+		"recover_crashed_tab":     c.cfg.RecoverCrashedTab && !targetBrowser.chromium,
+		"check_screen_lock":       c.cfg.CheckScreenLock,
+		"profiles":                !targetBrowser.chromium,
+		"site_profiles":           true,
+		"move":                    input,
+		"human_move":              input,
+		"abort_move":              input,
+		"play_moves":              input,
+		"drag":                    input,
+		"move_by_pixels":          input,
+		"hover":                   input,
+		"key":                     input,
+		"set_addressbar":          input,
+		"get_addressbar":          scripting,
+		"click":                   input,
+		"dismiss_dialog":          scripting || (input && screenshot && !c.cfg.DialogRegion.empty() && c.cfg.DialogColor != ""),
+		"offer_response":          scripting || (input && screenshot && len(c.cfg.Offers) > 0),
+		"new_game":                len(c.cfg.NewGame) > 0,
+		"set_time_control":        input && (scripting || len(c.cfg.TimeControls) > 0),
+		"after_navigate":          len(c.cfg.AfterNavigate) > 0,
+		"screenshot":              screenshot,
+		"save_screenshot":         screenshot,
+		"move_verify":             input && screenshot,
+		"move_keyboard":           input && (scripting || c.cfg.MoveInputClick != (point{})),
+		"move_verify_destination": input && screenshot,
+		"move_log":                screenshot && c.cfg.MoveLogDir != "",
+		"match_window":            c.cfg.MatchWindow && runtime.GOOS != "darwin",
+		"orientation_check":       scripting && c.cfg.OrientationCheck != orientationCheckOff,
+		"board_events":            screenshot,
+		"board_stable":            screenshot,
+		"debug":                   c.authRequired() || c.cfg.AllowDebug,
+		"tracing":                 tracer != nil,
+		"ocr":                     screenshot && haveTool(c.cfg.TesseractBin),
+	}
+}
+
+// handleCapabilities reports which features work with the current backend and environment
+func (c *Controller) handleCapabilities(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "Only GET method is allowed")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, CapabilitiesResponse{
+		Response:     Response{Success: true, Message: "Capabilities of the " + c.cfg.Backend + " backend"},
+		Backend:      c.cfg.Backend,
+		OS:           runtime.GOOS,
+		Capabilities: c.capabilities(),
+	})
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// challengeTitles are page titles of Cloudflare, DDoS-Guard and similar bot
+// checks, matched case-insensitively as prefixes of the window title
+var challengeTitles = []string{
+	"Just a moment...",
+	"Attention Required! | Cloudflare",
+	"Please Wait... | Cloudflare",
+	"Verify you are human",
+	"Checking your browser",
+	"DDoS-Guard",
+	"Security check",
+}
+
+// challengeURLs are URL fragments of challenge pages
+var challengeURLs = []string{
+	"/cdn-cgi/challenge-platform",
+	"challenges.cloudflare.com",
+	"__cf_chl_",
+	"/captcha",
+}
+
+// challengeSelectors match challenge widgets embedded in a page, which the
+// title and URL don't reveal
+const challengeSelectors = `#challenge-form, #challenge-running, #cf-challenge-running, .cf-turnstile, ` +
+	`iframe[src*="challenges.cloudflare.com"], iframe[src*="hcaptcha.com"], ` +
+	`iframe[src*="google.com/recaptcha"], iframe[src*="recaptcha.net"], #px-captcha`
+
+// challengeScript returns the title, URL and first challenge element on the page
+const challengeScript = `
+const el = document.querySelector(arguments[0]);
+let element = '';
+if (el) {
+	element = el.tagName.toLowerCase() + (el.id ? '#' + el.id : '') + (el.src ? ' ' + el.src.split('?')[0] : '');
+}
+return {title: document.title, url: location.href, element: element};`
+
+// challengeError is returned when a bot challenge blocks the page
+type challengeError struct {
+	indicator string
+}
+
+func (e *challengeError) Error() string {
+	return "page shows a bot challenge (" + e.indicator + ")"
+}
+
+// ChallengeResponse is the Response for /check-challenge
+type ChallengeResponse struct {
+	Response
+	Challenge bool   `json:"challenge"`
+	Indicator string `json:"indicator,omitempty"` // what gave the challenge away
+}
+
+// challengeTitle returns the challenge title that title starts with
+func challengeTitle(title string) (string, bool) {
+	lower := strings.ToLower(title)
+	for _, t := range challengeTitles {
+		if strings.HasPrefix(lower, strings.ToLower(t)) {
+			return t, true
+		}
+	}
+	return "", false
+}
+
+// detectChallenge returns what shows the current page is a bot challenge,
+// or "" when none is found. The marionette backend checks the title, URL and
+// known challenge widgets; the native backend only has the window title.
+func (c *Controller) detectChallenge(ctx context.Context) (string, error) {
+	if c.marionette == nil {
+		title, err := firefoxWindowTitle(ctx)
+		if err != nil {
+			return "", err
+		}
+		if t, ok := challengeTitle(title); ok {
+			return fmt.Sprintf("title %q", t), nil
+		}
+		return "", nil
+	}
+
+	var page struct {
+		Title   string `json:"title"`
+		URL     string `json:"url"`
+		Element string `json:"element"`
+	}
+	if err := c.marionette.ExecuteScript(ctx, challengeScript, []interface{}{challengeSelectors}, &page); err != nil {
+		return "", fmt.Errorf("failed to inspect the page: %v", err)
+	}
+	if t, ok := challengeTitle(page.Title); ok {
+		return fmt.Sprintf("title %q", t), nil
+	}
+	for _, u := range challengeURLs {
+		if strings.Contains(page.URL, u) {
+			return fmt.Sprintf("URL contains %s", u), nil
+		}
+	}
+	if page.Element != "" {
+		return "element " + page.Element, nil
+	}
+	return "", nil
+}
+
+// checkChallenge returns a *challengeError if a bot challenge blocks the
+// page. A page that can't be inspected is logged rather than blocking the
+// action that asked.
+func (c *Controller) checkChallenge(ctx context.Context) error {
+	indicator, err := c.detectChallenge(ctx)
+	if err != nil {
+		log.Printf("check-challenge: %v", err)
+		return nil
+	}
+	if indicator != "" {
+		return &challengeError{indicator: indicator}
+	}
+	return nil
+}
+
+// challengeCheckSkipped are the routes -check-challenge doesn't check before
+// acting, since they can take the browser away from a challenge page
+var challengeCheckSkipped = map[string]bool{
+	"/open":            true,
+	"/launch":          true,
+	"/restart-browser": true,
+	"/switch-tab":      true,
+}
+
+// handleCheckChallenge reports whether a CAPTCHA or bot-challenge page is
+// blocking the current tab
+func (c *Controller) handleCheckChallenge(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "Only GET method is allowed")
+		return
+	}
+
+	var indicator string
+	err := c.command(r, func() error {
+		var err error
+		indicator, err = c.detectChallenge(r.Context())
+		return err
+	})
+	if err != nil {
+		writeCommandError(w, err, fmt.Sprintf("Failed to check for a challenge: %v", err))
+		return
+	}
+
+	message := "No challenge detected"
+	if indicator != "" {
+		message = "A bot challenge is blocking the page: " + indicator
+	}
+	writeJSON(w, http.StatusOK, ChallengeResponse{
+		Response:  Response{Success: true, Message: message},
+		Challenge: indicator != "",
+		Indicator: indicator,
+	})
+}
@@ -0,0 +1,484 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// startFEN is the standard starting position
+const startFEN = "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1"
+
+// position is a chess position, enough of one to generate legal moves.
+// Squares are numbered a1=0 to h8=63; pieces use FEN letters, uppercase for
+// White, with 0 for an empty square.
+type position struct {
+	board    [64]byte
+	white    bool    // White to move
+	castling [4]bool // White king side, White queen side, Black king side, Black queen side
+	ep       int     // en passant target square, or -1
+}
+
+// chessMove is a move from one square to another, with the promotion piece
+// in lowercase when a pawn promotes
+type chessMove struct {
+	from, to  int
+	promotion byte
+}
+
+func squareName(sq int) string {
+	return string([]byte{byte('a' + sq%8), byte('1' + sq/8)})
+}
+
+func parseSquare(s string) (int, bool) {
+	if !squarePattern.MatchString(s) {
+		return 0, false
+	}
+	return int(s[0]-'a') + 8*int(s[1]-'1'), true
+}
+
+// uci returns the move in UCI notation, such as "e2e4" or "e7e8q"
+func (m chessMove) uci() string {
+	s := squareName(m.from) + squareName(m.to)
+	if m.promotion != 0 {
+		s += string(m.promotion)
+	}
+	return s
+}
+
+// parseFEN reads the board, side to move, castling rights and en passant
+// square of a FEN; the move counters are ignored
+func parseFEN(fen string) (*position, error) {
+	fields := strings.Fields(fen)
+	if len(fields) < 4 {
+		return nil, fmt.Errorf("FEN needs at least 4 fields, got %d", len(fields))
+	}
+	pos := &position{ep: -1}
+	ranks := strings.Split(fields[0], "/")
+	if len(ranks) != 8 {
+		return nil, fmt.Errorf("FEN board needs 8 ranks, got %d", len(ranks))
+	}
+	for i, rank := range ranks {
+		file := 0
+		for _, c := range []byte(rank) {
+			switch {
+			case c >= '1' && c <= '8':
+				file += int(c - '0')
+			case strings.IndexByte("PNBRQKpnbrqk", c) >= 0:
+				if file > 7 {
+					return nil, fmt.Errorf("FEN rank %q is too long", rank)
+				}
+				pos.board[(7-i)*8+file] = c
+				file++
+			default:
+				return nil, fmt.Errorf("invalid FEN piece %q", c)
+			}
+		}
+		if file != 8 {
+			return nil, fmt.Errorf("FEN rank %q does not have 8 squares", rank)
+		}
+	}
+	switch fields[1] {
+	case "w":
+		pos.white = true
+	case "b":
+	default:
+		return nil, fmt.Errorf("invalid FEN side to move %q", fields[1])
+	}
+	for _, c := range fields[2] {
+		switch c {
+		case 'K':
+			pos.castling[0] = true
+		case 'Q':
+			pos.castling[1] = true
+		case 'k':
+			pos.castling[2] = true
+		case 'q':
+			pos.castling[3] = true
+		case '-':
+		default:
+			return nil, fmt.Errorf("invalid FEN castling rights %q", fields[2])
+		}
+	}
+	if fields[3] != "-" {
+		sq, ok := parseSquare(fields[3])
+		if !ok {
+			return nil, fmt.Errorf("invalid FEN en passant square %q", fields[3])
+		}
+		pos.ep = sq
+	}
+	return pos, nil
+}
+
+// fen returns the board, side to move, castling rights and en passant
+// square of pos as the first four fields of a FEN
+func (pos *position) fen() string {
+	var b strings.Builder
+	for rank := 7; rank >= 0; rank-- {
+		empty := 0
+		for file := 0; file < 8; file++ {
+			p := pos.board[rank*8+file]
+			if p == 0 {
+				empty++
+				continue
+			}
+			if empty > 0 {
+				b.WriteByte(byte('0' + empty))
+				empty = 0
+			}
+			b.WriteByte(p)
+		}
+		if empty > 0 {
+			b.WriteByte(byte('0' + empty))
+		}
+		if rank > 0 {
+			b.WriteByte('/')
+		}
+	}
+	if pos.white {
+		b.WriteString(" w ")
+	} else {
+		b.WriteString(" b ")
+	}
+	castling := ""
+	for i, right := range pos.castling {
+		if right {
+			castling += string("KQkq"[i])
+		}
+	}
+	if castling == "" {
+		castling = "-"
+	}
+	b.WriteString(castling)
+	if pos.ep >= 0 {
+		b.WriteString(" " + squareName(pos.ep))
+	} else {
+		b.WriteString(" -")
+	}
+	return b.String()
+}
+
+func isWhite(p byte) bool { return p >= 'A' && p <= 'Z' }
+
+func lower(p byte) byte {
+	if isWhite(p) {
+		return p + 'a' - 'A'
+	}
+	return p
+}
+
+// own reports whether square sq holds a piece of the side to move
+func (pos *position) own(sq int) bool {
+	return pos.board[sq] != 0 && isWhite(pos.board[sq]) == pos.white
+}
+
+// squareOffset returns the square dx files and dy ranks from sq, or -1 off the board
+func squareOffset(sq, dx, dy int) int {
+	f, r := sq%8+dx, sq/8+dy
+	if f < 0 || f > 7 || r < 0 || r > 7 {
+		return -1
+	}
+	return r*8 + f
+}
+
+var (
+	knightSteps = [][2]int{{1, 2}, {2, 1}, {2, -1}, {1, -2}, {-1, -2}, {-2, -1}, {-2, 1}, {-1, 2}}
+	kingSteps   = [][2]int{{1, 0}, {1, 1}, {0, 1}, {-1, 1}, {-1, 0}, {-1, -1}, {0, -1}, {1, -1}}
+	rookDirs    = [][2]int{{1, 0}, {0, 1}, {-1, 0}, {0, -1}}
+	bishopDirs  = [][2]int{{1, 1}, {-1, 1}, {-1, -1}, {1, -1}}
+)
+
+// attacked reports whether a piece of the given color attacks sq
+func (pos *position) attacked(sq int, byWhite bool) bool {
+	is := func(s int, piece byte) bool {
+		p := pos.board[s]
+		return p != 0 && isWhite(p) == byWhite && lower(p) == piece
+	}
+	pawnDy := -1
+	if !byWhite {
+		pawnDy = 1
+	}
+	for _, dx := range []int{-1, 1} {
+		if s := squareOffset(sq, dx, pawnDy); s >= 0 && is(s, 'p') {
+			return true
+		}
+	}
+	for _, d := range knightSteps {
+		if s := squareOffset(sq, d[0], d[1]); s >= 0 && is(s, 'n') {
+			return true
+		}
+	}
+	for _, d := range kingSteps {
+		if s := squareOffset(sq, d[0], d[1]); s >= 0 && is(s, 'k') {
+			return true
+		}
+	}
+	slide := func(dirs [][2]int, a, b byte) bool {
+		for _, d := range dirs {
+			for s := squareOffset(sq, d[0], d[1]); s >= 0; s = squareOffset(s, d[0], d[1]) {
+				if pos.board[s] != 0 {
+					if is(s, a) || is(s, b) {
+						return true
+					}
+					break
+				}
+			}
+		}
+		return false
+	}
+	return slide(rookDirs, 'r', 'q') || slide(bishopDirs, 'b', 'q')
+}
+
+// pseudoMoves returns the moves of the side to move, ignoring whether they
+// leave its own king in check
+func (pos *position) pseudoMoves() []chessMove {
+	var moves []chessMove
+	add := func(from, to int) {
+		if to >= 0 && !pos.own(to) {
+			moves = append(moves, chessMove{from: from, to: to})
+		}
+	}
+	for sq := 0; sq < 64; sq++ {
+		if !pos.own(sq) {
+			continue
+		}
+		switch lower(pos.board[sq]) {
+		case 'p':
+			dy, startRank, lastRank := 1, 1, 7
+			if !pos.white {
+				dy, startRank, lastRank = -1, 6, 0
+			}
+			var targets []int
+			if one := squareOffset(sq, 0, dy); one >= 0 && pos.board[one] == 0 {
+				targets = append(targets, one)
+				if two := squareOffset(sq, 0, 2*dy); sq/8 == startRank && pos.board[two] == 0 {
+					targets = append(targets, two)
+				}
+			}
+			for _, dx := range []int{-1, 1} {
+				s := squareOffset(sq, dx, dy)
+				if s >= 0 && ((pos.board[s] != 0 && !pos.own(s)) || s == pos.ep) {
+					targets = append(targets, s)
+				}
+			}
+			for _, to := range targets {
+				if to/8 == lastRank {
+					for _, p := range []byte("qrbn") {
+						moves = append(moves, chessMove{from: sq, to: to, promotion: p})
+					}
+				} else {
+					moves = append(moves, chessMove{from: sq, to: to})
+				}
+			}
+		case 'n':
+			for _, d := range knightSteps {
+				add(sq, squareOffset(sq, d[0], d[1]))
+			}
+		case 'k':
+			for _, d := range kingSteps {
+				add(sq, squareOffset(sq, d[0], d[1]))
+			}
+			moves = append(moves, pos.castlingMoves(sq)...)
+		default:
+			var dirs [][2]int
+			switch lower(pos.board[sq]) {
+			case 'r':
+				dirs = rookDirs
+			case 'b':
+				dirs = bishopDirs
+			default:
+				dirs = append(append(dirs, rookDirs...), bishopDirs...)
+			}
+			for _, d := range dirs {
+				for s := squareOffset(sq, d[0], d[1]); s >= 0; s = squareOffset(s, d[0], d[1]) {
+					add(sq, s)
+					if pos.board[s] != 0 {
+						break
+					}
+				}
+			}
+		}
+	}
+	return moves
+}
+
+// castlingMoves returns the king moves two squares sideways allowed by the
+// castling rights, with the squares between empty and not passing through check
+func (pos *position) castlingMoves(king int) []chessMove {
+	home, rights := 4, pos.castling[0:2]
+	if !pos.white {
+		home, rights = 60, pos.castling[2:4]
+	}
+	if king != home || pos.attacked(king, !pos.white) {
+		return nil
+	}
+	var moves []chessMove
+	if rights[0] && pos.board[home+1] == 0 && pos.board[home+2] == 0 &&
+		!pos.attacked(home+1, !pos.white) {
+		moves = append(moves, chessMove{from: home, to: home + 2})
+	}
+	if rights[1] && pos.board[home-1] == 0 && pos.board[home-2] == 0 && pos.board[home-3] == 0 &&
+		!pos.attacked(home-1, !pos.white) {
+		moves = append(moves, chessMove{from: home, to: home - 2})
+	}
+	return moves
+}
+
+// play returns the position after m, which must be pseudo-legal
+func (pos *position) play(m chessMove) *position {
+	next := *pos
+	piece := pos.board[m.from]
+	next.board[m.from] = 0
+	next.board[m.to] = piece
+	next.ep = -1
+	switch lower(piece) {
+	case 'p':
+		if m.to == pos.ep {
+			// The captured pawn is beside the moving one, not on the target square
+			next.board[m.from/8*8+m.to%8] = 0
+		}
+		if d := m.to - m.from; d == 16 || d == -16 {
+			next.ep = (m.from + m.to) / 2
+		}
+		if m.promotion != 0 {
+			next.board[m.to] = m.promotion
+			if pos.white {
+				next.board[m.to] = m.promotion - 'a' + 'A'
+			}
+		}
+	case 'k':
+		if m.to-m.from == 2 {
+			next.board[m.from+1], next.board[m.from+3] = next.board[m.from+3], 0
+		} else if m.from-m.to == 2 {
+			next.board[m.from-1], next.board[m.from-4] = next.board[m.from-4], 0
+		}
+	}
+	// Moving the king or a rook, or capturing a rook, loses those rights
+	for i, sq := range []int{7, 0, 63, 56} {
+		if m.from == sq || m.to == sq {
+			next.castling[i] = false
+		}
+	}
+	for i, sq := range []int{4, 4, 60, 60} {
+		if m.from == sq {
+			next.castling[i] = false
+		}
+	}
+	next.white = !pos.white
+	return &next
+}
+
+// legalMoves returns the moves that don't leave the mover's king in check
+func (pos *position) legalMoves() []chessMove {
+	var legal []chessMove
+	for _, m := range pos.pseudoMoves() {
+		next := pos.play(m)
+		for sq, p := range next.board {
+			if p != 0 && lower(p) == 'k' && isWhite(p) == pos.white {
+				if !next.attacked(sq, next.white) {
+					legal = append(legal, m)
+				}
+				break
+			}
+		}
+	}
+	return legal
+}
+
+// resolveSAN finds the legal move written in Standard Algebraic Notation,
+// such as "Nf3", "exd5", "O-O" or "e8=Q+"
+func (pos *position) resolveSAN(san string) (chessMove, error) {
+	s := strings.TrimRight(strings.TrimSpace(san), "+#!?")
+	s = strings.ReplaceAll(s, "0", "O")
+	home := 4
+	if !pos.white {
+		home = 60
+	}
+	var castle *chessMove
+	switch s {
+	case "O-O":
+		castle = &chessMove{from: home, to: home + 2}
+	case "O-O-O":
+		castle = &chessMove{from: home, to: home - 2}
+	}
+
+	piece := byte('p')
+	var promotion byte
+	fromFile, fromRank := -1, -1
+	to := -1
+	if castle == nil {
+		if len(s) > 0 && strings.IndexByte("KQRBN", s[0]) >= 0 {
+			piece, s = lower(s[0]), s[1:]
+		}
+		// A promotion piece is uppercase ("e8Q", "e8=Q"), but lowercase after
+		// "=" is accepted too; a bare lowercase b would be the b-file
+		if n := len(s); piece == 'p' && n > 0 && strings.IndexByte("QRBN", s[n-1]) >= 0 {
+			promotion, s = lower(s[n-1]), strings.TrimSuffix(s[:n-1], "=")
+		} else if piece == 'p' && n > 1 && s[n-2] == '=' {
+			promotion, s = s[n-1], s[:n-2]
+		}
+		s = strings.ReplaceAll(s, "x", "")
+		if len(s) < 2 {
+			return chessMove{}, fmt.Errorf("invalid SAN %q", san)
+		}
+		var ok bool
+		if to, ok = parseSquare(s[len(s)-2:]); !ok {
+			return chessMove{}, fmt.Errorf("invalid SAN %q", san)
+		}
+		for _, c := range []byte(s[:len(s)-2]) {
+			switch {
+			case c >= 'a' && c <= 'h':
+				fromFile = int(c - 'a')
+			case c >= '1' && c <= '8':
+				fromRank = int(c - '1')
+			default:
+				return chessMove{}, fmt.Errorf("invalid SAN %q", san)
+			}
+		}
+	}
+
+	var matches []chessMove
+	for _, m := range pos.legalMoves() {
+		if castle != nil {
+			if m.from == castle.from && m.to == castle.to && lower(pos.board[m.from]) == 'k' {
+				matches = append(matches, m)
+			}
+			continue
+		}
+		if m.to != to || lower(pos.board[m.from]) != piece || m.promotion != promotion ||
+			(fromFile >= 0 && m.from%8 != fromFile) || (fromRank >= 0 && m.from/8 != fromRank) {
+			continue
+		}
+		// Castling is only written O-O or O-O-O, never as a king move such as Kg1
+		if piece == 'k' && (m.to-m.from == 2 || m.from-m.to == 2) {
+			continue
+		}
+		matches = append(matches, m)
+	}
+	switch len(matches) {
+	case 0:
+		return chessMove{}, fmt.Errorf("%s is not a legal move", san)
+	case 1:
+		return matches[0], nil
+	}
+	options := make([]string, len(matches))
+	for i, m := range matches {
+		options[i] = m.uci()
+	}
+	return chessMove{}, fmt.Errorf("%s is ambiguous: %s", san, strings.Join(options, ", "))
+}
+
+// replaySAN plays SAN moves in order from pos
+func replaySAN(pos *position, moves []string) (*position, error) {
+	for i, san := range moves {
+		m, err := pos.resolveSAN(san)
+		if err != nil {
+			number := fmt.Sprintf("%d.", i/2+1)
+			if i%2 == 1 {
+				number += ".."
+			}
+			return nil, fmt.Errorf("move %s %v", number, err)
+		}
+		pos = pos.play(m)
+	}
+	return pos, nil
+}
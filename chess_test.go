@@ -0,0 +1,121 @@
+package main
+
+import "testing"
+
+// perft counts the move paths depth plies deep
+func perft(pos *position, depth int) int {
+	if depth == 0 {
+		return 1
+	}
+	n := 0
+	for _, m := range pos.legalMoves() {
+		n += perft(pos.play(m), depth-1)
+	}
+	return n
+}
+
+func TestPerft(t *testing.T) {
+	tests := []struct {
+		fen   string
+		depth int
+		want  int
+	}{
+		{startFEN, 3, 8902},
+		// "Kiwipete", with castling, en passant and promotions
+		{"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1", 2, 2039},
+		{"8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 1", 3, 2812},
+	}
+	for _, tt := range tests {
+		pos, err := parseFEN(tt.fen)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := perft(pos, tt.depth); got != tt.want {
+			t.Errorf("perft(%s, %d) = %d, want %d", tt.fen, tt.depth, got, tt.want)
+		}
+	}
+}
+
+func TestResolveSAN(t *testing.T) {
+	const (
+		castling   = "r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1"
+		knights    = "4k3/8/8/8/8/5N2/8/1N2K3 w - - 0 1"
+		rooks      = "4k3/8/8/4R3/8/8/8/R6K w - - 0 1"
+		files      = "4k3/8/8/8/R6R/8/8/4K3 w - - 0 1"
+		promotion  = "3r3k/4P3/8/8/8/8/8/4K3 w - - 0 1"
+		scholars   = "r1bqkbnr/pppp1ppp/2n5/4p2Q/2B1P3/8/PPPP1PPP/RNB1K1NR w KQkq - 2 3"
+		kingOnF1   = "4k3/8/8/8/8/8/8/5K2 w - - 0 1"
+		noCastling = "r3k2r/8/8/8/8/8/8/R3K2R w - - 0 1"
+	)
+	tests := []struct {
+		fen, san string
+		want     string // "" when the move must be refused
+	}{
+		{startFEN, "e4", "e2e4"},
+		{startFEN, "Nf3", "g1f3"},
+		{startFEN, "Nf3!?", "g1f3"},
+		{startFEN, "e5", ""},
+
+		// Disambiguation by file and by rank
+		{knights, "Nbd2", "b1d2"},
+		{knights, "Nfd2", "f3d2"},
+		{knights, "Nf3d2", "f3d2"},
+		{knights, "Nd2", ""},
+		{rooks, "R1e1", "a1e1"},
+		{rooks, "R5e1", "e5e1"},
+		{rooks, "Rae1", "a1e1"},
+		{rooks, "Re1", ""},
+		{files, "Rae4", "a4e4"},
+		{files, "Rhe4", "h4e4"},
+		{files, "Re4", ""},
+
+		// Promotion, with and without "=", and with a capture and a check
+		{promotion, "e8=Q", "e7e8q"},
+		{promotion, "e8Q", "e7e8q"},
+		{promotion, "e8=N", "e7e8n"},
+		{promotion, "e8=q", "e7e8q"},
+		{promotion, "exd8=R+", "e7d8r"},
+		{promotion, "exd8=Q#", "e7d8q"},
+		{promotion, "e8", ""},
+
+		// Check and mate suffixes
+		{scholars, "Qxf7#", "h5f7"},
+		{scholars, "Qxf7+", "h5f7"},
+		{scholars, "Qxf7", "h5f7"},
+		{scholars, "Bxf7+", "c4f7"},
+
+		// Castling, written with letters or zeros, for both sides
+		{castling, "O-O", "e1g1"},
+		{castling, "0-0", "e1g1"},
+		{castling, "O-O-O", "e1c1"},
+		{castling, "0-0-0+", "e1c1"},
+		{"r3k2r/8/8/8/8/8/8/R3K2R b KQkq - 0 1", "O-O", "e8g8"},
+		{"r3k2r/8/8/8/8/8/8/R3K2R b KQkq - 0 1", "0-0-0", "e8c8"},
+		{noCastling, "O-O", ""},
+		// A king move two squares is castling, not Kg1
+		{castling, "Kg1", ""},
+		{castling, "Kc1", ""},
+		{castling, "Kf1", "e1f1"},
+		{kingOnF1, "Kg1", "f1g1"},
+	}
+	for _, tt := range tests {
+		pos, err := parseFEN(tt.fen)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m, err := pos.resolveSAN(tt.san)
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("%s in %s = %s, want an error", tt.san, tt.fen, m.uci())
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s in %s: %v", tt.san, tt.fen, err)
+			continue
+		}
+		if m.uci() != tt.want {
+			t.Errorf("%s in %s = %s, want %s", tt.san, tt.fen, m.uci(), tt.want)
+		}
+	}
+}
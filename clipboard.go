@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// clipboardTool is how the clipboard is written and read on this host
+type clipboardTool struct {
+	name      string
+	copyArgs  []string // reads the new contents from stdin
+	pasteArgs []string // prints the contents
+}
+
+// linuxClipboardTools are tried in order; Wayland sessions only use wl-clipboard
+var linuxClipboardTools = []clipboardTool{
+	{name: "xclip", copyArgs: []string{"xclip", "-selection", "clipboard", "-i"}, pasteArgs: []string{"xclip", "-selection", "clipboard", "-o"}},
+	{name: "xsel", copyArgs: []string{"xsel", "--clipboard", "--input"}, pasteArgs: []string{"xsel", "--clipboard", "--output"}},
+}
+
+var waylandClipboardTool = clipboardTool{name: "wl-clipboard", copyArgs: []string{"wl-copy"}, pasteArgs: []string{"wl-paste", "--no-newline"}}
+
+// findClipboardTool returns the clipboard tool for this OS, if installed
+func findClipboardTool() (clipboardTool, error) {
+	switch runtime.GOOS {
+	case "linux":
+		if os.Getenv("XDG_SESSION_TYPE") == "wayland" {
+			if !haveTool("wl-copy") || !haveTool("wl-paste") {
+				return clipboardTool{}, fmt.Errorf("wl-copy and wl-paste are not installed")
+			}
+			return waylandClipboardTool, nil
+		}
+		for _, t := range linuxClipboardTools {
+			if haveTool(t.name) {
+				return t, nil
+			}
+		}
+		return clipboardTool{}, fmt.Errorf("neither xclip nor xsel is installed")
+	case "darwin":
+		return clipboardTool{name: "pbcopy", copyArgs: []string{"pbcopy"}, pasteArgs: []string{"pbpaste"}}, nil
+	case "windows":
+		return clipboardTool{name: "clip", copyArgs: []string{"clip"}, pasteArgs: []string{"powershell", "-Command", "Get-Clipboard -Raw"}}, nil
+	}
+	return clipboardTool{}, fmt.Errorf("unsupported operating system: %s", runtime.GOOS)
+}
+
+// writeClipboard replaces the clipboard contents with text
+func writeClipboard(ctx context.Context, t clipboardTool, text string) error {
+	cmd := newCommand(ctx, t.copyArgs[0], t.copyArgs[1:]...)
+	cmd.Stdin = strings.NewReader(text)
+	// xclip stays behind to serve the selection, so its output isn't
+	// collected: that would wait for it to exit
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s failed to write the clipboard: %v", t.name, err)
+	}
+	return nil
+}
+
+// readClipboard returns the clipboard contents
+func readClipboard(ctx context.Context, t clipboardTool) (string, error) {
+	output, err := newCommand(ctx, t.pasteArgs[0], t.pasteArgs[1:]...).Output()
+	if err != nil {
+		return "", fmt.Errorf("%s failed to read the clipboard: %v", t.name, err)
+	}
+	return string(output), nil
+}
+
+// clipboardRoundTrip writes a known string to the clipboard and reads it
+// back, reporting whether it came back unchanged and what was read. The
+// earlier contents are put back when they were text.
+func clipboardRoundTrip(ctx context.Context, t clipboardTool) (working bool, got string, restored bool, err error) {
+	want := fmt.Sprintf("browser-controller clipboard check %d", time.Now().UnixNano())
+	previous, prevErr := readClipboard(ctx, t)
+	if err := writeClipboard(ctx, t, want); err != nil {
+		return false, "", false, err
+	}
+	if got, err = readClipboard(ctx, t); err != nil {
+		return false, "", false, err
+	}
+	if prevErr == nil && previous != "" {
+		restored = writeClipboard(ctx, t, previous) == nil
+	}
+	return strings.TrimRight(got, "\r\n") == want, got, restored, nil
+}
+
+// clipboardState is the outcome of the last /clipboard-check, for /capabilities
+type clipboardState struct {
+	mu      sync.Mutex
+	checked bool
+	working bool
+}
+
+func (s *clipboardState) set(working bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.checked, s.working = true, working
+}
+
+// status returns whether the last check passed, and whether there was one
+func (s *clipboardState) status() (working, checked bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.working, s.checked
+}
+
+// ClipboardCheckResponse is the Response for /clipboard-check
+type ClipboardCheckResponse struct {
+	Response
+	Working bool   `json:"working"`
+	Tool    string `json:"tool,omitempty"`
+	// Restored is set when the clipboard's earlier contents were put back
+	Restored bool `json:"restored"`
+}
+
+// handleClipboardCheck writes a known string to the clipboard and reads it
+// back, reporting whether the clipboard tools work on this host before
+// anything relies on them. The earlier contents are restored afterwards
+// when they were text. The outcome is kept for the "clipboard" capability.
+func (c *Controller) handleClipboardCheck(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "Only POST method is allowed")
+		return
+	}
+
+	tool, err := findClipboardTool()
+	if err != nil {
+		c.clipboard.set(false)
+		writeJSON(w, http.StatusOK, ClipboardCheckResponse{
+			Response: Response{Success: true, Message: fmt.Sprintf("Clipboard is not usable: %v", err)},
+		})
+		return
+	}
+
+	var got string
+	var working, restored bool
+	err = c.command(r, func() error {
+		var err error
+		working, got, restored, err = clipboardRoundTrip(r.Context(), tool)
+		return err
+	})
+	if err != nil && r.Context().Err() != nil {
+		writeCommandError(w, err, err.Error())
+		return
+	}
+
+	c.clipboard.set(working)
+	message := fmt.Sprintf("Clipboard works with %s", tool.name)
+	switch {
+	case err != nil:
+		message = fmt.Sprintf("Clipboard is not usable: %v", err)
+	case !working:
+		message = fmt.Sprintf("Clipboard read back %q instead of what %s wrote", got, tool.name)
+	}
+	writeJSON(w, http.StatusOK, ClipboardCheckResponse{
+		Response: Response{Success: true, Message: message},
+		Working:  working,
+		Tool:     tool.name,
+		Restored: restored,
+	})
+}
+
+// clipboardCapability reports the last /clipboard-check or deep /health
+// probe, or before one
+// whether a clipboard tool is installed
+func (c *Controller) clipboardCapability() bool {
+	if working, checked := c.clipboard.status(); checked {
+		return working
+	}
+	_, err := findClipboardTool()
+	return err == nil
+}
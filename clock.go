@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ClockResponse is the Response for /clock. The seconds are omitted for a
+// clock that isn't shown or can't be parsed.
+type ClockResponse struct {
+	Response
+	Site         string   `json:"site"`
+	White        string   `json:"white"`
+	Black        string   `json:"black"`
+	WhiteSeconds *float64 `json:"white_seconds,omitempty"`
+	BlackSeconds *float64 `json:"black_seconds,omitempty"`
+}
+
+// clockScript returns the text of the first element matching each of
+// arguments[0] and arguments[1], or an empty string where none matches
+const clockScript = `
+return [arguments[0], arguments[1]].map(selector => {
+	const el = document.querySelector(selector);
+	return el ? el.textContent.replace(/\s+/g, '') : '';
+});`
+
+// parseClock parses a clock display such as "2:03", "0:09.4" or "1:02:03" into seconds
+func parseClock(s string) (float64, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return 0, fmt.Errorf("invalid clock %q", s)
+	}
+	var seconds float64
+	for i, p := range parts {
+		var v float64
+		var err error
+		if i == len(parts)-1 {
+			v, err = strconv.ParseFloat(p, 64)
+		} else {
+			var n int
+			n, err = strconv.Atoi(p)
+			v = float64(n)
+		}
+		if err != nil || v < 0 {
+			return 0, fmt.Errorf("invalid clock %q", s)
+		}
+		seconds = seconds*60 + v
+	}
+	return seconds, nil
+}
+
+// handleClock returns the time left on both sides' clocks on the current page
+func (c *Controller) handleClock(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "Only GET method is allowed")
+		return
+	}
+	if c.marionette == nil {
+		writeError(w, http.StatusNotImplemented, "Reading the clock requires the marionette backend")
+		return
+	}
+
+	site, current, err := c.currentSite(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if site == nil || site.WhiteClockSelector == "" {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("Unsupported site: %s", current))
+		return
+	}
+
+	var clocks []string
+	if err := c.marionette.ExecuteScript(r.Context(), clockScript, []interface{}{site.WhiteClockSelector, site.BlackClockSelector}, &clocks); err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to read clocks: %v", err))
+		return
+	}
+	if len(clocks) != 2 || (clocks[0] == "" && clocks[1] == "") {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("No clocks shown on %s", site.Name))
+		return
+	}
+
+	resp := ClockResponse{
+		Response: Response{
+			Success: true,
+			Message: fmt.Sprintf("White %s, Black %s", clocks[0], clocks[1]),
+		},
+		Site:  site.Name,
+		White: clocks[0],
+		Black: clocks[1],
+	}
+	if v, err := parseClock(clocks[0]); err == nil {
+		resp.WhiteSeconds = &v
+	}
+	if v, err := parseClock(clocks[1]); err == nil {
+		resp.BlackSeconds = &v
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// acceptsGzip reports whether a request's Accept-Encoding allows gzip
+func acceptsGzip(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if name != "gzip" && name != "*" {
+			continue
+		}
+		// gzip;q=0 refuses it
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if v, err := strconv.ParseFloat(q, 64); err == nil && v == 0 {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// gzipWriter holds a response back until it is known to be large enough to
+// compress: the first minSize bytes are buffered, and a response that ends
+// smaller is written as it is
+type gzipWriter struct {
+	http.ResponseWriter
+	minSize int
+	status  int
+	buf     bytes.Buffer
+	started bool         // the header has been written
+	gz      *gzip.Writer // nil unless the response is being compressed
+}
+
+func (g *gzipWriter) WriteHeader(status int) {
+	if g.status == 0 {
+		g.status = status
+	}
+}
+
+func (g *gzipWriter) Write(p []byte) (int, error) {
+	if g.status == 0 {
+		g.status = http.StatusOK
+	}
+	if g.started {
+		if g.gz != nil {
+			return g.gz.Write(p)
+		}
+		return g.ResponseWriter.Write(p)
+	}
+	g.buf.Write(p)
+	if g.buf.Len() >= g.minSize {
+		if err := g.start(true); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// start writes the header, compressing the rest of the response if
+// compress is set and its type isn't compressed already, then the buffer
+func (g *gzipWriter) start(compress bool) error {
+	g.started = true
+	h := g.Header()
+	if g.status == 0 {
+		g.status = http.StatusOK
+	}
+	// net/http would otherwise sniff the type from the compressed bytes
+	if h.Get("Content-Type") == "" && g.buf.Len() > 0 {
+		h.Set("Content-Type", http.DetectContentType(g.buf.Bytes()))
+	}
+	if compress && h.Get("Content-Encoding") == "" && compressible(h.Get("Content-Type")) {
+		h.Set("Content-Encoding", "gzip")
+		h.Del("Content-Length")
+		g.gz = gzip.NewWriter(g.ResponseWriter)
+	}
+	g.ResponseWriter.WriteHeader(g.status)
+	if g.buf.Len() == 0 {
+		return nil
+	}
+	var err error
+	if g.gz != nil {
+		_, err = g.gz.Write(g.buf.Bytes())
+	} else {
+		_, err = g.ResponseWriter.Write(g.buf.Bytes())
+	}
+	g.buf.Reset()
+	return err
+}
+
+// Flush sends what is buffered, uncompressed if the response hasn't
+// reached the size threshold, so /events streams right away
+func (g *gzipWriter) Flush() {
+	if !g.started {
+		g.start(false)
+	}
+	if g.gz != nil {
+		g.gz.Flush()
+	}
+	if f, ok := g.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// finish completes the response once the handler has returned
+func (g *gzipWriter) finish() {
+	if !g.started {
+		if g.status == 0 {
+			return
+		}
+		g.start(false)
+	}
+	if g.gz != nil {
+		g.gz.Close()
+	}
+}
+
+// compressible reports whether a content type is worth gzipping: images
+// are compressed already and event streams must not be held back
+func compressible(contentType string) bool {
+	return !strings.HasPrefix(contentType, "image/") && !strings.HasPrefix(contentType, "text/event-stream")
+}
+
+// withGzip compresses responses of at least -gzip-min-size bytes, such as
+// base64 screenshots and page HTML, for clients that accept gzip
+func withGzip(h http.Handler, minSize int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		if !acceptsGzip(r) {
+			h.ServeHTTP(w, r)
+			return
+		}
+		g := &gzipWriter{ResponseWriter: w, minSize: minSize}
+		defer g.finish()
+		h.ServeHTTP(g, r)
+	})
+}
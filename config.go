@@ -0,0 +1,560 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// Config holds the controller settings, taken from flags with environment fallbacks
+type Config struct {
+	Port                 string
+	Backend              string
+	MarionetteAddr       string
+	SelfTest             bool
+	FailFast             bool
+	MacroDir             string
+	ScreenshotDir        string
+	NewGame              map[string][]sequenceStep            // new-game sequences by site name or "default"
+	AfterNavigate        map[string][]sequenceStep            // steps run after /open, by site name or domain
+	TimeControls         map[string]map[string][]sequenceStep // /set-time-control sequences by site and time control
+	KeyMap               map[string]keyName                   // extra key names from -key-map
+	Replay               string
+	ReplaySpeed          float64
+	ReplayCommands       string // JSON-lines action log to replay with a fake command runner
+	Golden               string
+	UpdateGolden         bool
+	FirefoxBin           string
+	Browser              string // firefox, brave or vivaldi
+	Private              bool
+	Kiosk                bool
+	SquareInset          int
+	OccupancyThreshold   float64         // fraction of a square's middle unlike its background for /board-state to call it occupied
+	LabelInset           int             // percent of a square clicks on edge squares move away from labels
+	LabelEdges           map[string]bool // board edges drawn with coordinate labels
+	LaunchTimeout        time.Duration
+	LaunchRetries        int           // times a failed launch is retried
+	LaunchRetryDelay     time.Duration // before the first launch retry, doubling after each
+	RestartGrace         time.Duration
+	ShutdownTimeout      time.Duration
+	Profile              string
+	NoRemote             bool
+	Prefs                map[string]string // preferences written to -profile-dir's user.js, as user.js literals
+	ProfileDir           string            // isolated profile directory for this controller's Firefox
+	Sessions             []sessionSpec     // named browser sessions served by this process
+	LaunchArgs           []string          // extra arguments for starting Firefox
+	MaxURLLength         int
+	VerifyURLRetries     int           // times /open retypes a URL the browser didn't reach
+	VerifyURLWait        time.Duration // how long /open waits for the browser to reach the URL
+	OpenDebounce         time.Duration
+	AllowedDomains       []string // hosts /open may navigate to; empty allows all
+	LogCommands          bool
+	AllowDebug           bool
+	Gzip                 bool
+	GzipMinSize          int
+	ResetZoomOnOpen      bool
+	BasePixelRatio       float64 // devicePixelRatio at 100% zoom
+	APIKey               string
+	BasicAuth            map[string]string // htpasswd entries by user name, from -basic-auth and -basic-auth-file
+	TLSCert              string            // serve HTTPS with this certificate and -tls-key
+	TLSKey               string
+	TLSClientCA          string   // require client certificates signed by this CA
+	TLSClientCNs         []string // client certificate common names allowed, empty for any
+	HTTPAddr             string   // also serve plain HTTP here alongside TLS on -port
+	CallbackRetries      int
+	RedactParams         []string // query parameters whose values are hidden in logs
+	TesseractBin         string
+	OCRRegion            rect
+	CommandTimeout       time.Duration
+	Timeouts             map[string]time.Duration // per endpoint category, see timeoutFor
+	Monitor              string                   // monitor to capture and click on: primary, an index or a name
+	Display              string                   // X display for spawned commands, such as ":0.1"
+	CommandEnv           []string                 // KEY=value entries spawned commands get over the server's environment
+	BatchSettle          time.Duration
+	MoveRetries          int
+	MoveLogDir           string        // record each /move with its screenshots under this directory
+	MoveRetryBudget      int           // retries a /move's sub-steps share; -1 leaves each its own
+	MoveDeadline         time.Duration // the most a /move may take; 0 for no limit beyond -timeout-click
+	MoveSettle           time.Duration
+	PlayMovesDelay       time.Duration
+	RecentScreenshots    int               // board screenshots kept after actions for /recent-screenshots
+	DragSteps            int               // intermediate pointer moves during a drag
+	DragStepDelay        time.Duration     // pause between drag pointer moves
+	BoardPollInterval    time.Duration     // how often /events screenshots the board
+	BoardChangeThreshold float64           // fraction of board pixels that must change for board_changed
+	BoardStable          time.Duration     // how long the board must stay unchanged for /wait-for-board-stable
+	ConfirmMoves         map[string]string // confirmation mode by site name; "" applies to all sites
+	OrientationCheck     string
+	PlayingColor         string            // side the controller plays, if known: white or black
+	MoveStyles           map[string]string // move style by site name; "" applies to all sites
+	ConfirmButton        point
+	MoveInputClick       point // where to click to focus the move input box for the keyboard move style
+	AbortClick           point
+	AbortClearPremoves   bool
+	RestoreFocus         bool
+	CheckChallenge       bool
+	RecoverCrashedTab    bool
+	CheckScreenLock      bool
+	WakeScreen           bool
+	VerifyBoard          bool
+	BoardLoadTimeout     time.Duration
+	ScreenshotInterval   time.Duration
+	MinActionInterval    time.Duration
+	FocusSettle          time.Duration // -focus-settle for this OS
+	WindowInput          bool
+	MatchWindow          bool   // focus the window showing the game rather than any browser window
+	WindowID             string // the window -match-window focuses, overriding the match
+	StartURL             string
+	CalibrationFile      string
+	LaunchOnStart        bool
+	AutoLaunch           bool
+	ReadyGate            bool
+	PinURL               string
+	PinRedirect          bool
+	InputTools           []string // Linux input tools to try, in order
+	TypeMode             string
+	ScreenshotTools      []string       // Linux screenshot tools to try, in order
+	ScreenshotCommand    screenshotTool // custom Linux screenshot command, overriding ScreenshotTools
+
+	// Frozen browser detection
+	WatchdogInterval time.Duration
+	WatchdogStale    time.Duration
+
+	// Native post-game dialog detection for /dismiss-dialog
+	DialogRegion    rect
+	DialogColor     string
+	DialogTolerance int
+	DialogClick     point
+
+	// Native draw and rematch offer detection for /offer-response
+	Offers map[string]nativeOffer
+}
+
+// Supported browser backends
+const (
+	backendNative     = "native"
+	backendMarionette = "marionette"
+)
+
+// envOr returns the value of the environment variable key, or def if it is unset
+func envOr(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+// loadConfig parses the command line flags into a Config
+func loadConfig() (*Config, error) {
+	cfg := &Config{}
+	var err error
+	if cfg.OCRRegion, err = parseRect(os.Getenv("OCR_REGION")); err != nil {
+		return nil, fmt.Errorf("invalid OCR_REGION: %v", err)
+	}
+	flag.StringVar(&cfg.Port, "port", envOr("PORT", "9001"), "port to listen on (env PORT)")
+	flag.StringVar(&cfg.Backend, "backend", envOr("BACKEND", backendNative), "browser backend: native (keystrokes) or marionette (env BACKEND)")
+	flag.StringVar(&cfg.MarionetteAddr, "marionette-addr", envOr("MARIONETTE_ADDR", "127.0.0.1:2828"), "address of the Firefox Marionette server (env MARIONETTE_ADDR)")
+	flag.BoolVar(&cfg.SelfTest, "self-test", false, "check browser control capabilities at startup before serving")
+	flag.BoolVar(&cfg.FailFast, "fail-fast", false, "with -self-test, exit non-zero if a required capability is broken")
+	flag.StringVar(&cfg.MacroDir, "macro-dir", envOr("MACRO_DIR", "macros"), "directory where recorded macros are saved (env MACRO_DIR)")
+	flag.StringVar(&cfg.ScreenshotDir, "screenshot-dir", envOr("SCREENSHOT_DIR", "screenshots"), "directory /save-screenshot writes under; filenames can't leave it (env SCREENSHOT_DIR)")
+	flag.StringVar(&cfg.Replay, "replay", "", "replay the named macro and exit instead of serving")
+	useAutomationPrefs := flag.Bool("automation-prefs", false, "with -profile-dir, turn off Firefox features that interfere with automation before each launch: form and password autofill, smooth scrolling, hardware acceleration, and first-run, default-browser and session-restore prompts")
+	prefsFile := flag.String("prefs-file", envOr("PREFS_FILE", ""), "JSON file of Firefox preferences, such as {\"general.smoothScroll\": false}, written to -profile-dir's user.js before each launch, over -automation-prefs; profiles the controller doesn't manage are left alone (env PREFS_FILE)")
+	newGameFile := flag.String("new-game-file", envOr("NEW_GAME_FILE", ""), "JSON file mapping site names, or \"default\", to the steps /new-game runs: clicks ({\"action\":\"click\"} with x and y, square or selector), keys ({\"action\":\"key\",\"key\":\"ctrl+l\"}) and waits ({\"action\":\"wait\",\"ms\":500}) (env NEW_GAME_FILE)")
+	afterNavigateFile := flag.String("after-navigate-file", envOr("AFTER_NAVIGATE_FILE", ""), "JSON file mapping site names or domains (matching subdomains too) to steps, in the -new-game-file format, run after every successful /open there, such as dismissing a cookie banner; steps with \"optional\":true may fail without failing the sequence (env AFTER_NAVIGATE_FILE)")
+	timeControlFile := flag.String("time-control-file", envOr("TIME_CONTROL_FILE", ""), "JSON file mapping site names to time controls such as \"3+2\" to the steps, in the -new-game-file format, that start such a game; adds to and overrides lichess's built-in quick pairing buttons (env TIME_CONTROL_FILE)")
+	keyMap := flag.String("key-map", envOr("KEY_MAP", ""), "JSON file of extra key names for /key, such as {\"Insert\": {\"linux\": \"Insert\", \"darwin\": \"114\", \"windows\": \"{INSERT}\"}}, giving the xdotool keysym, macOS key code and SendKeys token (env KEY_MAP)")
+	flag.StringVar(&cfg.ReplayCommands, "replay-commands", "", "replay a JSON-lines action log of {method, path, body} without running any command, print the commands it would run, and exit")
+	flag.StringVar(&cfg.Golden, "golden", "", "with -replay-commands, compare the commands against this file and exit 1 on a difference")
+	flag.BoolVar(&cfg.UpdateGolden, "update-golden", false, "with -replay-commands, rewrite -golden instead of comparing")
+	flag.Float64Var(&cfg.ReplaySpeed, "replay-speed", 1, "playback speed multiplier for -replay")
+	flag.StringVar(&cfg.FirefoxBin, "firefox-bin", envOr("FIREFOX_BIN", ""), "path to the browser binary (env FIREFOX_BIN; default: the -browser binary on PATH, or its app on macOS)")
+	flag.StringVar(&cfg.Browser, "browser", envOr("TARGET_BROWSER", "firefox"), "browser to drive: firefox, brave or vivaldi; brave and vivaldi need -backend native (env TARGET_BROWSER)")
+	flag.BoolVar(&cfg.Private, "private", false, "launch Firefox in a private window")
+	flag.BoolVar(&cfg.Kiosk, "kiosk", runtime.GOOS == "linux", "launch the browser fullscreen with --kiosk, with no address bar or tabs; navigation then uses marionette when available, else Ctrl+L typed blind, and /set-addressbar is unavailable")
+	flag.DurationVar(&cfg.RestartGrace, "restart-grace", 10*time.Second, "how long /restart-browser waits for Firefox to quit before killing it")
+	flag.DurationVar(&cfg.ShutdownTimeout, "shutdown-timeout", 10*time.Second, "on SIGINT or SIGTERM, how long requests in flight and async jobs get to finish before they are cancelled; /events streams are closed at once")
+	flag.IntVar(&cfg.LaunchRetries, "launch-retries", 2, "how many times to retry launching the browser when it fails to start or exits before it is ready, distinct from the focus and typing retries")
+	flag.DurationVar(&cfg.LaunchRetryDelay, "launch-retry-delay", time.Second, "wait before the first launch retry, doubling after each")
+	flag.DurationVar(&cfg.LaunchTimeout, "launch-timeout", 20*time.Second, "how long launching waits for Firefox to be ready: its window found and activatable and, with the marionette backend, Marionette listening")
+	flag.StringVar(&cfg.Profile, "profile", envOr("FIREFOX_PROFILE", ""), "Firefox profile name to launch with via -P, or the profile directory of a Chromium -browser (env FIREFOX_PROFILE)")
+	if env := os.Getenv("LAUNCH_ARGS"); env != "" {
+		args, err := splitArgs(env)
+		if err != nil {
+			return nil, fmt.Errorf("invalid LAUNCH_ARGS: %v", err)
+		}
+		cfg.LaunchArgs = args
+	}
+	flag.Func("launch-args", "extra arguments for starting Firefox, split like a shell would (such as \"--width 1280 --height 800\"); may be repeated (env LAUNCH_ARGS)", func(s string) error {
+		args, err := splitArgs(s)
+		if err != nil {
+			return err
+		}
+		cfg.LaunchArgs = append(cfg.LaunchArgs, args...)
+		return nil
+	})
+	flag.StringVar(&cfg.ProfileDir, "profile-dir", envOr("FIREFOX_PROFILE_DIR", ""), "launch Firefox with --profile <dir> --no-remote so this controller drives its own isolated instance; created if missing, overrides -profile. Window focus still picks the first Firefox window, so give each instance its own -display (env FIREFOX_PROFILE_DIR)")
+	sessions := flag.String("sessions", envOr("SESSIONS", ""), "comma-separated named browser sessions to serve from one process, each as name or name@display, such as \"alpha@:1,beta@:2\"; each gets its own profile directory under -profile-dir (default ./sessions), calibration and command queue, and with the marionette backend the Marionette port after the previous session's. Address a session with a /s/<name>/ path prefix, a session query parameter or a \"session\" body field; others go to the first session (env SESSIONS)")
+	flag.BoolVar(&cfg.NoRemote, "no-remote", false, "launch Firefox with --no-remote so it starts a separate instance")
+	flag.IntVar(&cfg.VerifyURLRetries, "verify-url-retries", 0, "after /open types a URL, read the browser's URL back and retype it up to this many times if it doesn't match; needs the marionette backend; 0 disables")
+	flag.DurationVar(&cfg.VerifyURLWait, "verify-url-wait", 3*time.Second, "how long -verify-url-retries waits for the browser to reach the URL before retyping")
+	allowedDomains := flag.String("allowed-domains", envOr("ALLOWED_DOMAINS", ""), "comma-separated hosts /open may navigate to, such as \"lichess.org,*.chess.com\"; *.domain also matches the domain itself; /fill also refuses to run on pages outside them; empty allows all (env ALLOWED_DOMAINS)")
+	flag.StringVar(&cfg.APIKey, "api-key", envOr("API_KEY", ""), "require this key in X-API-Key or an Authorization Bearer token on every request but /health and /ready; also signs callbacks (env API_KEY)")
+	basicAuth := flag.String("basic-auth", envOr("BASIC_AUTH", ""), "require HTTP basic auth with this user:password on every request but /health and /ready, for clients that can't send -api-key headers; with -api-key either is accepted (env BASIC_AUTH)")
+	basicAuthFile := flag.String("basic-auth-file", envOr("BASIC_AUTH_FILE", ""), "like -basic-auth, for the users in this htpasswd file of user:password lines, with passwords in plain text or hashed by htpasswd -s (env BASIC_AUTH_FILE)")
+	flag.StringVar(&cfg.TLSCert, "tls-cert", envOr("TLS_CERT", ""), "serve HTTPS with this PEM certificate, together with -tls-key (env TLS_CERT)")
+	flag.StringVar(&cfg.TLSKey, "tls-key", envOr("TLS_KEY", ""), "PEM private key for -tls-cert (env TLS_KEY)")
+	flag.StringVar(&cfg.TLSClientCA, "tls-client-ca", envOr("TLS_CLIENT_CA", ""), "require every connection to present a client certificate signed by the CAs in this PEM file; needs -tls-cert (env TLS_CLIENT_CA)")
+	flag.StringVar(&cfg.HTTPAddr, "http-addr", envOr("HTTP_ADDR", ""), "with -tls-cert, also serve plain HTTP on this address, such as 127.0.0.1:9002 for local tools, from the same process; client certificates aren't asked for there, but -api-key and -basic-auth still apply (env HTTP_ADDR)")
+	tlsClientCNs := flag.String("tls-client-cns", envOr("TLS_CLIENT_CNS", ""), "comma-separated client certificate common names allowed with -tls-client-ca; empty allows any certificate the CA signed (env TLS_CLIENT_CNS)")
+	flag.IntVar(&cfg.CallbackRetries, "callback-retries", 5, "how many times to retry delivering a callback_url result, with exponential backoff")
+	flag.BoolVar(&cfg.LogCommands, "log-commands", false, "log every command line the server runs, for debugging")
+	flag.BoolVar(&cfg.ResetZoomOnOpen, "reset-zoom-on-open", false, "reset the page zoom to 100% after each /open, since Firefox remembers zoom per site and calibration assumes 100%")
+	flag.Float64Var(&cfg.BasePixelRatio, "base-pixel-ratio", 1, "the page's devicePixelRatio at 100% zoom, such as 2 on HiDPI screens; GET /zoom divides by it")
+	flag.BoolVar(&cfg.AllowDebug, "allow-debug", false, "honor ?debug=1 without -api-key or basic auth; the debug field shows command lines, paths and the environment")
+	flag.BoolVar(&cfg.Gzip, "gzip", false, "gzip responses of at least -gzip-min-size bytes, such as base64 screenshots, for clients sending Accept-Encoding: gzip; image responses are sent as they are")
+	flag.IntVar(&cfg.GzipMinSize, "gzip-min-size", 1024, "smallest response in bytes that -gzip compresses")
+	redactParams := flag.String("redact-params", envOr("REDACT_PARAMS", "token,sig,signature,key,auth,password,session"), "comma-separated query parameters whose values are replaced with REDACTED in logged commands (env REDACT_PARAMS)")
+	flag.DurationVar(&cfg.OpenDebounce, "open-debounce", 0, "coalesce identical /open requests arriving within this window into one navigation (0 disables)")
+	flag.IntVar(&cfg.MaxURLLength, "max-url-length", 2048, "reject /open URLs longer than this many characters (0 disables the check)")
+	flag.StringVar(&cfg.TesseractBin, "tesseract-bin", envOr("TESSERACT_BIN", "tesseract"), "path to the tesseract binary used by /ocr (env TESSERACT_BIN)")
+	flag.Func("ocr-region", "screen region x,y,width,height of the move list for /ocr (env OCR_REGION)", func(s string) (err error) {
+		cfg.OCRRegion, err = parseRect(s)
+		return err
+	})
+	flag.DurationVar(&cfg.CommandTimeout, "command-timeout", 30*time.Second, "timeout for endpoints without a category timeout (0 disables)")
+	var navTimeout, clickTimeout, shotTimeout, waitTimeout time.Duration
+	flag.DurationVar(&navTimeout, "timeout-navigation", 15*time.Second, "timeout for navigation endpoints such as /open and /launch")
+	flag.DurationVar(&clickTimeout, "timeout-click", 5*time.Second, "timeout for click and input endpoints")
+	flag.DurationVar(&shotTimeout, "timeout-screenshot", 20*time.Second, "timeout for screenshot endpoints")
+	flag.DurationVar(&waitTimeout, "timeout-wait", 60*time.Second, "timeout for endpoints that wait for the page")
+	flag.StringVar(&cfg.Monitor, "monitor", envOr("MONITOR", ""), "monitor that screenshots capture and coordinates are relative to: primary, an index or a name from /status; default the whole desktop (env MONITOR)")
+	flag.Func("command-env", "KEY=value to set in the environment of spawned commands, such as Firefox, xdotool and the screenshot tools, over the server's own, like MOZ_ENABLE_WAYLAND=1 or XAUTHORITY=/home/me/.Xauthority; may be repeated (env COMMAND_ENV, comma-separated)", func(s string) error {
+		if err := checkEnvVar(s); err != nil {
+			return err
+		}
+		cfg.CommandEnv = append(cfg.CommandEnv, s)
+		return nil
+	})
+	flag.StringVar(&cfg.Display, "display", envOr("BROWSER_DISPLAY", ""), "X display (such as :0.1) that xdotool, Firefox and screenshots use on Linux; requests may override it with ?display= (env BROWSER_DISPLAY)")
+	flag.StringVar(&cfg.MoveLogDir, "move-log-dir", envOr("MOVE_LOG_DIR", ""), "record every /move, with board screenshots before and after it and its outcome, in a directory per game under this one; empty records nothing (env MOVE_LOG_DIR)")
+	flag.IntVar(&cfg.MoveRetryBudget, "move-retry-budget", -1, "total retries one /move shares between focusing Firefox and re-entering a verified move that didn't register, instead of -move-retries for the drag alone; -1 disables the budget")
+	flag.DurationVar(&cfg.MoveDeadline, "move-deadline", 0, "the most one /move may take, waiting for the command mutex included; no retry is started that wouldn't finish by then; 0 disables")
+	flag.IntVar(&cfg.MoveRetries, "move-retries", 2, "how many times /move retries a drag that didn't change the board when verify is set")
+	confirmMoves := flag.String("confirm-moves", envOr("CONFIRM_MOVES", confirmOff), "how /move confirms a move on sites set to require it: off, destination (click the square again) or button (click -confirm-button); either one mode or site=mode pairs such as \"lichess=destination,chess.com=button\" (env CONFIRM_MOVES)")
+	moveStyle := flag.String("move-style", envOr("MOVE_STYLE", ""), "how /move enters a move: drag (press, move and release), click (click the piece, then the destination) or keyboard (type it into the site's move input box, which needs no calibration); either one style or site=style pairs such as \"chess.com=click\"; requests may override it with move_style. Sites it sets no style for use their profile's, keyboard on lichess while its move box is shown, or else drag. Premoves are always clicked (env MOVE_STYLE)")
+	flag.StringVar(&cfg.PlayingColor, "playing-color", envOr("PLAYING_COLOR", ""), "the side the controller plays, white or black: calibrations that give no orientation put it at the bottom, and boards read from the page are checked against it; /setup's playing_color overrides it (env PLAYING_COLOR)")
+	flag.StringVar(&cfg.OrientationCheck, "orientation-check", envOr("ORIENTATION_CHECK", orientationCheckOff), "with the marionette backend on a known site, compare the calibrated orientation with the page's before each /move and /play-moves: off, correct (update the calibration to the page's side) or error (fail with ORIENTATION_MISMATCH) (env ORIENTATION_CHECK)")
+	flag.Func("confirm-button", "screen point x,y of the confirm button for -confirm-moves button", func(s string) (err error) {
+		cfg.ConfirmButton, err = parsePoint(s)
+		return err
+	})
+	flag.Func("move-input-click", "screen point x,y of the site's move input box, clicked to focus it for the keyboard move style with the native backend", func(s string) (err error) {
+		cfg.MoveInputClick, err = parsePoint(s)
+		return err
+	})
+	flag.Func("abort-click", "screen point x,y of an empty area off the board that /abort-move clicks to deselect a piece, after pressing Escape", func(s string) (err error) {
+		cfg.AbortClick, err = parsePoint(s)
+		return err
+	})
+	flag.BoolVar(&cfg.AbortClearPremoves, "abort-clear-premoves", false, "have /abort-move also right-click the board, which cancels premoves on lichess and chess.com")
+	flag.DurationVar(&cfg.MoveSettle, "move-settle", 300*time.Millisecond, "how long /move waits after a drag before checking the board changed")
+	flag.DurationVar(&cfg.PlayMovesDelay, "play-moves-delay", 300*time.Millisecond, "pause between the moves of /play-moves, leaving the site time to animate each; requests may override it with delay_ms")
+	flag.IntVar(&cfg.RecentScreenshots, "recent-screenshots", 0, "keep a screenshot of the board after each of the last N successful actions in memory, for /recent-screenshots; 0 disables")
+	flag.IntVar(&cfg.DragSteps, "drag-steps", 0, "intermediate mouse moves between press and release in drags, for sites that treat a jump as a click; 0 moves straight to the target")
+	flag.DurationVar(&cfg.DragStepDelay, "drag-step-delay", 10*time.Millisecond, "pause between the mouse moves of a drag with -drag-steps")
+	flag.DurationVar(&cfg.BoardPollInterval, "board-poll-interval", 500*time.Millisecond, "how often the board is screenshotted for board_changed events while /events has subscribers")
+	flag.Float64Var(&cfg.BoardChangeThreshold, "board-change-threshold", 0.005, "fraction of the calibrated board's pixels that must change between screenshots to send board_changed")
+	flag.DurationVar(&cfg.BoardStable, "board-stable", 400*time.Millisecond, "how long the board must stay unchanged before /wait-for-board-stable returns")
+	flag.DurationVar(&cfg.BatchSettle, "batch-settle", 500*time.Millisecond, "how long /batch waits after the action before taking its screenshot")
+	inputTools := flag.String("input-tools", envOr("INPUT_TOOLS", "xdotool,ydotool,xte"), "comma-separated Linux input tools to try in order; ydotool goes first on Wayland (env INPUT_TOOLS)")
+	flag.StringVar(&cfg.TypeMode, "type-mode", envOr("TYPE_MODE", typeModeType), "how xdotool enters URLs: type, keysym (xdotool key with one keysym per character, for non-US layouts where type gets symbols wrong) or auto (keysym unless setxkbmap reports a US layout) (env TYPE_MODE)")
+	screenshotTools := flag.String("screenshot-tools", envOr("SCREENSHOT_TOOLS", "import,scrot,maim,gnome-screenshot,grim"), "comma-separated Linux screenshot tools to try in order; the first installed one is used and grim goes first on Wayland (env SCREENSHOT_TOOLS)")
+	screenshotCommand := flag.String("screenshot-command", envOr("SCREENSHOT_COMMAND", ""), "custom Linux screenshot command writing a PNG to {file}, such as \"spectacle -b -n -o {file}\"; the file is appended when {file} is absent; overrides -screenshot-tools (env SCREENSHOT_COMMAND)")
+	flag.DurationVar(&cfg.WatchdogInterval, "watchdog-interval", 0, "how often to check the window title for a frozen browser; 0 disables the watchdog")
+	flag.DurationVar(&cfg.WatchdogStale, "watchdog-stale", 15*time.Second, "how long the title may stay unchanged after a navigation before /health reports the browser frozen")
+	flag.StringVar(&cfg.CalibrationFile, "calibration-file", envOr("CALIBRATION_FILE", ""), "save the board calibration to this JSON file and restore it at startup; with -sessions each session gets name.<session>.json (env CALIBRATION_FILE)")
+	flag.StringVar(&cfg.StartURL, "start-url", envOr("START_URL", ""), "URL to open once the server is listening (env START_URL)")
+	flag.BoolVar(&cfg.LaunchOnStart, "launch-on-start", false, "launch Firefox at startup, on -start-url if set, and report /ready only once its window can take input")
+	flag.BoolVar(&cfg.AutoLaunch, "auto-launch", true, "have /open start Firefox on the URL when it isn't running, on every platform; with -auto-launch=false /open fails with BROWSER_NOT_RUNNING instead, for setups that require a browser started by hand")
+	flag.BoolVar(&cfg.ReadyGate, "ready-gate", false, "with -launch-on-start, refuse requests other than GET with 503 until the startup launch is done")
+	flag.StringVar(&cfg.PinURL, "pin-url", envOr("PIN_URL", ""), "only let /open navigate to this URL or pages under its path; others get 403, or the pin itself with -pin-redirect (env PIN_URL)")
+	flag.BoolVar(&cfg.PinRedirect, "pin-redirect", false, "with -pin-url, navigate to the pin instead of refusing other URLs")
+	flag.BoolVar(&cfg.RestoreFocus, "restore-focus", false, "after actions that focus Firefox, give focus back to the previously active window")
+	focusSettle := flag.String("focus-settle", envOr("FOCUS_SETTLE", "0"), "how long to wait after activating the browser window before sending input, up to 1s, for compositors that need a moment after reporting the window active; one duration or os=duration pairs such as \"linux=30ms,windows=50ms\" (env FOCUS_SETTLE)")
+	flag.DurationVar(&cfg.MinActionInterval, "min-action-interval", 0, "minimum gap between actions that focus Firefox, such as 500ms; a request arriving sooner waits instead of being refused; 0 disables")
+	flag.BoolVar(&cfg.CheckScreenLock, "check-screen-lock", false, "check the screen isn't locked or blanked by a screensaver before each action that sends input, failing with SCREEN_LOCKED instead of playing into the lock screen")
+	flag.BoolVar(&cfg.WakeScreen, "wake-screen", false, "when -check-screen-lock finds a screensaver or a display in power saving, try to wake it before failing; a locked screen still fails")
+	flag.BoolVar(&cfg.RecoverCrashedTab, "recover-crashed-tab", false, "before each action that sends input, check whether the tab crashed and restore it, reopening the game URL when restoring fails, before going on; fails with TAB_CRASHED when the tab can't be restored")
+	flag.BoolVar(&cfg.CheckChallenge, "check-challenge", false, "check for a CAPTCHA or bot-challenge page after each /open and before each action that sends input, failing with CHALLENGE instead of typing into it")
+	flag.BoolVar(&cfg.VerifyBoard, "verify-board", false, "after each /open, wait for the board to render (the site's board element with the marionette backend, two square shades in the calibrated region natively), reloading once before failing with BOARD_NOT_LOADED; requests may override it with verify_board")
+	flag.DurationVar(&cfg.BoardLoadTimeout, "board-load-timeout", 10*time.Second, "how long -verify-board waits for the board before reloading, and again after")
+	flag.DurationVar(&cfg.ScreenshotInterval, "screenshot-min-interval", 0, "least time between two screen captures, such as 200ms; requests within it share the last capture, and input clears it; 0 captures for every request")
+	flag.BoolVar(&cfg.MatchWindow, "match-window", false, "with several browser windows open, such as one per session, focus the one showing this session's game: with the marionette backend the tab whose URL matches the last /open or -pin-url, found by its title, otherwise the window focused last; Linux and Windows only")
+	flag.StringVar(&cfg.WindowID, "window-id", envOr("WINDOW_ID", ""), "window id -match-window always focuses, as /list-windows reports it (env WINDOW_ID)")
+	flag.BoolVar(&cfg.WindowInput, "window-input", false, "on Linux with xdotool, send keys to the Firefox window with --window instead of activating it; mouse input still needs the board visible")
+	flag.Func("dialog-region", "screen region x,y,width,height whose color shows the post-game dialog is open (native backend)", func(s string) (err error) {
+		cfg.DialogRegion, err = parseRect(s)
+		return err
+	})
+	flag.StringVar(&cfg.DialogColor, "dialog-color", "", "#rrggbb average color of -dialog-region while the dialog is open")
+	flag.IntVar(&cfg.DialogTolerance, "dialog-tolerance", 24, "per-channel tolerance when matching -dialog-color")
+	flag.Func("dialog-click", "screen point x,y to click to dismiss the dialog (default: center of -dialog-region)", func(s string) (err error) {
+		cfg.DialogClick, err = parsePoint(s)
+		return err
+	})
+	flag.IntVar(&cfg.LabelInset, "label-inset", 0, "percent of a square, up to 40, that clicks on edge squares move away from the board edges in -label-edges, for themes drawing coordinate labels inside the edge squares; 0 clicks square centers")
+	labelEdges := flag.String("label-edges", envOr("LABEL_EDGES", "left,right,top,bottom"), "comma-separated board edges, as seen on screen, whose squares carry coordinate labels for -label-inset (env LABEL_EDGES)")
+	flag.Float64Var(&cfg.OccupancyThreshold, "occupancy-threshold", 0.1, "fraction of a square's middle that must differ from the square's background for /board-state to report a piece there; requests may override it with ?threshold=")
+	flag.IntVar(&cfg.SquareInset, "square-inset", 0, "pixels to keep clear of each square's edges: screenshot checks sample inside them, and /move-by-pixels refuses points that close to the edge between two squares")
+	offerFile := flag.String("offer-file", envOr("OFFER_FILE", ""), "JSON file mapping \"draw\" and \"rematch\" to how /offer-response finds them natively: {\"region\":{\"x\":0,\"y\":0,\"width\":0,\"height\":0},\"color\":\"#rrggbb\",\"tolerance\":24,\"accept\":{\"x\":0,\"y\":0},\"decline\":{\"x\":0,\"y\":0}} (env OFFER_FILE)")
+	flag.Parse()
+	for _, cn := range strings.Split(*tlsClientCNs, ",") {
+		if cn = strings.TrimSpace(cn); cn != "" {
+			cfg.TLSClientCNs = append(cfg.TLSClientCNs, cn)
+		}
+	}
+	if len(cfg.CommandEnv) == 0 {
+		for _, v := range strings.Split(os.Getenv("COMMAND_ENV"), ",") {
+			if v = strings.TrimSpace(v); v == "" {
+				continue
+			}
+			if err := checkEnvVar(v); err != nil {
+				return nil, fmt.Errorf("invalid COMMAND_ENV: %v", err)
+			}
+			cfg.CommandEnv = append(cfg.CommandEnv, v)
+		}
+	}
+	for _, name := range strings.Split(*redactParams, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			cfg.RedactParams = append(cfg.RedactParams, name)
+		}
+	}
+	if cfg.ConfirmMoves, err = parseConfirmMoves(*confirmMoves); err != nil {
+		return nil, fmt.Errorf("invalid -confirm-moves: %v", err)
+	}
+	if err := checkPlayingColor(cfg.PlayingColor); err != nil {
+		return nil, fmt.Errorf("invalid -playing-color %q: %v", cfg.PlayingColor, err)
+	}
+	switch cfg.OrientationCheck {
+	case orientationCheckOff, orientationCheckCorrect, orientationCheckError:
+	default:
+		return nil, fmt.Errorf("invalid -orientation-check %q: use %s, %s or %s", cfg.OrientationCheck, orientationCheckOff, orientationCheckCorrect, orientationCheckError)
+	}
+	if cfg.MoveStyles, err = parseMoveStyles(*moveStyle); err != nil {
+		return nil, fmt.Errorf("invalid -move-style: %v", err)
+	}
+	if cfg.MoveStyles[""] == moveStyleKeyboard && cfg.Backend == backendNative && cfg.MoveInputClick == (point{}) {
+		return nil, fmt.Errorf("-move-style keyboard needs -move-input-click with the native backend")
+	}
+	for _, mode := range cfg.ConfirmMoves {
+		if mode == confirmButton && cfg.ConfirmButton == (point{}) {
+			return nil, fmt.Errorf("-confirm-moves button needs -confirm-button")
+		}
+	}
+	if *basicAuth != "" || *basicAuthFile != "" {
+		cfg.BasicAuth = make(map[string]string)
+	}
+	if *basicAuth != "" {
+		if err := parseBasicAuth(cfg.BasicAuth, *basicAuth); err != nil {
+			return nil, fmt.Errorf("invalid -basic-auth: %v", err)
+		}
+	}
+	if *basicAuthFile != "" {
+		if err := loadHtpasswd(*basicAuthFile, cfg.BasicAuth); err != nil {
+			return nil, fmt.Errorf("invalid -basic-auth-file: %v", err)
+		}
+		if len(cfg.BasicAuth) == 0 {
+			return nil, fmt.Errorf("invalid -basic-auth-file: no users")
+		}
+	}
+	if *newGameFile != "" {
+		if cfg.NewGame, err = loadNewGameSequences(*newGameFile); err != nil {
+			return nil, fmt.Errorf("invalid -new-game-file: %v", err)
+		}
+	}
+	if *offerFile != "" {
+		if cfg.Offers, err = loadOffers(*offerFile); err != nil {
+			return nil, fmt.Errorf("invalid -offer-file: %v", err)
+		}
+	}
+	if *afterNavigateFile != "" {
+		if cfg.AfterNavigate, err = loadAfterNavigate(*afterNavigateFile); err != nil {
+			return nil, fmt.Errorf("invalid -after-navigate-file: %v", err)
+		}
+	}
+	if *timeControlFile != "" {
+		if cfg.TimeControls, err = loadTimeControls(*timeControlFile); err != nil {
+			return nil, fmt.Errorf("invalid -time-control-file: %v", err)
+		}
+	}
+	if *keyMap != "" {
+		if cfg.KeyMap, err = loadKeyMap(*keyMap); err != nil {
+			return nil, fmt.Errorf("invalid -key-map: %v", err)
+		}
+	}
+	if cfg.AllowedDomains, err = parseDomainList(*allowedDomains); err != nil {
+		return nil, fmt.Errorf("invalid -allowed-domains: %v", err)
+	}
+	if cfg.PinURL != "" {
+		if cfg.PinURL, err = normalizeURL(cfg.PinURL); err != nil {
+			return nil, fmt.Errorf("invalid -pin-url: %v", err)
+		}
+		if urlHost(cfg.PinURL) == "" {
+			return nil, fmt.Errorf("invalid -pin-url: %s has no host", cfg.PinURL)
+		}
+	} else if cfg.PinRedirect {
+		return nil, fmt.Errorf("-pin-redirect needs -pin-url")
+	}
+	if cfg.ReadyGate && !cfg.LaunchOnStart {
+		return nil, fmt.Errorf("-ready-gate needs -launch-on-start")
+	}
+	if cfg.BasePixelRatio <= 0 {
+		return nil, fmt.Errorf("-base-pixel-ratio must be positive")
+	}
+	switch cfg.TypeMode {
+	case typeModeType, typeModeKeysym, typeModeAuto:
+	default:
+		return nil, fmt.Errorf("invalid -type-mode %q: use %s, %s or %s", cfg.TypeMode, typeModeType, typeModeKeysym, typeModeAuto)
+	}
+	for _, name := range strings.Split(*inputTools, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			cfg.InputTools = append(cfg.InputTools, name)
+		}
+	}
+	for _, name := range strings.Split(*screenshotTools, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			cfg.ScreenshotTools = append(cfg.ScreenshotTools, name)
+		}
+	}
+	if *screenshotCommand != "" {
+		if cfg.ScreenshotCommand, err = parseScreenshotCommand(*screenshotCommand); err != nil {
+			return nil, fmt.Errorf("invalid -screenshot-command: %v", err)
+		}
+	}
+	cfg.Timeouts = map[string]time.Duration{
+		timeoutNavigation: navTimeout,
+		timeoutClick:      clickTimeout,
+		timeoutScreenshot: shotTimeout,
+		timeoutWait:       waitTimeout,
+	}
+
+	if cfg.BoardPollInterval <= 0 {
+		return nil, fmt.Errorf("invalid -board-poll-interval: must be positive")
+	}
+	if (cfg.Golden != "" || cfg.UpdateGolden) && cfg.ReplayCommands == "" {
+		return nil, fmt.Errorf("-golden and -update-golden need -replay-commands")
+	}
+	if cfg.UpdateGolden && cfg.Golden == "" {
+		return nil, fmt.Errorf("-update-golden needs -golden")
+	}
+	if cfg.FocusSettle, err = parseFocusSettle(*focusSettle, runtime.GOOS); err != nil {
+		return nil, fmt.Errorf("invalid -focus-settle: %v", err)
+	}
+	if cfg.MinActionInterval < 0 {
+		return nil, fmt.Errorf("invalid -min-action-interval: must not be negative")
+	}
+	if cfg.LaunchRetries < 0 {
+		return nil, fmt.Errorf("invalid -launch-retries: must not be negative")
+	}
+	if cfg.LabelInset < 0 || cfg.LabelInset > 40 {
+		return nil, fmt.Errorf("invalid -label-inset: must be between 0 and 40")
+	}
+	if cfg.LabelEdges, err = parseLabelEdges(*labelEdges); err != nil {
+		return nil, fmt.Errorf("invalid -label-edges: %v", err)
+	}
+	if cfg.OccupancyThreshold <= 0 || cfg.OccupancyThreshold >= 1 {
+		return nil, fmt.Errorf("invalid -occupancy-threshold: must be between 0 and 1")
+	}
+	if cfg.SquareInset < 0 {
+		return nil, fmt.Errorf("invalid -square-inset: must not be negative")
+	}
+	if cfg.GzipMinSize < 0 {
+		return nil, fmt.Errorf("invalid -gzip-min-size: must not be negative")
+	}
+	if cfg.ShutdownTimeout < 0 {
+		return nil, fmt.Errorf("invalid -shutdown-timeout: must not be negative")
+	}
+	if cfg.PlayMovesDelay < 0 {
+		return nil, fmt.Errorf("invalid -play-moves-delay: must not be negative")
+	}
+	if cfg.ScreenshotInterval < 0 {
+		return nil, fmt.Errorf("invalid -screenshot-min-interval: must not be negative")
+	}
+	if cfg.BoardLoadTimeout <= 0 {
+		return nil, fmt.Errorf("invalid -board-load-timeout: must be positive")
+	}
+	if cfg.LaunchRetryDelay < 0 {
+		return nil, fmt.Errorf("invalid -launch-retry-delay: must not be negative")
+	}
+	if cfg.VerifyURLRetries < 0 {
+		return nil, fmt.Errorf("invalid -verify-url-retries: must not be negative")
+	}
+	if cfg.VerifyURLRetries > 0 && cfg.Backend != backendMarionette {
+		return nil, fmt.Errorf("-verify-url-retries needs -backend marionette to read the browser's URL")
+	}
+	if cfg.RecentScreenshots < 0 {
+		return nil, fmt.Errorf("invalid -recent-screenshots: must not be negative")
+	}
+	if cfg.MoveRetryBudget < -1 {
+		return nil, fmt.Errorf("invalid -move-retry-budget: must be -1 or more")
+	}
+	if cfg.MoveDeadline < 0 {
+		return nil, fmt.Errorf("invalid -move-deadline: must not be negative")
+	}
+	if cfg.DragSteps < 0 {
+		return nil, fmt.Errorf("invalid -drag-steps: must not be negative")
+	}
+	if cfg.Sessions, err = parseSessions(*sessions); err != nil {
+		return nil, fmt.Errorf("invalid -sessions: %v", err)
+	}
+	if cfg.ProfileDir != "" {
+		if cfg.ProfileDir, err = filepath.Abs(cfg.ProfileDir); err != nil {
+			return nil, fmt.Errorf("invalid -profile-dir: %v", err)
+		}
+		if err := os.MkdirAll(cfg.ProfileDir, 0o700); err != nil {
+			return nil, fmt.Errorf("failed to create -profile-dir: %v", err)
+		}
+	}
+	if *useAutomationPrefs || *prefsFile != "" {
+		if cfg.ProfileDir == "" {
+			return nil, fmt.Errorf("-automation-prefs and -prefs-file need -profile-dir: preferences are only written to a profile the controller manages")
+		}
+		cfg.Prefs = map[string]string{}
+		if *useAutomationPrefs {
+			for name, v := range automationPrefs {
+				cfg.Prefs[name] = v
+			}
+		}
+		if *prefsFile != "" {
+			prefs, err := loadPrefs(*prefsFile)
+			if err != nil {
+				return nil, fmt.Errorf("invalid -prefs-file: %v", err)
+			}
+			for name, v := range prefs {
+				cfg.Prefs[name] = v
+			}
+		}
+	}
+	if err := validateLaunchArgs(cfg.LaunchArgs); err != nil {
+		return nil, fmt.Errorf("invalid launch args: %v", err)
+	}
+
+	switch cfg.Backend {
+	case backendNative, backendMarionette:
+	default:
+		return nil, fmt.Errorf("unknown backend %q", cfg.Backend)
+	}
+	if err := validateBrowser(cfg); err != nil {
+		return nil, err
+	}
+	if err := checkConfigConflicts(cfg); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// secretFlags are the flags /config reports as set without their values
+var secretFlags = map[string]bool{
+	"api-key":         true,
+	"basic-auth":      true,
+	"basic-auth-file": true,
+	"tls-key":         true,
+}
+
+// redactedValue stands in for a secret flag's value
+const redactedValue = "REDACTED"
+
+// EffectiveConfig is what the flags resolved to for this controller, which
+// differs between -sessions
+type EffectiveConfig struct {
+	OS             string            `json:"os"`
+	Backend        string            `json:"backend"`
+	MarionetteAddr string            `json:"marionette_addr,omitempty"`
+	Browser        string            `json:"browser"`
+	BrowserBin     string            `json:"browser_bin"`
+	ProfileDir     string            `json:"profile_dir,omitempty"`
+	Display        string            `json:"display,omitempty"`
+	CommandEnv     []string          `json:"command_env,omitempty"` // names of the -command-env variables, without their values
+	Monitor        *Monitor          `json:"monitor,omitempty"`
+	InputTool      string            `json:"input_tool,omitempty"`      // Linux only
+	ScreenshotTool string            `json:"screenshot_tool,omitempty"` // Linux only
+	Timeouts       map[string]string `json:"timeouts"`                  // by endpoint category
+	Auth           []string          `json:"auth"`                      // the credentials accepted: api_key, basic, client_cert
+	TLS            bool              `json:"tls"`
+	HTTPAddr       string            `json:"http_addr,omitempty"`
+	AllowedDomains []string          `json:"allowed_domains,omitempty"`
+	PinURL         string            `json:"pin_url,omitempty"`
+	PlayingColor   string            `json:"playing_color,omitempty"`
+	Calibration    *Calibration      `json:"calibration,omitempty"`
+}
+
+// ConfigResponse is the Response for /config
+type ConfigResponse struct {
+	Response
+	// Flags holds every flag's value after environment fallbacks, secrets
+	// replaced by REDACTED when set; files such as -new-game-file are named
+	// by path
+	Flags     map[string]string `json:"flags"`
+	Effective EffectiveConfig   `json:"effective"`
+}
+
+// handleConfig reports the configuration the controller is running with,
+// for checking a deployment without inferring it from behavior
+func (c *Controller) handleConfig(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "Only GET method is allowed")
+		return
+	}
+
+	flags := map[string]string{}
+	flag.VisitAll(func(f *flag.Flag) {
+		value := f.Value.String()
+		if secretFlags[f.Name] && value != "" {
+			value = redactedValue
+		}
+		flags[f.Name] = redact(value)
+	})
+	// flag.Func flags have no value to report, so they come from the config
+	for name, value := range c.funcFlagValues() {
+		flags[name] = redact(value)
+	}
+
+	eff := EffectiveConfig{
+		OS:             runtime.GOOS,
+		Backend:        c.cfg.Backend,
+		Browser:        targetBrowser.name,
+		BrowserBin:     c.firefoxBin(),
+		ProfileDir:     c.cfg.ProfileDir,
+		Display:        c.cfg.Display,
+		Monitor:        c.dev.monitor,
+		Timeouts:       map[string]string{},
+		Auth:           []string{},
+		TLS:            c.cfg.TLSCert != "",
+		HTTPAddr:       c.cfg.HTTPAddr,
+		AllowedDomains: c.cfg.AllowedDomains,
+		PinURL:         redact(c.cfg.PinURL),
+		PlayingColor:   c.playingColor(),
+	}
+	eff.CommandEnv = c.commandEnvNames()
+	if c.marionette != nil {
+		eff.MarionetteAddr = c.cfg.MarionetteAddr
+	}
+	if runtime.GOOS == "linux" {
+		eff.InputTool = c.dev.input.name()
+		eff.ScreenshotTool = c.dev.screenshot.name
+	}
+	for _, category := range []string{timeoutNavigation, timeoutClick, timeoutScreenshot, timeoutWait} {
+		eff.Timeouts[category] = c.timeoutFor(category).String()
+	}
+	if c.cfg.APIKey != "" {
+		eff.Auth = append(eff.Auth, "api_key")
+	}
+	if len(c.cfg.BasicAuth) > 0 {
+		eff.Auth = append(eff.Auth, "basic")
+	}
+	if c.cfg.TLSClientCA != "" {
+		eff.Auth = append(eff.Auth, "client_cert")
+	}
+	sort.Strings(eff.Auth)
+	if cal, ok := c.calibration(); ok {
+		eff.Calibration = &cal
+	}
+
+	writeJSON(w, http.StatusOK, ConfigResponse{
+		Response:  Response{Success: true, Message: "Configuration of the " + c.cfg.Backend + " backend"},
+		Flags:     flags,
+		Effective: eff,
+	})
+}
+
+// funcFlagValues returns the values of the flags defined with flag.Func,
+// as the flags would set them; -command-env only by variable name
+func (c *Controller) funcFlagValues() map[string]string {
+	values := map[string]string{
+		"launch-args": joinArgs(c.cfg.LaunchArgs),
+		"command-env": strings.Join(c.commandEnvNames(), ","),
+	}
+	for name, p := range map[string]point{
+		"confirm-button":   c.cfg.ConfirmButton,
+		"move-input-click": c.cfg.MoveInputClick,
+		"abort-click":      c.cfg.AbortClick,
+		"dialog-click":     c.cfg.DialogClick,
+	} {
+		values[name] = ""
+		if p != (point{}) {
+			values[name] = fmt.Sprintf("%d,%d", p.X, p.Y)
+		}
+	}
+	for name, r := range map[string]rect{
+		"ocr-region":    c.cfg.OCRRegion,
+		"dialog-region": c.cfg.DialogRegion,
+	} {
+		values[name] = ""
+		if !r.empty() {
+			values[name] = r.String()
+		}
+	}
+	return values
+}
+
+// commandEnvNames returns the names of the -command-env variables, whose
+// values may be secrets
+func (c *Controller) commandEnvNames() []string {
+	var names []string
+	for _, v := range c.cfg.CommandEnv {
+		name, _, _ := strings.Cut(v, "=")
+		names = append(names, name)
+	}
+	return names
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestConfigReportsFuncFlags(t *testing.T) {
+	c := newController(&Config{
+		APIKey:        testAPIKey,
+		LaunchArgs:    []string{"--width", "1280", "--class", "my browser"},
+		CommandEnv:    []string{"MOZ_ENABLE_WAYLAND=1", "TOKEN=hunter2"},
+		ConfirmButton: point{X: 640, Y: 820},
+		OCRRegion:     rect{X: 1, Y: 2, Width: 300, Height: 400},
+	})
+	rec := serveWithKey(c, http.MethodGet, "/config", "")
+	var resp ConfigResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("/config: %v: %s", err, rec.Body)
+	}
+	want := map[string]string{
+		"launch-args":      "--width 1280 --class 'my browser'",
+		"command-env":      "MOZ_ENABLE_WAYLAND,TOKEN",
+		"confirm-button":   "640,820",
+		"move-input-click": "",
+		"ocr-region":       "1,2,300,400",
+		"dialog-region":    "",
+	}
+	for name, value := range want {
+		if got, ok := resp.Flags[name]; !ok || got != value {
+			t.Errorf("flag %s = %q, want %q", name, got, value)
+		}
+	}
+}
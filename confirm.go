@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Move confirmation modes for -confirm-moves
+const (
+	confirmOff         = "off"
+	confirmDestination = "destination" // click the destination square again
+	confirmButton      = "button"      // click -confirm-button
+)
+
+// confirmDelay leaves time for the site to show its confirmation state
+const confirmDelay = 150 * time.Millisecond
+
+// parseConfirmMoves parses -confirm-moves: either one mode for every site
+// or comma-separated site=mode pairs such as "lichess=destination". The
+// mode for all sites is stored under the empty name.
+func parseConfirmMoves(s string) (map[string]string, error) {
+	modes := map[string]string{}
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		site, mode, ok := strings.Cut(part, "=")
+		if !ok {
+			site, mode = "", part
+		}
+		switch mode {
+		case confirmOff, confirmDestination, confirmButton:
+		default:
+			return nil, fmt.Errorf("unknown mode %q; use %s, %s or %s", mode, confirmOff, confirmDestination, confirmButton)
+		}
+		if site != "" && siteByName(site) == nil {
+			return nil, fmt.Errorf("unknown site %q", site)
+		}
+		modes[site] = mode
+	}
+	return modes, nil
+}
+
+// siteByName returns the built-in site profile with the given name, or nil
+func siteByName(name string) *siteProfile {
+	for _, site := range siteProfiles {
+		if site.Name == name {
+			return site
+		}
+	}
+	return nil
+}
+
+// confirmMode returns the confirmation mode for the current page. Per-site
+// modes need the marionette backend to know the site.
+func (c *Controller) confirmMode(ctx context.Context) string {
+	modes := c.cfg.ConfirmMoves
+	if c.marionette != nil && len(modes) > 0 {
+		if site, _, err := c.currentSite(ctx); err == nil && site != nil {
+			if mode, ok := modes[site.Name]; ok {
+				return mode
+			}
+		}
+	}
+	if mode, ok := modes[""]; ok {
+		return mode
+	}
+	return confirmOff
+}
+
+// confirmMove performs the confirmation interaction after a move to dest
+func (c *Controller) confirmMove(ctx context.Context, mode string, dest point) error {
+	if mode == confirmOff {
+		return nil
+	}
+	select {
+	case <-time.After(confirmDelay):
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	target := dest
+	if mode == confirmButton {
+		target = c.cfg.ConfirmButton
+	}
+	if err := mouseClick(ctx, target, buttonLeft); err != nil {
+		return fmt.Errorf("failed to confirm move: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+)
+
+// flagChanged reports whether a flag differs from its default, whether it
+// was given on the command line or through its environment fallback
+func flagChanged(name string) bool {
+	f := flag.Lookup(name)
+	return f != nil && f.Value.String() != f.DefValue
+}
+
+// configConflicts checks the settings against each other. Conflicts make
+// the configuration unusable; warnings are settings that have no effect or
+// probably don't do what was meant, which the controller runs with.
+func configConflicts(cfg *Config) (conflicts, warnings []string) {
+	if (cfg.TLSCert == "") != (cfg.TLSKey == "") {
+		conflicts = append(conflicts, "-tls-cert and -tls-key must be set together")
+	}
+	if cfg.TLSClientCA != "" && cfg.TLSCert == "" {
+		conflicts = append(conflicts, "-tls-client-ca needs -tls-cert")
+	}
+	if len(cfg.TLSClientCNs) > 0 && cfg.TLSClientCA == "" {
+		conflicts = append(conflicts, "-tls-client-cns needs -tls-client-ca")
+	}
+	if cfg.HTTPAddr != "" && cfg.TLSCert == "" {
+		conflicts = append(conflicts, "-http-addr needs -tls-cert, as -port already serves plain HTTP")
+	}
+	allowed := &Controller{cfg: cfg}
+	if cfg.PinURL != "" && len(cfg.AllowedDomains) > 0 {
+		if _, ok := allowed.allowedDomain(urlHost(cfg.PinURL)); !ok {
+			conflicts = append(conflicts, fmt.Sprintf("-pin-url %s is outside -allowed-domains", cfg.PinURL))
+		}
+	}
+	if cfg.StartURL != "" && len(cfg.AllowedDomains) > 0 {
+		if _, ok := allowed.allowedDomain(urlHost(cfg.StartURL)); !ok {
+			conflicts = append(conflicts, fmt.Sprintf("-start-url %s is outside -allowed-domains", cfg.StartURL))
+		}
+	}
+
+	if len(cfg.BasicAuth) > 0 && cfg.TLSCert == "" {
+		warnings = append(warnings, "-basic-auth sends passwords in the clear without -tls-cert")
+	}
+	if host, _, err := net.SplitHostPort(cfg.HTTPAddr); err == nil && !loopbackHost(host) {
+		warnings = append(warnings, fmt.Sprintf("-http-addr %s serves plain HTTP beyond this machine", cfg.HTTPAddr))
+	}
+	if cfg.ProfileDir != "" && cfg.Profile != "" {
+		warnings = append(warnings, "-profile is ignored, as -profile-dir overrides it")
+	}
+	if cfg.Backend == backendNative {
+		if flagChanged("kiosk") && cfg.Kiosk {
+			warnings = append(warnings, "-kiosk with the native backend types URLs blind after Ctrl+L, as there is no address bar; use -backend marionette to navigate")
+		}
+		if cfg.OrientationCheck != orientationCheckOff {
+			warnings = append(warnings, "-orientation-check has no effect with the native backend, which can't read the page's orientation")
+		}
+	} else if cfg.MoveInputClick != (point{}) {
+		warnings = append(warnings, "-move-input-click is unused with the marionette backend, which focuses the move input by selector")
+	}
+	if cfg.WindowID != "" && !cfg.MatchWindow {
+		warnings = append(warnings, "-window-id has no effect without -match-window")
+	}
+	if cfg.WakeScreen && !cfg.CheckScreenLock {
+		warnings = append(warnings, "-wake-screen has no effect without -check-screen-lock")
+	}
+	if !cfg.Gzip && flagChanged("gzip-min-size") {
+		warnings = append(warnings, "-gzip-min-size has no effect without -gzip")
+	}
+	usesButton := false
+	for _, mode := range cfg.ConfirmMoves {
+		usesButton = usesButton || mode == confirmButton
+	}
+	if cfg.ConfirmButton != (point{}) && !usesButton {
+		warnings = append(warnings, "-confirm-button is unused unless -confirm-moves is button for some site")
+	}
+	return conflicts, warnings
+}
+
+// checkConfigConflicts fails with every conflict found at once, and logs
+// each warning
+func checkConfigConflicts(cfg *Config) error {
+	conflicts, warnings := configConflicts(cfg)
+	for _, w := range warnings {
+		log.Printf("config warning: %s", w)
+	}
+	switch len(conflicts) {
+	case 0:
+		return nil
+	case 1:
+		return fmt.Errorf("conflicting settings: %s", conflicts[0])
+	}
+	return fmt.Errorf("%d conflicting settings:\n  %s", len(conflicts), strings.Join(conflicts, "\n  "))
+}
+
+// loopbackHost reports whether a listen host only takes connections from
+// this machine; an empty host listens on every interface
+func loopbackHost(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
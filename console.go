@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// consoleBufferSize bounds the console entries kept since the last navigation
+const consoleBufferSize = 500
+
+// ConsoleEntry is one console message or uncaught error from the page
+type ConsoleEntry struct {
+	Level   string    `json:"level"` // log, info, warn, error, debug or exception
+	Message string    `json:"message"`
+	Time    time.Time `json:"time"`
+}
+
+// ConsoleLogsResponse is the Response for /console-logs
+type ConsoleLogsResponse struct {
+	Response
+	Entries []ConsoleEntry `json:"entries"`
+	Dropped int            `json:"dropped"` // older entries discarded to stay within the buffer
+	Hooked  bool           `json:"hooked"`  // the hook was just installed, so earlier messages were missed
+}
+
+// consoleLog is the server-side ring buffer of console entries
+type consoleLog struct {
+	mu      sync.Mutex
+	entries []ConsoleEntry
+	dropped int
+}
+
+func (l *consoleLog) add(entries []ConsoleEntry) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries = append(l.entries, entries...)
+	if over := len(l.entries) - consoleBufferSize; over > 0 {
+		l.entries = append([]ConsoleEntry(nil), l.entries[over:]...)
+		l.dropped += over
+	}
+}
+
+// reset empties the buffer, after a navigation
+func (l *consoleLog) reset() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries = nil
+	l.dropped = 0
+}
+
+func (l *consoleLog) snapshot() ([]ConsoleEntry, int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]ConsoleEntry{}, l.entries...), l.dropped
+}
+
+// consoleScript installs a hook recording console calls and uncaught errors
+// on the page if it isn't there yet, then drains what it recorded. Marionette
+// has no console event stream, so messages logged before the hook was
+// installed on a page can't be recovered.
+const consoleScript = `
+const key = '__browserControllerConsole';
+const limit = arguments[0];
+let hooked = false;
+if (!window[key]) {
+	hooked = true;
+	const buffer = window[key] = [];
+	const push = (level, args) => {
+		const message = Array.from(args).map(a => {
+			if (a instanceof Error) { return a.stack || String(a); }
+			if (typeof a === 'object') { try { return JSON.stringify(a); } catch (e) { return String(a); } }
+			return String(a);
+		}).join(' ');
+		buffer.push({level: level, message: message, time: new Date().toISOString()});
+		if (buffer.length > limit) { buffer.shift(); }
+	};
+	for (const level of ['log', 'info', 'warn', 'error', 'debug']) {
+		const original = console[level];
+		console[level] = function() { push(level, arguments); return original.apply(console, arguments); };
+	}
+	window.addEventListener('error', e => push('exception', [e.error || e.message]));
+	window.addEventListener('unhandledrejection', e => push('exception', ['Unhandled rejection:', e.reason]));
+}
+const entries = window[key].splice(0);
+return {hooked: hooked, entries: entries};`
+
+// handleConsoleLogs returns the page's console messages since the last navigation
+func (c *Controller) handleConsoleLogs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "Only GET method is allowed")
+		return
+	}
+	if c.marionette == nil {
+		writeError(w, http.StatusNotImplemented, "Reading console logs requires the marionette backend")
+		return
+	}
+
+	var result struct {
+		Hooked  bool           `json:"hooked"`
+		Entries []ConsoleEntry `json:"entries"`
+	}
+	if err := c.marionette.ExecuteScript(r.Context(), consoleScript, []interface{}{consoleBufferSize}, &result); err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to read console logs: %v", err))
+		return
+	}
+	c.console.add(result.Entries)
+	entries, dropped := c.console.snapshot()
+
+	message := fmt.Sprintf("%d console entries since the last navigation", len(entries))
+	if result.Hooked {
+		message += "; the console hook was just installed on this page, so earlier messages were missed"
+	}
+	writeJSON(w, http.StatusOK, ConsoleLogsResponse{
+		Response: Response{Success: true, Message: message},
+		Entries:  entries,
+		Dropped:  dropped,
+		Hooked:   result.Hooked,
+	})
+}
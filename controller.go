@@ -0,0 +1,341 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"time"
+)
+
+// Controller ties the configuration to the browser backend and serves the HTTP API
+type Controller struct {
+	cfg        *Config
+	marionette *marionetteClient // nil when using the native keystroke backend
+	mux        http.Handler
+
+	// cmdLock is the command mutex: it serializes everything that drives the
+	// browser. It is a channel so waiting for it can give up with the request.
+	cmdLock     chan struct{}
+	recorder    macroRecorder
+	state       stateStore
+	queue       queueStats
+	watchdog    watchdog
+	debounce    navDebouncer
+	events      eventHub
+	launch      launchGuard
+	console     consoleLog
+	readiness   readiness
+	pacer       focusPacer
+	recentShots screenshotRing
+	jobs        jobTracker
+	pause       pauseState
+	window      gameWindow // the window -match-window focuses
+	dev         *devices   // the input and screenshot tools for this display
+	clipboard   clipboardState
+}
+
+func newController(cfg *Config) *Controller {
+	c := &Controller{
+		cfg:       cfg,
+		cmdLock:   make(chan struct{}, 1),
+		readiness: readiness{starting: cfg.LaunchOnStart},
+		dev:       newDevices(),
+	}
+	if cfg.Backend == backendMarionette {
+		c.marionette = newMarionetteClient(cfg.MarionetteAddr)
+	}
+	c.loadSavedCalibration()
+	c.mux = c.routes()
+	return c
+}
+
+// errCommandTimeout is returned by command when the request's timeout expires
+var errCommandTimeout = errors.New("command timed out")
+
+// lock acquires the command mutex for the task name, giving up when ctx is done
+func (c *Controller) lock(ctx context.Context, name string) error {
+	defer timeStep(ctx, "lock_wait")()
+	select {
+	case c.cmdLock <- struct{}{}:
+		c.queue.acquired(name, false)
+		traceStep(ctx, "lock", "acquired for "+name)
+		return nil
+	default:
+	}
+
+	c.queue.wait()
+	start := time.Now()
+	select {
+	case c.cmdLock <- struct{}{}:
+		c.queue.acquired(name, true)
+		traceStep(ctx, "lock", fmt.Sprintf("waited %dms for %s", time.Since(start).Milliseconds(), name))
+		return nil
+	case <-ctx.Done():
+		c.queue.gaveUp()
+		return ctx.Err()
+	}
+}
+
+func (c *Controller) unlock() {
+	c.queue.released()
+	<-c.cmdLock
+}
+
+// lockHeldKey marks requests dispatched internally (macro replay, /batch)
+// by a caller that already holds the command mutex
+type lockHeldKey struct{}
+
+// command runs fn with the command mutex held. Internally dispatched
+// requests already hold it, so they run fn directly. A delay_ms on the
+// request is waited first, inside the mutex. If the request context times
+// out, while waiting or running, errCommandTimeout is returned.
+func (c *Controller) command(r *http.Request, fn func() error) error {
+	ctx := r.Context()
+	if ctx.Value(lockHeldKey{}) == nil {
+		if err := c.lock(ctx, r.URL.Path); err != nil {
+			if err == context.DeadlineExceeded {
+				return errCommandTimeout
+			}
+			return err
+		}
+		defer c.unlock()
+	}
+	err := waitDelay(ctx)
+	if err == nil {
+		err = fn()
+	}
+	if err != nil && ctx.Err() == context.DeadlineExceeded {
+		return errCommandTimeout
+	}
+	return err
+}
+
+// dispatchLocked serves a POST to path with body through the API handlers,
+// for a caller that holds the command mutex, and returns the buffered response
+func (c *Controller) dispatchLocked(ctx context.Context, path string, body []byte) (*bufferedResponse, error) {
+	return c.dispatchLockedMethod(ctx, http.MethodPost, path, body)
+}
+
+// dispatchLockedMethod is dispatchLocked for any HTTP method
+func (c *Controller) dispatchLockedMethod(ctx context.Context, method, path string, body []byte) (*bufferedResponse, error) {
+	ctx = context.WithValue(ctx, lockHeldKey{}, true)
+	req, err := http.NewRequestWithContext(ctx, method, path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	rec := &bufferedResponse{header: http.Header{}, status: http.StatusOK}
+	c.mux.ServeHTTP(rec, req)
+	return rec, nil
+}
+
+// bufferedResponse is an in-memory http.ResponseWriter for internally dispatched requests
+type bufferedResponse struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (b *bufferedResponse) Header() http.Header         { return b.header }
+func (b *bufferedResponse) Write(p []byte) (int, error) { return b.body.Write(p) }
+func (b *bufferedResponse) WriteHeader(status int)      { b.status = status }
+
+// commandStatus maps an error from command to an HTTP status code
+func commandStatus(err error) int {
+	if err == errCommandTimeout {
+		return http.StatusGatewayTimeout
+	}
+	if _, ok := err.(*challengeError); ok {
+		return http.StatusConflict
+	}
+	if _, ok := err.(*screenLockError); ok {
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
+
+// Endpoint timeout categories
+const (
+	timeoutNavigation = "navigation"
+	timeoutClick      = "click"
+	timeoutScreenshot = "screenshot"
+	timeoutWait       = "wait"
+)
+
+// timeoutFor returns the configured timeout for an endpoint category,
+// falling back to the global command timeout
+func (c *Controller) timeoutFor(category string) time.Duration {
+	if d, ok := c.cfg.Timeouts[category]; ok && d > 0 {
+		return d
+	}
+	return c.cfg.CommandTimeout
+}
+
+// withTimeout bounds a handler's request context by its category timeout.
+// A "timeout" query parameter (a duration such as 5s) overrides it per request.
+func (c *Controller) withTimeout(category string, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		timeout := c.timeoutFor(category)
+		if q := r.URL.Query().Get("timeout"); q != "" {
+			d, err := time.ParseDuration(q)
+			if err != nil || d <= 0 {
+				writeError(w, http.StatusBadRequest, fmt.Sprintf("Invalid timeout %q", q))
+				return
+			}
+			timeout = d
+		}
+		if timeout <= 0 {
+			h(w, r)
+			return
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+		h(w, r.WithContext(ctx))
+	}
+}
+
+// routes registers the API handlers
+func (c *Controller) routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/open", c.async(c.debounceNavigation(c.recordable(c.withTimeout(timeoutNavigation, c.verifiable(c.handleOpenURL))))))
+	// Not recordable: macros would keep session cookie values in plain text
+	mux.HandleFunc("/cookies", c.withTimeout("", c.handleCookies))
+	mux.HandleFunc("/launch", c.async(c.recordable(c.withTimeout(timeoutNavigation, c.verifiable(c.handleLaunch)))))
+	mux.HandleFunc("/profiles", c.withTimeout("", c.handleProfiles))
+	mux.HandleFunc("/profiles/sites", c.withTimeout("", c.handleSiteProfiles))
+	mux.HandleFunc("/health", c.handleHealth)
+	mux.HandleFunc("/ready", c.handleReady)
+	mux.HandleFunc("/capabilities", c.handleCapabilities)
+	mux.HandleFunc("/config", c.handleConfig)
+	mux.HandleFunc("/status", c.withTimeout("", c.handleStatus))
+	mux.HandleFunc("/queue-status", c.handleQueueStatus)
+	mux.HandleFunc("/pause", c.withTimeout(timeoutWait, c.handlePause))
+	mux.HandleFunc("/resume", c.handleResume)
+	mux.HandleFunc("/metrics", c.handleMetrics)
+	mux.HandleFunc("/restart-browser", c.async(c.handleRestartBrowser))
+	mux.HandleFunc("/check-challenge", c.withTimeout("", c.handleCheckChallenge))
+	mux.HandleFunc("/ping", c.withTimeout(timeoutClick, c.handlePing))
+	mux.HandleFunc("/move-list", c.withTimeout("", c.handleMoveList))
+	mux.HandleFunc("/clock", c.withTimeout("", c.handleClock))
+	mux.HandleFunc("/turn", c.withTimeout("", c.handleTurn))
+	mux.HandleFunc("/result", c.withTimeout(timeoutScreenshot, c.handleResult))
+	mux.HandleFunc("/wait-for-board-stable", c.withTimeout(timeoutWait, c.handleWaitForBoardStable))
+	mux.HandleFunc("/console-logs", c.withTimeout("", c.handleConsoleLogs))
+	mux.HandleFunc("/pgn", c.withTimeout(timeoutWait, c.handlePGN))
+	mux.HandleFunc("/last-move", c.withTimeout(timeoutScreenshot, c.handleLastMove))
+	mux.HandleFunc("/recent-screenshots", c.handleRecentScreenshots)
+	mux.HandleFunc("/screenshot-element", c.withTimeout(timeoutScreenshot, c.handleScreenshotElement))
+	mux.HandleFunc("/save-screenshot", c.withTimeout(timeoutScreenshot, c.handleSaveScreenshot))
+	mux.HandleFunc("/ocr", c.withTimeout(timeoutScreenshot, c.handleOCR))
+	mux.HandleFunc("/set-window-bounds", c.async(c.recordable(c.withTimeout(timeoutClick, c.verifiable(c.handleSetWindowBounds)))))
+	mux.HandleFunc("/calibrate", c.recordable(c.handleCalibrate))
+	mux.HandleFunc("/orientation", c.recordable(c.handleOrientation))
+	mux.HandleFunc("/clear-calibration", c.recordable(c.handleClearCalibration))
+	mux.HandleFunc("/display-info", c.withTimeout("", c.handleDisplayInfo))
+	mux.HandleFunc("/zoom", c.recordable(c.withTimeout(timeoutClick, c.handleZoom)))
+	mux.HandleFunc("/auto-calibrate", c.async(c.recordable(c.handleAutoCalibrate)))
+	mux.HandleFunc("/setup", c.async(c.recordable(c.withTimeout(timeoutNavigation, c.verifiable(c.handleSetup)))))
+	mux.HandleFunc("/move", c.async(c.recordable(c.withTimeout(timeoutClick, c.verifiable(c.handleMove)))))
+	mux.HandleFunc("/human-move", c.async(c.recordable(c.withTimeout(timeoutWait, c.verifiable(c.handleHumanMove)))))
+	mux.HandleFunc("/play-moves", c.async(c.recordable(c.withTimeout(timeoutWait, c.verifiable(c.handlePlayMoves)))))
+	mux.HandleFunc("/abort-move", c.async(c.recordable(c.withTimeout(timeoutClick, c.verifiable(c.handleAbortMove)))))
+	mux.HandleFunc("/get-text", c.withTimeout("", c.handleGetText))
+	mux.HandleFunc("/square-info", c.withTimeout("", c.handleSquareInfo))
+	mux.HandleFunc("/test-square", c.withTimeout(timeoutScreenshot, c.handleTestSquare))
+	mux.HandleFunc("/board-state", c.withTimeout(timeoutScreenshot, c.handleBoardState))
+	mux.HandleFunc("/drag-square", c.async(c.recordable(c.withTimeout(timeoutClick, c.verifiable(c.handleDragSquare)))))
+	mux.HandleFunc("/move-by-pixels", c.async(c.recordable(c.withTimeout(timeoutClick, c.verifiable(c.handleMoveByPixels)))))
+	mux.HandleFunc("/fill", c.async(c.recordable(c.withTimeout(timeoutClick, c.verifiable(c.handleFill)))))
+	mux.HandleFunc("/switch-tab", c.async(c.recordable(c.withTimeout(timeoutClick, c.verifiable(c.handleSwitchTab)))))
+	mux.HandleFunc("/key", c.async(c.recordable(c.withTimeout(timeoutClick, c.verifiable(c.handleKey)))))
+	mux.HandleFunc("/set-addressbar", c.async(c.recordable(c.withTimeout(timeoutClick, c.verifiable(c.handleSetAddressBar)))))
+	mux.HandleFunc("/get-addressbar", c.withTimeout("", c.handleGetAddressBar))
+	mux.HandleFunc("/keys", c.handleKeys)
+	mux.HandleFunc("/hover", c.async(c.recordable(c.withTimeout(timeoutClick, c.verifiable(c.handleHover)))))
+	mux.HandleFunc("/dismiss-dialog", c.async(c.recordable(c.withTimeout(timeoutClick, c.verifiable(c.handleDismissDialog)))))
+	mux.HandleFunc("/offer-response", c.async(c.recordable(c.withTimeout(timeoutClick, c.verifiable(c.handleOfferResponse)))))
+	mux.HandleFunc("/new-game", c.async(c.recordable(c.withTimeout(timeoutWait, c.verifiable(c.handleNewGame)))))
+	mux.HandleFunc("/set-time-control", c.async(c.recordable(c.withTimeout(timeoutWait, c.verifiable(c.handleSetTimeControl)))))
+	mux.HandleFunc("/batch", c.async(c.recordable(c.withTimeout(timeoutScreenshot, c.verifiable(c.handleBatch)))))
+	mux.HandleFunc("/rpc", c.handleRPC)
+	mux.HandleFunc("/record", c.handleRecord)
+	mux.HandleFunc("/replay", c.async(c.handleReplay))
+	mux.HandleFunc("/events", c.handleEvents)
+	mux.HandleFunc("/list-windows", c.withTimeout("", c.handleListWindows))
+	mux.HandleFunc("/clipboard-check", c.withTimeout(timeoutClick, c.handleClipboardCheck))
+	mux.HandleFunc("/reset-session", c.async(c.recordable(c.withTimeout(timeoutNavigation, c.verifiable(c.handleResetSession)))))
+	mux.HandleFunc("/", c.handleNotFound)
+	return c.withRecovery(c.withTracing(c.withAuth(c.withReadyGate(c.withDisplay(c.withRecentScreenshots(c.withDebug(c.withTiming(c.withDelay(mux)))))))))
+}
+
+var displayPattern = regexp.MustCompile(`^[A-Za-z0-9.-]*:[0-9]+(\.[0-9]+)?$`)
+
+// baseContext returns a background context carrying the configured command
+// environment and the controller's devices
+func (c *Controller) baseContext() context.Context {
+	ctx := context.Background()
+	if len(c.cfg.CommandEnv) > 0 {
+		ctx = withCommandEnv(ctx, c.cfg.CommandEnv...)
+	}
+	if c.cfg.Display != "" {
+		ctx = withCommandEnv(ctx, "DISPLAY="+c.cfg.Display)
+	}
+	if c.cfg.ProfileDir != "" {
+		ctx = withProfileDir(ctx, c.cfg.ProfileDir)
+	}
+	if c.cfg.MatchWindow {
+		ctx = withGameWindow(ctx, &c.window)
+	}
+	return withDevices(ctx, c.dev)
+}
+
+// withDisplay sets DISPLAY for the commands a request spawns, from -display
+// or the request's "display" query parameter. This selects the X screen that
+// xdotool drives, Firefox launches on and screenshots are captured from.
+// The -command-env variables are set first, so DISPLAY from either wins.
+func (c *Controller) withDisplay(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		display := c.cfg.Display
+		if d := r.URL.Query().Get("display"); d != "" {
+			if !displayPattern.MatchString(d) {
+				writeError(w, http.StatusBadRequest, fmt.Sprintf("Invalid display %q", d))
+				return
+			}
+			display = d
+		}
+		if len(c.cfg.CommandEnv) > 0 {
+			r = r.WithContext(withCommandEnv(r.Context(), c.cfg.CommandEnv...))
+		}
+		if display != "" {
+			r = r.WithContext(withCommandEnv(r.Context(), "DISPLAY="+display))
+		}
+		if c.cfg.ProfileDir != "" {
+			r = r.WithContext(withProfileDir(r.Context(), c.cfg.ProfileDir))
+		}
+		if c.cfg.MatchWindow {
+			r = r.WithContext(withGameWindow(r.Context(), &c.window))
+		}
+		h.ServeHTTP(w, r.WithContext(withDevices(r.Context(), c.dev)))
+	})
+}
+
+// writeJSON writes v as the JSON response body with the given status code
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError writes a failed Response with the given status code and the
+// error code that goes with it
+func writeError(w http.ResponseWriter, status int, message string) {
+	code, ok := statusCodes[status]
+	if !ok {
+		code = codeInternal
+	}
+	writeErrorCode(w, status, code, message)
+}
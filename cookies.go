@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Cookie is a browser cookie as accepted and returned by /cookies
+type Cookie struct {
+	Name     string `json:"name"`
+	Value    string `json:"value"`
+	Domain   string `json:"domain,omitempty"`
+	Path     string `json:"path,omitempty"`
+	Secure   bool   `json:"secure"`
+	HTTPOnly bool   `json:"http_only"`
+	Expiry   int64  `json:"expiry,omitempty"`
+	SameSite string `json:"same_site,omitempty"`
+}
+
+// CookieRequest represents the JSON payload for setting cookies
+type CookieRequest struct {
+	Cookies []Cookie `json:"cookies"`
+}
+
+// CookieResponse is the Response for /cookies, carrying the current domain's cookies
+type CookieResponse struct {
+	Response
+	Cookies []Cookie `json:"cookies"`
+}
+
+// publicSecondLevel are labels that, under a two-letter country code, make
+// a public suffix such as co.uk or com.au. The controller sticks to the
+// standard library, so this stands in for the full public suffix list.
+var publicSecondLevel = map[string]bool{
+	"ac": true, "co": true, "com": true, "edu": true, "gen": true, "go": true,
+	"gob": true, "gov": true, "ltd": true, "ne": true, "net": true, "nic": true,
+	"or": true, "org": true, "plc": true, "sch": true,
+}
+
+// publicSuffix reports whether domain is one every site under it shares,
+// such as com or co.uk, rather than one a site registers
+func publicSuffix(domain string) bool {
+	labels := strings.Split(domain, ".")
+	switch len(labels) {
+	case 1:
+		return true
+	case 2:
+		return len(labels[1]) == 2 && publicSecondLevel[labels[0]]
+	}
+	return false
+}
+
+// cookieDomainMatches reports whether a cookie for domain may be set from
+// host. Public suffixes are refused, as one cookie would reach every site
+// under them, unless the page's host is the domain itself.
+func cookieDomainMatches(domain, host string) bool {
+	domain = strings.ToLower(strings.TrimPrefix(domain, "."))
+	host = strings.ToLower(host)
+	if host == domain {
+		return true
+	}
+	return strings.HasSuffix(host, "."+domain) && !publicSuffix(domain)
+}
+
+// handleCookies gets (GET) or sets (POST) cookies for the domain of the current tab
+func (c *Controller) handleCookies(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "Only GET and POST methods are allowed")
+		return
+	}
+	if c.marionette == nil {
+		writeError(w, http.StatusNotImplemented, "Cookie management requires the marionette backend")
+		return
+	}
+
+	current, err := c.marionette.CurrentURL(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to read current URL: %v", err))
+		return
+	}
+	u, err := url.Parse(current)
+	if err != nil || u.Hostname() == "" {
+		writeError(w, http.StatusConflict, fmt.Sprintf("Current page %q has no cookie domain", current))
+		return
+	}
+	host := u.Hostname()
+
+	if r.Method == http.MethodGet {
+		cookies, err := c.marionette.Cookies(r.Context())
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to read cookies: %v", err))
+			return
+		}
+		resp := CookieResponse{
+			Response: Response{
+				Success: true,
+				Message: fmt.Sprintf("Found %d cookies for %s", len(cookies), host),
+			},
+			Cookies: []Cookie{},
+		}
+		for _, wc := range cookies {
+			resp.Cookies = append(resp.Cookies, Cookie(wc))
+		}
+		writeJSON(w, http.StatusOK, resp)
+		return
+	}
+
+	var req CookieRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid JSON payload")
+		return
+	}
+	if len(req.Cookies) == 0 {
+		writeError(w, http.StatusBadRequest, "At least one cookie is required")
+		return
+	}
+
+	// Validate everything before setting anything so a bad cookie doesn't leave a partial session
+	for _, cookie := range req.Cookies {
+		if cookie.Name == "" {
+			writeError(w, http.StatusBadRequest, "Cookie name cannot be empty")
+			return
+		}
+		if domain := strings.ToLower(strings.TrimPrefix(cookie.Domain, ".")); domain != "" && domain != strings.ToLower(host) && publicSuffix(domain) {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("Cookie %q has domain %s, a public suffix shared by every site under it", cookie.Name, cookie.Domain))
+			return
+		}
+		if cookie.Domain != "" && !cookieDomainMatches(cookie.Domain, host) {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("Cookie %q has domain %s which does not match current domain %s", cookie.Name, cookie.Domain, host))
+			return
+		}
+		if cookie.Secure && u.Scheme != "https" {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("Secure cookie %q cannot be set on a %s page", cookie.Name, u.Scheme))
+			return
+		}
+	}
+
+	err = c.command(r, func() error {
+		for _, cookie := range req.Cookies {
+			if cookie.Path == "" {
+				cookie.Path = "/"
+			}
+			if err := c.marionette.AddCookie(r.Context(), webdriverCookie(cookie)); err != nil {
+				return fmt.Errorf("failed to set cookie %q: %v", cookie.Name, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		writeCommandError(w, err, fmt.Sprintf("Failed to set cookies: %v", err))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, Response{
+		Success: true,
+		Message: fmt.Sprintf("Set %d cookies for %s", len(req.Cookies), host),
+	})
+}
@@ -0,0 +1,31 @@
+package main
+
+import "testing"
+
+func TestCookieDomainMatches(t *testing.T) {
+	tests := []struct {
+		domain, host string
+		want         bool
+	}{
+		{"lichess.org", "lichess.org", true},
+		{".lichess.org", "lichess.org", true},
+		{"lichess.org", "www.lichess.org", true},
+		{"LICHESS.org", "Lichess.Org", true},
+		{"www.lichess.org", "lichess.org", false},
+		{"chess.com", "lichess.org", false},
+		{"ess.org", "lichess.org", false},
+		{"bbc.co.uk", "www.bbc.co.uk", true},
+		{"localhost", "localhost", true},
+		// Public suffixes would reach every site under them
+		{"org", "lichess.org", false},
+		{".com", "www.chess.com", false},
+		{"co.uk", "www.bbc.co.uk", false},
+		{".com.au", "shop.example.com.au", false},
+		{"example.co.uk", "www.example.co.uk", true},
+	}
+	for _, tt := range tests {
+		if got := cookieDomainMatches(tt.domain, tt.host); got != tt.want {
+			t.Errorf("cookieDomainMatches(%q, %q) = %v, want %v", tt.domain, tt.host, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// When a tab's content process crashes Firefox replaces the page with
+// about:tabcrashed. Its title is "Tab crash reporter" in English builds, and
+// its heading "Your tab just crashed".
+const (
+	tabCrashedURL = "about:tabcrashed"
+	// tabCrashedRestore is the page's "Restore This Tab" button
+	tabCrashedRestore = "#restoreTab"
+	// tabCrashedWait is how long a recovered tab may take to leave the crash page
+	tabCrashedWait = 2 * time.Second
+)
+
+// tabCrashedTitles are the window titles the crash page shows
+var tabCrashedTitles = []string{"Tab crash reporter", "Your tab just crashed"}
+
+// tabCrashedScript reports whether the current tab shows the crash page
+const tabCrashedScript = `return document.documentURI.startsWith(arguments[0]) || document.querySelector(arguments[1]) !== null;`
+
+// tabCrashedRestoreScript clicks the crash page's restore button, reporting whether there was one
+const tabCrashedRestoreScript = `
+const button = document.querySelector(arguments[0]);
+if (!button) { return false; }
+button.click();
+return true;`
+
+// tabCrashed reports whether the current tab shows Firefox's crashed-tab
+// page: from the page with the marionette backend, otherwise from the
+// window title. Chromium browsers keep the page's own title when a tab
+// crashes, so it is only detected for Firefox.
+func (c *Controller) tabCrashed(ctx context.Context) (bool, error) {
+	if targetBrowser.chromium {
+		return false, nil
+	}
+	if c.marionette != nil {
+		if current, err := c.marionette.CurrentURL(ctx); err == nil && strings.HasPrefix(current, tabCrashedURL) {
+			return true, nil
+		}
+		var crashed bool
+		err := c.marionette.ExecuteScript(ctx, tabCrashedScript, []interface{}{tabCrashedURL, tabCrashedRestore}, &crashed)
+		return crashed, err
+	}
+	title, err := firefoxWindowTitle(ctx)
+	if err != nil {
+		return false, err
+	}
+	for _, t := range tabCrashedTitles {
+		if strings.Contains(strings.ToLower(title), strings.ToLower(t)) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// restoreCrashedTab gets the current tab off the crash page: with the
+// marionette backend by clicking "Restore This Tab", natively by reloading,
+// and failing either by opening the game URL again
+func (c *Controller) restoreCrashedTab(ctx context.Context) error {
+	if c.marionette != nil {
+		var clicked bool
+		if err := c.marionette.ExecuteScript(ctx, tabCrashedRestoreScript, []interface{}{tabCrashedRestore}, &clicked); err == nil && clicked {
+			return nil
+		}
+	} else if err := c.reloadPage(ctx); err != nil {
+		log.Printf("recover-crashed-tab: failed to reload: %v", err)
+	} else if crashed, _ := c.waitTabRestored(ctx); !crashed {
+		return nil
+	}
+	target := c.gameURL()
+	if target == "" {
+		return fmt.Errorf("the restore failed and there is no game URL to reopen")
+	}
+	if c.marionette != nil {
+		return c.marionette.Navigate(ctx, target)
+	}
+	return c.updateFirefoxURL(ctx, target, "")
+}
+
+// waitTabRestored waits up to tabCrashedWait for the crash page to go,
+// reporting whether it is still shown
+func (c *Controller) waitTabRestored(ctx context.Context) (bool, error) {
+	deadline := time.Now().Add(tabCrashedWait)
+	for {
+		crashed, err := c.tabCrashed(ctx)
+		if err == nil && !crashed {
+			return false, nil
+		}
+		if time.Now().After(deadline) {
+			return true, err
+		}
+		select {
+		case <-time.After(250 * time.Millisecond):
+		case <-ctx.Done():
+			return true, ctx.Err()
+		}
+	}
+}
+
+// recoverCrashedTab restores the tab, with -recover-crashed-tab, when it
+// shows the crashed-tab page, so the action that asked doesn't type into
+// it. It fails with TAB_CRASHED when the tab can't be restored. A page that
+// can't be inspected is logged rather than blocking the action.
+func (c *Controller) recoverCrashedTab(ctx context.Context) error {
+	crashed, err := c.tabCrashed(ctx)
+	if err != nil {
+		log.Printf("recover-crashed-tab: %v", err)
+		return nil
+	}
+	if !crashed {
+		return nil
+	}
+	log.Printf("recover-crashed-tab: the tab crashed; restoring it")
+	if err := c.restoreCrashedTab(ctx); err != nil {
+		return withCode(codeTabCrashed, fmt.Errorf("the tab crashed and could not be restored: %v", err))
+	}
+	if crashed, _ := c.waitTabRestored(ctx); crashed {
+		return withCode(codeTabCrashed, fmt.Errorf("the tab crashed and still shows the crash page after restoring it"))
+	}
+	log.Printf("recover-crashed-tab: restored the tab")
+	return nil
+}
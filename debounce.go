@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Requests answered with another request's response instead of running,
+// by reason, for /metrics. They cover every session of the process.
+var (
+	dedupOpenInFlight atomic.Int64 // an identical /open was still running
+	dedupOpenRecent   atomic.Int64 // an identical /open succeeded within -open-debounce
+)
+
+// navCall is one /open request that identical requests may share
+type navCall struct {
+	done     chan struct{}
+	status   int
+	body     []byte
+	finished time.Time
+}
+
+// navDebouncer coalesces identical /open requests arriving within -open-debounce
+type navDebouncer struct {
+	mu    sync.Mutex
+	calls map[string]*navCall
+}
+
+// teeWriter records the status and body a handler writes while passing them through
+type teeWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (t *teeWriter) WriteHeader(status int) {
+	t.status = status
+	t.ResponseWriter.WriteHeader(status)
+}
+
+func (t *teeWriter) Write(p []byte) (int, error) {
+	t.body.Write(p)
+	return t.ResponseWriter.Write(p)
+}
+
+// debounceNavigation wraps the /open handler so a request identical to one
+// in flight, or one that succeeded less than -open-debounce ago, gets that
+// request's response instead of navigating again. Different URLs are never
+// coalesced.
+func (c *Controller) debounceNavigation(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		window := c.cfg.OpenDebounce
+		if window <= 0 || r.Method != http.MethodPost || r.Context().Value(lockHeldKey{}) != nil {
+			h(w, r)
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "Failed to read request body")
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		var req URLRequest
+		if err := json.Unmarshal(body, &req); err != nil {
+			h(w, r)
+			return
+		}
+		target, err := normalizeURL(req.URL)
+		if err != nil || req.URL == "" {
+			h(w, r)
+			return
+		}
+		key, _ := json.Marshal(URLRequest{URL: target, Profile: req.Profile, Background: req.Background})
+
+		d := &c.debounce
+		d.mu.Lock()
+		if d.calls == nil {
+			d.calls = map[string]*navCall{}
+		}
+		for k, call := range d.calls {
+			if !call.finished.IsZero() && time.Since(call.finished) > window {
+				delete(d.calls, k)
+			}
+		}
+		if call, ok := d.calls[string(key)]; ok {
+			inFlight := call.finished.IsZero()
+			d.mu.Unlock()
+			if inFlight {
+				dedupOpenInFlight.Add(1)
+				log.Printf("debounce: /open of %s joined an identical request in flight", redact(target))
+			} else {
+				dedupOpenRecent.Add(1)
+				log.Printf("debounce: /open of %s answered with the response from %v ago", redact(target), time.Since(call.finished).Round(time.Millisecond))
+			}
+			select {
+			case <-call.done:
+			case <-r.Context().Done():
+				writeError(w, http.StatusServiceUnavailable, "Request cancelled while waiting for an identical navigation")
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("X-Debounced", "true")
+			w.WriteHeader(call.status)
+			w.Write(call.body)
+			return
+		}
+		call := &navCall{done: make(chan struct{})}
+		d.calls[string(key)] = call
+		d.mu.Unlock()
+
+		tw := &teeWriter{ResponseWriter: w, status: http.StatusOK}
+		h(tw, r)
+
+		d.mu.Lock()
+		call.status = tw.status
+		call.body = tw.body.Bytes()
+		call.finished = time.Now()
+		// Only a success is reused after it finishes, so a retry after a failure navigates again
+		if tw.status < 200 || tw.status > 299 {
+			delete(d.calls, string(key))
+		}
+		d.mu.Unlock()
+		close(call.done)
+	}
+}
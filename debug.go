@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DebugStep is one thing the server did while handling a request, timed from
+// when the request arrived
+type DebugStep struct {
+	AtMs   int64  `json:"at_ms"`
+	Kind   string `json:"kind"` // "exec" or "lock"
+	Detail string `json:"detail"`
+}
+
+// DebugEnvironment is what the server detected about where it runs
+type DebugEnvironment struct {
+	OS             string `json:"os"`
+	Backend        string `json:"backend"`
+	InputTool      string `json:"input_tool,omitempty"`      // Linux only
+	ScreenshotTool string `json:"screenshot_tool,omitempty"` // Linux only
+	Display        string `json:"display,omitempty"`
+	ProfileDir     string `json:"profile_dir,omitempty"`
+	GoVersion      string `json:"go_version"`
+}
+
+// DebugInfo is added as the "debug" field of JSON responses to ?debug=1 requests
+type DebugInfo struct {
+	DurationMs  int64            `json:"duration_ms"`
+	Steps       []DebugStep      `json:"steps"`
+	Environment DebugEnvironment `json:"environment"`
+}
+
+// debugTrace collects the steps of one ?debug=1 request. Async handlers keep
+// adding to it after the response is written, so it has its own lock.
+type debugTrace struct {
+	mu    sync.Mutex
+	start time.Time
+	steps []DebugStep
+}
+
+type debugTraceKey struct{}
+
+// traceStep records a step in the request's debug trace, if it has one
+func traceStep(ctx context.Context, kind, detail string) {
+	t, _ := ctx.Value(debugTraceKey{}).(*debugTrace)
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.steps = append(t.steps, DebugStep{
+		AtMs:   time.Since(t.start).Milliseconds(),
+		Kind:   kind,
+		Detail: detail,
+	})
+}
+
+func (t *debugTrace) info(ctx context.Context, c *Controller) DebugInfo {
+	t.mu.Lock()
+	steps := append([]DebugStep{}, t.steps...)
+	t.mu.Unlock()
+
+	env := DebugEnvironment{
+		OS:         runtime.GOOS,
+		Backend:    c.cfg.Backend,
+		ProfileDir: c.cfg.ProfileDir,
+		GoVersion:  runtime.Version(),
+	}
+	if runtime.GOOS == "linux" {
+		env.InputTool = c.dev.input.name()
+		env.ScreenshotTool = c.dev.screenshot.name
+	}
+	env.Display = commandDisplay(ctx)
+	return DebugInfo{
+		DurationMs:  time.Since(t.start).Milliseconds(),
+		Steps:       steps,
+		Environment: env,
+	}
+}
+
+// debugRequested reports whether r asks for debug output with ?debug=1
+func debugRequested(r *http.Request) bool {
+	v := r.URL.Query().Get("debug")
+	on, err := strconv.ParseBool(v)
+	return err == nil && on
+}
+
+// withDebug adds a "debug" field with the commands run, their timings and
+// the detected environment to JSON responses of ?debug=1 requests. The output
+// shows command lines and paths, so it is refused unless the server requires
+// an API key or was started with -allow-debug. Other responses get the same
+// information in an X-Debug header instead.
+func (c *Controller) withDebug(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !debugRequested(r) {
+			h.ServeHTTP(w, r)
+			return
+		}
+		if !c.authRequired() && !c.cfg.AllowDebug {
+			writeError(w, http.StatusForbidden, "Debug output needs -api-key, -basic-auth or -allow-debug")
+			return
+		}
+		if r.URL.Path == "/events" {
+			// a stream has no end to attach the trace to
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		trace := &debugTrace{start: time.Now()}
+		ctx := context.WithValue(r.Context(), debugTraceKey{}, trace)
+		rec := &bufferedResponse{header: http.Header{}, status: http.StatusOK}
+		h.ServeHTTP(rec, r.WithContext(ctx))
+		info := trace.info(ctx, c)
+
+		for k, v := range rec.header {
+			w.Header()[k] = v
+		}
+		data, _ := json.Marshal(info)
+		body, ok := addJSONField(rec, "debug", data)
+		if !ok {
+			w.Header().Set("X-Debug", string(data))
+		}
+		w.Header().Del("Content-Length")
+		w.WriteHeader(rec.status)
+		w.Write(body)
+	})
+}
+
+// addJSONField returns the body of rec with key set to value when it is a
+// JSON object, or the body unchanged and false otherwise. The field is
+// spliced in rather than re-encoding, which would reorder the others.
+func addJSONField(rec *bufferedResponse, key string, value []byte) ([]byte, bool) {
+	body := bytes.TrimSpace(rec.body.Bytes())
+	if !strings.HasPrefix(rec.header.Get("Content-Type"), "application/json") || len(body) < 2 || body[0] != '{' || !json.Valid(body) {
+		return rec.body.Bytes(), false
+	}
+	var out bytes.Buffer
+	out.Write(body[:len(body)-1])
+	if len(bytes.TrimSpace(body[1:len(body)-1])) > 0 {
+		out.WriteByte(',')
+	}
+	k, _ := json.Marshal(key)
+	out.Write(k)
+	out.WriteByte(':')
+	out.Write(value)
+	out.WriteString("}\n")
+	return out.Bytes(), true
+}
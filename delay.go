@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// maxRequestDelay bounds delay_ms, since the command mutex is held throughout
+const maxRequestDelay = time.Minute
+
+// requestDelay is the delay_ms of one request, waited once by the first
+// command it runs
+type requestDelay struct {
+	delay    time.Duration
+	mu       sync.Mutex
+	started  bool
+	finished bool
+	waited   time.Duration
+}
+
+type requestDelayKey struct{}
+
+// waitDelay waits out the delay of the request in ctx, if it has one that
+// hasn't been waited yet. command calls it with the mutex held, so the
+// action starts as soon as the delay ends.
+func waitDelay(ctx context.Context) error {
+	d, _ := ctx.Value(requestDelayKey{}).(*requestDelay)
+	if d == nil {
+		return nil
+	}
+	d.mu.Lock()
+	started := d.started
+	d.started = true
+	d.mu.Unlock()
+	if started {
+		return nil
+	}
+
+	defer timeStep(ctx, "delay")()
+	start := time.Now()
+	timer := time.NewTimer(d.delay)
+	defer timer.Stop()
+	var err error
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	d.mu.Lock()
+	d.finished, d.waited = true, time.Since(start)
+	d.mu.Unlock()
+	return err
+}
+
+// withDelay handles the delay_ms field of POST requests: the action waits
+// that long with the command mutex held before it runs, and the response
+// gets a "delayed_ms" field with the time waited. Holding the mutex keeps
+// the action next in line, but it also blocks every other action for the
+// whole delay. The delay counts against the request's timeout; raise it with
+// ?timeout= for long delays.
+func (c *Controller) withDelay(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			h.ServeHTTP(w, r)
+			return
+		}
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "Failed to read request body")
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		var fields struct {
+			DelayMs *int64 `json:"delay_ms"`
+		}
+		if json.Unmarshal(body, &fields) != nil || fields.DelayMs == nil {
+			h.ServeHTTP(w, r)
+			return
+		}
+		delay := time.Duration(*fields.DelayMs) * time.Millisecond
+		if delay < 0 || delay > maxRequestDelay {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("delay_ms must be between 0 and %d", maxRequestDelay.Milliseconds()))
+			return
+		}
+
+		d := &requestDelay{delay: delay}
+		rec := &bufferedResponse{header: http.Header{}, status: http.StatusOK}
+		h.ServeHTTP(rec, r.WithContext(context.WithValue(r.Context(), requestDelayKey{}, d)))
+
+		d.mu.Lock()
+		waited, finished := d.waited, d.finished
+		d.mu.Unlock()
+		for k, v := range rec.header {
+			w.Header()[k] = v
+		}
+		out := rec.body.Bytes()
+		// An asynchronous request waits in its job, after this response
+		if finished {
+			out, _ = addJSONField(rec, "delayed_ms", []byte(strconv.FormatInt(waited.Milliseconds(), 10)))
+			w.Header().Del("Content-Length")
+		}
+		w.WriteHeader(rec.status)
+		w.Write(out)
+	})
+}
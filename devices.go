@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"runtime"
+)
+
+// devices are the tools a controller drives its display with, chosen at
+// startup by chooseInputTool, chooseTypeMode, chooseScreenshotTool,
+// chooseWindowInput and chooseMonitor. Each session probes its own, since
+// sessions on other displays may have other tools working.
+type devices struct {
+	input       inputTool
+	keysyms     bool // xdotool typing with keysyms, see chooseTypeMode
+	screenshot  screenshotTool
+	windowInput bool       // see chooseWindowInput
+	window      gameWindow // the X window keys go to with windowInput; empty for the focused one
+	monitor     *Monitor   // the -monitor, or nil for the whole desktop
+}
+
+// newDevices returns the defaults, used until the choose functions run, so
+// that errors name the expected tools
+func newDevices() *devices {
+	return &devices{input: xdotoolInput{}, screenshot: screenshotTools["import"]}
+}
+
+// defaultDevices serve contexts that carry no controller's devices
+var defaultDevices = newDevices()
+
+type devicesKey struct{}
+
+// withDevices returns a copy of ctx whose input and screenshots use d
+func withDevices(ctx context.Context, d *devices) context.Context {
+	return context.WithValue(ctx, devicesKey{}, d)
+}
+
+// ctxDevices returns the devices ctx carries, or the defaults
+func ctxDevices(ctx context.Context) *devices {
+	if d, ok := ctx.Value(devicesKey{}).(*devices); ok {
+		return d
+	}
+	return defaultDevices
+}
+
+// linuxInput is the input tool for ctx's controller
+func linuxInput(ctx context.Context) inputTool {
+	return ctxDevices(ctx).input
+}
+
+// linuxScreenshot is the screenshot tool for ctx's controller
+func linuxScreenshot(ctx context.Context) screenshotTool {
+	return ctxDevices(ctx).screenshot
+}
+
+// activeMonitor is the -monitor that ctx's screenshots capture and
+// coordinates are relative to, or nil for the whole desktop
+func activeMonitor(ctx context.Context) *Monitor {
+	return ctxDevices(ctx).monitor
+}
+
+// chooseDevices probes the controller's display for the tools to use, in
+// order, since the type mode and window input depend on the input tool
+func (c *Controller) chooseDevices() error {
+	if runtime.GOOS == "linux" {
+		c.chooseInputTool()
+		c.chooseTypeMode()
+		c.chooseScreenshotTool()
+	}
+	c.chooseWindowInput()
+	return c.chooseMonitor()
+}
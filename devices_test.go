@@ -0,0 +1,22 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestInputWindowPerController(t *testing.T) {
+	a, b := newController(&Config{}), newController(&Config{})
+	a.dev.window.set("111")
+	b.dev.window.set("222")
+	if got := xdotoolWindowArgs(a.baseContext()); !reflect.DeepEqual(got, []string{"--window", "111"}) {
+		t.Errorf("first controller's window args = %v", got)
+	}
+	if got := xdotoolWindowArgs(b.baseContext()); !reflect.DeepEqual(got, []string{"--window", "222"}) {
+		t.Errorf("second controller's window args = %v", got)
+	}
+	if got := xdotoolWindowArgs(context.Background()); got != nil {
+		t.Errorf("window args without a controller = %v, want none", got)
+	}
+}
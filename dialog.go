@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// DismissDialogRequest represents the optional JSON payload for /dismiss-dialog
+type DismissDialogRequest struct {
+	Button string `json:"button"` // a button name from the site profile; defaults to "close"
+}
+
+// DismissDialogResponse is the Response for /dismiss-dialog
+type DismissDialogResponse struct {
+	Response
+	Present bool `json:"present"`
+	Clicked bool `json:"clicked"`
+}
+
+// dismissDialogScript clicks arguments[1] if a dialog matching arguments[0] is open
+const dismissDialogScript = `
+const dialog = document.querySelector(arguments[0]);
+if (!dialog) { return {present: false, clicked: false}; }
+const button = dialog.querySelector(arguments[1]) || document.querySelector(arguments[1]);
+if (!button) { return {present: true, clicked: false}; }
+button.click();
+return {present: true, clicked: true};`
+
+// handleDismissDialog closes the post-game modal if one is showing. With the
+// marionette backend the dialog is found by the site profile's selectors;
+// natively it is detected by the color of -dialog-region and closed by
+// clicking -dialog-click.
+func (c *Controller) handleDismissDialog(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "Only POST method is allowed")
+		return
+	}
+
+	var req DismissDialogRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid JSON payload")
+			return
+		}
+	}
+	if req.Button == "" {
+		req.Button = "close"
+	}
+
+	var result struct {
+		Present bool `json:"present"`
+		Clicked bool `json:"clicked"`
+	}
+
+	if c.marionette != nil {
+		site, current, err := c.currentSite(r.Context())
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if site == nil || site.DialogSelector == "" {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("Unsupported site: %s", current))
+			return
+		}
+		selector, ok := site.DialogButtons[req.Button]
+		if !ok {
+			names := make([]string, 0, len(site.DialogButtons))
+			for name := range site.DialogButtons {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("Unknown button %q for %s; available: %s", req.Button, site.Name, strings.Join(names, ", ")))
+			return
+		}
+		err = c.command(r, func() error {
+			return c.marionette.ExecuteScript(r.Context(), dismissDialogScript, []interface{}{site.DialogSelector, selector}, &result)
+		})
+		if err != nil {
+			writeCommandError(w, err, fmt.Sprintf("Failed to dismiss dialog: %v", err))
+			return
+		}
+	} else {
+		if c.cfg.DialogRegion.empty() || c.cfg.DialogColor == "" {
+			writeError(w, http.StatusConflict, "Dialog detection is not configured; set -dialog-region and -dialog-color")
+			return
+		}
+		want, err := parseHexColor(c.cfg.DialogColor)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, fmt.Sprintf("Invalid -dialog-color: %v", err))
+			return
+		}
+		region := c.cfg.DialogRegion
+		err = c.focusCommand(r, func() error {
+			shot, err := captureScreen(r.Context())
+			if err != nil {
+				return err
+			}
+			got, err := averageColor(shot, region)
+			if err != nil {
+				return err
+			}
+			if !colorsClose(got, want, c.cfg.DialogTolerance) {
+				return nil
+			}
+			result.Present = true
+
+			target := c.cfg.DialogClick
+			if target == (point{}) {
+				target = point{X: region.X + region.Width/2, Y: region.Y + region.Height/2}
+			}
+			if err := focusFirefox(r.Context()); err != nil {
+				return err
+			}
+			if err := mouseClick(r.Context(), target, buttonLeft); err != nil {
+				return err
+			}
+			result.Clicked = true
+			return nil
+		})
+		if err != nil {
+			writeCommandError(w, err, fmt.Sprintf("Failed to dismiss dialog: %v", err))
+			return
+		}
+	}
+
+	message := "No dialog present"
+	switch {
+	case result.Clicked:
+		message = fmt.Sprintf("Dismissed dialog with %s", req.Button)
+	case result.Present:
+		message = fmt.Sprintf("Dialog present but no %s button found", req.Button)
+	}
+	writeJSON(w, http.StatusOK, DismissDialogResponse{
+		Response: Response{Success: !result.Present || result.Clicked, Message: message},
+		Present:  result.Present,
+		Clicked:  result.Clicked,
+	})
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+)
+
+// viewportScript measures the browser window and its content area.
+// mozInnerScreenX and mozInnerScreenY are where the page's top-left corner
+// is on screen, in CSS pixels, past the tab strip and toolbars.
+const viewportScript = `
+return {
+	inner_width: window.innerWidth, inner_height: window.innerHeight,
+	outer_width: window.outerWidth, outer_height: window.outerHeight,
+	screen_x: window.screenX, screen_y: window.screenY,
+	content_x: window.mozInnerScreenX || 0, content_y: window.mozInnerScreenY || 0,
+	device_pixel_ratio: window.devicePixelRatio || 1,
+	screen_width: window.screen.width, screen_height: window.screen.height,
+};`
+
+// Viewport is the browser window as the page sees it, in CSS pixels; multiply
+// by device_pixel_ratio for screen pixels
+type Viewport struct {
+	InnerWidth       float64 `json:"inner_width"`
+	InnerHeight      float64 `json:"inner_height"`
+	OuterWidth       float64 `json:"outer_width"`
+	OuterHeight      float64 `json:"outer_height"`
+	ScreenX          float64 `json:"screen_x"`
+	ScreenY          float64 `json:"screen_y"`
+	ContentX         float64 `json:"content_x"` // where the page starts on screen
+	ContentY         float64 `json:"content_y"`
+	DevicePixelRatio float64 `json:"device_pixel_ratio"`
+	Zoom             float64 `json:"zoom"`          // the ratio over -base-pixel-ratio, 1 at 100%
+	ScreenWidth      float64 `json:"screen_width"`  // of the screen the window is on
+	ScreenHeight     float64 `json:"screen_height"` // likewise
+}
+
+// DisplayInfoResponse is the Response for /display-info
+type DisplayInfoResponse struct {
+	Response
+	Monitors []Monitor `json:"monitors"`
+	Monitor  *Monitor  `json:"monitor,omitempty"` // the -monitor screenshots and coordinates use
+	// Viewport is only measured with the marionette backend
+	Viewport *Viewport `json:"viewport,omitempty"`
+}
+
+// handleDisplayInfo reports the resolution of each monitor and, with the
+// marionette backend, the browser's viewport and device pixel ratio: what
+// calibrating a board from page coordinates needs to know
+func (c *Controller) handleDisplayInfo(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "Only GET method is allowed")
+		return
+	}
+
+	monitors, err := listMonitors(r.Context())
+	if err != nil {
+		writeCommandError(w, err, fmt.Sprintf("Failed to list monitors: %v", err))
+		return
+	}
+	resp := DisplayInfoResponse{Monitors: monitors, Monitor: c.dev.monitor}
+	if c.marionette != nil {
+		var vp Viewport
+		err := c.command(r, func() error {
+			if err := c.marionette.ExecuteScript(r.Context(), viewportScript, nil, &vp); err != nil {
+				return fmt.Errorf("failed to measure the viewport: %v", err)
+			}
+			return nil
+		})
+		if err != nil {
+			writeCommandError(w, err, err.Error())
+			return
+		}
+		vp.Zoom = math.Round(vp.DevicePixelRatio/c.cfg.BasePixelRatio*100) / 100
+		resp.Viewport = &vp
+	}
+
+	message := fmt.Sprintf("%d monitors", len(monitors))
+	if len(monitors) == 1 {
+		message = "1 monitor"
+	}
+	if vp := resp.Viewport; vp != nil {
+		message += fmt.Sprintf("; viewport %.0fx%.0f at device pixel ratio %g", vp.InnerWidth, vp.InnerHeight, vp.DevicePixelRatio)
+	}
+	resp.Response = Response{Success: true, Message: message}
+	writeJSON(w, http.StatusOK, resp)
+}
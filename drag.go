@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// DragSquareRequest represents the JSON payload for /drag-square
+type DragSquareRequest struct {
+	From   string `json:"from"`
+	To     string `json:"to"`
+	Button int    `json:"button"` // 1 left (default), 2 middle, 3 right
+}
+
+// DragResponse is the Response for drag endpoints, with the pixels used
+type DragResponse struct {
+	Response
+	FromPoint point `json:"from_point"`
+	ToPoint   point `json:"to_point"`
+}
+
+// handleDragSquare drags between two named squares, for editor and analysis
+// boards where UCI move semantics don't apply
+func (c *Controller) handleDragSquare(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "Only POST method is allowed")
+		return
+	}
+
+	var req DragSquareRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid JSON payload")
+		return
+	}
+	if req.Button == 0 {
+		req.Button = buttonLeft
+	}
+	if req.Button < buttonLeft || req.Button > buttonRight {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("Invalid button %d", req.Button))
+		return
+	}
+
+	cal, ok := c.calibration()
+	if !ok {
+		writeErrorCode(w, http.StatusConflict, codeCalibrationMissing, "Board is not calibrated")
+		return
+	}
+	from, err := cal.squareCenter(req.From)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("Invalid from square: %v", err))
+		return
+	}
+	to, err := cal.squareCenter(req.To)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("Invalid to square: %v", err))
+		return
+	}
+
+	err = c.focusCommand(r, func() error {
+		if err := focusFirefox(r.Context()); err != nil {
+			return err
+		}
+		return mouseDrag(r.Context(), c.dragPath(from, to), c.cfg.DragStepDelay, req.Button)
+	})
+	if err != nil {
+		writeCommandError(w, err, fmt.Sprintf("Failed to drag %s to %s: %v", req.From, req.To, err))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, DragResponse{
+		Response: Response{
+			Success: true,
+			Message: fmt.Sprintf("Dragged %s to %s", req.From, req.To),
+		},
+		FromPoint: from,
+		ToPoint:   to,
+	})
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// handleScreenshotElement returns an image of exactly the element matching
+// ?selector=, such as the board, without needing a calibration; a PNG
+// unless ?format= asks for another encoding
+func (c *Controller) handleScreenshotElement(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "Only GET method is allowed")
+		return
+	}
+	if c.marionette == nil {
+		writeError(w, http.StatusNotImplemented, "Element screenshots require the marionette backend")
+		return
+	}
+	selector := r.URL.Query().Get("selector")
+	if selector == "" {
+		writeError(w, http.StatusBadRequest, "selector is required")
+		return
+	}
+	format, err := queryImageFormat(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("Invalid image format: %v", err))
+		return
+	}
+
+	var shot []byte
+	err = c.command(r, func() error {
+		id, err := c.marionette.FindElement(r.Context(), selector)
+		if err != nil {
+			return err
+		}
+		if shot, err = c.marionette.ElementScreenshot(r.Context(), id); err != nil {
+			return err
+		}
+		shot, err = format.encode(shot)
+		return err
+	})
+	if merr, ok := err.(*marionetteError); ok && merr.Code == "no such element" {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("No element matches %s", selector))
+		return
+	}
+	if err != nil {
+		writeCommandError(w, err, fmt.Sprintf("Failed to screenshot %s: %v", selector, err))
+		return
+	}
+
+	w.Header().Set("Content-Type", format.contentType())
+	w.Write(shot)
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"net/http"
+	"os/exec"
+	"strings"
+)
+
+// Error codes returned in Response.ErrorCode. They are part of the API, so
+// existing values must not change.
+const (
+	codeInvalidRequest      = "INVALID_REQUEST"
+	codeInvalidURL          = "INVALID_URL"
+	codeUnauthorized        = "UNAUTHORIZED"
+	codeForbidden           = "FORBIDDEN"
+	codeNotFound            = "NOT_FOUND"
+	codeMethodNotAllowed    = "METHOD_NOT_ALLOWED"
+	codeConflict            = "CONFLICT"
+	codeCalibrationMissing  = "CALIBRATION_MISSING"
+	codeMoveNotRegistered   = "MOVE_NOT_REGISTERED"
+	codeMoveUnverified      = "MOVE_UNVERIFIED"
+	codeURLMismatch         = "URL_MISMATCH"
+	codeActionUnverified    = "ACTION_UNVERIFIED"
+	codeNotSupported        = "NOT_SUPPORTED"
+	codeBrowserNotRunning   = "BROWSER_NOT_RUNNING"
+	codeDepMissing          = "DEP_MISSING"
+	codeFocusFailed         = "FOCUS_FAILED"
+	codeTimeout             = "TIMEOUT"
+	codeUnavailable         = "UNAVAILABLE"
+	codeNotReady            = "NOT_READY"
+	codeChallenge           = "CHALLENGE"
+	codeBoardNotLoaded      = "BOARD_NOT_LOADED"
+	codeOrientationMismatch = "ORIENTATION_MISMATCH"
+	codeScreenLocked        = "SCREEN_LOCKED"
+	codeTabCrashed          = "TAB_CRASHED"
+	codeInternal            = "INTERNAL"
+)
+
+// statusCodes is the error code for each HTTP status when no more specific code applies
+var statusCodes = map[int]string{
+	http.StatusBadRequest:          codeInvalidRequest,
+	http.StatusUnauthorized:        codeUnauthorized,
+	http.StatusForbidden:           codeForbidden,
+	http.StatusNotFound:            codeNotFound,
+	http.StatusMethodNotAllowed:    codeMethodNotAllowed,
+	http.StatusConflict:            codeConflict,
+	http.StatusUnprocessableEntity: codeInvalidRequest,
+	http.StatusNotImplemented:      codeNotSupported,
+	http.StatusServiceUnavailable:  codeUnavailable,
+	http.StatusGatewayTimeout:      codeTimeout,
+}
+
+// codedError attaches an error code to an error for writeCommandError
+type codedError struct {
+	code string
+	err  error
+}
+
+func (e *codedError) Error() string { return e.err.Error() }
+
+// withCode returns err tagged with code
+func withCode(code string, err error) error {
+	return &codedError{code: code, err: err}
+}
+
+// errorCode returns the error code that best describes err
+func errorCode(err error) string {
+	switch e := err.(type) {
+	case *codedError:
+		return e.code
+	case *exec.Error:
+		return codeDepMissing
+	case *challengeError:
+		return codeChallenge
+	case *screenLockError:
+		return codeScreenLocked
+	}
+	switch {
+	case err == errCommandTimeout:
+		return codeTimeout
+	case err == errFocusStolen:
+		return codeFocusFailed
+	case err == errMoveNotRegistered:
+		return codeMoveNotRegistered
+	case err == errMoveUnverified:
+		return codeMoveUnverified
+	case strings.Contains(err.Error(), exec.ErrNotFound.Error()):
+		// errors are wrapped with %v, so a missing tool only survives as text
+		return codeDepMissing
+	}
+	return codeInternal
+}
+
+// writeErrorCode writes a failed Response with the given status and error code
+func writeErrorCode(w http.ResponseWriter, status int, code, message string) {
+	writeJSON(w, status, Response{
+		Success:   false,
+		Message:   message,
+		ErrorCode: code,
+	})
+}
+
+// writeCommandError writes the failed Response for an error returned by command
+func writeCommandError(w http.ResponseWriter, err error, message string) {
+	writeErrorCode(w, commandStatus(err), errorCode(err), message)
+}
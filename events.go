@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// eventHeartbeat is how often an idle /events stream gets a comment line so
+// proxies don't close it
+const eventHeartbeat = 15 * time.Second
+
+// Event is one server-sent event on /events
+type Event struct {
+	Type          string    `json:"type"`
+	Time          time.Time `json:"time"`
+	ChangedPixels int       `json:"changed_pixels,omitempty"`
+}
+
+// eventHub fans events out to /events subscribers and runs the board diff
+// loop only while at least one is connected
+type eventHub struct {
+	mu          sync.Mutex
+	subscribers map[chan Event]struct{}
+	stop        context.CancelFunc // stops the board diff loop; nil when it isn't running
+	closing     chan struct{}      // closed at shutdown to end every stream
+}
+
+// closed returns a channel that is closed once the server shuts down
+func (hub *eventHub) closed() <-chan struct{} {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	if hub.closing == nil {
+		hub.closing = make(chan struct{})
+	}
+	return hub.closing
+}
+
+// closeStreams ends every /events stream for shutdown, returning how many
+// were connected. A stream never ends by itself, so it would otherwise hold
+// up draining until the deadline.
+func (hub *eventHub) closeStreams() int {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	if hub.closing == nil {
+		hub.closing = make(chan struct{})
+	}
+	select {
+	case <-hub.closing:
+		return 0
+	default:
+	}
+	close(hub.closing)
+	return len(hub.subscribers)
+}
+
+// subscribe registers a subscriber, starting the board diff loop for the first one
+func (c *Controller) subscribe() chan Event {
+	hub := &c.events
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	if hub.subscribers == nil {
+		hub.subscribers = make(map[chan Event]struct{})
+	}
+	ch := make(chan Event, 16)
+	hub.subscribers[ch] = struct{}{}
+	if hub.stop == nil {
+		ctx, cancel := context.WithCancel(c.baseContext())
+		hub.stop = cancel
+		go c.watchBoard(ctx)
+	}
+	return ch
+}
+
+// unsubscribe removes a subscriber, stopping the board diff loop after the last one
+func (c *Controller) unsubscribe(ch chan Event) {
+	hub := &c.events
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	delete(hub.subscribers, ch)
+	if len(hub.subscribers) == 0 && hub.stop != nil {
+		hub.stop()
+		hub.stop = nil
+	}
+}
+
+// publish sends ev to every subscriber, dropping it for any that is behind
+func (hub *eventHub) publish(ev Event) {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	for ch := range hub.subscribers {
+		select {
+		case ch <- ev:
+		default:
+		}
+	}
+}
+
+// watchBoard screenshots the calibrated board every -board-poll-interval and
+// publishes board_changed when enough of it differs from the previous frame
+func (c *Controller) watchBoard(ctx context.Context) {
+	ticker := time.NewTicker(c.cfg.BoardPollInterval)
+	defer ticker.Stop()
+
+	var previous []byte
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+
+		cal, ok := c.calibration()
+		if !ok {
+			previous = nil
+			continue
+		}
+		shot, err := captureScreen(ctx)
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Printf("events: %v", err)
+			}
+			continue
+		}
+		if previous != nil {
+			board := rect{X: cal.X, Y: cal.Y, Width: cal.Width, Height: cal.Height}
+			changed, total, err := changedPixels(previous, shot, board, moveColorTolerance)
+			if err != nil {
+				log.Printf("events: %v", err)
+			} else if float64(changed) >= c.cfg.BoardChangeThreshold*float64(total) && changed > 0 {
+				c.events.publish(Event{Type: "board_changed", Time: time.Now(), ChangedPixels: changed})
+			}
+		}
+		previous = shot
+	}
+}
+
+// handleEvents streams server-sent events until the client disconnects, or
+// until shutdown, announced with a final shutdown event
+func (c *Controller) handleEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "Only GET method is allowed")
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "Streaming is not supported")
+		return
+	}
+
+	ch := c.subscribe()
+	defer c.unsubscribe(ch)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, ": connected\n\n")
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(eventHeartbeat)
+	defer heartbeat.Stop()
+	closing := c.events.closed()
+	for {
+		select {
+		case ev := <-ch:
+			data, err := json.Marshal(ev)
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", ev.Type, data)
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": heartbeat\n\n")
+		case <-closing:
+			fmt.Fprint(w, "event: shutdown\ndata: {}\n\n")
+			flusher.Flush()
+			return
+		case <-r.Context().Done():
+			return
+		}
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// commandEnvKey carries environment overrides for spawned commands in a context
+type commandEnvKey struct{}
+
+// withCommandEnv returns a copy of ctx whose spawned commands also get env
+// ("KEY=value" entries, later ones winning)
+func withCommandEnv(ctx context.Context, env ...string) context.Context {
+	prev, _ := ctx.Value(commandEnvKey{}).([]string)
+	merged := append(append([]string{}, prev...), env...)
+	return context.WithValue(ctx, commandEnvKey{}, merged)
+}
+
+// checkEnvVar checks a KEY=value entry for -command-env
+func checkEnvVar(s string) error {
+	key, _, ok := strings.Cut(s, "=")
+	switch {
+	case !ok:
+		return fmt.Errorf("%q is not KEY=value", s)
+	case key == "":
+		return fmt.Errorf("%q has no variable name", s)
+	case strings.ContainsAny(key, " \t\x00") || strings.ContainsRune(s, 0):
+		return fmt.Errorf("%q is not a valid variable", s)
+	}
+	return nil
+}
+
+type profileDirKey struct{}
+
+// withProfileDir returns a copy of ctx whose Firefox process checks only
+// match the instance using the profile directory dir
+func withProfileDir(ctx context.Context, dir string) context.Context {
+	return context.WithValue(ctx, profileDirKey{}, dir)
+}
+
+// newCommand is exec.CommandContext with the environment overrides carried by ctx
+// applied over the server's own environment
+func newCommand(ctx context.Context, name string, args ...string) *exec.Cmd {
+	if logCommands {
+		log.Printf("exec: %s", commandLine(name, args))
+	}
+	traceStep(ctx, "exec", commandLine(name, args))
+	spanEvent(ctx, "exec", stringAttr("process.command_line", commandLine(name, args)))
+	if t := fakeRunner.Load(); t != nil {
+		return fakeCommand(ctx, t, name, args)
+	}
+	cmd := exec.CommandContext(ctx, name, args...)
+	if env, _ := ctx.Value(commandEnvKey{}).([]string); len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
+	return cmd
+}
+
+// lookPath is exec.LookPath, except that under the fake runner every tool
+// is found, so a replay takes the same paths on every machine
+func lookPath(name string) (string, error) {
+	if fakeRunner.Load() != nil {
+		return name, nil
+	}
+	return exec.LookPath(name)
+}
+
+// Command logging, set up from the config by configureCommandLog
+var (
+	logCommands   bool
+	redactPattern *regexp.Regexp // matches the values of redacted query parameters
+)
+
+// configureCommandLog enables -log-commands with values of the -redact-params
+// query parameters hidden
+func configureCommandLog(cfg *Config) {
+	logCommands = cfg.LogCommands
+	var names []string
+	for _, name := range cfg.RedactParams {
+		names = append(names, regexp.QuoteMeta(name))
+	}
+	if len(names) > 0 {
+		redactPattern = regexp.MustCompile(`(?i)([?&;](?:` + strings.Join(names, "|") + `)=)[^&;#\s'"]*`)
+	}
+}
+
+// redact hides the values of redacted query parameters anywhere in s
+func redact(s string) string {
+	if redactPattern == nil {
+		return s
+	}
+	return redactPattern.ReplaceAllString(s, "${1}REDACTED")
+}
+
+// commandLine formats a command for logs and debug traces, redacted and quoted
+func commandLine(name string, args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = strconv.Quote(redact(arg))
+	}
+	return name + " " + strings.Join(quoted, " ")
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// FillRequest represents the JSON payload for /fill
+type FillRequest struct {
+	Selector string `json:"selector"`
+	Text     string `json:"text"`
+}
+
+// fillScript focuses the element matching arguments[0] and sets its value to
+// arguments[1], returning false if nothing matches. The value is set through
+// the prototype setter so frameworks that track the property see the change.
+const fillScript = `
+const el = document.querySelector(arguments[0]);
+if (!el) { return false; }
+el.focus();
+const proto = el instanceof HTMLTextAreaElement ? HTMLTextAreaElement.prototype
+	: el instanceof HTMLInputElement ? HTMLInputElement.prototype : null;
+const setter = proto && Object.getOwnPropertyDescriptor(proto, 'value').set;
+if (setter) {
+	setter.call(el, arguments[1]);
+} else if (el.isContentEditable) {
+	el.textContent = arguments[1];
+} else {
+	el.value = arguments[1];
+}
+el.dispatchEvent(new Event('input', {bubbles: true}));
+el.dispatchEvent(new Event('change', {bubbles: true}));
+return true;`
+
+// handleFill types text into the element matching a CSS selector, only on
+// pages in -allowed-domains when it is set
+func (c *Controller) handleFill(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "Only POST method is allowed")
+		return
+	}
+	if c.marionette == nil {
+		writeError(w, http.StatusNotImplemented, "Filling by selector requires the marionette backend")
+		return
+	}
+
+	var req FillRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid JSON payload")
+		return
+	}
+	if req.Selector == "" {
+		writeError(w, http.StatusBadRequest, "Selector cannot be empty")
+		return
+	}
+
+	var found bool
+	err := c.command(r, func() error {
+		if err := c.checkPageAllowed(r.Context()); err != nil {
+			return err
+		}
+		return c.marionette.ExecuteScript(r.Context(), fillScript, []interface{}{req.Selector, req.Text}, &found)
+	})
+	if perr, ok := err.(*pageNotAllowedError); ok {
+		writeError(w, http.StatusForbidden, fmt.Sprintf("Refusing to fill %s: %v", req.Selector, perr))
+		return
+	}
+	if err != nil {
+		writeCommandError(w, err, fmt.Sprintf("Failed to fill %s: %v", req.Selector, err))
+		return
+	}
+	if !found {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("No element matches %s", req.Selector))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, Response{
+		Success: true,
+		Message: fmt.Sprintf("Filled %s", req.Selector),
+	})
+}
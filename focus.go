@@ -0,0 +1,250 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// psWindowType defines a PowerShell type wrapping the user32 window functions
+const psWindowType = `
+Add-Type @"
+using System;
+using System.Runtime.InteropServices;
+public class BrowserControllerWindow {
+    [DllImport("user32.dll")] public static extern IntPtr GetForegroundWindow();
+    [DllImport("user32.dll")] public static extern bool SetForegroundWindow(IntPtr hwnd);
+    [DllImport("user32.dll")] public static extern bool MoveWindow(IntPtr hwnd, int x, int y, int width, int height, bool repaint);
+}
+"@
+`
+
+// psForegroundExit is the exit code psForegroundGuard uses when another window has focus
+const psForegroundExit = 3
+
+// psForegroundGuard defines Assert-Foreground, which exits the script before
+// a SendKeys burst if the given window is no longer foreground, e.g. because
+// a UAC or SmartScreen prompt took focus. It needs psWindowType.
+const psForegroundGuard = `
+function Assert-Foreground($hwnd) {
+	$foreground = [BrowserControllerWindow]::GetForegroundWindow()
+	if ($foreground -ne $hwnd) {
+		exit 3
+	}
+}
+`
+
+// errFocusStolen is returned when another window took focus before keystrokes were sent
+var errFocusStolen = errors.New("another window, such as a UAC or SmartScreen prompt, took focus from Firefox; stopped sending keystrokes")
+
+// checkForegroundExit maps the psForegroundGuard exit code to errFocusStolen
+func checkForegroundExit(err error) error {
+	if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == psForegroundExit {
+		return errFocusStolen
+	}
+	return err
+}
+
+// activeWindow returns an identifier for the window that currently has focus:
+// the X window id on Linux, the frontmost application name on macOS and the
+// window handle on Windows
+func activeWindow(ctx context.Context) (string, error) {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "linux":
+		cmd = newCommand(ctx, "xdotool", "getactivewindow")
+	case "darwin":
+		cmd = newCommand(ctx, "osascript", "-e", `tell application "System Events" to get name of first application process whose frontmost is true`)
+	case "windows":
+		cmd = newCommand(ctx, "powershell", "-Command", psWindowType+`[BrowserControllerWindow]::GetForegroundWindow().ToInt64()`)
+	default:
+		return "", fmt.Errorf("unsupported operating system: %s", runtime.GOOS)
+	}
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to read active window: %v", err)
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// activateWindow gives focus back to a window identified by activeWindow
+func activateWindow(ctx context.Context, id string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "linux":
+		cmd = newCommand(ctx, "xdotool", "windowactivate", id)
+	case "darwin":
+		cmd = newCommand(ctx, "osascript", "-e", fmt.Sprintf(`tell application "%s" to activate`, strings.ReplaceAll(id, `"`, `\"`)))
+	case "windows":
+		cmd = newCommand(ctx, "powershell", "-Command", psWindowType+fmt.Sprintf(`[void][BrowserControllerWindow]::SetForegroundWindow([IntPtr]%s)`, id))
+	default:
+		return fmt.Errorf("unsupported operating system: %s", runtime.GOOS)
+	}
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to activate window %s: %v %s", id, err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// focusPacer spaces out actions that take focus, for -min-action-interval.
+// It is only used under the command lock.
+type focusPacer struct {
+	last time.Time // when the last focus-taking action finished
+}
+
+// focusSettle is -focus-settle for this OS, set at startup
+var focusSettle time.Duration
+
+// parseFocusSettle parses -focus-settle, one duration for every OS or
+// comma-separated os=duration pairs such as "linux=30ms,windows=50ms", and
+// returns the one for goos
+func parseFocusSettle(s, goos string) (time.Duration, error) {
+	var settle time.Duration
+	found := false
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(part, "=")
+		if !ok {
+			name, value = "", part
+		}
+		switch name {
+		case "", "linux", "darwin", "windows":
+		default:
+			return 0, fmt.Errorf("unknown OS %q; use linux, darwin or windows", name)
+		}
+		d, err := time.ParseDuration(value)
+		if err != nil || d < 0 || d > time.Second {
+			return 0, fmt.Errorf("%q must be a duration between 0 and 1s", value)
+		}
+		if name == goos || (name == "" && !found) {
+			settle, found = d, name == goos
+		}
+	}
+	return settle, nil
+}
+
+// settleFocus waits -focus-settle after the browser window was activated,
+// for compositors that deliver input to a window only some time after
+// reporting it active
+func settleFocus(ctx context.Context) error {
+	if focusSettle <= 0 || (runtime.GOOS == "linux" && ctxDevices(ctx).windowInput) {
+		return nil
+	}
+	defer timeStep(ctx, "focus_settle")()
+	select {
+	case <-time.After(focusSettle):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// actionsPaced counts focus-taking actions held back by -min-action-interval, for /metrics
+var actionsPaced atomic.Int64
+
+// pace waits until -min-action-interval has passed since the last
+// focus-taking action. Unlike rate limiting it never rejects the request,
+// unless ctx ends while waiting.
+func (c *Controller) pace(ctx context.Context) error {
+	wait := c.cfg.MinActionInterval - time.Since(c.pacer.last)
+	if c.pacer.last.IsZero() || wait <= 0 {
+		return nil
+	}
+	actionsPaced.Add(1)
+	log.Printf("pacing: holding the action %v for -min-action-interval", wait.Round(time.Millisecond))
+	done := timeStep(ctx, "pacing")
+	defer done()
+	select {
+	case <-time.After(wait):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// focusCommand is command for actions that bring Firefox to the front. With
+// -restore-focus, the window that was active beforehand is re-activated
+// afterwards, so the bot can play while someone works in another window.
+// With -min-action-interval they are paced to that gap, and with
+// -check-challenge they fail with a *challengeError instead of sending input
+// to a bot-challenge page, with -recover-crashed-tab a crashed tab is
+// restored first, and with -check-screen-lock with a
+// *screenLockError instead of sending it to a lock screen. With
+// -match-window, focusFirefox activates the window showing the game.
+func (c *Controller) focusCommand(r *http.Request, fn func() error) error {
+	if c.cfg.MatchWindow {
+		action := fn
+		fn = func() error {
+			c.matchGameWindow(r.Context())
+			return action()
+		}
+	}
+	if c.cfg.CheckChallenge && !challengeCheckSkipped[r.URL.Path] {
+		action := fn
+		fn = func() error {
+			if err := c.checkChallenge(r.Context()); err != nil {
+				return err
+			}
+			return action()
+		}
+	}
+	if c.cfg.RecoverCrashedTab {
+		action := fn
+		fn = func() error {
+			if err := c.recoverCrashedTab(r.Context()); err != nil {
+				return err
+			}
+			return action()
+		}
+	}
+	if c.cfg.CheckScreenLock {
+		action := fn
+		fn = func() error {
+			if err := c.checkScreenLock(r.Context()); err != nil {
+				return err
+			}
+			return action()
+		}
+	}
+	if c.cfg.MinActionInterval > 0 {
+		inner := fn
+		fn = func() error {
+			if err := c.pace(r.Context()); err != nil {
+				return err
+			}
+			defer func() { c.pacer.last = time.Now() }()
+			return inner()
+		}
+	}
+	if !c.cfg.RestoreFocus {
+		return c.command(r, fn)
+	}
+	return c.command(r, func() error {
+		prev, err := activeWindow(r.Context())
+		if err != nil {
+			log.Printf("restore-focus: %v", err)
+		}
+
+		actionErr := fn()
+
+		if prev != "" {
+			// Restore even if the request ran out of time
+			ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), 5*time.Second)
+			defer cancel()
+			if err := activateWindow(ctx, prev); err != nil {
+				log.Printf("restore-focus: %v", err)
+			}
+		}
+		return actionErr
+	})
+}
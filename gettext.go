@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// getTextScript returns the trimmed text of the first element matching
+// arguments[0], null when nothing matches, or {error} for a selector the
+// browser can't parse
+const getTextScript = `
+let el;
+try { el = document.querySelector(arguments[0]); } catch (e) { return {error: e.message}; }
+return el ? {text: el.textContent.replace(/\s+/g, ' ').trim()} : null;`
+
+// GetTextResponse is the Response for /get-text
+type GetTextResponse struct {
+	Response
+	Selector string `json:"selector"`
+	Found    bool   `json:"found"`
+	Text     string `json:"text"` // empty when nothing matches
+}
+
+// handleGetText returns the text of the first element matching ?selector=,
+// such as an opponent's name or the result banner, with runs of whitespace
+// collapsed. A selector matching nothing is not an error: found is false.
+func (c *Controller) handleGetText(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "Only GET method is allowed")
+		return
+	}
+	if c.marionette == nil {
+		writeError(w, http.StatusNotImplemented, "Reading element text requires the marionette backend")
+		return
+	}
+	selector := r.URL.Query().Get("selector")
+	if selector == "" {
+		writeError(w, http.StatusBadRequest, "selector is required")
+		return
+	}
+
+	var result *struct {
+		Text  string `json:"text"`
+		Error string `json:"error"`
+	}
+	err := c.command(r, func() error {
+		return c.marionette.ExecuteScript(r.Context(), getTextScript, []interface{}{selector}, &result)
+	})
+	if err != nil {
+		writeCommandError(w, err, fmt.Sprintf("Failed to read %s: %v", selector, err))
+		return
+	}
+	if result != nil && result.Error != "" {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("Invalid selector %q: %s", selector, result.Error))
+		return
+	}
+
+	resp := GetTextResponse{
+		Response: Response{Success: true, Message: fmt.Sprintf("No element matches %s", selector)},
+		Selector: selector,
+	}
+	if result != nil {
+		resp.Found, resp.Text = true, result.Text
+		resp.Message = fmt.Sprintf("Read the text of %s", selector)
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// -replay-commands feeds a JSON-lines action log through the controller
+// with a fake command runner and compares the commands it would have run
+// against a golden file, so changes to the per-OS command lines show up in
+// CI. Golden files are specific to the OS they were recorded on.
+
+// fakeExecEnv makes the server binary exit successfully at once. The fake
+// runner starts the binary itself with it set instead of the real command.
+const fakeExecEnv = "BROWSER_CONTROLLER_FAKE_EXEC"
+
+// exitIfFakeExec ends a process started by the fake runner. It is the first
+// thing main does.
+func exitIfFakeExec() {
+	if os.Getenv(fakeExecEnv) == "1" {
+		os.Exit(0)
+	}
+}
+
+// ReplayAction is one line of an action log: a request to an endpoint
+type ReplayAction struct {
+	Method string          `json:"method"` // defaults to POST
+	Path   string          `json:"path"`
+	Body   json.RawMessage `json:"body"`
+}
+
+// fakeRunner records command lines instead of running them, when set. It is
+// swapped by replayCommands while request and background goroutines read it.
+var fakeRunner atomic.Pointer[commandTranscript]
+
+// commandTranscript collects the lines of a replay in order
+type commandTranscript struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+func (t *commandTranscript) add(line string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.lines = append(t.lines, line)
+}
+
+// mark returns the position the next line will be added at
+func (t *commandTranscript) mark() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.lines)
+}
+
+// insert puts line at position i, as returned by mark
+func (t *commandTranscript) insert(i int, line string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.lines = slices.Insert(t.lines, i, line)
+}
+
+// snapshot returns a copy of the lines so far
+func (t *commandTranscript) snapshot() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return slices.Clone(t.lines)
+}
+
+// tempPathPattern matches paths under the temp directory, whose names are random
+var tempPathPattern = regexp.MustCompile(regexp.QuoteMeta(os.TempDir()) + `[/\\][^"]*`)
+
+// fakeCommand records the command and returns one that runs this binary
+// with fakeExecEnv, which exits 0 with no output
+func fakeCommand(ctx context.Context, t *commandTranscript, name string, args []string) *exec.Cmd {
+	t.add("  " + tempPathPattern.ReplaceAllString(commandLine(name, args), "<tmp>"))
+	self, err := os.Executable()
+	if err != nil {
+		self = os.Args[0]
+	}
+	cmd := exec.CommandContext(ctx, self)
+	cmd.Env = append(os.Environ(), fakeExecEnv+"=1")
+	return cmd
+}
+
+// loadActionLog reads a JSON-lines action log, skipping blank lines
+func loadActionLog(path string) ([]ReplayAction, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var actions []ReplayAction
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1<<20)
+	for n := 1; scanner.Scan(); n++ {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var a ReplayAction
+		if err := json.Unmarshal(line, &a); err != nil {
+			return nil, fmt.Errorf("line %d: %v", n, err)
+		}
+		if !strings.HasPrefix(a.Path, "/") {
+			return nil, fmt.Errorf("line %d: path %q must start with /", n, a.Path)
+		}
+		if a.Method == "" {
+			a.Method = http.MethodPost
+		}
+		actions = append(actions, a)
+	}
+	return actions, scanner.Err()
+}
+
+// replayCommands runs the actions through the controller under the fake
+// runner and returns the transcript: each action with its status, followed
+// by the commands it ran
+func (c *Controller) replayCommands(ctx context.Context, actions []ReplayAction) ([]string, error) {
+	transcript := &commandTranscript{}
+	fakeRunner.Store(transcript)
+	defer fakeRunner.Store(nil)
+
+	if err := c.lock(ctx, "replay-commands"); err != nil {
+		return nil, err
+	}
+	defer c.unlock()
+	for _, a := range actions {
+		start := transcript.mark()
+		rec, err := c.dispatchLockedMethod(ctx, a.Method, a.Path, a.Body)
+		if err != nil {
+			return nil, fmt.Errorf("%s %s: %v", a.Method, a.Path, err)
+		}
+		// Each action heads the commands it ran
+		transcript.insert(start, fmt.Sprintf("%s %s -> %d", a.Method, a.Path, rec.status))
+	}
+	return transcript.snapshot(), nil
+}
+
+// runGoldenReplay replays -replay-commands and checks the transcript
+// against -golden, or rewrites it with -update-golden
+func (c *Controller) runGoldenReplay() error {
+	actions, err := loadActionLog(c.cfg.ReplayCommands)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %v", c.cfg.ReplayCommands, err)
+	}
+	lines, err := c.replayCommands(c.baseContext(), actions)
+	if err != nil {
+		return err
+	}
+	got := strings.Join(lines, "\n") + "\n"
+
+	if c.cfg.Golden == "" {
+		fmt.Print(got)
+		return nil
+	}
+	if c.cfg.UpdateGolden {
+		if err := os.MkdirAll(filepath.Dir(c.cfg.Golden), 0o755); err != nil {
+			return err
+		}
+		return os.WriteFile(c.cfg.Golden, []byte(got), 0o644)
+	}
+	want, err := os.ReadFile(c.cfg.Golden)
+	if err != nil {
+		return fmt.Errorf("failed to read golden file: %v", err)
+	}
+	wantLines := strings.Split(strings.TrimSuffix(strings.ReplaceAll(string(want), "\r\n", "\n"), "\n"), "\n")
+	for i := 0; i < len(lines) || i < len(wantLines); i++ {
+		var g, w string
+		if i < len(lines) {
+			g = lines[i]
+		}
+		if i < len(wantLines) {
+			w = wantLines[i]
+		}
+		if g != w {
+			return fmt.Errorf("%s differs at line %d:\n  want: %s\n  got:  %s\nrerun with -update-golden if the change is intended", c.cfg.Golden, i+1, w, g)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// TestMain lets the fake runner start this test binary as its stand-in command
+func TestMain(m *testing.M) {
+	exitIfFakeExec()
+	os.Exit(m.Run())
+}
+
+func TestReplayCommandsConcurrentCommands(t *testing.T) {
+	c := newController(&Config{})
+	actions := []ReplayAction{
+		{Method: "POST", Path: "/calibrate", Body: []byte(`{"x":0,"y":0,"width":800,"height":800}`)},
+		{Method: "POST", Path: "/key", Body: []byte(`{"key":"Escape"}`)},
+		{Method: "POST", Path: "/key", Body: []byte(`{"key":"ctrl+shift+k"}`)},
+	}
+
+	// Background goroutines start commands while the replay swaps the runner
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ctx.Err() == nil {
+				lookPath("xdotool")
+				newCommand(ctx, "true")
+			}
+		}()
+	}
+	var lines []string
+	var err error
+	for i := 0; i < 2 && err == nil; i++ {
+		lines, err = c.replayCommands(context.Background(), actions)
+	}
+	cancel()
+	wg.Wait()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var heads []string
+	for _, line := range lines {
+		if !strings.HasPrefix(line, "  ") {
+			heads = append(heads, line)
+		}
+	}
+	want := []string{"POST /calibrate -> 200", "POST /key -> 200", "POST /key -> 200"}
+	if strings.Join(heads, "\n") != strings.Join(want, "\n") {
+		t.Errorf("replay transcript heads = %q, want %q\n%s", heads, want, strings.Join(lines, "\n"))
+	}
+}
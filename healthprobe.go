@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// healthProbeTimeout bounds each /health?deep=1 probe
+	healthProbeTimeout = 10 * time.Second
+	// deepHealthTimeout bounds a whole /health?deep=1, waiting for the
+	// command mutex included
+	deepHealthTimeout = 30 * time.Second
+)
+
+// HealthProbe is the outcome of one /health?deep=1 probe
+type HealthProbe struct {
+	Name     string `json:"name"`
+	Passed   bool   `json:"passed"`
+	Required bool   `json:"required"` // a failure makes the controller unhealthy
+	Skipped  string `json:"skipped,omitempty"`
+	Error    string `json:"error,omitempty"`
+	Ms       int64  `json:"ms"`
+}
+
+// runHealthProbes exercises each capability the command path depends on,
+// as the startup self-test does, and times each. It runs holding the
+// command mutex.
+func (c *Controller) runHealthProbes(ctx context.Context) []HealthProbe {
+	var probes []HealthProbe
+	probe := func(name string, required bool, fn func(ctx context.Context) error) {
+		pctx, cancel := context.WithTimeout(ctx, healthProbeTimeout)
+		defer cancel()
+		start := time.Now()
+		err := fn(pctx)
+		p := HealthProbe{Name: name, Passed: err == nil, Required: required, Ms: time.Since(start).Milliseconds()}
+		if err != nil {
+			p.Error = err.Error()
+		}
+		probes = append(probes, p)
+	}
+	skip := func(name, reason string) {
+		probes = append(probes, HealthProbe{Name: name, Skipped: reason})
+	}
+
+	if firefoxRunning(ctx) {
+		probe("focus", true, focusFirefox)
+		probe("title", false, func(ctx context.Context) error {
+			var title string
+			var err error
+			if c.marionette != nil {
+				title, err = c.marionette.Title(ctx)
+			} else {
+				title, err = firefoxWindowTitle(ctx)
+			}
+			if err == nil && title == "" {
+				return fmt.Errorf("window title is empty")
+			}
+			return err
+		})
+	} else {
+		skip("focus", "Firefox is not running")
+		skip("title", "Firefox is not running")
+	}
+
+	probe("screenshot", true, func(ctx context.Context) error {
+		// Taken afresh rather than from the screen cache, and cut down to a
+		// corner to check it decodes
+		shot, err := captureScreenNow(ctx)
+		if err != nil {
+			return err
+		}
+		_, err = cropPNG(shot, rect{Width: 16, Height: 16})
+		return err
+	})
+
+	if tool, err := findClipboardTool(); err != nil {
+		skip("clipboard", err.Error())
+	} else {
+		probe("clipboard", false, func(ctx context.Context) error {
+			working, got, _, err := clipboardRoundTrip(ctx, tool)
+			c.clipboard.set(err == nil && working)
+			if err == nil && !working {
+				return fmt.Errorf("read back %q instead of what %s wrote", got, tool.name)
+			}
+			return err
+		})
+	}
+
+	if c.marionette != nil {
+		probe("marionette", true, func(context.Context) error {
+			_, err := c.marionette.CurrentURL(ctx)
+			return err
+		})
+	}
+	return probes
+}
+
+// deepHealthRequested reports whether r asks for active probes with ?deep=1
+func deepHealthRequested(r *http.Request) bool {
+	on, err := strconv.ParseBool(r.URL.Query().Get("deep"))
+	return err == nil && on
+}
+
+// handleDeepHealth serves /health?deep=1: instead of the cached state, it
+// focuses the browser, reads its title, takes a screenshot and checks the
+// clipboard, reporting 503 when a required probe fails
+func (c *Controller) handleDeepHealth(w http.ResponseWriter, r *http.Request, resp HealthResponse) {
+	ctx, cancel := context.WithTimeout(r.Context(), deepHealthTimeout)
+	defer cancel()
+	r = r.WithContext(ctx)
+
+	err := c.command(r, func() error {
+		resp.Probes = c.runHealthProbes(r.Context())
+		return nil
+	})
+	if err != nil {
+		writeCommandError(w, err, fmt.Sprintf("Health probes did not run: %v", err))
+		return
+	}
+
+	var failed []string
+	for _, p := range resp.Probes {
+		if !p.Passed && p.Skipped == "" && p.Required {
+			failed = append(failed, p.Name)
+		}
+	}
+	if len(failed) > 0 {
+		resp.Response = Response{Success: false, Message: "Probes failed: " + strings.Join(failed, ", "), ErrorCode: codeUnavailable}
+		resp.Healthy = false
+		writeJSON(w, http.StatusServiceUnavailable, resp)
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// maxHoverDwell caps how long /hover keeps the command mutex
+const maxHoverDwell = 10 * time.Second
+
+// HoverRequest represents the JSON payload for /hover. Either a square or
+// both coordinates must be given.
+type HoverRequest struct {
+	X       *int   `json:"x"`
+	Y       *int   `json:"y"`
+	Square  string `json:"square"`
+	DwellMs int    `json:"dwell_ms"` // how long to stay so hover handlers fire
+}
+
+// HoverResponse is the Response for /hover
+type HoverResponse struct {
+	Response
+	Point point `json:"point"`
+}
+
+// handleHover moves the mouse over a point or square without clicking
+func (c *Controller) handleHover(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "Only POST method is allowed")
+		return
+	}
+
+	var req HoverRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid JSON payload")
+		return
+	}
+	dwell := time.Duration(req.DwellMs) * time.Millisecond
+	if dwell < 0 || dwell > maxHoverDwell {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("dwell_ms must be between 0 and %d", maxHoverDwell.Milliseconds()))
+		return
+	}
+
+	var target point
+	switch {
+	case req.Square != "":
+		cal, ok := c.calibration()
+		if !ok {
+			writeErrorCode(w, http.StatusConflict, codeCalibrationMissing, "Board is not calibrated")
+			return
+		}
+		p, err := cal.squareCenter(req.Square)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("Invalid square: %v", err))
+			return
+		}
+		target = p
+	case req.X != nil && req.Y != nil:
+		target = point{X: *req.X, Y: *req.Y}
+	default:
+		writeError(w, http.StatusBadRequest, "Either square or x and y are required")
+		return
+	}
+
+	err := c.focusCommand(r, func() error {
+		if err := focusFirefox(r.Context()); err != nil {
+			return err
+		}
+		if err := mouseMove(r.Context(), target); err != nil {
+			return err
+		}
+		select {
+		case <-time.After(dwell):
+			return nil
+		case <-r.Context().Done():
+			return r.Context().Err()
+		}
+	})
+	if err != nil {
+		writeCommandError(w, err, fmt.Sprintf("Failed to hover: %v", err))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, HoverResponse{
+		Response: Response{
+			Success: true,
+			Message: fmt.Sprintf("Hovered at %d,%d", target.X, target.Y),
+		},
+		Point: target,
+	})
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+	"net/http"
+	"time"
+)
+
+// Default /human-move ranges, in milliseconds
+var (
+	defaultThinkMs        = []int{800, 2500}
+	defaultDragDurationMs = []int{250, 600}
+	defaultPauseMs        = []int{100, 300}
+)
+
+const (
+	defaultHumanJitter = 2
+	// defaultHumanSteps is the least number of waypoints a human drag has
+	defaultHumanSteps = 10
+	// humanCurve is the most a drag bows away from the straight line, as a
+	// fraction of its length
+	humanCurve = 0.15
+)
+
+// HumanMoveRequest represents the JSON payload for /human-move. Each range
+// is [min, max] in milliseconds, or a single fixed value, and a time is
+// picked uniformly from it.
+type HumanMoveRequest struct {
+	Move           string `json:"move"`             // UCI notation, e.g. "e2e4" or "e7e8q"
+	ThinkMs        []int  `json:"think_ms"`         // waited before the move, without holding the command mutex
+	DragDurationMs []int  `json:"drag_duration_ms"` // how long the drag takes from press to release
+	PauseMs        []int  `json:"pause_ms"`         // waited after the move, before the next command
+	JitterPx       *int   `json:"jitter_px"`        // how far each point may stray, at most a quarter square
+	Steps          *int   `json:"steps"`            // waypoints between press and release
+	Verify         bool   `json:"verify"`           // check the destination square changed, retrying the move if not
+	Retries        *int   `json:"retries"`          // defaults to -move-retries
+}
+
+// HumanMoveResponse is the Response for /human-move, with the timings used
+type HumanMoveResponse struct {
+	DragResponse
+	Move           string  `json:"move"`
+	Attempts       int     `json:"attempts"`
+	ThinkMs        int64   `json:"think_ms"`
+	DragDurationMs int64   `json:"drag_duration_ms"`
+	PauseMs        int64   `json:"pause_ms"`
+	DragPath       []point `json:"drag_path"`
+	// OrientationCorrected is set when -orientation-check found the board
+	// flipped and updated the calibration first
+	OrientationCorrected bool `json:"orientation_corrected,omitempty"`
+}
+
+// pickDuration picks a time from a [min, max] range in milliseconds, or
+// def when the range is empty
+func pickDuration(name string, ms, def []int, limit time.Duration) (time.Duration, error) {
+	if len(ms) == 0 {
+		ms = def
+	}
+	lo, hi := ms[0], ms[len(ms)-1]
+	switch {
+	case len(ms) > 2:
+		return 0, fmt.Errorf("%s must be [min, max] or a single value", name)
+	case lo < 0:
+		return 0, fmt.Errorf("%s cannot be negative", name)
+	case lo > hi:
+		return 0, fmt.Errorf("%s minimum is above its maximum", name)
+	case time.Duration(hi)*time.Millisecond > limit:
+		return 0, fmt.Errorf("%s cannot be more than %v", name, limit)
+	}
+	return time.Duration(lo+rand.Intn(hi-lo+1)) * time.Millisecond, nil
+}
+
+// jitterPoint moves p by up to jitter pixels in each direction
+func jitterPoint(p point, jitter int) point {
+	if jitter <= 0 {
+		return p
+	}
+	return point{X: p.X + rand.Intn(2*jitter+1) - jitter, Y: p.Y + rand.Intn(2*jitter+1) - jitter}
+}
+
+// humanPath returns a drag from from to to that bows slightly to one side,
+// eases in and out so the pointer is slowest at the ends, and strays up to
+// jitter pixels at every point but the release
+func humanPath(from, to point, steps, jitter int) []point {
+	dx, dy := float64(to.X-from.X), float64(to.Y-from.Y)
+	// The curve's control point sits off the midpoint, perpendicular to the line
+	bow := (rand.Float64()*2 - 1) * humanCurve
+	cx, cy := float64(from.X)+dx/2-dy*bow, float64(from.Y)+dy/2+dx*bow
+	path := make([]point, 0, steps+2)
+	path = append(path, jitterPoint(from, jitter))
+	for i := 1; i <= steps; i++ {
+		t := float64(i) / float64(steps+1)
+		t = t * t * (3 - 2*t)
+		x := (1-t)*(1-t)*float64(from.X) + 2*(1-t)*t*cx + t*t*float64(to.X)
+		y := (1-t)*(1-t)*float64(from.Y) + 2*(1-t)*t*cy + t*t*float64(to.Y)
+		path = append(path, jitterPoint(point{X: int(math.Round(x)), Y: int(math.Round(y))}, jitter))
+	}
+	// A jittered release could land on the next square's edge, so it only
+	// strays half as far
+	return append(path, jitterPoint(to, jitter/2))
+}
+
+// handleHumanMove plays a UCI move the way a person would: it waits a think
+// time, drags along a slightly curved, uneven path at human speed, then
+// pauses before the next command. The think time is waited before taking
+// the command mutex, so other requests aren't held up by it; the pause is
+// waited holding it.
+func (c *Controller) handleHumanMove(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "Only POST method is allowed")
+		return
+	}
+
+	var req HumanMoveRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid JSON payload")
+		return
+	}
+	if _, _, _, err := parseUCIMove(req.Move); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("Invalid move: %v", err))
+		return
+	}
+	think, err := pickDuration("think_ms", req.ThinkMs, defaultThinkMs, maxRequestDelay)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	duration, err := pickDuration("drag_duration_ms", req.DragDurationMs, defaultDragDurationMs, maxRequestDelay)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	pause, err := pickDuration("pause_ms", req.PauseMs, defaultPauseMs, maxRequestDelay)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	steps := max(c.cfg.DragSteps, defaultHumanSteps)
+	if req.Steps != nil {
+		steps = *req.Steps
+	}
+	if steps < 1 {
+		writeError(w, http.StatusBadRequest, "steps must be at least 1")
+		return
+	}
+	retries := c.cfg.MoveRetries
+	if req.Retries != nil {
+		retries = *req.Retries
+	}
+	if retries < 0 {
+		writeError(w, http.StatusBadRequest, "retries cannot be negative")
+		return
+	}
+	if !req.Verify {
+		retries = 0
+	}
+
+	doneThink := timeStep(r.Context(), "think")
+	select {
+	case <-time.After(think):
+	case <-r.Context().Done():
+		writeCommandError(w, r.Context().Err(), fmt.Sprintf("Stopped while thinking about %s: %v", req.Move, r.Context().Err()))
+		return
+	}
+	doneThink()
+
+	// The board is looked up after thinking, as it may have been recalibrated meanwhile
+	corrected, err := c.checkOrientation(r.Context())
+	if err != nil {
+		writeOrientationError(w, err)
+		return
+	}
+	cal, ok := c.calibration()
+	if !ok {
+		writeErrorCode(w, http.StatusConflict, codeCalibrationMissing, "Board is not calibrated")
+		return
+	}
+	jitter := defaultHumanJitter
+	if req.JitterPx != nil {
+		jitter = *req.JitterPx
+	}
+	if jitter < 0 || jitter > cal.Width/32 {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("jitter_px must be between 0 and %d, a quarter of a square", cal.Width/32))
+		return
+	}
+	plan, _ := planMove(cal, req.Move, moveStyleDrag, c.confirmMode(r.Context()))
+	plan.path = humanPath(plan.from, plan.to, steps, jitter)
+	// The drag pauses after each waypoint
+	plan.stepDelay = duration / time.Duration(steps)
+
+	attempts := 0
+	err = c.focusCommand(r, func() error {
+		ctx := r.Context()
+		if err := focusFirefox(ctx); err != nil {
+			return err
+		}
+		var err error
+		if attempts, err = c.playMove(ctx, plan, req.Verify, retries); err != nil {
+			return err
+		}
+		defer timeStep(ctx, "pause")()
+		select {
+		case <-time.After(pause):
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+	if err == errMoveNotRegistered {
+		writeErrorCode(w, http.StatusUnprocessableEntity, codeMoveNotRegistered, fmt.Sprintf("Move %s did not register after %d attempts", req.Move, attempts))
+		return
+	}
+	if err != nil {
+		writeCommandError(w, err, fmt.Sprintf("Failed to play %s: %v", req.Move, err))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, HumanMoveResponse{
+		DragResponse: DragResponse{
+			Response: Response{
+				Success: true,
+				Message: fmt.Sprintf("Played %s after thinking %v", req.Move, think),
+			},
+			FromPoint: plan.path[0],
+			ToPoint:   plan.path[len(plan.path)-1],
+		},
+		Move:                 req.Move,
+		Attempts:             attempts,
+		ThinkMs:              think.Milliseconds(),
+		DragDurationMs:       duration.Milliseconds(),
+		PauseMs:              pause.Milliseconds(),
+		DragPath:             plan.path,
+		OrientationCorrected: corrected,
+	})
+}
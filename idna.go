@@ -0,0 +1,207 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+)
+
+// normalizeURL converts the host of raw to its ASCII (punycode) form and
+// percent-encodes any other non-ASCII characters, so the browser receives
+// text that types correctly regardless of keyboard layout. URLs without a
+// host, such as about:blank or data: URLs, are returned unchanged.
+func normalizeURL(raw string) (string, error) {
+	// Accept scheme-less input such as "lichess.org/abc" by parsing it as a network-path reference
+	u, err := url.Parse(raw)
+	schemeless := err != nil || u.Scheme == "" || bareHostPort(u)
+	if schemeless {
+		if u, err = url.Parse("//" + raw); err != nil {
+			return "", err
+		}
+	}
+	if u.Host == "" {
+		return raw, nil
+	}
+
+	host, err := toASCIIHost(u.Hostname())
+	if err != nil {
+		return "", err
+	}
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	if port := u.Port(); port != "" {
+		host = net.JoinHostPort(strings.Trim(host, "[]"), port)
+	}
+	u.Host = host
+	u.RawQuery = escapeNonASCII(u.RawQuery)
+
+	normalized := u.String()
+	if schemeless {
+		normalized = strings.TrimPrefix(normalized, "//")
+	}
+	return normalized, nil
+}
+
+// bareHostPort reports whether u, parsed with a scheme, is really a host
+// and port such as "localhost:8080/abc" or "example.com:8080": its
+// "scheme" has a dot in it or its opaque part starts with a port number
+func bareHostPort(u *url.URL) bool {
+	if strings.Contains(u.Scheme, ".") {
+		return true
+	}
+	port, _, _ := strings.Cut(u.Opaque, "/")
+	if port == "" {
+		return false
+	}
+	for i := 0; i < len(port); i++ {
+		if port[i] < '0' || port[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// toASCIIHost converts each non-ASCII label of host to its "xn--" punycode form.
+// Labels are lowercased first; this covers the common case of IDNA mapping
+// without the full UTS #46 tables.
+func toASCIIHost(host string) (string, error) {
+	// IDNA treats these as label separators too
+	host = strings.NewReplacer("。", ".", "．", ".", "｡", ".").Replace(host)
+
+	labels := strings.Split(host, ".")
+	for i, label := range labels {
+		if isASCII(label) {
+			continue
+		}
+		encoded, err := punycodeEncode(strings.ToLower(label))
+		if err != nil {
+			return "", fmt.Errorf("invalid host label %q: %v", label, err)
+		}
+		labels[i] = "xn--" + encoded
+	}
+	return strings.Join(labels, "."), nil
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+// escapeNonASCII percent-encodes the bytes of s that are outside ASCII
+func escapeNonASCII(s string) string {
+	if isASCII(s) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			fmt.Fprintf(&b, "%%%02X", s[i])
+		} else {
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String()
+}
+
+// Punycode parameters from RFC 3492 section 5
+const (
+	punyBase        = 36
+	punyTMin        = 1
+	punyTMax        = 26
+	punySkew        = 38
+	punyDamp        = 700
+	punyInitialBias = 72
+	punyInitialN    = 128
+)
+
+// punycodeEncode encodes a Unicode label using the RFC 3492 algorithm
+func punycodeEncode(label string) (string, error) {
+	runes := []rune(label)
+	var out []byte
+	for _, r := range runes {
+		if r < utf8.RuneSelf {
+			out = append(out, byte(r))
+		}
+	}
+	basic := len(out)
+	handled := basic
+	if basic > 0 {
+		out = append(out, '-')
+	}
+
+	n, delta, bias := punyInitialN, 0, punyInitialBias
+	for handled < len(runes) {
+		// Find the smallest code point not yet handled
+		m := int(utf8.MaxRune) + 1
+		for _, r := range runes {
+			if int(r) >= n && int(r) < m {
+				m = int(r)
+			}
+		}
+		delta += (m - n) * (handled + 1)
+		n = m
+
+		for _, r := range runes {
+			if int(r) < n {
+				delta++
+			}
+			if int(r) != n {
+				continue
+			}
+			q := delta
+			for k := punyBase; ; k += punyBase {
+				t := k - bias
+				if t < punyTMin {
+					t = punyTMin
+				} else if t > punyTMax {
+					t = punyTMax
+				}
+				if q < t {
+					break
+				}
+				out = append(out, punyDigit(t+(q-t)%(punyBase-t)))
+				q = (q - t) / (punyBase - t)
+			}
+			out = append(out, punyDigit(q))
+			bias = punyAdapt(delta, handled+1, handled == basic)
+			delta = 0
+			handled++
+		}
+		delta++
+		n++
+	}
+	// DNS labels are limited to 63 octets including the "xn--" prefix
+	if len(out) > 59 {
+		return "", fmt.Errorf("encoded label exceeds 63 characters")
+	}
+	return string(out), nil
+}
+
+func punyAdapt(delta, numPoints int, first bool) int {
+	if first {
+		delta /= punyDamp
+	} else {
+		delta /= 2
+	}
+	delta += delta / numPoints
+	k := 0
+	for delta > ((punyBase-punyTMin)*punyTMax)/2 {
+		delta /= punyBase - punyTMin
+		k += punyBase
+	}
+	return k + (punyBase-punyTMin+1)*delta/(delta+punySkew)
+}
+
+func punyDigit(d int) byte {
+	if d < 26 {
+		return byte('a' + d)
+	}
+	return byte('0' + d - 26)
+}
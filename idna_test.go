@@ -0,0 +1,35 @@
+package main
+
+import "testing"
+
+func TestNormalizeURL(t *testing.T) {
+	tests := []struct {
+		raw, want string
+	}{
+		{"bücher.de", "xn--bcher-kva.de"},
+		{"https://bücher.de", "https://xn--bcher-kva.de"},
+		{"https://MÜNCHEN.de/karte", "https://xn--mnchen-3ya.de/karte"},
+		{"https://bücher.de:8443/straße?q=ü", "https://xn--bcher-kva.de:8443/stra%C3%9Fe?q=%C3%BC"},
+		{"bücher.de:8443/suche", "xn--bcher-kva.de:8443/suche"},
+		{"例え。テスト/abc", "xn--r8jz45g.xn--zckzah/abc"},
+		{"lichess.org/abc", "lichess.org/abc"},
+		{"localhost:8080/abc", "localhost:8080/abc"},
+		{"https://lichess.org/abc?x=1", "https://lichess.org/abc?x=1"},
+		{"about:blank", "about:blank"},
+		{"data:text/html,<p>hi</p>", "data:text/html,<p>hi</p>"},
+		{"view-source:https://lichess.org/", "view-source:https://lichess.org/"},
+	}
+	for _, tt := range tests {
+		got, err := normalizeURL(tt.raw)
+		if err != nil {
+			t.Errorf("normalizeURL(%q): %v", tt.raw, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("normalizeURL(%q) = %q, want %q", tt.raw, got, tt.want)
+		}
+		if !isASCII(got) {
+			t.Errorf("normalizeURL(%q) = %q is not ASCII", tt.raw, got)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"strconv"
+)
+
+// Screenshot encodings
+const (
+	formatPNG  = "png"
+	formatJPEG = "jpeg"
+	formatWebP = "webp"
+)
+
+// defaultJPEGQuality keeps board pieces sharp at a fraction of the PNG size
+const defaultJPEGQuality = 80
+
+// imageFormat is how a screenshot is returned: lossless PNG, as captured,
+// or JPEG at quality 1-100 for smaller payloads
+type imageFormat struct {
+	name    string
+	quality int
+}
+
+// parseImageFormat checks a requested format and quality; an empty format
+// is PNG and a zero quality the default
+func parseImageFormat(format string, quality int) (imageFormat, error) {
+	switch format {
+	case "", formatPNG:
+		if quality != 0 {
+			return imageFormat{}, fmt.Errorf("quality only applies to %s", formatJPEG)
+		}
+		return imageFormat{name: formatPNG}, nil
+	case formatJPEG, "jpg":
+		if quality == 0 {
+			quality = defaultJPEGQuality
+		}
+		if quality < 1 || quality > 100 {
+			return imageFormat{}, fmt.Errorf("quality must be between 1 and 100")
+		}
+		return imageFormat{name: formatJPEG, quality: quality}, nil
+	case formatWebP:
+		// Go's image packages, x/image included, only decode WebP
+		return imageFormat{}, fmt.Errorf("%s is not supported, as Go has no WebP encoder; use %s", formatWebP, formatJPEG)
+	}
+	return imageFormat{}, fmt.Errorf("unknown format %q; use %s or %s", format, formatPNG, formatJPEG)
+}
+
+// queryImageFormat reads ?format= and ?quality=
+func queryImageFormat(r *http.Request) (imageFormat, error) {
+	quality := 0
+	if q := r.URL.Query().Get("quality"); q != "" {
+		var err error
+		if quality, err = strconv.Atoi(q); err != nil {
+			return imageFormat{}, fmt.Errorf("quality must be a number")
+		}
+	}
+	return parseImageFormat(r.URL.Query().Get("format"), quality)
+}
+
+// encode converts a PNG screenshot to the format
+func (f imageFormat) encode(shot []byte) ([]byte, error) {
+	if f.name != formatJPEG {
+		return shot, nil
+	}
+	img, err := png.Decode(bytes.NewReader(shot))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode screenshot: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: f.quality}); err != nil {
+		return nil, fmt.Errorf("failed to encode screenshot as JPEG: %v", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// contentType returns the format's MIME type
+func (f imageFormat) contentType() string {
+	if f.name == formatJPEG {
+		return "image/jpeg"
+	}
+	return "image/png"
+}
+
+// ext returns the format's file extension
+func (f imageFormat) ext() string {
+	if f.name == formatJPEG {
+		return ".jpg"
+	}
+	return ".png"
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// Mouse buttons, numbered as xdotool does
+const (
+	buttonLeft   = 1
+	buttonMiddle = 2
+	buttonRight  = 3
+)
+
+// psMouseType defines a PowerShell type wrapping the user32 mouse functions.
+// The here-string terminator must start its line, so this isn't indented.
+const psMouseType = `
+Add-Type @"
+using System;
+using System.Runtime.InteropServices;
+public class BrowserControllerMouse {
+    [DllImport("user32.dll")] public static extern bool SetCursorPos(int x, int y);
+    [DllImport("user32.dll")] public static extern void mouse_event(uint flags, uint dx, uint dy, uint data, UIntPtr extra);
+}
+"@
+`
+
+// psButtonFlags returns the mouse_event down and up flags for a button
+func psButtonFlags(button int) (down, up int, err error) {
+	switch button {
+	case buttonLeft:
+		return 0x0002, 0x0004, nil
+	case buttonMiddle:
+		return 0x0020, 0x0040, nil
+	case buttonRight:
+		return 0x0008, 0x0010, nil
+	}
+	return 0, 0, fmt.Errorf("unsupported mouse button %d", button)
+}
+
+// dragPath returns the pointer positions for a drag from from to to, with
+// -drag-steps evenly spaced points in between
+func (c *Controller) dragPath(from, to point) []point {
+	steps := c.cfg.DragSteps
+	path := make([]point, 0, steps+2)
+	path = append(path, from)
+	for i := 1; i <= steps; i++ {
+		path = append(path, point{
+			X: from.X + (to.X-from.X)*i/(steps+1),
+			Y: from.Y + (to.Y-from.Y)*i/(steps+1),
+		})
+	}
+	return append(path, to)
+}
+
+// mouseDrag presses button at the first point of path, moves through the
+// rest pausing delay between moves, and releases at the last point. Some
+// sites only register a drag after seeing intermediate mousemove events.
+func mouseDrag(ctx context.Context, path []point, delay time.Duration, button int) error {
+	defer invalidateScreenCache()
+	if len(path) < 2 {
+		return fmt.Errorf("drag path needs at least two points")
+	}
+	mapped := make([]point, len(path))
+	for i, p := range path {
+		mapped[i] = screenPoint(ctx, p)
+	}
+	path = mapped
+	from, to := path[0], path[len(path)-1]
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "linux":
+		return linuxInput(ctx).drag(ctx, path, delay, button)
+	case "darwin":
+		// cliclick only drags with the left button
+		if button != buttonLeft {
+			return fmt.Errorf("only the left button can drag on macOS")
+		}
+		args := []string{fmt.Sprintf("dd:%d,%d", from.X, from.Y)}
+		for _, p := range path[1 : len(path)-1] {
+			args = append(args, fmt.Sprintf("w:%d", delay.Milliseconds()), fmt.Sprintf("dm:%d,%d", p.X, p.Y))
+		}
+		args = append(args, fmt.Sprintf("du:%d,%d", to.X, to.Y))
+		cmd = newCommand(ctx, "cliclick", args...)
+	case "windows":
+		down, up, err := psButtonFlags(button)
+		if err != nil {
+			return err
+		}
+		var moves strings.Builder
+		for _, p := range path[1 : len(path)-1] {
+			fmt.Fprintf(&moves, "[void][BrowserControllerMouse]::SetCursorPos(%d, %d)\nStart-Sleep -Milliseconds %d\n", p.X, p.Y, delay.Milliseconds())
+		}
+		cmd = newCommand(ctx, "powershell", "-Command", psMouseType+fmt.Sprintf(`
+[void][BrowserControllerMouse]::SetCursorPos(%d, %d)
+[BrowserControllerMouse]::mouse_event(%d, 0, 0, 0, [UIntPtr]::Zero)
+Start-Sleep -Milliseconds 50
+%s[void][BrowserControllerMouse]::SetCursorPos(%d, %d)
+Start-Sleep -Milliseconds 50
+[BrowserControllerMouse]::mouse_event(%d, 0, 0, 0, [UIntPtr]::Zero)`, from.X, from.Y, down, moves.String(), to.X, to.Y, up))
+	default:
+		return fmt.Errorf("unsupported operating system: %s", runtime.GOOS)
+	}
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to drag mouse: %v %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// mouseClick clicks button at p
+func mouseClick(ctx context.Context, p point, button int) error {
+	defer invalidateScreenCache()
+	p = screenPoint(ctx, p)
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "linux":
+		return linuxInput(ctx).click(ctx, p, button)
+	case "darwin":
+		var action string
+		switch button {
+		case buttonLeft:
+			action = "c"
+		case buttonRight:
+			action = "rc"
+		default:
+			return fmt.Errorf("unsupported mouse button %d on macOS", button)
+		}
+		cmd = newCommand(ctx, "cliclick", fmt.Sprintf("%s:%d,%d", action, p.X, p.Y))
+	case "windows":
+		down, up, err := psButtonFlags(button)
+		if err != nil {
+			return err
+		}
+		cmd = newCommand(ctx, "powershell", "-Command", psMouseType+fmt.Sprintf(`
+[void][BrowserControllerMouse]::SetCursorPos(%d, %d)
+[BrowserControllerMouse]::mouse_event(%d, 0, 0, 0, [UIntPtr]::Zero)
+[BrowserControllerMouse]::mouse_event(%d, 0, 0, 0, [UIntPtr]::Zero)`, p.X, p.Y, down, up))
+	default:
+		return fmt.Errorf("unsupported operating system: %s", runtime.GOOS)
+	}
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to click: %v %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// mouseMove moves the pointer to p without clicking
+func mouseMove(ctx context.Context, p point) error {
+	defer invalidateScreenCache()
+	p = screenPoint(ctx, p)
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "linux":
+		return linuxInput(ctx).move(ctx, p)
+	case "darwin":
+		cmd = newCommand(ctx, "cliclick", fmt.Sprintf("m:%d,%d", p.X, p.Y))
+	case "windows":
+		cmd = newCommand(ctx, "powershell", "-Command", psMouseType+fmt.Sprintf(`
+[void][BrowserControllerMouse]::SetCursorPos(%d, %d)`, p.X, p.Y))
+	default:
+		return fmt.Errorf("unsupported operating system: %s", runtime.GOOS)
+	}
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to move mouse: %v %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
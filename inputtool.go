@@ -0,0 +1,301 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// inputTool synthesizes keyboard and mouse input on Linux. Keys use
+// xdotool's names, such as "ctrl+l" or "Return".
+type inputTool interface {
+	name() string
+	// probe checks the tool works in this session, not just that it is installed
+	probe(ctx context.Context) error
+	key(ctx context.Context, combo string) error
+	typeText(ctx context.Context, text string) error
+	move(ctx context.Context, p point) error
+	click(ctx context.Context, p point, button int) error
+	// drag presses at the first point of path, moves through the rest
+	// pausing delay between moves, and releases at the last
+	drag(ctx context.Context, path []point, delay time.Duration, button int) error
+}
+
+// inputTools are the supported Linux input tools by name
+var inputTools = map[string]inputTool{
+	"xdotool": xdotoolInput{},
+	"ydotool": ydotoolInput{},
+	"xte":     xteInput{},
+}
+
+// selectInputTool picks the first tool in order that is installed and
+// works, trying ydotool first on Wayland where the X tools only reach
+// XWayland clients
+func selectInputTool(ctx context.Context, order []string) (inputTool, error) {
+	if os.Getenv("XDG_SESSION_TYPE") == "wayland" {
+		preferred := []string{"ydotool"}
+		for _, name := range order {
+			if name != "ydotool" {
+				preferred = append(preferred, name)
+			}
+		}
+		order = preferred
+	}
+
+	var failures []string
+	for _, name := range order {
+		tool, ok := inputTools[name]
+		if !ok {
+			failures = append(failures, fmt.Sprintf("%s: unknown tool", name))
+			continue
+		}
+		if _, err := exec.LookPath(name); err != nil {
+			failures = append(failures, fmt.Sprintf("%s: not installed", name))
+			continue
+		}
+		if err := tool.probe(ctx); err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", name, err))
+			continue
+		}
+		return tool, nil
+	}
+	return nil, fmt.Errorf("no usable input tool (%s)", strings.Join(failures, "; "))
+}
+
+// runInput runs an input tool command, including its output in the error
+func runInput(ctx context.Context, name string, args ...string) error {
+	defer invalidateScreenCache()
+	if output, err := newCommand(ctx, name, args...).CombinedOutput(); err != nil {
+		return fmt.Errorf("%s failed: %v %s", name, err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+type xdotoolInput struct{}
+
+func (xdotoolInput) name() string { return "xdotool" }
+
+func (xdotoolInput) probe(ctx context.Context) error {
+	return runInput(ctx, "xdotool", "getmouselocation")
+}
+
+func (xdotoolInput) key(ctx context.Context, combo string) error {
+	return runInput(ctx, "xdotool", append(append([]string{"key"}, xdotoolWindowArgs(ctx)...), combo)...)
+}
+
+func (xdotoolInput) typeText(ctx context.Context, text string) error {
+	window := xdotoolWindowArgs(ctx)
+	if ctxDevices(ctx).keysyms {
+		return runInput(ctx, "xdotool", append(append([]string{"key", "--clearmodifiers"}, window...), textKeysyms(text)...)...)
+	}
+	return runInput(ctx, "xdotool", append(append([]string{"type", "--clearmodifiers"}, window...), text)...)
+}
+
+func (xdotoolInput) move(ctx context.Context, p point) error {
+	return runInput(ctx, "xdotool", "mousemove", strconv.Itoa(p.X), strconv.Itoa(p.Y))
+}
+
+func (xdotoolInput) click(ctx context.Context, p point, button int) error {
+	return runInput(ctx, "xdotool", "mousemove", strconv.Itoa(p.X), strconv.Itoa(p.Y), "click", strconv.Itoa(button))
+}
+
+func (xdotoolInput) drag(ctx context.Context, path []point, delay time.Duration, button int) error {
+	b := strconv.Itoa(button)
+	from, to := path[0], path[len(path)-1]
+	args := []string{"mousemove", strconv.Itoa(from.X), strconv.Itoa(from.Y), "mousedown", b}
+	for _, p := range path[1 : len(path)-1] {
+		args = append(args, "mousemove", strconv.Itoa(p.X), strconv.Itoa(p.Y), "sleep", strconv.FormatFloat(delay.Seconds(), 'f', 3, 64))
+	}
+	args = append(args, "mousemove", strconv.Itoa(to.X), strconv.Itoa(to.Y), "mouseup", b)
+	return runInput(ctx, "xdotool", args...)
+}
+
+// ydotoolInput drives the kernel uinput device through ydotoold, so it also
+// works on Wayland. It needs ydotool 1.0 or later.
+type ydotoolInput struct{}
+
+// ydotoolKeycodes maps xdotool key names to Linux input event codes
+var ydotoolKeycodes = map[string]int{
+	"ctrl": 29, "shift": 42, "alt": 56, "super": 125,
+	"Return": 28, "Escape": 1, "Tab": 15, "BackSpace": 14, "space": 57,
+	"1": 2, "2": 3, "3": 4, "4": 5, "5": 6, "6": 7, "7": 8, "8": 9, "9": 10, "0": 11,
+	"q": 16, "w": 17, "e": 18, "r": 19, "t": 20, "y": 21, "u": 22, "i": 23, "o": 24, "p": 25,
+	"a": 30, "s": 31, "d": 32, "f": 33, "g": 34, "h": 35, "j": 36, "k": 37, "l": 38,
+	"z": 44, "x": 45, "c": 46, "v": 47, "b": 48, "n": 49, "m": 50,
+}
+
+// ydotoolButtons maps mouse buttons to ydotool's button codes
+var ydotoolButtons = map[int]int{buttonLeft: 0x00, buttonRight: 0x01, buttonMiddle: 0x02}
+
+func (ydotoolInput) name() string { return "ydotool" }
+
+func (ydotoolInput) probe(ctx context.Context) error {
+	// a zero relative move fails when ydotoold isn't reachable
+	return runInput(ctx, "ydotool", "mousemove", "-x", "0", "-y", "0")
+}
+
+func (ydotoolInput) key(ctx context.Context, combo string) error {
+	names := strings.Split(combo, "+")
+	var down, up []string
+	for i, name := range names {
+		code, ok := ydotoolKeycodes[name]
+		if !ok {
+			return fmt.Errorf("ydotool: unsupported key %q", name)
+		}
+		down = append(down, fmt.Sprintf("%d:1", code))
+		up = append(up, fmt.Sprintf("%d:0", ydotoolKeycodes[names[len(names)-1-i]]))
+	}
+	return runInput(ctx, "ydotool", append([]string{"key"}, append(down, up...)...)...)
+}
+
+func (ydotoolInput) typeText(ctx context.Context, text string) error {
+	return runInput(ctx, "ydotool", "type", "--", text)
+}
+
+func (ydotoolInput) move(ctx context.Context, p point) error {
+	return runInput(ctx, "ydotool", "mousemove", "--absolute", "-x", strconv.Itoa(p.X), "-y", strconv.Itoa(p.Y))
+}
+
+func (t ydotoolInput) click(ctx context.Context, p point, button int) error {
+	code, ok := ydotoolButtons[button]
+	if !ok {
+		return fmt.Errorf("unsupported mouse button %d", button)
+	}
+	if err := t.move(ctx, p); err != nil {
+		return err
+	}
+	return runInput(ctx, "ydotool", "click", fmt.Sprintf("0x%02X", 0xC0|code))
+}
+
+// drag runs one ydotool command per step, so once it has pressed the button
+// it releases it even when a move fails or ctx expires, or it would stay held
+func (t ydotoolInput) drag(ctx context.Context, path []point, delay time.Duration, button int) (err error) {
+	code, ok := ydotoolButtons[button]
+	if !ok {
+		return fmt.Errorf("unsupported mouse button %d", button)
+	}
+	if err := t.move(ctx, path[0]); err != nil {
+		return err
+	}
+	// Releasing a button that isn't held does nothing, so the release
+	// follows a press that was interrupted too
+	defer func() {
+		releaseCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 2*time.Second)
+		defer cancel()
+		if releaseErr := runInput(releaseCtx, "ydotool", "click", fmt.Sprintf("0x%02X", 0x80|code)); releaseErr != nil {
+			if err == nil {
+				err = releaseErr
+			} else {
+				log.Printf("failed to release the mouse button after the drag failed: %v", releaseErr)
+			}
+		}
+	}()
+	if err := runInput(ctx, "ydotool", "click", fmt.Sprintf("0x%02X", 0x40|code)); err != nil {
+		return err
+	}
+	for i, p := range path[1:] {
+		if i > 0 {
+			select {
+			case <-time.After(delay):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		if err := t.move(ctx, p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// xteInput uses xte from xautomation, which only needs the XTEST extension
+type xteInput struct{}
+
+// xteModifiers maps xdotool modifier names to X keysyms
+var xteModifiers = map[string]string{
+	"ctrl": "Control_L", "shift": "Shift_L", "alt": "Alt_L", "super": "Super_L",
+}
+
+func (xteInput) name() string { return "xte" }
+
+func (xteInput) probe(ctx context.Context) error {
+	// xte exits with an error when it cannot open the display
+	return runInput(ctx, "xte", "usleep 1")
+}
+
+func (xteInput) key(ctx context.Context, combo string) error {
+	names := strings.Split(combo, "+")
+	var cmds []string
+	for _, name := range names[:len(names)-1] {
+		cmds = append(cmds, "keydown "+xteKeysym(name))
+	}
+	cmds = append(cmds, "key "+xteKeysym(names[len(names)-1]))
+	for i := len(names) - 2; i >= 0; i-- {
+		cmds = append(cmds, "keyup "+xteKeysym(names[i]))
+	}
+	return runInput(ctx, "xte", cmds...)
+}
+
+func xteKeysym(name string) string {
+	if sym, ok := xteModifiers[name]; ok {
+		return sym
+	}
+	return name
+}
+
+func (xteInput) typeText(ctx context.Context, text string) error {
+	return runInput(ctx, "xte", "str "+text)
+}
+
+func (xteInput) move(ctx context.Context, p point) error {
+	return runInput(ctx, "xte", fmt.Sprintf("mousemove %d %d", p.X, p.Y))
+}
+
+func (xteInput) click(ctx context.Context, p point, button int) error {
+	return runInput(ctx, "xte", fmt.Sprintf("mousemove %d %d", p.X, p.Y), fmt.Sprintf("mouseclick %d", button))
+}
+
+func (xteInput) drag(ctx context.Context, path []point, delay time.Duration, button int) error {
+	from, to := path[0], path[len(path)-1]
+	cmds := []string{fmt.Sprintf("mousemove %d %d", from.X, from.Y), fmt.Sprintf("mousedown %d", button)}
+	for _, p := range path[1 : len(path)-1] {
+		cmds = append(cmds, fmt.Sprintf("mousemove %d %d", p.X, p.Y), fmt.Sprintf("usleep %d", delay.Microseconds()))
+	}
+	cmds = append(cmds, fmt.Sprintf("mousemove %d %d", to.X, to.Y), fmt.Sprintf("mouseup %d", button))
+	return runInput(ctx, "xte", cmds...)
+}
+
+var warnNoWindowTool sync.Once
+
+// haveWindowTool reports whether xdotool is available for window management.
+// ydotool and xte only synthesize input, so without xdotool the server can't
+// find or focus windows and assumes Firefox already has focus.
+func haveWindowTool() bool {
+	if _, err := lookPath("xdotool"); err != nil {
+		warnNoWindowTool.Do(func() {
+			log.Printf("xdotool not found; assuming the Firefox window already has focus")
+		})
+		return false
+	}
+	return true
+}
+
+// chooseInputTool selects the input tool from -input-tools and logs the choice.
+// If none works it keeps xdotool so errors name the expected tool.
+func (c *Controller) chooseInputTool() {
+	ctx, cancel := context.WithTimeout(c.baseContext(), 5*time.Second)
+	defer cancel()
+	tool, err := selectInputTool(ctx, c.cfg.InputTools)
+	if err != nil {
+		log.Printf("warning: %v; falling back to xdotool", err)
+		return
+	}
+	c.dev.input = tool
+	log.Printf("using %s for keyboard and mouse input", tool.name())
+}
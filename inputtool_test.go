@@ -0,0 +1,34 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestYdotoolDragReleasesWhenCancelled(t *testing.T) {
+	transcript := &commandTranscript{}
+	prev := fakeRunner.Swap(transcript)
+	defer fakeRunner.Store(prev)
+
+	// The context ends once the button is held, during a move or the pause after it
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		for ctx.Err() == nil {
+			if strings.Contains(strings.Join(transcript.snapshot(), "\n"), `"click" "0x40"`) {
+				cancel()
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}()
+	path := []point{{X: 10, Y: 10}, {X: 20, Y: 20}, {X: 30, Y: 30}}
+	if err := (ydotoolInput{}).drag(ctx, path, time.Hour, buttonLeft); err == nil {
+		t.Fatal("drag succeeded after its context ended")
+	}
+	lines := transcript.snapshot()
+	if len(lines) == 0 || !strings.Contains(lines[len(lines)-1], `"click" "0x80"`) {
+		t.Errorf("the drag did not end by releasing the button: %q", lines)
+	}
+}
@@ -0,0 +1,343 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// keyName is how one named key is written on each OS: an xdotool keysym on
+// Linux, a key code on macOS and a SendKeys token on Windows. An empty
+// field means the key isn't available there.
+type keyName struct {
+	Linux   string `json:"linux,omitempty"`
+	Darwin  string `json:"darwin,omitempty"`
+	Windows string `json:"windows,omitempty"`
+}
+
+// keyNames maps the key names accepted by /key and sequence steps to each
+// OS's syntax. Single characters need no entry. -key-map adds to it.
+var keyNames = map[string]keyName{
+	"Return":    {Linux: "Return", Darwin: "36", Windows: "{ENTER}"},
+	"Enter":     {Linux: "Return", Darwin: "36", Windows: "{ENTER}"},
+	"Escape":    {Linux: "Escape", Darwin: "53", Windows: "{ESC}"},
+	"Esc":       {Linux: "Escape", Darwin: "53", Windows: "{ESC}"},
+	"Tab":       {Linux: "Tab", Darwin: "48", Windows: "{TAB}"},
+	"BackSpace": {Linux: "BackSpace", Darwin: "51", Windows: "{BACKSPACE}"},
+	"Backspace": {Linux: "BackSpace", Darwin: "51", Windows: "{BACKSPACE}"},
+	"Delete":    {Linux: "Delete", Darwin: "117", Windows: "{DEL}"},
+	"space":     {Linux: "space", Darwin: "49", Windows: " "},
+	"Space":     {Linux: "space", Darwin: "49", Windows: " "},
+	"Home":      {Linux: "Home", Darwin: "115", Windows: "{HOME}"},
+	"End":       {Linux: "End", Darwin: "119", Windows: "{END}"},
+	"PageUp":    {Linux: "Prior", Darwin: "116", Windows: "{PGUP}"},
+	"PageDown":  {Linux: "Next", Darwin: "121", Windows: "{PGDN}"},
+	"Left":      {Linux: "Left", Darwin: "123", Windows: "{LEFT}"},
+	"Right":     {Linux: "Right", Darwin: "124", Windows: "{RIGHT}"},
+	"Up":        {Linux: "Up", Darwin: "126", Windows: "{UP}"},
+	"Down":      {Linux: "Down", Darwin: "125", Windows: "{DOWN}"},
+	"F1":        {Linux: "F1", Darwin: "122", Windows: "{F1}"},
+	"F2":        {Linux: "F2", Darwin: "120", Windows: "{F2}"},
+	"F3":        {Linux: "F3", Darwin: "99", Windows: "{F3}"},
+	"F4":        {Linux: "F4", Darwin: "118", Windows: "{F4}"},
+	"F5":        {Linux: "F5", Darwin: "96", Windows: "{F5}"},
+	"F6":        {Linux: "F6", Darwin: "97", Windows: "{F6}"},
+	"F7":        {Linux: "F7", Darwin: "98", Windows: "{F7}"},
+	"F8":        {Linux: "F8", Darwin: "100", Windows: "{F8}"},
+	"F9":        {Linux: "F9", Darwin: "101", Windows: "{F9}"},
+	"F10":       {Linux: "F10", Darwin: "109", Windows: "{F10}"},
+	"F11":       {Linux: "F11", Darwin: "103", Windows: "{F11}"},
+	"F12":       {Linux: "F12", Darwin: "111", Windows: "{F12}"},
+}
+
+// keyModifiers maps modifier names to each OS's syntax: the xdotool name,
+// the AppleScript "using" clause and the SendKeys prefix
+var keyModifiers = map[string]keyName{
+	"ctrl":    {Linux: "ctrl", Darwin: "control down", Windows: "^"},
+	"control": {Linux: "ctrl", Darwin: "control down", Windows: "^"},
+	"shift":   {Linux: "shift", Darwin: "shift down", Windows: "+"},
+	"alt":     {Linux: "alt", Darwin: "option down", Windows: "%"},
+	"option":  {Linux: "alt", Darwin: "option down", Windows: "%"},
+	"super":   {Linux: "super", Darwin: "command down"},
+	"cmd":     {Linux: "super", Darwin: "command down"},
+	"meta":    {Linux: "super", Darwin: "command down"},
+}
+
+// KeyRequest represents the JSON payload for /key
+type KeyRequest struct {
+	Key string `json:"key"` // such as "Escape" or "ctrl+z"
+}
+
+// KeysResponse is the Response for /keys
+type KeysResponse struct {
+	Response
+	OS        string             `json:"os"`
+	Keys      map[string]keyName `json:"keys"`
+	Modifiers []string           `json:"modifiers"`
+}
+
+// loadKeyMap reads a -key-map JSON object of key names to keyName entries
+func loadKeyMap(path string) (map[string]keyName, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var keys map[string]keyName
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return nil, err
+	}
+	for name, k := range keys {
+		if name == "" || strings.Contains(name, "+") {
+			return nil, fmt.Errorf("invalid key name %q", name)
+		}
+		if k.Darwin != "" {
+			if _, err := strconv.Atoi(k.Darwin); err != nil {
+				return nil, fmt.Errorf("key %s: darwin must be a key code, got %q", name, k.Darwin)
+			}
+		}
+	}
+	return keys, nil
+}
+
+// configureKeyNames adds the -key-map entries to keyNames
+func configureKeyNames(cfg *Config) {
+	for name, k := range cfg.KeyMap {
+		keyNames[name] = k
+	}
+}
+
+// platform returns k's syntax on this OS
+func (k keyName) platform() string {
+	return k.forOS(runtime.GOOS)
+}
+
+// forOS returns k's syntax on goos
+func (k keyName) forOS(goos string) string {
+	switch goos {
+	case "linux":
+		return k.Linux
+	case "darwin":
+		return k.Darwin
+	case "windows":
+		return k.Windows
+	}
+	return ""
+}
+
+// keyChord is a parsed key combination: modifier names in the order given,
+// then one key name or single character
+type keyChord struct {
+	modifiers []string
+	key       string
+}
+
+// parseChord splits a combination such as "ctrl+shift+k" into its
+// modifiers and key, checking the names but not their availability on any
+// OS. A "+" key is written last, as in "ctrl++". A letter held with
+// modifiers is taken as lowercase, as shift is a modifier of its own.
+func parseChord(combo string) (keyChord, error) {
+	var k keyChord
+	rest := combo
+	if strings.HasSuffix(rest, "++") || rest == "+" {
+		k.key, rest = "+", strings.TrimSuffix(rest, "+")
+	} else if i := strings.LastIndex(rest, "+"); i >= 0 {
+		k.key, rest = rest[i+1:], rest[:i+1]
+	} else {
+		k.key, rest = rest, ""
+	}
+	if k.key == "" {
+		return k, fmt.Errorf("%q has no key after its modifiers", combo)
+	}
+	if rest != "" {
+		seen := map[string]bool{}
+		for _, m := range strings.Split(strings.TrimSuffix(rest, "+"), "+") {
+			mod, ok := keyModifiers[strings.ToLower(m)]
+			if !ok {
+				return k, fmt.Errorf("unknown modifier %q", m)
+			}
+			// Aliases such as cmd and super are the same modifier
+			if seen[mod.Linux] {
+				return k, fmt.Errorf("modifier %q is repeated in %q", m, combo)
+			}
+			seen[mod.Linux] = true
+			k.modifiers = append(k.modifiers, strings.ToLower(m))
+		}
+	}
+	if _, ok := keyNames[k.key]; !ok {
+		if len([]rune(k.key)) != 1 {
+			return k, fmt.Errorf("unknown key %q; add it with -key-map", k.key)
+		}
+		if len(k.modifiers) > 0 {
+			k.key = strings.ToLower(k.key)
+		}
+	}
+	return k, nil
+}
+
+// translatedKey is a key combination in one OS's syntax
+type translatedKey struct {
+	modifiers []string
+	key       string
+	named     bool // key came from keyNames rather than being a single character
+}
+
+// render converts the chord into goos's syntax, failing for names that
+// aren't available there
+func (k keyChord) render(goos string) (translatedKey, error) {
+	var t translatedKey
+	for _, m := range k.modifiers {
+		mod := keyModifiers[m].forOS(goos)
+		if mod == "" {
+			return t, fmt.Errorf("modifier %q is not available on %s", m, goos)
+		}
+		t.modifiers = append(t.modifiers, mod)
+	}
+	if name, ok := keyNames[k.key]; ok {
+		if t.key = name.forOS(goos); t.key == "" {
+			return t, fmt.Errorf("key %q is not available on %s", k.key, goos)
+		}
+		t.named = true
+		return t, nil
+	}
+	t.key = k.key
+	if goos == "linux" {
+		// xdotool takes keysyms, so punctuation goes by name, such as "plus"
+		t.key = textKeysyms(k.key)[0]
+	}
+	return t, nil
+}
+
+// translateKey converts a combination such as "ctrl+shift+t" into this OS's
+// syntax, failing for names that aren't known or available here
+func translateKey(combo string) (translatedKey, error) {
+	k, err := parseChord(combo)
+	if err != nil {
+		return translatedKey{}, err
+	}
+	return k.render(runtime.GOOS)
+}
+
+// xdotoolKey returns t as an xdotool key argument, such as "ctrl+shift+k"
+func (t translatedKey) xdotoolKey() string {
+	return strings.Join(append(append([]string(nil), t.modifiers...), t.key), "+")
+}
+
+// appleScriptKey returns t as a System Events command, such as
+// `keystroke "k" using {control down, shift down}`
+func (t translatedKey) appleScriptKey() string {
+	press := fmt.Sprintf("keystroke %q", t.key)
+	if t.named {
+		press = "key code " + t.key
+	}
+	if len(t.modifiers) > 0 {
+		press += " using {" + strings.Join(t.modifiers, ", ") + "}"
+	}
+	return press
+}
+
+// sendKeysKey returns t as a SendKeys string, such as "^+k"
+func (t translatedKey) sendKeysKey() string {
+	key := t.key
+	if !t.named && strings.ContainsAny(key, "+^%~(){}[]") {
+		key = "{" + key + "}"
+	}
+	return strings.Join(t.modifiers, "") + key
+}
+
+// pressKey presses a key combination such as "ctrl+shift+t" or "Escape",
+// translated through keyNames and keyModifiers
+func pressKey(ctx context.Context, combo string) error {
+	defer invalidateScreenCache()
+	t, err := translateKey(combo)
+	if err != nil {
+		return err
+	}
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "linux":
+		return linuxInput(ctx).key(ctx, t.xdotoolKey())
+	case "darwin":
+		cmd = newCommand(ctx, "osascript", "-e", `tell application "System Events" to `+t.appleScriptKey())
+	case "windows":
+		cmd = newCommand(ctx, "powershell", "-Command", fmt.Sprintf(`
+			Add-Type -AssemblyName System.Windows.Forms
+			[System.Windows.Forms.SendKeys]::SendWait('%s')`, strings.ReplaceAll(t.sendKeysKey(), "'", "''")))
+	default:
+		return fmt.Errorf("unsupported operating system: %s", runtime.GOOS)
+	}
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to press %s: %v %s", combo, err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// handleKey presses a key combination in Firefox
+func (c *Controller) handleKey(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "Only POST method is allowed")
+		return
+	}
+
+	var req KeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid JSON payload")
+		return
+	}
+	if req.Key == "" {
+		writeError(w, http.StatusBadRequest, "Key cannot be empty")
+		return
+	}
+	if _, err := translateKey(req.Key); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("Invalid key: %v", err))
+		return
+	}
+
+	err := c.focusCommand(r, func() error {
+		if err := focusFirefox(r.Context()); err != nil {
+			return err
+		}
+		return pressKey(r.Context(), req.Key)
+	})
+	if err != nil {
+		writeCommandError(w, err, fmt.Sprintf("Failed to press %s: %v", req.Key, err))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, Response{
+		Success: true,
+		Message: fmt.Sprintf("Pressed %s", req.Key),
+	})
+}
+
+// handleKeys lists the known key names and their syntax on each OS
+func (c *Controller) handleKeys(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "Only GET method is allowed")
+		return
+	}
+
+	modifiers := make([]string, 0, len(keyModifiers))
+	for name, mod := range keyModifiers {
+		if mod.platform() != "" {
+			modifiers = append(modifiers, name)
+		}
+	}
+	sort.Strings(modifiers)
+
+	writeJSON(w, http.StatusOK, KeysResponse{
+		Response: Response{
+			Success: true,
+			Message: fmt.Sprintf("%d named keys; single characters need no name", len(keyNames)),
+		},
+		OS:        runtime.GOOS,
+		Keys:      keyNames,
+		Modifiers: modifiers,
+	})
+}
@@ -0,0 +1,60 @@
+package main
+
+import "testing"
+
+func TestKeyChordRender(t *testing.T) {
+	tests := []struct {
+		combo  string
+		goos   string
+		want   string // "" when the chord must fail
+		render func(translatedKey) string
+	}{
+		{"ctrl+shift+k", "linux", "ctrl+shift+k", translatedKey.xdotoolKey},
+		{"ctrl+shift+k", "darwin", `keystroke "k" using {control down, shift down}`, translatedKey.appleScriptKey},
+		{"ctrl+shift+k", "windows", "^+k", translatedKey.sendKeysKey},
+
+		{"cmd+option+i", "linux", "super+alt+i", translatedKey.xdotoolKey},
+		{"cmd+option+i", "darwin", `keystroke "i" using {command down, option down}`, translatedKey.appleScriptKey},
+		{"cmd+option+i", "windows", "", translatedKey.sendKeysKey},
+
+		{"ctrl+alt+shift+F5", "linux", "ctrl+alt+shift+F5", translatedKey.xdotoolKey},
+		{"ctrl+alt+shift+F5", "darwin", "key code 96 using {control down, option down, shift down}", translatedKey.appleScriptKey},
+		{"ctrl+alt+shift+F5", "windows", "^%+{F5}", translatedKey.sendKeysKey},
+
+		{"Control+Shift+Alt+T", "linux", "ctrl+shift+alt+t", translatedKey.xdotoolKey},
+		{"Control+Shift+Alt+T", "darwin", `keystroke "t" using {control down, shift down, option down}`, translatedKey.appleScriptKey},
+		{"Control+Shift+Alt+T", "windows", "^+%t", translatedKey.sendKeysKey},
+
+		{"ctrl++", "linux", "ctrl+plus", translatedKey.xdotoolKey},
+		{"ctrl++", "darwin", `keystroke "+" using {control down}`, translatedKey.appleScriptKey},
+		{"ctrl++", "windows", "^{+}", translatedKey.sendKeysKey},
+
+		{"cmd+super+k", "linux", "", translatedKey.xdotoolKey},
+		{"cmd+super+k", "darwin", "", translatedKey.appleScriptKey},
+		{"cmd+super+k", "windows", "", translatedKey.sendKeysKey},
+
+		{"super+k", "linux", "super+k", translatedKey.xdotoolKey},
+		{"super+k", "darwin", `keystroke "k" using {command down}`, translatedKey.appleScriptKey},
+		{"super+k", "windows", "", translatedKey.sendKeysKey},
+	}
+	for _, tt := range tests {
+		k, err := parseChord(tt.combo)
+		var got translatedKey
+		if err == nil {
+			got, err = k.render(tt.goos)
+		}
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("%s on %s = %q, want an error", tt.combo, tt.goos, tt.render(got))
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s on %s: %v", tt.combo, tt.goos, err)
+			continue
+		}
+		if s := tt.render(got); s != tt.want {
+			t.Errorf("%s on %s = %q, want %q", tt.combo, tt.goos, s, tt.want)
+		}
+	}
+}
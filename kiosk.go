@@ -0,0 +1,29 @@
+package main
+
+import (
+	"context"
+	"fmt"
+)
+
+// With -kiosk the browser is launched fullscreen with no address bar or tabs,
+// for a machine that only shows the game: nothing else on screen can take a
+// click and the board keeps one size. Native address-bar navigation is not
+// available there, so /open navigates through marionette when it is
+// connected and otherwise types the URL after the Ctrl+L shortcut with
+// nothing visible to type into, and /set-addressbar is refused.
+
+// kioskNavigate loads url through marionette in kiosk mode, reporting whether
+// it handled the navigation. A browser that isn't running yet is left to
+// updateFirefoxURL, which launches it on url.
+func (c *Controller) kioskNavigate(ctx context.Context, url string) (bool, error) {
+	if !c.cfg.Kiosk || c.marionette == nil || !firefoxRunning(ctx) {
+		return false, nil
+	}
+	if err := c.awaitLaunch(ctx); err != nil {
+		return true, err
+	}
+	if err := c.marionette.Navigate(ctx, url); err != nil {
+		return true, fmt.Errorf("failed to navigate through marionette: %v", err)
+	}
+	return true, nil
+}
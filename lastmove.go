@@ -0,0 +1,231 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"sort"
+)
+
+// LastMoveResponse is the Response for /last-move
+type LastMoveResponse struct {
+	Response
+	Squares []string `json:"squares"`        // the highlighted squares, from then to when known
+	From    string   `json:"from,omitempty"` // the empty one of the two squares
+	To      string   `json:"to,omitempty"`   // the one the piece stands on
+	Source  string   `json:"source"`         // "page" or "screenshot"
+}
+
+// lastMoveScript returns the squares of the elements matching arguments[1]
+// on the board matching arguments[0], and which of them hold an element
+// matching arguments[2]. Squares come from each element's position on the
+// board, so it reads any site; arguments[3] matches only on a flipped board.
+const lastMoveScript = `
+const board = document.querySelector(arguments[0]);
+if (!board) { return null; }
+const b = board.getBoundingClientRect();
+const flipped = arguments[3] ? document.querySelector(arguments[3]) !== null : false;
+const squareOf = el => {
+	const r = el.getBoundingClientRect();
+	const col = Math.floor((r.left + r.width / 2 - b.left) / (b.width / 8));
+	const row = Math.floor((r.top + r.height / 2 - b.top) / (b.height / 8));
+	if (col < 0 || col > 7 || row < 0 || row > 7) { return null; }
+	return flipped ? String.fromCharCode(104 - col) + (row + 1) : String.fromCharCode(97 + col) + (8 - row);
+};
+const squares = [...new Set(Array.from(document.querySelectorAll(arguments[1])).map(squareOf).filter(s => s))];
+const pieces = new Set(Array.from(document.querySelectorAll(arguments[2])).map(squareOf));
+return {squares: squares, occupied: squares.filter(s => pieces.has(s))};`
+
+// Screenshot analysis: a highlighted square's color differs from the other
+// squares of its shade by more than highlightTolerance on some channel
+const highlightTolerance = 30
+
+// squarePatch returns the part of a square sampled for its color: near the
+// top right corner, clear of most pieces and of the coordinate labels sites
+// draw in the other corners
+func squarePatch(r rect) image.Rectangle {
+	return image.Rect(r.X+r.Width*3/4, r.Y+r.Height/12, r.X+r.Width*11/12, r.Y+r.Height/4)
+}
+
+// squareCenterPatch returns the middle of a square, where a piece stands
+func squareCenterPatch(r rect) image.Rectangle {
+	return image.Rect(r.X+r.Width*3/8, r.Y+r.Height*3/8, r.X+r.Width*5/8, r.Y+r.Height*5/8)
+}
+
+// colorDistance returns the largest channel difference between a and b
+func colorDistance(a, b color.RGBA) int {
+	d := 0
+	for _, pair := range [][2]uint8{{a.R, b.R}, {a.G, b.G}, {a.B, b.B}} {
+		diff := int(pair[0]) - int(pair[1])
+		if diff < 0 {
+			diff = -diff
+		}
+		if diff > d {
+			d = diff
+		}
+	}
+	return d
+}
+
+// medianColor returns the per-channel median of colors
+func medianColor(colors []color.RGBA) color.RGBA {
+	channel := func(get func(color.RGBA) uint8) uint8 {
+		v := make([]int, len(colors))
+		for i, c := range colors {
+			v[i] = int(get(c))
+		}
+		sort.Ints(v)
+		return uint8(v[len(v)/2])
+	}
+	return color.RGBA{
+		R: channel(func(c color.RGBA) uint8 { return c.R }),
+		G: channel(func(c color.RGBA) uint8 { return c.G }),
+		B: channel(func(c color.RGBA) uint8 { return c.B }),
+		A: 0xff,
+	}
+}
+
+// highlightedSquares finds the squares of the calibrated board in a
+// screenshot whose color stands out from the other squares of their shade,
+// most distinct first, and which of them hold a piece
+func highlightedSquares(shot []byte, cal Calibration) (squares []string, occupied map[string]bool, err error) {
+	img, err := png.Decode(bytes.NewReader(shot))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to decode screenshot: %v", err)
+	}
+	type sample struct {
+		square         string
+		corner, center color.RGBA
+	}
+	var shades [2][]sample // dark and light squares
+	for file := 0; file < 8; file++ {
+		for rank := 0; rank < 8; rank++ {
+			square := string([]byte{byte('a' + file), byte('1' + rank)})
+			r, _ := cal.squareRect(square)
+			patch := squarePatch(r).Intersect(img.Bounds())
+			center := squareCenterPatch(r).Intersect(img.Bounds())
+			if patch.Empty() || center.Empty() {
+				return nil, nil, fmt.Errorf("the board at %d,%d is outside the screenshot", cal.X, cal.Y)
+			}
+			shade := (file + rank) % 2
+			shades[shade] = append(shades[shade], sample{square, meanColor(img, patch), meanColor(img, center)})
+		}
+	}
+
+	type candidate struct {
+		square   string
+		distance int
+	}
+	var found []candidate
+	occupied = map[string]bool{}
+	for _, samples := range shades {
+		corners := make([]color.RGBA, len(samples))
+		for i, s := range samples {
+			corners[i] = s.corner
+		}
+		typical := medianColor(corners)
+		for _, s := range samples {
+			if d := colorDistance(s.corner, typical); d > highlightTolerance {
+				found = append(found, candidate{s.square, d})
+				occupied[s.square] = colorDistance(s.center, s.corner) > highlightTolerance
+			}
+		}
+	}
+	sort.Slice(found, func(i, j int) bool { return found[i].distance > found[j].distance })
+	for _, f := range found {
+		squares = append(squares, f.square)
+	}
+	return squares, occupied, nil
+}
+
+// handleLastMove returns the two squares highlighted for the last move.
+// With the marionette backend on a known site it reads the highlight
+// elements; otherwise it looks for squares of an unusual color in a
+// screenshot of the calibrated board.
+func (c *Controller) handleLastMove(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "Only GET method is allowed")
+		return
+	}
+
+	var squares []string
+	occupied := map[string]bool{}
+	source := "page"
+	var site *siteProfile
+	if c.marionette != nil {
+		var current string
+		var err error
+		if site, current, err = c.currentSite(r.Context()); err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if site != nil && site.LastMoveSelector == "" {
+			site = nil
+		}
+		if _, calibrated := c.calibration(); site == nil && !calibrated {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("Unsupported site: %s", current))
+			return
+		}
+	}
+
+	if site != nil {
+		var result *struct {
+			Squares  []string `json:"squares"`
+			Occupied []string `json:"occupied"`
+		}
+		if err := c.marionette.ExecuteScript(r.Context(), lastMoveScript, []interface{}{site.BoardSelector, site.LastMoveSelector, site.PieceSelector, site.FlippedSelector}, &result); err != nil {
+			writeError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to read the last move: %v", err))
+			return
+		}
+		if result == nil {
+			writeError(w, http.StatusNotFound, fmt.Sprintf("No board found on %s", site.Name))
+			return
+		}
+		squares = result.Squares
+		for _, s := range result.Occupied {
+			occupied[s] = true
+		}
+	} else {
+		cal, ok := c.calibration()
+		if !ok {
+			writeErrorCode(w, http.StatusConflict, codeCalibrationMissing, "Board is not calibrated")
+			return
+		}
+		shot, err := captureScreen(r.Context())
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to capture screen: %v", err))
+			return
+		}
+		if squares, occupied, err = highlightedSquares(shot, cal); err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		source = "screenshot"
+	}
+
+	if len(squares) == 0 {
+		writeError(w, http.StatusNotFound, "No last move is highlighted")
+		return
+	}
+	resp := LastMoveResponse{Squares: squares, Source: source}
+	if len(squares) > 2 {
+		// Extra highlights are selections or premoves; the screenshot list is most distinct first
+		resp.Squares = squares[:2]
+	}
+	if len(resp.Squares) == 2 && occupied[resp.Squares[0]] != occupied[resp.Squares[1]] {
+		if occupied[resp.Squares[0]] {
+			resp.Squares[0], resp.Squares[1] = resp.Squares[1], resp.Squares[0]
+		}
+		resp.From, resp.To = resp.Squares[0], resp.Squares[1]
+	}
+
+	message := fmt.Sprintf("Last move highlights %v", resp.Squares)
+	if resp.From != "" {
+		message = fmt.Sprintf("Last move was %s to %s", resp.From, resp.To)
+	}
+	resp.Response = Response{Success: true, Message: message}
+	writeJSON(w, http.StatusOK, resp)
+}
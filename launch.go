@@ -0,0 +1,407 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// firefoxBin returns the executable of the target browser to launch
+func (c *Controller) firefoxBin() string {
+	if c.cfg.FirefoxBin != "" {
+		return c.cfg.FirefoxBin
+	}
+	if runtime.GOOS == "windows" {
+		return targetBrowser.exe()
+	}
+	return targetBrowser.bin
+}
+
+// launchArgs returns the Firefox command line arguments used to start it on url.
+// url may be empty to start on the home page, and profile empty to use the
+// one selected with POST /profiles or else -profile.
+func (c *Controller) launchArgs(url, profile string) []string {
+	var args []string
+	if profile == "" {
+		profile = c.state.launchProfile()
+	}
+	if profile == "" {
+		profile = c.cfg.Profile
+	}
+	if targetBrowser.chromium {
+		return c.chromiumLaunchArgs(url, profile)
+	}
+	if c.cfg.ProfileDir != "" {
+		// A profile directory isolates this controller's instance, and
+		// --no-remote keeps it from handing the launch to another instance
+		args = append(args, "--profile", c.cfg.ProfileDir)
+	} else if profile != "" {
+		args = append(args, "-P", profile)
+	}
+	if c.cfg.NoRemote || c.cfg.ProfileDir != "" {
+		args = append(args, "--no-remote")
+	}
+	if c.cfg.Kiosk {
+		args = append(args, "--kiosk")
+	}
+	if c.cfg.Backend == backendMarionette {
+		args = append(args, "--marionette")
+	}
+	if c.cfg.Private {
+		args = append(args, "--private-window")
+	}
+	if url != "" {
+		// End the options so no extra argument can take the URL as its value
+		if len(c.cfg.LaunchArgs) > 0 {
+			args = append(args, c.cfg.LaunchArgs...)
+			args = append(args, "--")
+		}
+		args = append(args, url)
+	} else {
+		args = append(args, c.cfg.LaunchArgs...)
+	}
+	return args
+}
+
+// chromiumLaunchArgs is launchArgs for Brave, Vivaldi and other Chromium
+// browsers, whose profiles are a user data directory and a profile
+// directory inside it. They have no --no-remote: a separate user data
+// directory already starts a separate instance.
+func (c *Controller) chromiumLaunchArgs(url, profile string) []string {
+	var args []string
+	if c.cfg.ProfileDir != "" {
+		args = append(args, "--user-data-dir="+c.cfg.ProfileDir)
+	}
+	if profile != "" {
+		args = append(args, "--profile-directory="+profile)
+	}
+	if c.cfg.Kiosk {
+		args = append(args, "--kiosk")
+	}
+	if c.cfg.Private {
+		args = append(args, "--incognito")
+	}
+	args = append(args, c.cfg.LaunchArgs...)
+	if url != "" {
+		args = append(args, "--", url)
+	}
+	return args
+}
+
+// splitArgs splits s into arguments at unquoted whitespace. Single quotes
+// keep their contents literally; in double quotes and outside quotes a
+// backslash escapes the next character.
+func splitArgs(s string) ([]string, error) {
+	var args []string
+	var cur strings.Builder
+	inArg := false
+	var quote rune
+	escaped := false
+	for _, r := range s {
+		switch {
+		case escaped:
+			cur.WriteRune(r)
+			escaped = false
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			} else {
+				cur.WriteRune(r)
+			}
+		case r == '\\':
+			escaped, inArg = true, true
+		case quote == '"':
+			if r == '"' {
+				quote = 0
+			} else {
+				cur.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote, inArg = r, true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inArg {
+				args = append(args, cur.String())
+				cur.Reset()
+				inArg = false
+			}
+		default:
+			cur.WriteRune(r)
+			inArg = true
+		}
+	}
+	if quote != 0 || escaped {
+		return nil, fmt.Errorf("unterminated quote or escape in %q", s)
+	}
+	if inArg {
+		args = append(args, cur.String())
+	}
+	return args, nil
+}
+
+// joinArgs is the inverse of splitArgs, single-quoting the arguments that need it
+func joinArgs(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		if arg != "" && !strings.ContainsAny(arg, " \t\n'\"\\") {
+			quoted[i] = arg
+			continue
+		}
+		quoted[i] = "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+	}
+	return strings.Join(quoted, " ")
+}
+
+// validateLaunchArgs rejects extra launch arguments that could end the
+// options early
+func validateLaunchArgs(args []string) error {
+	for _, arg := range args {
+		if arg == "--" {
+			return fmt.Errorf("%q is added before the URL automatically", arg)
+		}
+	}
+	return nil
+}
+
+// launchCommand builds the command that starts Firefox with args. Firefox
+// must outlive the request, so only ctx's values (not its deadline) apply.
+func (c *Controller) launchCommand(ctx context.Context, args []string) *exec.Cmd {
+	ctx = context.WithoutCancel(ctx)
+	switch runtime.GOOS {
+	case "darwin":
+		if c.cfg.FirefoxBin == "" {
+			return newCommand(ctx, "open", append([]string{"-a", targetBrowser.app, "--args"}, args...)...)
+		}
+	case "windows":
+		// The binary is started directly, never through cmd, which would run
+		// "&calc" or the like in a client's URL. Installers usually register
+		// it under App Paths rather than putting it on PATH.
+		bin := c.firefoxBin()
+		if _, err := lookPath(bin); err != nil && !strings.ContainsAny(bin, `\/`) {
+			if registered := appPathsExe(ctx, bin); registered != "" {
+				bin = registered
+			}
+		}
+		return newCommand(ctx, bin, args...)
+	}
+	return newCommand(ctx, c.firefoxBin(), args...)
+}
+
+// errFirefoxRunning is returned by launchFirefox when Firefox is already running,
+// such as when another request launched it while this one waited
+var errFirefoxRunning = errors.New("firefox is already running")
+
+// launchGuard lets one launch happen at a time, so requests arriving while
+// Firefox starts don't each spawn their own instance
+type launchGuard struct {
+	mu      sync.Mutex
+	started time.Time // when the last launch began
+}
+
+// launchFirefox starts Firefox on url with the given profile and waits for
+// its window, without waiting for it to exit, then gets past a "Restore
+// Session" page left by a crash. Launches are serialized and a launch finding
+// Firefox already running returns errFirefoxRunning.
+func (c *Controller) launchFirefox(ctx context.Context, url, profile string) error {
+	if err := c.startFirefox(ctx, url, profile); err != nil {
+		return err
+	}
+	c.dismissSessionRestore(ctx, url)
+	return nil
+}
+
+func (c *Controller) startFirefox(ctx context.Context, url, profile string) error {
+	c.launch.mu.Lock()
+	defer c.launch.mu.Unlock()
+	if firefoxRunning(ctx) {
+		return errFirefoxRunning
+	}
+
+	if c.cfg.ProfileDir != "" && !targetBrowser.chromium {
+		if err := preventSessionRestore(c.cfg.ProfileDir); err != nil {
+			log.Printf("warning: %v", err)
+		}
+		if len(c.cfg.Prefs) > 0 {
+			if err := writeUserPrefs(c.cfg.ProfileDir, c.cfg.Prefs); err != nil {
+				return fmt.Errorf("failed to apply preferences: %v", err)
+			}
+		}
+	}
+
+	// On a loaded machine a launch can fail for want of resources and
+	// succeed seconds later, so failures are retried -launch-retries times,
+	// doubling -launch-retry-delay after each
+	delay := c.cfg.LaunchRetryDelay
+	for attempt := 1; ; attempt++ {
+		retryable, err := c.startFirefoxOnce(ctx, url, profile)
+		if err == nil || !retryable || attempt > c.cfg.LaunchRetries {
+			return err
+		}
+		// A browser that is running but slow to get ready would only be
+		// started a second time
+		if firefoxRunning(ctx) {
+			return err
+		}
+		log.Printf("launch attempt %d of %d failed: %v; retrying in %v", attempt, c.cfg.LaunchRetries+1, err, delay)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return err
+		}
+		delay *= 2
+	}
+}
+
+// startFirefoxOnce makes one launch attempt for startFirefox, and reports
+// whether its failure is worth retrying: a missing binary is not
+func (c *Controller) startFirefoxOnce(ctx context.Context, url, profile string) (bool, error) {
+	cmd := c.launchCommand(ctx, c.launchArgs(url, profile))
+	if err := cmd.Start(); err != nil {
+		return !errors.Is(err, exec.ErrNotFound), fmt.Errorf("failed to launch Firefox: %v", err)
+	}
+	c.launch.started = time.Now()
+	// Reap the process whenever it exits
+	go cmd.Wait()
+	return true, c.waitForFirefoxReady(ctx, c.cfg.LaunchTimeout)
+}
+
+// awaitLaunch waits for a launch still inside -launch-timeout to be ready,
+// so input isn't sent to a Firefox process that has no window yet
+func (c *Controller) awaitLaunch(ctx context.Context) error {
+	c.launch.mu.Lock()
+	started := c.launch.started
+	c.launch.mu.Unlock()
+	remaining := c.cfg.LaunchTimeout - time.Since(started)
+	if started.IsZero() || remaining <= 0 || c.firefoxReady(ctx) {
+		return nil
+	}
+	return c.waitForFirefoxReady(ctx, remaining)
+}
+
+// firefoxWindowExists reports whether Firefox has a main window open
+func firefoxWindowExists(ctx context.Context) bool {
+	switch runtime.GOOS {
+	case "linux":
+		if !haveWindowTool() {
+			return firefoxRunning(ctx)
+		}
+		return newCommand(ctx, "xdotool", "search", "--onlyvisible", "--class", targetBrowser.class).Run() == nil
+	case "darwin":
+		output, err := newCommand(ctx, "osascript", "-e", `tell application "System Events" to count windows of process "`+targetBrowser.app+`"`).Output()
+		return err == nil && len(output) > 0 && output[0] != '0'
+	case "windows":
+		err := newCommand(ctx, "powershell", "-Command", `if (-not (Get-Process `+targetBrowser.process+` -ErrorAction SilentlyContinue | Where-Object {$_.MainWindowHandle -ne 0})) { exit 1 }`).Run()
+		return err == nil
+	}
+	return false
+}
+
+// firefoxWindowActivatable reports whether the Firefox window can take
+// focus. On Linux a window can be found before the window manager lets it
+// be activated, and keys sent in between are lost.
+func firefoxWindowActivatable(ctx context.Context) bool {
+	if runtime.GOOS == "linux" && haveWindowTool() {
+		return newCommand(ctx, "xdotool", "search", "--onlyvisible", "--class", targetBrowser.class, "windowactivate").Run() == nil
+	}
+	return firefoxWindowExists(ctx)
+}
+
+// firefoxReady reports whether a launched Firefox can take input: its window
+// can be activated and, with the marionette backend, Marionette is listening
+func (c *Controller) firefoxReady(ctx context.Context) bool {
+	if !firefoxWindowActivatable(ctx) {
+		return false
+	}
+	if c.cfg.Backend == backendMarionette {
+		conn, err := net.DialTimeout("tcp", c.cfg.MarionetteAddr, time.Second)
+		if err != nil {
+			return false
+		}
+		conn.Close()
+	}
+	return true
+}
+
+// waitForFirefoxReady polls until firefoxReady, timeout elapses or ctx is done
+func (c *Controller) waitForFirefoxReady(ctx context.Context, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	windowSeen := false
+	for {
+		if c.firefoxReady(ctx) {
+			return nil
+		}
+		if !windowSeen {
+			windowSeen = firefoxWindowExists(ctx)
+		}
+		select {
+		case <-ctx.Done():
+			if windowSeen {
+				return fmt.Errorf("Firefox was not ready for input within %v", timeout)
+			}
+			return fmt.Errorf("no Firefox window appeared within %v", timeout)
+		case <-time.After(250 * time.Millisecond):
+		}
+	}
+}
+
+// LaunchRequest represents the optional JSON payload for /launch
+type LaunchRequest struct {
+	Profile string `json:"profile"`
+}
+
+// profileIgnoredNote is appended to responses when a profile was requested but
+// Firefox was already running. A running instance can't switch profiles; it
+// has to be restarted with the new one.
+const profileIgnoredNote = " (profile ignored: Firefox is already running and must be restarted to switch profiles)"
+
+// handleLaunch starts Firefox without navigating, returning once its window exists
+func (c *Controller) handleLaunch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "Only POST method is allowed")
+		return
+	}
+
+	// The body is optional; it only selects a profile
+	var req LaunchRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid JSON payload")
+			return
+		}
+	}
+
+	var alreadyRunning bool
+	err := c.focusCommand(r, func() error {
+		err := c.launchFirefox(r.Context(), "", req.Profile)
+		if err == errFirefoxRunning {
+			alreadyRunning = true
+			return nil
+		}
+		return err
+	})
+	if err != nil {
+		writeCommandError(w, err, fmt.Sprintf("Failed to launch Firefox: %v", err))
+		return
+	}
+
+	message := "Firefox launched"
+	if alreadyRunning {
+		message = "Firefox is already running"
+		if req.Profile != "" {
+			message += profileIgnoredNote
+		}
+	}
+	writeJSON(w, http.StatusOK, Response{
+		Success: true,
+		Message: message,
+	})
+}
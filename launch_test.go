@@ -0,0 +1,81 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestJoinArgsRoundTrip(t *testing.T) {
+	for _, args := range [][]string{
+		{"--width", "1280"},
+		{"--class", "my browser"},
+		{"it's", `say "hi"`, `back\slash`, ""},
+		{"tab\there", "new\nline"},
+	} {
+		got, err := splitArgs(joinArgs(args))
+		if err != nil || len(got) != len(args) {
+			t.Errorf("splitArgs(joinArgs(%q)) = %q, %v", args, got, err)
+			continue
+		}
+		for i := range args {
+			if got[i] != args[i] {
+				t.Errorf("splitArgs(joinArgs(%q)) = %q", args, got)
+				break
+			}
+		}
+	}
+}
+
+func TestSplitArgs(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string // nil for an error
+	}{
+		{"", []string{}},
+		{"  ", []string{}},
+		{"--width 1280 --height 800", []string{"--width", "1280", "--height", "800"}},
+		{"--width\t1280\n--kiosk", []string{"--width", "1280", "--kiosk"}},
+		{`--class "my browser"`, []string{"--class", "my browser"}},
+		{`--class 'my browser'`, []string{"--class", "my browser"}},
+		{`--name="a b"c`, []string{"--name=a bc"}},
+		{`'it'\''s'`, []string{"it's"}},
+		{`"say \"hi\""`, []string{`say "hi"`}},
+		{`'no \escape'`, []string{`no \escape`}},
+		{`back\ slash`, []string{"back slash"}},
+		{`"" ''`, []string{"", ""}},
+		{`"unterminated`, nil},
+		{`'unterminated`, nil},
+		{`trailing\`, nil},
+	}
+	for _, tt := range tests {
+		got, err := splitArgs(tt.in)
+		if tt.want == nil {
+			if err == nil {
+				t.Errorf("splitArgs(%q) = %q, want an error", tt.in, got)
+			}
+			continue
+		}
+		if err != nil || len(got) != len(tt.want) || (len(got) > 0 && !reflect.DeepEqual(got, tt.want)) {
+			t.Errorf("splitArgs(%q) = %q, %v, want %q", tt.in, got, err, tt.want)
+		}
+	}
+}
+
+func TestValidateLaunchArgs(t *testing.T) {
+	tests := []struct {
+		args []string
+		ok   bool
+	}{
+		{nil, true},
+		{[]string{"--width", "1280", "--kiosk"}, true},
+		{[]string{"--class", "a & b"}, true},
+		{[]string{"---", "--x"}, true},
+		{[]string{"--width", "1280", "--"}, false},
+		{[]string{"--", "https://example.com"}, false},
+	}
+	for _, tt := range tests {
+		if err := validateLaunchArgs(tt.args); (err == nil) != tt.ok {
+			t.Errorf("validateLaunchArgs(%q) = %v, want ok %v", tt.args, err, tt.ok)
+		}
+	}
+}
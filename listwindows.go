@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// knownBrowser names a browser's window class on Linux, application on
+// macOS and process on Windows
+type knownBrowser struct {
+	name         string
+	class        string
+	app          string
+	process      string
+	linuxProcess string // process name on Linux, when it differs from process
+	bin          string // binary on Linux
+	chromium     bool
+}
+
+// knownBrowsers are the browsers /list-windows looks for
+var knownBrowsers = []knownBrowser{
+	{name: "firefox", class: "Firefox", app: "Firefox", process: "firefox", bin: "firefox"},
+	{name: "chrome", class: "Google-chrome", app: "Google Chrome", process: "chrome", bin: "google-chrome", chromium: true},
+	{name: "chromium", class: "Chromium", app: "Chromium", process: "chromium", bin: "chromium", chromium: true},
+	{name: "edge", class: "Microsoft-edge", app: "Microsoft Edge", process: "msedge", bin: "microsoft-edge", chromium: true},
+	{name: "brave", class: "Brave-browser", app: "Brave Browser", process: "brave", bin: "brave-browser", chromium: true},
+	{name: "vivaldi", class: "Vivaldi-stable", app: "Vivaldi", process: "vivaldi", linuxProcess: "vivaldi-bin", bin: "vivaldi", chromium: true},
+	{name: "opera", class: "Opera", app: "Opera", process: "opera", bin: "opera", chromium: true},
+}
+
+// BrowserWindow is one visible browser window
+type BrowserWindow struct {
+	ID      string `json:"id"`
+	Browser string `json:"browser"`
+	Title   string `json:"title"`
+	Bounds  rect   `json:"bounds"`
+}
+
+// ListWindowsResponse is the Response for /list-windows
+type ListWindowsResponse struct {
+	Response
+	Windows []BrowserWindow `json:"windows"`
+}
+
+// psEnumWindowsType defines a PowerShell type listing the visible top-level
+// windows as "hwnd<TAB>pid<TAB>x<TAB>y<TAB>width<TAB>height<TAB>title" lines
+const psEnumWindowsType = `
+Add-Type @"
+using System;
+using System.Collections.Generic;
+using System.Runtime.InteropServices;
+using System.Text;
+public class BrowserControllerEnum {
+    public delegate bool EnumProc(IntPtr hwnd, IntPtr param);
+    [StructLayout(LayoutKind.Sequential)] public struct RECT { public int Left, Top, Right, Bottom; }
+    [DllImport("user32.dll")] static extern bool EnumWindows(EnumProc proc, IntPtr param);
+    [DllImport("user32.dll")] static extern bool IsWindowVisible(IntPtr hwnd);
+    [DllImport("user32.dll", CharSet = CharSet.Unicode)] static extern int GetWindowText(IntPtr hwnd, StringBuilder text, int max);
+    [DllImport("user32.dll")] static extern bool GetWindowRect(IntPtr hwnd, out RECT rect);
+    [DllImport("user32.dll")] static extern uint GetWindowThreadProcessId(IntPtr hwnd, out uint pid);
+    public static List<string> List() {
+        var lines = new List<string>();
+        EnumWindows((hwnd, param) => {
+            var title = new StringBuilder(512);
+            if (!IsWindowVisible(hwnd) || GetWindowText(hwnd, title, title.Capacity) == 0) return true;
+            RECT r; GetWindowRect(hwnd, out r);
+            uint pid; GetWindowThreadProcessId(hwnd, out pid);
+            lines.Add(string.Join("\t", hwnd, pid, r.Left, r.Top, r.Right - r.Left, r.Bottom - r.Top, title));
+            return true;
+        }, IntPtr.Zero);
+        return lines;
+    }
+}
+"@
+`
+
+// listBrowserWindows returns the visible windows of every known browser
+func listBrowserWindows(ctx context.Context) ([]BrowserWindow, error) {
+	switch runtime.GOOS {
+	case "linux":
+		return listWindowsLinux(ctx)
+	case "darwin":
+		return listWindowsDarwin(ctx)
+	case "windows":
+		return listWindowsWindows(ctx)
+	}
+	return nil, fmt.Errorf("unsupported operating system: %s", runtime.GOOS)
+}
+
+func listWindowsLinux(ctx context.Context) ([]BrowserWindow, error) {
+	windows := []BrowserWindow{}
+	for _, b := range knownBrowsers {
+		// xdotool search exits 1 when nothing matches
+		output, err := newCommand(ctx, "xdotool", "search", "--onlyvisible", "--class", b.class).Output()
+		if err != nil {
+			if _, ok := err.(*exec.ExitError); ok {
+				continue
+			}
+			return nil, fmt.Errorf("failed to search windows: %v", err)
+		}
+		for _, id := range strings.Fields(string(output)) {
+			win := BrowserWindow{ID: id, Browser: b.name}
+			if name, err := newCommand(ctx, "xdotool", "getwindowname", id).Output(); err == nil {
+				win.Title = strings.TrimSpace(string(name))
+			}
+			if geometry, err := newCommand(ctx, "xdotool", "getwindowgeometry", "--shell", id).Output(); err == nil {
+				win.Bounds = parseShellGeometry(string(geometry))
+			}
+			windows = append(windows, win)
+		}
+	}
+	return windows, nil
+}
+
+// parseShellGeometry parses the X=, Y=, WIDTH= and HEIGHT= lines of
+// xdotool getwindowgeometry --shell
+func parseShellGeometry(s string) rect {
+	var r rect
+	for _, line := range strings.Split(s, "\n") {
+		key, value, _ := strings.Cut(strings.TrimSpace(line), "=")
+		n, _ := strconv.Atoi(value)
+		switch key {
+		case "X":
+			r.X = n
+		case "Y":
+			r.Y = n
+		case "WIDTH":
+			r.Width = n
+		case "HEIGHT":
+			r.Height = n
+		}
+	}
+	return r
+}
+
+func listWindowsDarwin(ctx context.Context) ([]BrowserWindow, error) {
+	windows := []BrowserWindow{}
+	for _, b := range knownBrowsers {
+		// Each line is "index<TAB>x<TAB>y<TAB>width<TAB>height<TAB>title"
+		script := fmt.Sprintf(`
+		tell application "System Events"
+			if not (exists process "%s") then return ""
+			set out to ""
+			set i to 0
+			repeat with w in windows of process "%s"
+				set i to i + 1
+				set {x, y} to position of w
+				set {ww, hh} to size of w
+				set out to out & i & tab & x & tab & y & tab & ww & tab & hh & tab & (name of w) & linefeed
+			end repeat
+			return out
+		end tell`, b.app, b.app)
+		output, err := newCommand(ctx, "osascript", "-e", script).Output()
+		if err != nil {
+			return nil, fmt.Errorf("failed to list %s windows: %v", b.app, err)
+		}
+		for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+			fields := strings.SplitN(line, "\t", 6)
+			if len(fields) != 6 {
+				continue
+			}
+			windows = append(windows, BrowserWindow{
+				ID:      b.app + ":" + fields[0],
+				Browser: b.name,
+				Title:   fields[5],
+				Bounds:  parseWindowBounds(fields[1:5]),
+			})
+		}
+	}
+	return windows, nil
+}
+
+func listWindowsWindows(ctx context.Context) ([]BrowserWindow, error) {
+	output, err := newCommand(ctx, "powershell", "-Command", psEnumWindowsType+`
+[Console]::OutputEncoding = [System.Text.Encoding]::UTF8
+foreach ($line in [BrowserControllerEnum]::List()) {
+	$fields = $line -split [char]9, 7
+	$process = Get-Process -Id $fields[1] -ErrorAction SilentlyContinue
+	if ($process) { $process.ProcessName + [char]9 + $line }
+}`).Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to enumerate windows: %v", err)
+	}
+
+	processes := make(map[string]string)
+	for _, b := range knownBrowsers {
+		processes[b.process] = b.name
+	}
+	windows := []BrowserWindow{}
+	for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+		// process, hwnd, pid, x, y, width, height, title
+		fields := strings.SplitN(strings.TrimRight(line, "\r"), "\t", 8)
+		if len(fields) != 8 {
+			continue
+		}
+		browser, ok := processes[strings.ToLower(fields[0])]
+		if !ok {
+			continue
+		}
+		windows = append(windows, BrowserWindow{
+			ID:      fields[1],
+			Browser: browser,
+			Title:   fields[7],
+			Bounds:  parseWindowBounds(fields[3:7]),
+		})
+	}
+	return windows, nil
+}
+
+// parseWindowBounds parses x, y, width and height fields, leaving unparsable ones zero
+func parseWindowBounds(fields []string) rect {
+	var v [4]int
+	for i := range v {
+		v[i], _ = strconv.Atoi(strings.TrimSpace(fields[i]))
+	}
+	return rect{X: v[0], Y: v[1], Width: v[2], Height: v[3]}
+}
+
+// handleListWindows lists every visible browser window, for diagnosing
+// which window focus lands on
+func (c *Controller) handleListWindows(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "Only GET method is allowed")
+		return
+	}
+	if runtime.GOOS == "linux" && !haveWindowTool() {
+		writeErrorCode(w, http.StatusNotImplemented, codeDepMissing, "Listing windows on Linux requires xdotool")
+		return
+	}
+
+	windows, err := listBrowserWindows(r.Context())
+	if err != nil {
+		writeCommandError(w, err, fmt.Sprintf("Failed to list windows: %v", err))
+		return
+	}
+	writeJSON(w, http.StatusOK, ListWindowsResponse{
+		Response: Response{
+			Success: true,
+			Message: fmt.Sprintf("Found %d browser windows", len(windows)),
+		},
+		Windows: windows,
+	})
+}
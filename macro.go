@@ -0,0 +1,288 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// MacroAction is one recorded request to a mutating endpoint
+type MacroAction struct {
+	Path    string          `json:"path"`
+	Body    json.RawMessage `json:"body"`
+	DelayMs int64           `json:"delay_ms"` // time since the previous action when recorded
+}
+
+// Macro is a named, ordered list of actions saved to the macro directory
+type Macro struct {
+	Name    string        `json:"name"`
+	Actions []MacroAction `json:"actions"`
+}
+
+// RecordRequest represents the JSON payload for starting or stopping a recording
+type RecordRequest struct {
+	Name   string `json:"name"`
+	Action string `json:"action"` // "start" or "stop"
+}
+
+// ReplayRequest represents the JSON payload for replaying a macro
+type ReplayRequest struct {
+	Name  string  `json:"name"`
+	Speed float64 `json:"speed"` // playback speed multiplier; 2 halves the recorded delays
+}
+
+// ReplayResponse is the Response for /replay
+type ReplayResponse struct {
+	Response
+	Executed int `json:"executed"`
+}
+
+// macroRecorder collects actions while a recording is active
+type macroRecorder struct {
+	mu     sync.Mutex
+	macro  *Macro
+	last   time.Time
+	active bool
+}
+
+var macroNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+func (c *Controller) macroPath(name string) string {
+	return filepath.Join(c.cfg.MacroDir, name+".json")
+}
+
+// recordable wraps a mutating handler so its successful POSTs are captured while recording
+func (c *Controller) recordable(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rec := &c.recorder
+		rec.mu.Lock()
+		active := rec.active
+		rec.mu.Unlock()
+		if !active || r.Method != http.MethodPost || r.Context().Value(lockHeldKey{}) != nil {
+			h(w, r)
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "Failed to read request body")
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		h(sw, r)
+		if sw.status < 200 || sw.status > 299 {
+			return
+		}
+
+		rec.mu.Lock()
+		defer rec.mu.Unlock()
+		if !rec.active {
+			return
+		}
+		now := time.Now()
+		var delay int64
+		if !rec.last.IsZero() {
+			delay = now.Sub(rec.last).Milliseconds()
+		}
+		rec.last = now
+		rec.macro.Actions = append(rec.macro.Actions, MacroAction{
+			Path:    r.URL.Path,
+			Body:    json.RawMessage(body),
+			DelayMs: delay,
+		})
+	}
+}
+
+// statusWriter records the status code written by a handler
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (sw *statusWriter) WriteHeader(status int) {
+	sw.status = status
+	sw.ResponseWriter.WriteHeader(status)
+}
+
+// handleRecord starts or stops recording a named macro
+func (c *Controller) handleRecord(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "Only POST method is allowed")
+		return
+	}
+
+	var req RecordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid JSON payload")
+		return
+	}
+
+	rec := &c.recorder
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+
+	switch req.Action {
+	case "start":
+		if !macroNamePattern.MatchString(req.Name) {
+			writeError(w, http.StatusBadRequest, "Macro name must contain only letters, digits, '-' and '_'")
+			return
+		}
+		if rec.active {
+			writeError(w, http.StatusConflict, fmt.Sprintf("Already recording macro %s", rec.macro.Name))
+			return
+		}
+		rec.macro = &Macro{Name: req.Name, Actions: []MacroAction{}}
+		rec.last = time.Time{}
+		rec.active = true
+		writeJSON(w, http.StatusOK, Response{
+			Success: true,
+			Message: fmt.Sprintf("Recording macro %s", req.Name),
+		})
+
+	case "stop":
+		if !rec.active {
+			writeError(w, http.StatusConflict, "Not recording")
+			return
+		}
+		// A failed save keeps recording, so stopping again can retry it
+		m := rec.macro
+		if err := c.saveMacro(m); err != nil {
+			writeError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to save macro: %v", err))
+			return
+		}
+		rec.active = false
+		rec.macro = nil
+		writeJSON(w, http.StatusOK, Response{
+			Success: true,
+			Message: fmt.Sprintf("Saved macro %s with %d actions", m.Name, len(m.Actions)),
+		})
+
+	default:
+		writeError(w, http.StatusBadRequest, "Action must be \"start\" or \"stop\"")
+	}
+}
+
+// saveMacro writes m readable by its owner only, as request bodies can carry
+// credentials, such as passwords typed with /fill
+func (c *Controller) saveMacro(m *Macro) error {
+	if err := os.MkdirAll(c.cfg.MacroDir, 0o700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := c.macroPath(m.Name)
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		return err
+	}
+	// WriteFile keeps the mode of a macro saved before
+	return os.Chmod(path, 0o600)
+}
+
+func (c *Controller) loadMacro(name string) (*Macro, error) {
+	if !macroNamePattern.MatchString(name) {
+		return nil, fmt.Errorf("invalid macro name %q", name)
+	}
+	data, err := os.ReadFile(c.macroPath(name))
+	if err != nil {
+		return nil, err
+	}
+	var m Macro
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("invalid macro file: %v", err)
+	}
+	return &m, nil
+}
+
+// replayMacro executes each action of m in order with the command mutex held,
+// returning how many actions completed successfully
+func (c *Controller) replayMacro(ctx context.Context, m *Macro, speed float64) (int, error) {
+	if speed <= 0 {
+		speed = 1
+	}
+
+	if err := c.lock(ctx, "replay "+m.Name); err != nil {
+		return 0, err
+	}
+	defer c.unlock()
+
+	for i, action := range m.Actions {
+		if i > 0 && action.DelayMs > 0 {
+			select {
+			case <-time.After(time.Duration(float64(action.DelayMs)/speed) * time.Millisecond):
+			case <-ctx.Done():
+				return i, ctx.Err()
+			}
+		}
+
+		rec, err := c.dispatchLocked(ctx, action.Path, action.Body)
+		if err != nil {
+			return i, err
+		}
+		if rec.status < 200 || rec.status > 299 {
+			var resp Response
+			json.Unmarshal(rec.body.Bytes(), &resp)
+			return i, fmt.Errorf("action %d (%s) failed with status %d: %s", i+1, action.Path, rec.status, resp.Message)
+		}
+	}
+	return len(m.Actions), nil
+}
+
+// handleReplay executes a saved macro
+func (c *Controller) handleReplay(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "Only POST method is allowed")
+		return
+	}
+
+	var req ReplayRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid JSON payload")
+		return
+	}
+	if req.Speed < 0 {
+		writeError(w, http.StatusBadRequest, "Speed cannot be negative")
+		return
+	}
+
+	m, err := c.loadMacro(req.Name)
+	if err != nil {
+		if os.IsNotExist(err) {
+			writeError(w, http.StatusNotFound, fmt.Sprintf("Macro %s not found", req.Name))
+			return
+		}
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("Failed to load macro: %v", err))
+		return
+	}
+
+	executed, err := c.replayMacro(r.Context(), m, req.Speed)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ReplayResponse{
+			Response: Response{
+				Success:   false,
+				Message:   fmt.Sprintf("Replay of %s stopped: %v", m.Name, err),
+				ErrorCode: errorCode(err),
+			},
+			Executed: executed,
+		})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, ReplayResponse{
+		Response: Response{
+			Success: true,
+			Message: fmt.Sprintf("Replayed macro %s", m.Name),
+		},
+		Executed: executed,
+	})
+}
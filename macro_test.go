@@ -0,0 +1,39 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStopRecordingKeepsMacroWhenSaveFails(t *testing.T) {
+	dir := t.TempDir()
+	blocked := filepath.Join(dir, "file")
+	if err := os.WriteFile(blocked, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	// A file where the macro directory should be makes the save fail
+	c := newController(&Config{APIKey: testAPIKey, MacroDir: blocked})
+
+	if rec := serveWithKey(c, http.MethodPost, "/record", `{"action":"start","name":"opening"}`); rec.Code != http.StatusOK {
+		t.Fatalf("start: status %d: %s", rec.Code, rec.Body)
+	}
+	if rec := serveWithKey(c, http.MethodPost, "/record", `{"action":"stop"}`); rec.Code != http.StatusInternalServerError {
+		t.Fatalf("stop with an unwritable -macro-dir: status %d: %s", rec.Code, rec.Body)
+	}
+	if !c.recorder.active || c.recorder.macro == nil {
+		t.Fatal("a failed save stopped the recording")
+	}
+
+	c.cfg.MacroDir = filepath.Join(dir, "macros")
+	if rec := serveWithKey(c, http.MethodPost, "/record", `{"action":"stop"}`); rec.Code != http.StatusOK {
+		t.Fatalf("stop after fixing -macro-dir: status %d: %s", rec.Code, rec.Body)
+	}
+	if c.recorder.active || c.recorder.macro != nil {
+		t.Error("the recording is still active after it was saved")
+	}
+	if _, err := os.Stat(c.macroPath("opening")); err != nil {
+		t.Errorf("macro not saved: %v", err)
+	}
+}
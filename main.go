@@ -1,188 +1,362 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
-	"os/exec"
-	"runtime"
+	"os/signal"
 	"strings"
+	"syscall"
+	"time"
 )
 
 // URLRequest represents the JSON payload with the URL to open
 type URLRequest struct {
 	URL string `json:"url"`
+	// Profile is the Firefox profile to launch with if Firefox isn't running yet.
+	// It has no effect on an already running instance.
+	Profile string `json:"profile,omitempty"`
+	// Background opens the URL in a new tab without selecting it (marionette backend only)
+	Background bool `json:"background,omitempty"`
+	// VerifyBoard overrides -verify-board for this request
+	VerifyBoard *bool `json:"verify_board,omitempty"`
+}
+
+// OpenResponse is the Response for /open
+type OpenResponse struct {
+	Response
+	TabID string `json:"tab_id,omitempty"` // handle of the tab opened in the background
 }
 
 // Response represents the API response
 type Response struct {
-	Success bool   `json:"success"`
-	Message string `json:"message"`
+	Success   bool   `json:"success"`
+	Message   string `json:"message"`
+	ErrorCode string `json:"error_code,omitempty"` // one of the code constants when Success is false
 }
 
-// updateFirefoxURL changes the URL of the current Firefox tab
-func updateFirefoxURL(url string) error {
-	var cmd *exec.Cmd
-
-	switch runtime.GOOS {
-	case "linux":
-		// For Linux, we can use the Firefox remote protocol
-		// First check if Firefox is running
-		checkCmd := exec.Command("pgrep", "firefox")
-		if err := checkCmd.Run(); err != nil {
-			// Firefox is not running, start it with the URL
-			cmd = exec.Command("firefox", "--kiosk", url)
-		} else {
-			// Firefox is running, use xdotool to focus Firefox and simulate keystrokes
-			// This approach is more reliable than --remote for modern Firefox
-			focusCmd := exec.Command("xdotool", "search", "--onlyvisible", "--class", "Firefox", "windowactivate")
-			if err := focusCmd.Run(); err != nil {
-				return fmt.Errorf("failed to focus Firefox window: %v", err)
-			}
-			
-			// Open a new tab with Ctrl+L to focus address bar, then type URL and press Enter
-			selectCmd := exec.Command("xdotool", "key", "ctrl+l")
-			if err := selectCmd.Run(); err != nil {
-				return fmt.Errorf("failed to select address bar: %v", err)
-			}
-			
-			// Type the URL (cleaner to split into two commands)
-			typeCmd := exec.Command("xdotool", "type", "--clearmodifiers", url)
-			if err := typeCmd.Run(); err != nil {
-				return fmt.Errorf("failed to type URL: %v", err)
-			}
-			
-			// Press Enter to navigate
-			enterCmd := exec.Command("xdotool", "key", "Return")
-			return enterCmd.Run()
-		}
-		
-	case "darwin":
-		// For macOS, we'll use AppleScript which is more reliable
-		scriptContent := fmt.Sprintf(`
-		tell application "Firefox"
-			activate
-			tell application "System Events"
-				tell process "Firefox"
-					keystroke "l" using command down
-					delay 0.1
-					keystroke "a" using command down
-					delay 0.1
-					keystroke "%s"
-					delay 0.1
-					keystroke return
-				end tell
-			end tell
-		end tell`, url)
-		cmd = exec.Command("osascript", "-e", scriptContent)
-		
-	case "windows":
-		// For Windows, we'll use a PowerShell script
-		// Check if Firefox is running
-		checkCmd := exec.Command("tasklist", "/FI", "IMAGENAME eq firefox.exe", "/NH")
-		output, _ := checkCmd.Output()
-		if !strings.Contains(string(output), "firefox.exe") {
-			// Firefox is not running, start it with the URL
-			cmd = exec.Command("cmd", "/C", "start", "firefox.exe", url)
-		} else {
-			// Firefox is running, use PowerShell to focus and change URL
-			psScript := fmt.Sprintf(`
-			Add-Type -AssemblyName System.Windows.Forms
-			# Focus Firefox window
-			$firefox = Get-Process firefox | Where-Object {$_.MainWindowHandle -ne 0} | Select-Object -First 1
-			if ($firefox) {
-				[void][System.Reflection.Assembly]::LoadWithPartialName('Microsoft.VisualBasic')
-				$hwnd = $firefox.MainWindowHandle
-				[Microsoft.VisualBasic.Interaction]::AppActivate($hwnd)
-				Start-Sleep -Milliseconds 100
-				# Select address bar and enter URL
-				[System.Windows.Forms.SendKeys]::SendWait("^l")
-				Start-Sleep -Milliseconds 100
-				[System.Windows.Forms.SendKeys]::SendWait("^a")
-				Start-Sleep -Milliseconds 100
-				[System.Windows.Forms.SendKeys]::SendWait("%s")
-				Start-Sleep -Milliseconds 100
-				[System.Windows.Forms.SendKeys]::SendWait("{ENTER}")
-			} else {
-				Start-Process "firefox.exe" -ArgumentList "%s"
-			}`, url, url)
-			cmd = exec.Command("powershell", "-Command", psScript)
-		}
-	default:
-		return fmt.Errorf("unsupported operating system: %s", runtime.GOOS)
-	}
-
-	return cmd.Run()
+// updateFirefoxURL changes the URL of the current Firefox tab, launching
+// Firefox with profile if it isn't running
+func (c *Controller) updateFirefoxURL(ctx context.Context, url, profile string) error {
+	if navigated, err := c.kioskNavigate(ctx, url); navigated {
+		return err
+	}
+
+	// Firefox that isn't running is started with the URL, the same on every
+	// platform, unless -auto-launch is off
+	if !firefoxRunning(ctx) {
+		if !c.cfg.AutoLaunch {
+			return withCode(codeBrowserNotRunning, fmt.Errorf("%s is not running, and -auto-launch=false leaves starting it to you", targetBrowser.app))
+		}
+		if err := c.launchFirefox(ctx, url, profile); err != errFirefoxRunning {
+			return err
+		}
+		// Another request launched it meanwhile, so type the URL into it
+	}
+	// Wait out a launch in progress so typing doesn't race its window
+	if err := c.awaitLaunch(ctx); err != nil {
+		return err
+	}
+
+	// Firefox is running: type the URL into its address bar, escaped for
+	// each platform's input tool, and press Enter to navigate
+	if err := setAddressBar(ctx, url); err != nil {
+		return err
+	}
+	if err := pressKey(ctx, "Return"); err != nil {
+		abortAddressBarEdit(ctx, "pressing Enter")
+		return fmt.Errorf("failed to press Enter: %v", err)
+	}
+	return nil
 }
 
-func handleOpenURL(w http.ResponseWriter, r *http.Request) {
-	// Set content type
-	w.Header().Set("Content-Type", "application/json")
+// abortAddressBarEdit presses Escape twice, closing the suggestions and
+// restoring the current page's URL, after the step that failed left the
+// address bar half edited. It runs even when ctx has expired, since that is
+// often why the step failed.
+func abortAddressBarEdit(ctx context.Context, failedStep string) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 2*time.Second)
+	defer cancel()
+	for i := 0; i < 2; i++ {
+		if err := linuxInput(ctx).key(ctx, "Escape"); err != nil {
+			log.Printf("failed to clear the address bar after %s failed: %v", failedStep, err)
+			return
+		}
+	}
+}
 
+// openBackgroundTab serves an /open request with background set
+func (c *Controller) openBackgroundTab(w http.ResponseWriter, r *http.Request, target string) {
+	if c.marionette == nil {
+		writeError(w, http.StatusNotImplemented, "Opening a background tab requires the marionette backend")
+		return
+	}
+	var tab string
+	err := c.command(r, func() error {
+		var err error
+		tab, err = c.marionette.OpenBackgroundTab(r.Context(), target)
+		return err
+	})
+	if err != nil {
+		writeCommandError(w, err, fmt.Sprintf("Failed to open background tab: %v", err))
+		return
+	}
+	writeJSON(w, http.StatusOK, OpenResponse{
+		Response: Response{
+			Success: true,
+			Message: fmt.Sprintf("Opened %s in a background tab", target),
+		},
+		TabID: tab,
+	})
+}
+
+func (c *Controller) handleOpenURL(w http.ResponseWriter, r *http.Request) {
 	// Only allow POST requests
 	if r.Method != http.MethodPost {
-		w.WriteHeader(http.StatusMethodNotAllowed)
-		json.NewEncoder(w).Encode(Response{
-			Success: false,
-			Message: "Only POST method is allowed",
-		})
+		writeError(w, http.StatusMethodNotAllowed, "Only POST method is allowed")
 		return
 	}
 
 	// Decode the request
 	var req URLRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(Response{
-			Success: false,
-			Message: "Invalid JSON payload",
-		})
+		writeError(w, http.StatusBadRequest, "Invalid JSON payload")
 		return
 	}
 
 	// Validate URL
 	if req.URL == "" {
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(Response{
-			Success: false,
-			Message: "URL cannot be empty",
-		})
+		writeErrorCode(w, http.StatusBadRequest, codeInvalidURL, "URL cannot be empty")
+		return
+	}
+
+	// Send the browser the ASCII form; the message keeps the human-readable one
+	target, err := normalizeURL(req.URL)
+	if err != nil {
+		writeErrorCode(w, http.StatusBadRequest, codeInvalidURL, fmt.Sprintf("Invalid URL: %v", err))
+		return
+	}
+
+	// A pinned controller only goes to its pin
+	if c.cfg.PinURL != "" && !matchesPin(target, c.cfg.PinURL) {
+		if !c.cfg.PinRedirect {
+			writeError(w, http.StatusForbidden, fmt.Sprintf("URL %s is outside the pinned URL %s", req.URL, c.cfg.PinURL))
+			return
+		}
+		req.URL, target = c.cfg.PinURL, c.cfg.PinURL
+	}
+
+	// Only navigate to allowed sites
+	var allowedBy string
+	if len(c.cfg.AllowedDomains) > 0 {
+		host := urlHost(target)
+		if host == "" {
+			writeError(w, http.StatusForbidden, fmt.Sprintf("URL %s has no host to check against the allowed domains", req.URL))
+			return
+		}
+		domain, ok := c.allowedDomain(host)
+		if !ok {
+			writeError(w, http.StatusForbidden, fmt.Sprintf("Host %s is not in the allowed domains", host))
+			return
+		}
+		allowedBy = fmt.Sprintf(" (host %s allowed by %s)", host, domain)
+	}
+
+	// Reject runaway URLs that would take too long to type
+	if c.cfg.MaxURLLength > 0 && len(target) > c.cfg.MaxURLLength {
+		writeErrorCode(w, http.StatusBadRequest, codeInvalidURL, fmt.Sprintf("URL is %d characters long, exceeding the limit of %d", len(target), c.cfg.MaxURLLength))
+		return
+	}
+
+	if req.Background {
+		c.openBackgroundTab(w, r, target)
 		return
 	}
 
+	verifyBoard := c.cfg.VerifyBoard
+	if req.VerifyBoard != nil {
+		verifyBoard = *req.VerifyBoard
+	}
+
 	// Update URL in Firefox
-	if err := updateFirefoxURL(req.URL); err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(Response{
-			Success: false,
-			Message: fmt.Sprintf("Failed to change URL: %v", err),
-		})
+	wasRunning := firefoxRunning(r.Context())
+	navigated, settled, settledBy := false, 0, ""
+	spanAttr(r.Context(), stringAttr("url.host", urlHost(target)))
+	err = c.focusCommand(r, func() error {
+		doneNavigate := timeStep(r.Context(), "navigate")
+		err := c.navigateVerified(r.Context(), target, req.Profile)
+		doneNavigate()
+		if err != nil {
+			return err
+		}
+		navigated = true
+		if c.cfg.ResetZoomOnOpen {
+			if err := resetZoom(r.Context()); err != nil {
+				return fmt.Errorf("failed to reset the zoom level: %v", err)
+			}
+		}
+		settled, settledBy, err = c.settleAfterNavigate(r.Context(), target)
+		if err == nil && c.cfg.CheckChallenge {
+			err = c.checkChallenge(r.Context())
+		}
+		if err == nil && verifyBoard {
+			err = c.waitForBoard(r.Context(), target)
+		}
+		return err
+	})
+	if navigated {
+		c.watchdog.navigated(target)
+		c.state.navigated(target)
+		c.console.reset()
+	}
+	if err != nil {
+		if navigated {
+			writeCommandError(w, err, fmt.Sprintf("Opened %s but the %v", req.URL, err))
+			return
+		}
+		writeCommandError(w, err, fmt.Sprintf("Failed to change URL: %v", err))
 		return
 	}
 
 	// Success response
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(Response{
+	message := fmt.Sprintf("Successfully changed Firefox tab to %s", req.URL) + allowedBy
+	if settledBy != "" {
+		message += fmt.Sprintf("; ran %d after-navigate steps for %s", settled, settledBy)
+	}
+	if wasRunning && req.Profile != "" {
+		message += profileIgnoredNote
+	}
+	writeJSON(w, http.StatusOK, Response{
 		Success: true,
-		Message: fmt.Sprintf("Successfully changed Firefox tab to %s", req.URL),
+		Message: message,
 	})
 }
 
 func main() {
-	// Get port from environment variable or use default
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "9001"
+	exitIfFakeExec()
+	cfg, err := loadConfig()
+	if err != nil {
+		log.Fatal(err)
+	}
+	configureCommandLog(cfg)
+	configureKeyNames(cfg)
+	configureBrowser(cfg)
+	screenshotInterval = cfg.ScreenshotInterval
+	focusSettle = cfg.FocusSettle
+	if err := configureTracing(); err != nil {
+		log.Fatal(err)
+	}
+	var handler http.Handler
+	var controllers []*Controller
+	if len(cfg.Sessions) > 0 {
+		sr, err := newSessionRouter(cfg)
+		if err != nil {
+			log.Fatal(err)
+		}
+		handler, controllers = sr, sr.controllers()
+		log.Printf("serving %d sessions: %s", len(sr.names), strings.Join(sr.names, ", "))
+	} else {
+		c := newController(cfg)
+		handler, controllers = c.mux, []*Controller{c}
+	}
+	c := controllers[0]
+	// A replay must not depend on the tools installed here, so it keeps the defaults
+	if cfg.ReplayCommands != "" {
+		if err := c.runGoldenReplay(); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if err := checkBrowserInstalled(cfg); err != nil {
+		log.Fatal(err)
+	}
+	// Each session probes its own display, which may have other tools working
+	for _, sc := range controllers {
+		if err := sc.chooseDevices(); err != nil {
+			log.Fatal(err)
+		}
 	}
 
-	// Register handlers
-	http.HandleFunc("/open", handleOpenURL)
+	if cfg.SelfTest {
+		if failed := logSelfTest(c.runSelfTest()); failed && cfg.FailFast {
+			log.Fatal("self-test failed, exiting")
+		}
+	}
+
+	if cfg.Replay != "" {
+		m, err := c.loadMacro(cfg.Replay)
+		if err != nil {
+			log.Fatalf("failed to load macro %s: %v", cfg.Replay, err)
+		}
+		executed, err := c.replayMacro(c.baseContext(), m, cfg.ReplaySpeed)
+		if err != nil {
+			log.Fatalf("replay of %s stopped after %d actions: %v", m.Name, executed, err)
+		}
+		log.Printf("replayed macro %s (%d actions)", m.Name, executed)
+		return
+	}
 
 	// Start server
-	addr := fmt.Sprintf(":%s", port)
-	fmt.Printf("Server running on http://localhost%s\n", addr)
+	tlsCfg, err := serverTLSConfig(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	scheme := "http"
+	if tlsCfg != nil {
+		scheme = "https"
+	}
+	addr := fmt.Sprintf(":%s", cfg.Port)
+	fmt.Printf("Server running on %s://localhost%s\n", scheme, addr)
 	fmt.Println("Send a POST request to /open with JSON payload {\"url\": \"https://example.com\"}")
-	log.Fatal(http.ListenAndServe(addr, nil))
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if tlsCfg != nil {
+		ln = tls.NewListener(ln, tlsCfg)
+	}
+	listeners := []net.Listener{ln}
+	if cfg.HTTPAddr != "" {
+		plain, err := net.Listen("tcp", cfg.HTTPAddr)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("Also serving plain HTTP on http://%s\n", plain.Addr())
+		listeners = append(listeners, plain)
+	}
+	for _, c := range controllers {
+		if cfg.WatchdogInterval > 0 {
+			go c.runWatchdog(c.baseContext())
+		}
+		if cfg.LaunchOnStart {
+			go c.launchOnStart()
+		} else if cfg.StartURL != "" {
+			go c.openStartURL()
+		}
+	}
+	if cfg.Gzip {
+		handler = withGzip(handler, cfg.GzipMinSize)
+	}
+	srv := &http.Server{Handler: countRequests(handler)}
+	// Both listeners share the server, so shutting it down stops them together
+	served := make(chan error, len(listeners))
+	for _, ln := range listeners {
+		go func() { served <- srv.Serve(ln) }()
+	}
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	select {
+	case err := <-served:
+		log.Fatal(err)
+	case sig := <-stop:
+		// A second signal stops the process at once
+		signal.Stop(stop)
+		log.Printf("received %v", sig)
+		shutdown(srv, controllers, cfg.ShutdownTimeout)
+	}
 }
@@ -0,0 +1,368 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// marionetteClient drives Firefox through the Marionette remote protocol,
+// which Firefox exposes on 127.0.0.1:2828 when started with --marionette
+type marionetteClient struct {
+	addr string
+
+	mu     sync.Mutex
+	conn   net.Conn
+	reader *bufio.Reader
+	nextID int
+}
+
+// marionetteError is an error reported by the browser in a command response
+type marionetteError struct {
+	Code    string `json:"error"`
+	Message string `json:"message"`
+}
+
+func (e *marionetteError) Error() string {
+	return fmt.Sprintf("marionette %s: %s", e.Code, e.Message)
+}
+
+// webdriverCookie is the WebDriver wire representation of a cookie
+type webdriverCookie struct {
+	Name     string `json:"name"`
+	Value    string `json:"value"`
+	Domain   string `json:"domain,omitempty"`
+	Path     string `json:"path,omitempty"`
+	Secure   bool   `json:"secure"`
+	HTTPOnly bool   `json:"httpOnly"`
+	Expiry   int64  `json:"expiry,omitempty"`
+	SameSite string `json:"sameSite,omitempty"`
+}
+
+// marionetteTimeout bounds a command whose context has no deadline
+const marionetteTimeout = 30 * time.Second
+
+func newMarionetteClient(addr string) *marionetteClient {
+	return &marionetteClient{addr: addr}
+}
+
+// connect dials Marionette, reads the server hello and starts a WebDriver session
+func (m *marionetteClient) connect(ctx context.Context) error {
+	dialer := net.Dialer{Timeout: 5 * time.Second}
+	conn, err := dialer.DialContext(ctx, "tcp", m.addr)
+	if err != nil {
+		return err
+	}
+	m.conn = conn
+	m.reader = bufio.NewReader(conn)
+	m.conn.SetDeadline(commandDeadline(ctx))
+
+	var hello struct {
+		ApplicationType    string `json:"applicationType"`
+		MarionetteProtocol int    `json:"marionetteProtocol"`
+	}
+	if err := m.readPacket(&hello); err != nil {
+		m.close()
+		return fmt.Errorf("failed to read hello: %v", err)
+	}
+	if hello.MarionetteProtocol < 3 {
+		m.close()
+		return fmt.Errorf("unsupported marionette protocol version %d", hello.MarionetteProtocol)
+	}
+
+	if _, err := m.roundTrip("WebDriver:NewSession", map[string]interface{}{"capabilities": map[string]interface{}{}}); err != nil {
+		m.close()
+		return fmt.Errorf("failed to start session: %v", err)
+	}
+	return nil
+}
+
+func (m *marionetteClient) close() {
+	if m.conn != nil {
+		m.conn.Close()
+	}
+	m.conn = nil
+	m.reader = nil
+}
+
+// commandDeadline is when a command under ctx must have finished
+func commandDeadline(ctx context.Context) time.Time {
+	if deadline, ok := ctx.Deadline(); ok {
+		return deadline
+	}
+	return time.Now().Add(marionetteTimeout)
+}
+
+// readPacket reads one length-prefixed ("<len>:<json>") packet into v
+func (m *marionetteClient) readPacket(v interface{}) error {
+	prefix, err := m.reader.ReadString(':')
+	if err != nil {
+		return err
+	}
+	n, err := strconv.Atoi(strings.TrimSuffix(prefix, ":"))
+	if err != nil {
+		return fmt.Errorf("invalid packet length %q", prefix)
+	}
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(m.reader, buf); err != nil {
+		return err
+	}
+	return json.Unmarshal(buf, v)
+}
+
+func (m *marionetteClient) writePacket(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(m.conn, "%d:%s", len(data), data)
+	return err
+}
+
+// roundTrip sends a command packet and waits for the matching response
+func (m *marionetteClient) roundTrip(command string, params interface{}) (json.RawMessage, error) {
+	if params == nil {
+		params = map[string]interface{}{}
+	}
+	m.nextID++
+	id := m.nextID
+	if err := m.writePacket([]interface{}{0, id, command, params}); err != nil {
+		return nil, err
+	}
+
+	for {
+		var msg []json.RawMessage
+		if err := m.readPacket(&msg); err != nil {
+			return nil, err
+		}
+		if len(msg) != 4 {
+			return nil, fmt.Errorf("malformed response with %d fields", len(msg))
+		}
+		var msgType, msgID int
+		if err := json.Unmarshal(msg[0], &msgType); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(msg[1], &msgID); err != nil {
+			return nil, err
+		}
+		// Skip anything that isn't the response to this command
+		if msgType != 1 || msgID != id {
+			continue
+		}
+		if string(msg[2]) != "null" {
+			var merr marionetteError
+			if err := json.Unmarshal(msg[2], &merr); err != nil {
+				return nil, fmt.Errorf("malformed error: %s", msg[2])
+			}
+			return nil, &merr
+		}
+		return msg[3], nil
+	}
+}
+
+// call runs a command, connecting first if needed, and decodes the result into out.
+// Transport failures drop the connection so the next call reconnects. The
+// command must finish by ctx's deadline, and ctx ending closes the
+// connection, so a wedged browser doesn't hold m.mu past the request.
+func (m *marionetteClient) call(ctx context.Context, command string, params interface{}, out interface{}) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if m.conn == nil {
+		if err := m.connect(ctx); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return withCode(codeBrowserNotRunning, fmt.Errorf("failed to connect to Marionette at %s: %v", m.addr, err))
+		}
+	}
+
+	conn := m.conn
+	conn.SetDeadline(commandDeadline(ctx))
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	raw, err := m.roundTrip(command, params)
+	if !stop() {
+		// ctx ended during the command, which closed the connection
+		m.close()
+		return ctx.Err()
+	}
+	if err != nil {
+		if _, ok := err.(*marionetteError); !ok {
+			m.close()
+		}
+		return err
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(unwrapValue(raw), out)
+}
+
+// unwrapValue strips the {"value": ...} envelope most commands respond with
+func unwrapValue(raw json.RawMessage) json.RawMessage {
+	var wrapped map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &wrapped); err == nil && len(wrapped) == 1 {
+		if v, ok := wrapped["value"]; ok {
+			return v
+		}
+	}
+	return raw
+}
+
+// CurrentURL returns the URL of the current tab
+func (m *marionetteClient) CurrentURL(ctx context.Context) (string, error) {
+	var url string
+	err := m.call(ctx, "WebDriver:GetCurrentURL", nil, &url)
+	return url, err
+}
+
+// Navigate loads url in the current tab, waiting for the page to load
+func (m *marionetteClient) Navigate(ctx context.Context, url string) error {
+	return m.call(ctx, "WebDriver:Navigate", map[string]string{"url": url}, nil)
+}
+
+// Refresh reloads the current tab, waiting for the page to load
+func (m *marionetteClient) Refresh(ctx context.Context) error {
+	return m.call(ctx, "WebDriver:Refresh", nil, nil)
+}
+
+// Cookies returns the cookies visible to the current page
+func (m *marionetteClient) Cookies(ctx context.Context) ([]webdriverCookie, error) {
+	var cookies []webdriverCookie
+	err := m.call(ctx, "WebDriver:GetCookies", nil, &cookies)
+	return cookies, err
+}
+
+// AddCookie sets a cookie on the current page's domain
+func (m *marionetteClient) AddCookie(ctx context.Context, cookie webdriverCookie) error {
+	return m.call(ctx, "WebDriver:AddCookie", map[string]interface{}{"cookie": cookie}, nil)
+}
+
+// Title returns the title of the current tab
+func (m *marionetteClient) Title(ctx context.Context) (string, error) {
+	var title string
+	err := m.call(ctx, "WebDriver:GetTitle", nil, &title)
+	return title, err
+}
+
+// ExecuteScript runs script as the body of a function in the current page,
+// with args available as arguments[], and decodes its return value into out
+func (m *marionetteClient) ExecuteScript(ctx context.Context, script string, args []interface{}, out interface{}) error {
+	if args == nil {
+		args = []interface{}{}
+	}
+	return m.call(ctx, "WebDriver:ExecuteScript", map[string]interface{}{"script": script, "args": args}, out)
+}
+
+// AddressBarValue returns the text in the address bar of the current
+// window. It runs in the browser chrome, which newer Firefox only allows
+// when started with -remote-allow-system-access.
+func (m *marionetteClient) AddressBarValue(ctx context.Context) (string, error) {
+	if err := m.call(ctx, "Marionette:SetContext", map[string]string{"value": "chrome"}, nil); err != nil {
+		return "", err
+	}
+	defer func() {
+		// Switch back even when ctx expired, or later commands would run in the chrome
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 2*time.Second)
+		defer cancel()
+		m.call(ctx, "Marionette:SetContext", map[string]string{"value": "content"}, nil)
+	}()
+	var value string
+	err := m.call(ctx, "WebDriver:ExecuteScript", map[string]interface{}{
+		"script": `const bar = document.getElementById("urlbar-input") || document.getElementById("urlbar"); return bar ? bar.value : null;`,
+		"args":   []interface{}{},
+	}, &value)
+	return value, err
+}
+
+// webElementKey is the W3C WebDriver key identifying an element reference
+const webElementKey = "element-6066-11e4-a52e-4f735466cecf"
+
+// FindElement returns the id of the first element matching a CSS selector
+func (m *marionetteClient) FindElement(ctx context.Context, selector string) (string, error) {
+	var ref map[string]string
+	if err := m.call(ctx, "WebDriver:FindElement", map[string]string{"using": "css selector", "value": selector}, &ref); err != nil {
+		return "", err
+	}
+	id, ok := ref[webElementKey]
+	if !ok {
+		return "", fmt.Errorf("unexpected element reference %v", ref)
+	}
+	return id, nil
+}
+
+// ElementScreenshot returns a PNG of just the element with the given id
+func (m *marionetteClient) ElementScreenshot(ctx context.Context, id string) ([]byte, error) {
+	var encoded string
+	err := m.call(ctx, "WebDriver:TakeScreenshot", map[string]interface{}{"id": id, "full": false, "hash": false}, &encoded)
+	if err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.DecodeString(encoded)
+}
+
+// OpenBackgroundTab opens url in a new tab without selecting it and returns
+// the tab's window handle. The current tab stays the command target.
+func (m *marionetteClient) OpenBackgroundTab(ctx context.Context, url string) (string, error) {
+	var current string
+	if err := m.call(ctx, "WebDriver:GetWindowHandle", nil, &current); err != nil {
+		return "", err
+	}
+	var tab struct {
+		Handle string `json:"handle"`
+	}
+	if err := m.call(ctx, "WebDriver:NewWindow", map[string]interface{}{"type": "tab", "focus": false}, &tab); err != nil {
+		return "", err
+	}
+	if err := m.call(ctx, "WebDriver:SwitchToWindow", map[string]interface{}{"handle": tab.Handle, "focus": false}, nil); err != nil {
+		return "", err
+	}
+	navErr := m.call(ctx, "WebDriver:Navigate", map[string]string{"url": url}, nil)
+	if err := m.call(ctx, "WebDriver:SwitchToWindow", map[string]interface{}{"handle": current, "focus": false}, nil); err != nil {
+		return "", err
+	}
+	return tab.Handle, navErr
+}
+
+// reset drops the connection so the next call reconnects, such as after
+// Firefox restarted
+func (m *marionetteClient) reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.close()
+}
+
+// TabHandles returns the window handles of the open tabs
+func (m *marionetteClient) TabHandles(ctx context.Context) ([]string, error) {
+	var handles []string
+	err := m.call(ctx, "WebDriver:GetWindowHandles", nil, &handles)
+	return handles, err
+}
+
+// SwitchToTab selects the tab with the given handle and makes it the command target
+func (m *marionetteClient) SwitchToTab(ctx context.Context, handle string) error {
+	return m.call(ctx, "WebDriver:SwitchToWindow", map[string]interface{}{"handle": handle, "focus": true}, nil)
+}
+
+// CloseTab closes the tab commands go to; another must be selected after
+func (m *marionetteClient) CloseTab(ctx context.Context) error {
+	return m.call(ctx, "WebDriver:CloseWindow", nil, nil)
+}
+
+// CurrentTab returns the handle of the tab commands go to
+func (m *marionetteClient) CurrentTab(ctx context.Context) (string, error) {
+	var handle string
+	err := m.call(ctx, "WebDriver:GetWindowHandle", nil, &handle)
+	return handle, err
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// wedgedMarionette serves a Marionette hello and a session, then never
+// answers another command
+func wedgedMarionette(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				hello := `{"applicationType":"gecko","marionetteProtocol":3}`
+				fmt.Fprintf(conn, "%d:%s", len(hello), hello)
+				reader := bufio.NewReader(conn)
+				for n := 0; ; n++ {
+					prefix, err := reader.ReadString(':')
+					if err != nil {
+						return
+					}
+					size, _ := strconv.Atoi(strings.TrimSuffix(prefix, ":"))
+					packet := make([]byte, size)
+					if _, err := io.ReadFull(reader, packet); err != nil {
+						return
+					}
+					if n > 0 {
+						continue
+					}
+					var msg []json.RawMessage
+					json.Unmarshal(packet, &msg)
+					reply := fmt.Sprintf(`[1,%s,null,{}]`, msg[1])
+					fmt.Fprintf(conn, "%d:%s", len(reply), reply)
+				}
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func TestMarionetteCallEndsWithContext(t *testing.T) {
+	m := newMarionetteClient(wedgedMarionette(t))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := m.CurrentURL(ctx); err == nil {
+		t.Fatal("CurrentURL succeeded against a wedged browser")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("CurrentURL took %v with a 200ms deadline", elapsed)
+	}
+
+	// Cancelling without a deadline closes the connection too
+	ctx, cancel = context.WithCancel(context.Background())
+	time.AfterFunc(200*time.Millisecond, cancel)
+	start = time.Now()
+	if _, err := m.CurrentURL(ctx); err != context.Canceled {
+		t.Errorf("CurrentURL = %v after cancelling, want %v", err, context.Canceled)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("CurrentURL took %v to notice the cancel", elapsed)
+	}
+
+	reset := make(chan struct{})
+	go func() {
+		m.reset()
+		close(reset)
+	}()
+	select {
+	case <-reset:
+	case <-time.After(time.Second):
+		t.Error("reset blocked after the calls ended")
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// handleMetrics reports the screen capture counters in the Prometheus text
+// format, so a scraper can see how often -screenshot-min-interval saves a
+// capture, and the requests answered without running or held back, so
+// duplicates sent by a client can be told apart from requests the
+// controller drops. The counters cover every session of the process.
+func (c *Controller) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "Only GET method is allowed")
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	fmt.Fprintf(w, "# HELP browser_controller_screen_captures_total Screen captures taken.\n")
+	fmt.Fprintf(w, "# TYPE browser_controller_screen_captures_total counter\n")
+	fmt.Fprintf(w, "browser_controller_screen_captures_total %d\n", screenCaptures.Load())
+	fmt.Fprintf(w, "# HELP browser_controller_screen_cache_hits_total Screenshot requests served the previous capture within -screenshot-min-interval.\n")
+	fmt.Fprintf(w, "# TYPE browser_controller_screen_cache_hits_total counter\n")
+	fmt.Fprintf(w, "browser_controller_screen_cache_hits_total %d\n", screenCacheHits.Load())
+	fmt.Fprintf(w, "# HELP browser_controller_screen_cache_shared_total Screenshot requests that waited for a capture already in flight.\n")
+	fmt.Fprintf(w, "# TYPE browser_controller_screen_cache_shared_total counter\n")
+	fmt.Fprintf(w, "browser_controller_screen_cache_shared_total %d\n", screenCacheShared.Load())
+	fmt.Fprintf(w, "# HELP browser_controller_screenshot_min_interval_seconds The -screenshot-min-interval setting.\n")
+	fmt.Fprintf(w, "# TYPE browser_controller_screenshot_min_interval_seconds gauge\n")
+	fmt.Fprintf(w, "browser_controller_screenshot_min_interval_seconds %g\n", screenshotInterval.Seconds())
+	fmt.Fprintf(w, "# HELP browser_controller_requests_deduplicated_total Requests answered with an identical request's response instead of running, by reason.\n")
+	fmt.Fprintf(w, "# TYPE browser_controller_requests_deduplicated_total counter\n")
+	fmt.Fprintf(w, "browser_controller_requests_deduplicated_total{reason=\"open_in_flight\"} %d\n", dedupOpenInFlight.Load())
+	fmt.Fprintf(w, "browser_controller_requests_deduplicated_total{reason=\"open_recent\"} %d\n", dedupOpenRecent.Load())
+	fmt.Fprintf(w, "# HELP browser_controller_actions_paced_total Focus-taking actions held back by -min-action-interval; none are rejected.\n")
+	fmt.Fprintf(w, "# TYPE browser_controller_actions_paced_total counter\n")
+	fmt.Fprintf(w, "browser_controller_actions_paced_total %d\n", actionsPaced.Load())
+}
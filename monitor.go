@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Monitor is one display of a multi-monitor desktop. Bounds are in the
+// desktop's coordinates, which place the monitors side by side.
+type Monitor struct {
+	Index   int    `json:"index"`
+	Name    string `json:"name"`
+	Primary bool   `json:"primary"`
+	Bounds  rect   `json:"bounds"`
+	// Scale is the screen pixels per point, 2 on Retina displays; only
+	// macOS reports it, the other platforms giving bounds in screen pixels
+	Scale float64 `json:"scale,omitempty"`
+}
+
+// xrandrMonitorPattern matches a line of xrandr --listmonitors, such as
+// " 1: +*HDMI-1 1920/477x1080/268+1920+0  HDMI-1"
+var xrandrMonitorPattern = regexp.MustCompile(`^\s*(\d+):\s+\+?(\*?)(\S+)\s+(\d+)/\d+x(\d+)/\d+([+-]\d+)([+-]\d+)`)
+
+// macMonitorScript lists NSScreen frames, flipped from AppKit's bottom-left
+// origin to the top-left one screenshots and cliclick use. The first screen
+// is the primary one, and screencapture -D numbers them in the same order.
+const macMonitorScript = `
+ObjC.import('AppKit');
+const screens = $.NSScreen.screens;
+const height = screens.objectAtIndex(0).frame.size.height;
+const out = [];
+for (let i = 0; i < screens.count; i++) {
+	const s = screens.objectAtIndex(i);
+	const f = s.frame;
+	out.push({name: s.localizedName ? ObjC.unwrap(s.localizedName) : 'Display ' + (i + 1), primary: i === 0,
+		x: f.origin.x, y: height - f.origin.y - f.size.height, width: f.size.width, height: f.size.height,
+		scale: s.backingScaleFactor});
+}
+JSON.stringify(out);`
+
+// windowsMonitorScript lists the monitors through Screen.AllScreens, which
+// enumerates them with EnumDisplayMonitors
+const windowsMonitorScript = `
+Add-Type -AssemblyName System.Windows.Forms
+ConvertTo-Json -Compress -InputObject @([System.Windows.Forms.Screen]::AllScreens | ForEach-Object {
+	[pscustomobject]@{name=$_.DeviceName; primary=$_.Primary; x=$_.Bounds.X; y=$_.Bounds.Y; width=$_.Bounds.Width; height=$_.Bounds.Height}
+})`
+
+// listMonitors returns the monitors of the desktop, as the platform
+// enumerates them: xrandr on Linux, NSScreen on macOS and
+// EnumDisplayMonitors on Windows
+func listMonitors(ctx context.Context) ([]Monitor, error) {
+	switch runtime.GOOS {
+	case "linux":
+		output, err := newCommand(ctx, "xrandr", "--listmonitors").Output()
+		if err != nil {
+			return nil, fmt.Errorf("xrandr failed: %v", err)
+		}
+		var monitors []Monitor
+		for _, line := range strings.Split(string(output), "\n") {
+			m := xrandrMonitorPattern.FindStringSubmatch(line)
+			if m == nil {
+				continue
+			}
+			var v [5]int
+			for i, s := range []string{m[1], m[4], m[5], m[6], m[7]} {
+				v[i], _ = strconv.Atoi(s)
+			}
+			monitors = append(monitors, Monitor{
+				Index:   v[0],
+				Name:    m[3],
+				Primary: m[2] == "*",
+				Bounds:  rect{X: v[3], Y: v[4], Width: v[1], Height: v[2]},
+			})
+		}
+		return monitors, nil
+	case "darwin":
+		return scriptedMonitors(ctx, "osascript", "-l", "JavaScript", "-e", macMonitorScript)
+	case "windows":
+		return scriptedMonitors(ctx, "powershell", "-Command", windowsMonitorScript)
+	}
+	return nil, fmt.Errorf("unsupported operating system: %s", runtime.GOOS)
+}
+
+// scriptedMonitors runs a script printing the monitors as a JSON array
+func scriptedMonitors(ctx context.Context, name string, args ...string) ([]Monitor, error) {
+	output, err := newCommand(ctx, name, args...).Output()
+	if err != nil {
+		return nil, fmt.Errorf("%s failed: %v", name, err)
+	}
+	var screens []struct {
+		Name    string  `json:"name"`
+		Primary bool    `json:"primary"`
+		X       float64 `json:"x"`
+		Y       float64 `json:"y"`
+		Width   float64 `json:"width"`
+		Height  float64 `json:"height"`
+		Scale   float64 `json:"scale"`
+	}
+	if err := json.Unmarshal(output, &screens); err != nil {
+		return nil, fmt.Errorf("unexpected monitor list %q: %v", strings.TrimSpace(string(output)), err)
+	}
+	monitors := make([]Monitor, len(screens))
+	for i, s := range screens {
+		monitors[i] = Monitor{
+			Index:   i,
+			Name:    s.Name,
+			Primary: s.Primary,
+			Bounds:  rect{X: int(s.X), Y: int(s.Y), Width: int(s.Width), Height: int(s.Height)},
+			Scale:   s.Scale,
+		}
+	}
+	return monitors, nil
+}
+
+// findMonitor returns the monitor named by -monitor: "primary", an index or
+// a name such as HDMI-1 or \\.\DISPLAY2
+func findMonitor(monitors []Monitor, spec string) (*Monitor, bool) {
+	for i, m := range monitors {
+		if (spec == "primary" && m.Primary) || strconv.Itoa(m.Index) == spec || strings.EqualFold(m.Name, spec) {
+			return &monitors[i], true
+		}
+	}
+	return nil, false
+}
+
+// chooseMonitor sets the monitor from -monitor. Clicking with the wrong
+// monitor misses the board entirely, so a monitor that can't be found stops
+// the server.
+func (c *Controller) chooseMonitor() error {
+	if c.cfg.Monitor == "" {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(c.baseContext(), 5*time.Second)
+	defer cancel()
+	monitors, err := listMonitors(ctx)
+	if err != nil {
+		return fmt.Errorf("-monitor: failed to list monitors: %v", err)
+	}
+	m, ok := findMonitor(monitors, c.cfg.Monitor)
+	if !ok {
+		names := make([]string, len(monitors))
+		for i, m := range monitors {
+			names[i] = fmt.Sprintf("%d (%s)", m.Index, m.Name)
+		}
+		return fmt.Errorf("-monitor %s: no such monitor; found %s", c.cfg.Monitor, strings.Join(names, ", "))
+	}
+	c.dev.monitor = m
+	log.Printf("using monitor %d (%s) at %v", m.Index, m.Name, m.Bounds)
+	return nil
+}
+
+// screenPoint maps p from the coordinates of ctx's monitor, which
+// screenshots and calibrations use, to the desktop's
+func screenPoint(ctx context.Context, p point) point {
+	m := activeMonitor(ctx)
+	if m == nil {
+		return p
+	}
+	return point{X: p.X + m.Bounds.X, Y: p.Y + m.Bounds.Y}
+}
@@ -0,0 +1,550 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	// moveChangedFraction is how much of the destination square must change
+	// for a verified move to count as registered; a hover or selection
+	// highlight changes far less than a piece arriving
+	moveChangedFraction = 0.15
+	// moveColorTolerance absorbs compression and antialiasing noise between screenshots
+	moveColorTolerance = 24
+	// promotionDelay leaves time for the promotion chooser to appear
+	promotionDelay = 200 * time.Millisecond
+)
+
+var uciMovePattern = regexp.MustCompile(`^([a-h][1-8])([a-h][1-8])([qrbn]?)$`)
+
+// errMoveNotRegistered is returned when a verified move never changed the board
+var errMoveNotRegistered = errors.New("the board did not change")
+
+// errMoveUnverified is returned when verify_destination finds no piece on
+// the destination square after the move
+var errMoveUnverified = errors.New("the destination square does not look occupied")
+
+// MoveRequest represents the JSON payload for /move
+type MoveRequest struct {
+	Move    string `json:"move"`    // UCI notation, e.g. "e2e4" or "e7e8q"
+	SAN     string `json:"san"`     // SAN instead of move, e.g. "Nf3" or "exd8=Q"
+	FEN     string `json:"fen"`     // position san is played in; defaults to replaying the page's move list
+	Verify  bool   `json:"verify"`  // check the destination square changed, retrying the move if not
+	Retries *int   `json:"retries"` // defaults to -move-retries
+	DryRun  bool   `json:"dry_run"` // only return the planned coordinates, without touching the mouse
+	// VerifyDestination checks a screenshot shows a piece on the destination
+	// square after the move, before confirming it; one that doesn't fails
+	// with MOVE_UNVERIFIED instead of being retried
+	VerifyDestination bool `json:"verify_destination"`
+	// MoveStyle is "drag", "click" or "keyboard", defaulting to -move-style
+	// for the site. The keyboard style types san when given, or else move,
+	// and needs no calibration unless the move is verified or confirmed by
+	// clicking its destination.
+	MoveStyle string `json:"move_style"`
+	// Premove queues the move during the opponent's turn. Premoves are
+	// always clicked, whatever the move style, and are neither verified nor
+	// confirmed, since the board only changes once the opponent has moved.
+	Premove bool `json:"premove"`
+	// Game and MoveNumber name the move's record with -move-log-dir. Game
+	// defaults to the last part of the page URL, such as the lichess game
+	// ID, and MoveNumber, the ply, to the move list's length plus one or
+	// the moves recorded for the game so far.
+	Game       string `json:"game"`
+	MoveNumber int    `json:"move_number"`
+	// RetryBudget and DeadlineMs override -move-retry-budget and
+	// -move-deadline: the retries focusing and verified drags share, and
+	// the most the whole move may take, waiting for the command mutex
+	// included
+	RetryBudget *int `json:"retry_budget"`
+	DeadlineMs  *int `json:"deadline_ms"`
+}
+
+// MoveResponse is the Response for /move
+type MoveResponse struct {
+	DragResponse
+	Move     string `json:"move"` // UCI notation, resolved from san when that was given
+	Attempts int    `json:"attempts"`
+	// MoveStyle is how the move was entered, "drag", "click" or "keyboard"
+	MoveStyle string `json:"move_style"`
+	// OrientationCorrected is set when -orientation-check found the board
+	// flipped and updated the calibration first
+	OrientationCorrected bool `json:"orientation_corrected,omitempty"`
+	// Record is the move's record under -move-log-dir
+	Record string `json:"record,omitempty"`
+	// RetriesUsed is how much of the retry budget the move spent, on
+	// focusing and drags together; only set with a budget
+	RetriesUsed *int `json:"retries_used,omitempty"`
+	// Only in a dry run: where the promotion choice and move confirmation
+	// would be clicked, if at all, and the pointer positions of the drag
+	PromotionPoint *point  `json:"promotion_point,omitempty"`
+	ConfirmPoint   *point  `json:"confirm_point,omitempty"`
+	DragPath       []point `json:"drag_path,omitempty"`
+	DryRun         bool    `json:"dry_run,omitempty"`
+}
+
+// errNoPosition is returned when a SAN move has no FEN and no move list to replay
+var errNoPosition = errors.New("a SAN move needs a fen or the marionette backend to read the move list")
+
+// sanPosition returns the position a SAN move is played in: fen when given,
+// otherwise the standard start followed by the current page's move list
+func (c *Controller) sanPosition(ctx context.Context, fen string) (*position, error) {
+	if fen != "" {
+		return parseFEN(fen)
+	}
+	if c.marionette == nil {
+		return nil, errNoPosition
+	}
+	site, current, err := c.currentSite(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if site == nil {
+		return nil, fmt.Errorf("unsupported site: %s", current)
+	}
+	moves := []string{}
+	if err := c.marionette.ExecuteScript(ctx, moveListScript, []interface{}{site.MoveListSelector}, &moves); err != nil {
+		return nil, fmt.Errorf("failed to read move list: %v", err)
+	}
+	start, _ := parseFEN(startFEN)
+	pos, err := replaySAN(start, moves)
+	if err != nil {
+		return nil, fmt.Errorf("failed to replay the move list: %v", err)
+	}
+	return pos, nil
+}
+
+// promotionSquare returns the square of the promotion chooser entry for
+// piece. Both supported sites list queen, knight, rook and bishop from the
+// promotion square towards the middle of the board.
+func promotionSquare(to string, piece byte) string {
+	offset := map[byte]int{'q': 0, 'n': 1, 'r': 2, 'b': 3}[piece]
+	rank := to[1]
+	if rank == '8' {
+		rank -= byte(offset)
+	} else {
+		rank += byte(offset)
+	}
+	return string([]byte{to[0], rank})
+}
+
+// handleMove plays a UCI move on the calibrated board by dragging the piece,
+// or by clicking it and then its destination with the click move style, or
+// types it into the site's move input box with the keyboard style
+func (c *Controller) handleMove(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "Only POST method is allowed")
+		return
+	}
+
+	var req MoveRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid JSON payload")
+		return
+	}
+	if req.SAN != "" {
+		if req.Move != "" {
+			writeError(w, http.StatusBadRequest, "Give either move or san, not both")
+			return
+		}
+		pos, err := c.sanPosition(r.Context(), req.FEN)
+		if err == errNoPosition {
+			writeError(w, http.StatusNotImplemented, "A SAN move needs a fen or the marionette backend to read the move list")
+			return
+		}
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("Failed to find the position for %s: %v", req.SAN, err))
+			return
+		}
+		move, err := pos.resolveSAN(req.SAN)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("Invalid SAN move: %v", err))
+			return
+		}
+		req.Move = move.uci()
+	}
+	_, _, promotion, err := parseUCIMove(req.Move)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("Invalid move: %v", err))
+		return
+	}
+	retries := c.cfg.MoveRetries
+	if req.Retries != nil {
+		retries = *req.Retries
+	}
+	if retries < 0 {
+		writeError(w, http.StatusBadRequest, "retries cannot be negative")
+		return
+	}
+	if !req.Verify {
+		retries = 0
+	}
+	style := req.MoveStyle
+	if style == "" {
+		style = c.moveStyle(r.Context())
+	} else if err := checkMoveStyle(style); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("Invalid move_style: %v", err))
+		return
+	}
+	confirm := c.confirmMode(r.Context())
+	if req.Premove {
+		if req.Verify || req.VerifyDestination {
+			writeError(w, http.StatusBadRequest, "A premove cannot be verified, as the board only changes once the opponent has moved")
+			return
+		}
+		if promotion != "" {
+			writeError(w, http.StatusBadRequest, "A premove cannot choose its promotion piece")
+			return
+		}
+		style, confirm = moveStyleClick, confirmOff
+	}
+	if req.Game != "" {
+		if err := checkGameName(req.Game); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("Invalid game: %v", err))
+			return
+		}
+	}
+	if req.MoveNumber < 0 {
+		writeError(w, http.StatusBadRequest, "move_number cannot be negative")
+		return
+	}
+	budget, deadline := c.cfg.MoveRetryBudget, c.cfg.MoveDeadline
+	if req.RetryBudget != nil {
+		if *req.RetryBudget < 0 {
+			writeError(w, http.StatusBadRequest, "retry_budget cannot be negative")
+			return
+		}
+		budget = *req.RetryBudget
+	}
+	if req.DeadlineMs != nil {
+		if *req.DeadlineMs < 0 {
+			writeError(w, http.StatusBadRequest, "deadline_ms cannot be negative")
+			return
+		}
+		deadline = time.Duration(*req.DeadlineMs) * time.Millisecond
+	}
+	var shared *retryBudget
+	if budget >= 0 || deadline > 0 {
+		if budget < 0 {
+			budget = retries
+		}
+		if req.Verify {
+			retries = budget
+		}
+		ctx := r.Context()
+		var until time.Time
+		if deadline > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, deadline)
+			defer cancel()
+			until, _ = ctx.Deadline()
+		}
+		ctx, shared = withRetryBudget(ctx, budget, until)
+		r = r.WithContext(ctx)
+	}
+	if style == moveStyleKeyboard {
+		if err := c.checkMoveInput(r.Context()); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("Cannot type the move: %v", err))
+			return
+		}
+	}
+
+	corrected, err := c.checkOrientation(r.Context())
+	if err != nil {
+		writeOrientationError(w, err)
+		return
+	}
+	doneCoords := timeStep(r.Context(), "coordinates")
+	cal, ok := c.calibration()
+	// Only a typed move that nothing clicks or checks on the board goes without
+	typedBlind := style == moveStyleKeyboard && !req.Verify && !req.VerifyDestination && confirm != confirmDestination
+	if !ok && !typedBlind {
+		writeErrorCode(w, http.StatusConflict, codeCalibrationMissing, "Board is not calibrated")
+		return
+	}
+	plan, _ := planMove(cal, req.Move, style, confirm)
+	plan.checkArrival = req.VerifyDestination
+	if req.SAN != "" {
+		// Sites take the move without check and mate marks
+		plan.text = strings.TrimRight(req.SAN, "+#")
+	}
+	doneCoords()
+	from, to := plan.from, plan.to
+
+	if req.DryRun {
+		message := fmt.Sprintf("Would play %s by dragging from %d,%d to %d,%d", req.Move, from.X, from.Y, to.X, to.Y)
+		switch style {
+		case moveStyleClick:
+			message = fmt.Sprintf("Would play %s by clicking %d,%d and then %d,%d", req.Move, from.X, from.Y, to.X, to.Y)
+		case moveStyleKeyboard:
+			message = fmt.Sprintf("Would play %s by typing %s", req.Move, plan.text)
+		}
+		resp := MoveResponse{
+			DragResponse: DragResponse{
+				Response:  Response{Success: true, Message: message},
+				FromPoint: from,
+				ToPoint:   to,
+			},
+			Move:                 req.Move,
+			MoveStyle:            style,
+			OrientationCorrected: corrected,
+			DryRun:               true,
+		}
+		if style == moveStyleDrag {
+			resp.DragPath = c.dragPath(from, to)
+		}
+		if plan.promotion != "" && style != moveStyleKeyboard {
+			resp.PromotionPoint = &plan.choice
+		}
+		switch confirm {
+		case confirmOff:
+		case confirmButton:
+			resp.ConfirmPoint = &c.cfg.ConfirmButton
+		default:
+			resp.ConfirmPoint = &to
+		}
+		writeJSON(w, http.StatusOK, resp)
+		return
+	}
+
+	var record *moveLog
+	if c.cfg.MoveLogDir != "" {
+		record = &moveLog{record: MoveRecord{Game: req.Game, Move: req.Move, SAN: req.SAN, MoveStyle: style, Premove: req.Premove}}
+		if ok {
+			record.board = rect{X: cal.X, Y: cal.Y, Width: cal.Width, Height: cal.Height}
+		}
+	}
+	attempts := 0
+	err = c.focusCommand(r, func() error {
+		ctx := r.Context()
+		doneFocus := timeStep(ctx, "focus")
+		if err := focusFirefoxBudgeted(ctx); err != nil {
+			return err
+		}
+		doneFocus()
+		if record != nil {
+			c.startMoveLog(ctx, record, req.MoveNumber)
+		}
+		var err error
+		attempts, err = c.playMove(ctx, plan, req.Verify, retries)
+		if record != nil && ctx.Err() == nil {
+			c.afterMove(ctx, record, req.Verify || req.VerifyDestination)
+		}
+		return err
+	})
+	recordPath := ""
+	if record != nil {
+		recordPath = record.finish(attempts, err)
+	}
+	var retriesUsed *int
+	if shared != nil {
+		used := shared.retriesUsed()
+		retriesUsed = &used
+	}
+	if err == errMoveNotRegistered {
+		writeErrorCode(w, http.StatusUnprocessableEntity, codeMoveNotRegistered, fmt.Sprintf("Move %s did not register after %d attempts", req.Move, attempts))
+		return
+	}
+	if err == errMoveUnverified {
+		writeErrorCode(w, http.StatusUnprocessableEntity, codeMoveUnverified, fmt.Sprintf("Move %s was entered but no piece shows on %s; it was not confirmed", req.Move, req.Move[2:4]))
+		return
+	}
+	if err != nil {
+		writeCommandError(w, err, fmt.Sprintf("Failed to play %s: %v", req.Move, err))
+		return
+	}
+
+	message := fmt.Sprintf("Played %s", req.Move)
+	if req.Premove {
+		message = fmt.Sprintf("Premoved %s", req.Move)
+	}
+	writeJSON(w, http.StatusOK, MoveResponse{
+		DragResponse: DragResponse{
+			Response: Response{
+				Success: true,
+				Message: message,
+			},
+			FromPoint: from,
+			ToPoint:   to,
+		},
+		Move:                 req.Move,
+		Attempts:             attempts,
+		MoveStyle:            style,
+		OrientationCorrected: corrected,
+		Record:               recordPath,
+		RetriesUsed:          retriesUsed,
+	})
+}
+
+// movePlan is where the mouse goes to enter a move on the calibrated board
+type movePlan struct {
+	move      string
+	from, to  point
+	toRect    rect // checked for a change when the move is verified
+	promotion string
+	choice    point  // the promotion chooser entry, with a promotion
+	text      string // what the keyboard style types, the UCI move unless set
+	style     string
+	confirm   string
+	// checkArrival looks for the piece on the destination before confirming
+	checkArrival bool
+	// path and stepDelay replace -drag-steps and -drag-step-delay for the
+	// drag when path is set, as /human-move does
+	path      []point
+	stepDelay time.Duration
+}
+
+// parseUCIMove splits a UCI move into its squares and promotion piece
+func parseUCIMove(move string) (from, to, promotion string, err error) {
+	m := uciMovePattern.FindStringSubmatch(move)
+	if m == nil {
+		return "", "", "", fmt.Errorf("%q is not a UCI move such as e2e4 or e7e8q", move)
+	}
+	if m[3] != "" && m[2][1] != '8' && m[2][1] != '1' {
+		return "", "", "", fmt.Errorf("promotion is only possible on the first or last rank, not %s", m[2])
+	}
+	return m[1], m[2], m[3], nil
+}
+
+// planMove checks a UCI move and finds its points on the board
+func planMove(cal Calibration, move, style, confirm string) (movePlan, error) {
+	fromSquare, toSquare, promotion, err := parseUCIMove(move)
+	if err != nil {
+		return movePlan{}, err
+	}
+	p := movePlan{move: move, promotion: promotion, text: move, style: style, confirm: confirm}
+	p.from, _ = cal.squareCenter(fromSquare)
+	p.to, _ = cal.squareCenter(toSquare)
+	p.toRect, _ = cal.squareRect(toSquare)
+	if promotion != "" {
+		p.choice, _ = cal.squareCenter(promotionSquare(toSquare, promotion[0]))
+	}
+	return p, nil
+}
+
+// playMove enters a planned move with Firefox focused. A verified move is
+// retried up to retries times while its destination square doesn't change,
+// then fails with errMoveNotRegistered.
+func (c *Controller) playMove(ctx context.Context, p movePlan, verify bool, retries int) (attempts int, err error) {
+	budget := budgetFrom(ctx)
+	var took time.Duration
+	for attempts < retries+1 {
+		// Within a retry budget, retries are shared with the other sub-steps
+		if attempts > 0 && budget != nil && !budget.spend(took) {
+			break
+		}
+		start := time.Now()
+		attempts++
+		var before []byte
+		if verify {
+			done := timeStep(ctx, "verify")
+			if before, err = captureScreen(ctx); err != nil {
+				return attempts, err
+			}
+			done()
+		}
+
+		switch p.style {
+		case moveStyleClick:
+			doneClick := timeStep(ctx, "click")
+			if err := clickMove(ctx, p.from, p.to); err != nil {
+				return attempts, err
+			}
+			doneClick()
+		case moveStyleKeyboard:
+			doneType := timeStep(ctx, "type")
+			if err := c.keyboardMove(ctx, p.text); err != nil {
+				return attempts, err
+			}
+			doneType()
+		default:
+			doneDrag := timeStep(ctx, "drag")
+			path, delay := p.path, p.stepDelay
+			if path == nil {
+				path, delay = c.dragPath(p.from, p.to), c.cfg.DragStepDelay
+			}
+			if err := mouseDrag(ctx, path, delay, buttonLeft); err != nil {
+				return attempts, err
+			}
+			doneDrag()
+		}
+		// A typed move names its promotion piece
+		if p.promotion != "" && p.style != moveStyleKeyboard {
+			done := timeStep(ctx, "promotion")
+			select {
+			case <-time.After(promotionDelay):
+			case <-ctx.Done():
+				return attempts, ctx.Err()
+			}
+			if err := mouseClick(ctx, p.choice, buttonLeft); err != nil {
+				return attempts, err
+			}
+			done()
+		}
+		if p.checkArrival {
+			if err := c.checkArrival(ctx, p); err != nil {
+				return attempts, err
+			}
+		}
+		doneConfirm := timeStep(ctx, "confirm")
+		if err := c.confirmMove(ctx, p.confirm, p.to); err != nil {
+			return attempts, err
+		}
+		doneConfirm()
+		if !verify {
+			return attempts, nil
+		}
+
+		doneSettle := timeStep(ctx, "settle")
+		select {
+		case <-time.After(c.cfg.MoveSettle):
+		case <-ctx.Done():
+			return attempts, ctx.Err()
+		}
+		doneSettle()
+		doneVerify := timeStep(ctx, "verify")
+		after, err := captureScreen(ctx)
+		if err != nil {
+			return attempts, err
+		}
+		changed, err := changedFraction(before, after, p.toRect, moveColorTolerance)
+		if err != nil {
+			return attempts, err
+		}
+		doneVerify()
+		if changed >= moveChangedFraction {
+			return attempts, nil
+		}
+		took = time.Since(start)
+	}
+	return attempts, errMoveNotRegistered
+}
+
+// checkArrival waits -move-settle for the piece to land, then checks a
+// screenshot shows it on the destination square
+func (c *Controller) checkArrival(ctx context.Context, p movePlan) error {
+	defer timeStep(ctx, "arrival")()
+	select {
+	case <-time.After(c.cfg.MoveSettle):
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	shot, err := captureScreen(ctx)
+	if err != nil {
+		return err
+	}
+	occupancy, err := squareOccupancy(shot, p.toRect)
+	if err != nil {
+		return err
+	}
+	if occupancy < occupiedFraction {
+		return errMoveUnverified
+	}
+	return nil
+}
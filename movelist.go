@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// MoveListResponse is the Response for /move-list
+type MoveListResponse struct {
+	Response
+	Site  string   `json:"site"`
+	Moves []string `json:"moves"`
+}
+
+// moveListScript returns the text of each element matching arguments[0].
+// chess.com renders piece letters as figurine icons, so their letter is prepended.
+const moveListScript = `
+return Array.from(document.querySelectorAll(arguments[0])).map(el => {
+	const fig = el.querySelector('[data-figurine]');
+	return ((fig ? fig.dataset.figurine : '') + el.textContent).trim();
+}).filter(text => text.length > 0);`
+
+// handleMoveList returns the SAN moves of the game on the current page
+func (c *Controller) handleMoveList(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "Only GET method is allowed")
+		return
+	}
+	if c.marionette == nil {
+		writeError(w, http.StatusNotImplemented, "Reading the move list requires the marionette backend")
+		return
+	}
+
+	site, current, err := c.currentSite(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if site == nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("Unsupported site: %s", current))
+		return
+	}
+
+	moves := []string{}
+	if err := c.marionette.ExecuteScript(r.Context(), moveListScript, []interface{}{site.MoveListSelector}, &moves); err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to read move list: %v", err))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, MoveListResponse{
+		Response: Response{
+			Success: true,
+			Message: fmt.Sprintf("Read %d moves from %s", len(moves), site.Name),
+		},
+		Site:  site.Name,
+		Moves: moves,
+	})
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// gameNamePattern is what a move log game directory may be called
+var gameNamePattern = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// MoveRecord is what -move-log-dir keeps of each /move, as NNN-move.json
+// in the game's directory next to its screenshots
+type MoveRecord struct {
+	Game       string    `json:"game"`
+	MoveNumber int       `json:"move_number"` // the ply, counting both sides' moves from 1
+	Move       string    `json:"move"`
+	SAN        string    `json:"san,omitempty"`
+	MoveStyle  string    `json:"move_style"`
+	Premove    bool      `json:"premove,omitempty"`
+	URL        string    `json:"url,omitempty"`
+	Time       time.Time `json:"time"`
+	DurationMs int64     `json:"duration_ms"`
+	Attempts   int       `json:"attempts"`
+	Success    bool      `json:"success"`
+	Error      string    `json:"error,omitempty"`
+	ErrorCode  string    `json:"error_code,omitempty"`
+	// Before and After are the screenshot files, of the board when it is
+	// calibrated or else the screen; empty if the capture failed
+	Before string `json:"before,omitempty"`
+	After  string `json:"after,omitempty"`
+}
+
+// moveLog is a move being recorded; dir and base are set once it is known
+// where it goes
+type moveLog struct {
+	record MoveRecord
+	dir    string
+	base   string
+	board  rect // empty to capture the whole screen
+}
+
+// checkGameName checks a game given to /move names a single directory
+func checkGameName(game string) error {
+	if !gameNamePattern.MatchString(game) || strings.Trim(game, ".") == "" {
+		return fmt.Errorf("%q must be letters, digits, '.', '_' and '-'", game)
+	}
+	return nil
+}
+
+// urlGame returns a game directory name from a game page URL, its last
+// path segment, such as lichess's game ID
+func urlGame(current string) string {
+	u, err := url.Parse(current)
+	if err != nil {
+		return ""
+	}
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	game := parts[len(parts)-1]
+	if checkGameName(game) != nil {
+		return ""
+	}
+	return game
+}
+
+// startMoveLog works out the game and move number of a move about to be
+// played and captures the board before it. It runs holding the command
+// mutex, so the numbering can't race another move. Failures are logged,
+// since the move goes ahead without its record.
+func (c *Controller) startMoveLog(ctx context.Context, l *moveLog, moveNumber int) {
+	if c.marionette != nil {
+		if current, err := c.marionette.CurrentURL(ctx); err == nil {
+			l.record.URL = current
+			if l.record.Game == "" {
+				l.record.Game = urlGame(current)
+			}
+		}
+		if moveNumber == 0 {
+			if plies, err := c.moveCount(ctx); err == nil {
+				moveNumber = plies + 1
+			}
+		}
+	}
+	if l.record.Game == "" {
+		l.record.Game = "game-" + time.Now().Format("20060102")
+	}
+	l.dir = filepath.Join(c.cfg.MoveLogDir, l.record.Game)
+	if err := os.MkdirAll(l.dir, 0o755); err != nil {
+		log.Printf("move log: failed to create %s: %v", l.dir, err)
+		l.dir = ""
+		return
+	}
+	if moveNumber == 0 {
+		// Without a move list, count the moves recorded in this game so far
+		records, _ := filepath.Glob(filepath.Join(l.dir, "[0-9][0-9][0-9]*-*.json"))
+		moveNumber = len(records) + 1
+	}
+	l.record.MoveNumber = moveNumber
+
+	// A move retried at the same ply keeps the earlier attempt's files
+	l.base = fmt.Sprintf("%03d-%s", moveNumber, l.record.Move)
+	for n := 2; ; n++ {
+		if _, err := os.Stat(filepath.Join(l.dir, l.base+".json")); os.IsNotExist(err) {
+			break
+		}
+		l.base = fmt.Sprintf("%03d-%s-%d", moveNumber, l.record.Move, n)
+	}
+	l.record.Before = l.saveShot(ctx, "before")
+	l.record.Time = time.Now()
+}
+
+// saveShot captures the board, or the screen, to the game directory,
+// returning the file name or "" if it failed
+func (l *moveLog) saveShot(ctx context.Context, suffix string) string {
+	shot, err := captureScreen(ctx)
+	if err == nil && !l.board.empty() {
+		shot, err = cropPNG(shot, l.board)
+	}
+	if err != nil {
+		log.Printf("move log: failed to capture %s %s: %v", l.base, suffix, err)
+		return ""
+	}
+	name := l.base + "-" + suffix + ".png"
+	if err := os.WriteFile(filepath.Join(l.dir, name), shot, 0o644); err != nil {
+		log.Printf("move log: failed to save %s: %v", name, err)
+		return ""
+	}
+	return name
+}
+
+// afterMove captures the board once the move has landed; settled is set
+// when verifying the move has already waited -move-settle
+func (c *Controller) afterMove(ctx context.Context, l *moveLog, settled bool) {
+	if l.dir == "" {
+		return
+	}
+	if !settled {
+		select {
+		case <-time.After(c.cfg.MoveSettle):
+		case <-ctx.Done():
+			return
+		}
+	}
+	l.record.After = l.saveShot(ctx, "after")
+}
+
+// finish writes the move's record with its outcome, returning its
+// path or "" if nothing was recorded
+func (l *moveLog) finish(attempts int, err error) string {
+	if l.dir == "" {
+		return ""
+	}
+	l.record.DurationMs = time.Since(l.record.Time).Milliseconds()
+	l.record.Attempts = attempts
+	l.record.Success = err == nil
+	if err != nil {
+		l.record.Error = err.Error()
+		l.record.ErrorCode = errorCode(err)
+	}
+	data, _ := json.MarshalIndent(l.record, "", "  ")
+	path := filepath.Join(l.dir, l.base+".json")
+	if err := os.WriteFile(path, append(data, '\n'), 0o644); err != nil {
+		log.Printf("move log: failed to save %s: %v", path, err)
+		return ""
+	}
+	return path
+}
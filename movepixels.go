@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// MoveByPixelsRequest represents the JSON payload for /move-by-pixels
+type MoveByPixelsRequest struct {
+	FromX *int `json:"from_x"`
+	FromY *int `json:"from_y"`
+	ToX   *int `json:"to_x"`
+	ToY   *int `json:"to_y"`
+}
+
+// MoveByPixelsResponse is the Response for /move-by-pixels, with the squares
+// the pixels snapped to
+type MoveByPixelsResponse struct {
+	DragResponse
+	FromSquare string `json:"from_square"`
+	ToSquare   string `json:"to_square"`
+}
+
+// handleMoveByPixels snaps rough pixel positions, such as from a vision
+// model, to the nearest squares and drags between their centers
+func (c *Controller) handleMoveByPixels(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "Only POST method is allowed")
+		return
+	}
+
+	var req MoveByPixelsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid JSON payload")
+		return
+	}
+	if req.FromX == nil || req.FromY == nil || req.ToX == nil || req.ToY == nil {
+		writeError(w, http.StatusBadRequest, "from_x, from_y, to_x and to_y are required")
+		return
+	}
+
+	cal, ok := c.calibration()
+	if !ok {
+		writeErrorCode(w, http.StatusConflict, codeCalibrationMissing, "Board is not calibrated")
+		return
+	}
+	fromSquare, err := cal.squareAt(point{X: *req.FromX, Y: *req.FromY})
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("Invalid from position: %v", err))
+		return
+	}
+	toSquare, err := cal.squareAt(point{X: *req.ToX, Y: *req.ToY})
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("Invalid to position: %v", err))
+		return
+	}
+	if fromSquare == toSquare {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("Both positions snap to %s", fromSquare))
+		return
+	}
+	from, _ := cal.squareCenter(fromSquare)
+	to, _ := cal.squareCenter(toSquare)
+
+	err = c.focusCommand(r, func() error {
+		if err := focusFirefox(r.Context()); err != nil {
+			return err
+		}
+		return mouseDrag(r.Context(), c.dragPath(from, to), c.cfg.DragStepDelay, buttonLeft)
+	})
+	if err != nil {
+		writeCommandError(w, err, fmt.Sprintf("Failed to drag %s to %s: %v", fromSquare, toSquare, err))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, MoveByPixelsResponse{
+		DragResponse: DragResponse{
+			Response: Response{
+				Success: true,
+				Message: fmt.Sprintf("Dragged %s to %s", fromSquare, toSquare),
+			},
+			FromPoint: from,
+			ToPoint:   to,
+		},
+		FromSquare: fromSquare,
+		ToSquare:   toSquare,
+	})
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Move input styles for -move-style
+const (
+	moveStyleDrag     = "drag"     // press on the piece, move to the destination and release
+	moveStyleClick    = "click"    // click the piece, then click the destination
+	moveStyleKeyboard = "keyboard" // type the move into the site's move input box
+)
+
+// moveInputScript focuses the move input box matching arguments[0],
+// returning false if there is none
+const moveInputScript = `
+const el = document.querySelector(arguments[0]);
+if (!el) { return false; }
+el.focus();
+return true;`
+
+// moveInputShownScript reports whether the move input box matching
+// arguments[0] is on the page
+const moveInputShownScript = `return document.querySelector(arguments[0]) !== null;`
+
+// clickMoveDelay leaves time for the site to select the piece before the
+// destination is clicked
+const clickMoveDelay = 100 * time.Millisecond
+
+// parseMoveStyles parses -move-style like -confirm-moves: either one style
+// for every site or comma-separated site=style pairs such as
+// "chess.com=click". The style for all sites is stored under the empty name.
+func parseMoveStyles(s string) (map[string]string, error) {
+	styles := map[string]string{}
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		site, style, ok := strings.Cut(part, "=")
+		if !ok {
+			site, style = "", part
+		}
+		if err := checkMoveStyle(style); err != nil {
+			return nil, err
+		}
+		if site != "" && siteByName(site) == nil {
+			return nil, fmt.Errorf("unknown site %q", site)
+		}
+		if site != "" && style == moveStyleKeyboard && siteByName(site).MoveInputSelector == "" {
+			return nil, fmt.Errorf("%s has no move input box for the keyboard style", site)
+		}
+		styles[site] = style
+	}
+	return styles, nil
+}
+
+// checkMoveStyle rejects anything but drag, click and keyboard
+func checkMoveStyle(style string) error {
+	switch style {
+	case moveStyleDrag, moveStyleClick, moveStyleKeyboard:
+		return nil
+	}
+	return fmt.Errorf("unknown move style %q; use %s, %s or %s", style, moveStyleDrag, moveStyleClick, moveStyleKeyboard)
+}
+
+// checkMoveInput reports why the keyboard move style can't be used on the
+// current page: with the marionette backend the site needs a move input
+// selector, and natively -move-input-click must say where the box is
+func (c *Controller) checkMoveInput(ctx context.Context) error {
+	if c.marionette == nil {
+		if c.cfg.MoveInputClick == (point{}) {
+			return fmt.Errorf("the keyboard move style needs -move-input-click with the native backend")
+		}
+		return nil
+	}
+	site, current, err := c.currentSite(ctx)
+	if err != nil {
+		return err
+	}
+	if site == nil || site.MoveInputSelector == "" {
+		return fmt.Errorf("%s has no move input box for the keyboard move style", current)
+	}
+	return nil
+}
+
+// keyboardMove focuses the move input box and types text, then Return. The
+// box is focused by selector with the marionette backend, or by clicking
+// -move-input-click. Keys are really pressed, as sites read keystrokes from
+// the box rather than its value.
+func (c *Controller) keyboardMove(ctx context.Context, text string) error {
+	if c.marionette != nil {
+		site, current, err := c.currentSite(ctx)
+		if err != nil {
+			return err
+		}
+		if site == nil || site.MoveInputSelector == "" {
+			return fmt.Errorf("%s has no move input box", current)
+		}
+		var found bool
+		if err := c.marionette.ExecuteScript(ctx, moveInputScript, []interface{}{site.MoveInputSelector}, &found); err != nil {
+			return fmt.Errorf("failed to focus the move input: %v", err)
+		}
+		if !found {
+			return fmt.Errorf("no move input matches %s; turn on keyboard input in the site's settings", site.MoveInputSelector)
+		}
+	} else if err := mouseClick(ctx, c.cfg.MoveInputClick, buttonLeft); err != nil {
+		return fmt.Errorf("failed to click the move input: %v", err)
+	}
+	for _, ch := range text {
+		if err := pressKey(ctx, string(ch)); err != nil {
+			return fmt.Errorf("failed to type %s: %v", text, err)
+		}
+	}
+	return pressKey(ctx, "Return")
+}
+
+// moveStyle returns the move style for the current page: -move-style's for
+// the site or for every site, else the site profile's, else drag. Per-site
+// and profile styles need the marionette backend to know the site. A
+// profile's keyboard style falls back to drag while the move input box isn't
+// shown, as sites keep it behind a setting.
+func (c *Controller) moveStyle(ctx context.Context) string {
+	styles := c.cfg.MoveStyles
+	var site *siteProfile
+	if c.marionette != nil {
+		site, _, _ = c.currentSite(ctx)
+	}
+	if site != nil {
+		if style, ok := styles[site.Name]; ok {
+			return style
+		}
+	}
+	if style, ok := styles[""]; ok {
+		return style
+	}
+	if site != nil && site.MoveStyle != "" {
+		if site.MoveStyle != moveStyleKeyboard {
+			return site.MoveStyle
+		}
+		var shown bool
+		if err := c.marionette.ExecuteScript(ctx, moveInputShownScript, []interface{}{site.MoveInputSelector}, &shown); err == nil && shown {
+			return site.MoveStyle
+		}
+	}
+	return moveStyleDrag
+}
+
+// clickMove enters a move by clicking the piece at from, then to
+func clickMove(ctx context.Context, from, to point) error {
+	if err := mouseClick(ctx, from, buttonLeft); err != nil {
+		return fmt.Errorf("failed to select the piece: %v", err)
+	}
+	select {
+	case <-time.After(clickMoveDelay):
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	if err := mouseClick(ctx, to, buttonLeft); err != nil {
+		return fmt.Errorf("failed to click the destination: %v", err)
+	}
+	return nil
+}
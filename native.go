@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os/exec"
+	"regexp"
+	"runtime"
+	"strings"
+)
+
+// firefoxMatch returns the pgrep and pkill arguments selecting the browser. With
+// a profile directory in ctx only the instance using it matches, so isolated
+// instances can be started and stopped independently.
+func firefoxMatch(ctx context.Context) []string {
+	if dir, _ := ctx.Value(profileDirKey{}).(string); dir != "" {
+		if targetBrowser.chromium {
+			return []string{"-f", "--", "--user-data-dir=" + regexp.QuoteMeta(dir)}
+		}
+		return []string{"-f", "--", "--profile " + regexp.QuoteMeta(dir)}
+	}
+	return []string{targetBrowser.pgrepName()}
+}
+
+// firefoxRunning reports whether a Firefox process exists. On Windows any
+// Firefox counts, even with a profile directory.
+func firefoxRunning(ctx context.Context) bool {
+	switch runtime.GOOS {
+	case "linux", "darwin":
+		return newCommand(ctx, "pgrep", firefoxMatch(ctx)...).Run() == nil
+	case "windows":
+		output, _ := newCommand(ctx, "tasklist", "/FI", "IMAGENAME eq "+targetBrowser.exe(), "/NH").Output()
+		return strings.Contains(string(output), targetBrowser.exe())
+	}
+	return false
+}
+
+// focusFirefox brings the Firefox window to the foreground. It picks the
+// first matching window, so controllers isolated with -profile-dir that share
+// a display can focus each other's browser; run each on its own -display.
+func focusFirefox(ctx context.Context) error {
+	if focusGameWindow(ctx) {
+		return settleFocus(ctx)
+	}
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "linux":
+		if !haveWindowTool() {
+			return nil
+		}
+		if dev := ctxDevices(ctx); dev.windowInput {
+			id, err := firefoxWindowID(ctx)
+			if err == nil {
+				dev.window.set(id)
+				return nil
+			}
+			dev.window.set("")
+			log.Printf("window-input: %v; activating Firefox instead", err)
+		}
+		cmd = newCommand(ctx, "xdotool", "search", "--onlyvisible", "--class", targetBrowser.class, "windowactivate")
+	case "darwin":
+		cmd = newCommand(ctx, "osascript", "-e", `tell application "`+targetBrowser.app+`" to activate`)
+	case "windows":
+		cmd = newCommand(ctx, "powershell", "-Command", `
+			$firefox = Get-Process `+targetBrowser.process+` | Where-Object {$_.MainWindowHandle -ne 0} | Select-Object -First 1
+			if (-not $firefox) { exit 1 }
+			[void][System.Reflection.Assembly]::LoadWithPartialName('Microsoft.VisualBasic')
+			[Microsoft.VisualBasic.Interaction]::AppActivate($firefox.Id)`)
+	default:
+		return fmt.Errorf("unsupported operating system: %s", runtime.GOOS)
+	}
+	if output, err := cmd.CombinedOutput(); err != nil {
+		err = fmt.Errorf("failed to focus Firefox window: %v %s", err, strings.TrimSpace(string(output)))
+		if !firefoxRunning(ctx) {
+			return withCode(codeBrowserNotRunning, err)
+		}
+		return withCode(codeFocusFailed, err)
+	}
+	rememberGameWindow(ctx)
+	return settleFocus(ctx)
+}
+
+// firefoxWindowTitle returns the title of the Firefox window
+func firefoxWindowTitle(ctx context.Context) (string, error) {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "linux":
+		cmd = newCommand(ctx, "xdotool", "search", "--onlyvisible", "--class", targetBrowser.class, "getwindowname")
+	case "darwin":
+		cmd = newCommand(ctx, "osascript", "-e", `tell application "System Events" to get name of front window of process "`+targetBrowser.app+`"`)
+	case "windows":
+		cmd = newCommand(ctx, "powershell", "-Command", `(Get-Process `+targetBrowser.process+` | Where-Object {$_.MainWindowHandle -ne 0} | Select-Object -First 1).MainWindowTitle`)
+	default:
+		return "", fmt.Errorf("unsupported operating system: %s", runtime.GOOS)
+	}
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to read Firefox window title: %v", err)
+	}
+	// xdotool prints one title per matching window; the first is the one windowactivate targets
+	title, _, _ := strings.Cut(strings.TrimSpace(string(output)), "\n")
+	return title, nil
+}
+
+// sendNoopKey presses a key that has no effect in the browser, to check that input injection works
+func sendNoopKey(ctx context.Context) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "linux":
+		return linuxInput(ctx).key(ctx, "shift")
+	case "darwin":
+		// key code 56 is Shift; this fails when accessibility access is denied
+		cmd = newCommand(ctx, "osascript", "-e", `tell application "System Events" to key code 56`)
+	case "windows":
+		cmd = newCommand(ctx, "powershell", "-Command", `
+			Add-Type -AssemblyName System.Windows.Forms
+			[System.Windows.Forms.SendKeys]::SendWait("{F15}")`)
+	default:
+		return fmt.Errorf("unsupported operating system: %s", runtime.GOOS)
+	}
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to send key: %v %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// requiredTools lists the external commands the native backend needs on this OS
+func (c *Controller) requiredTools() []string {
+	switch runtime.GOOS {
+	case "linux":
+		return []string{c.dev.input.name(), "pgrep", targetBrowser.bin}
+	case "darwin":
+		return []string{"osascript", "pgrep"}
+	case "windows":
+		return []string{"powershell", "tasklist"}
+	}
+	return nil
+}
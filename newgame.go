@@ -0,0 +1,269 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Sequence step actions
+const (
+	stepClick = "click" // click x,y, the center of square, or selector with the marionette backend
+	stepKey   = "key"   // press key, a combination such as "ctrl+l" or "Return"
+	stepWait  = "wait"  // pause for ms milliseconds
+)
+
+// maxStepWait bounds a single wait step
+const maxStepWait = 30 * time.Second
+
+// sequenceStep is one step of a configured action sequence
+type sequenceStep struct {
+	Action   string `json:"action"`
+	X        *int   `json:"x,omitempty"`
+	Y        *int   `json:"y,omitempty"`
+	Square   string `json:"square,omitempty"`
+	Selector string `json:"selector,omitempty"`
+	Key      string `json:"key,omitempty"`
+	Ms       int    `json:"ms,omitempty"`
+	Optional bool   `json:"optional,omitempty"` // carry on if this step fails, such as a banner that isn't always shown
+}
+
+// NewGameRequest represents the optional JSON payload for /new-game
+type NewGameRequest struct {
+	Site string `json:"site"` // which sequence to run; detected from the page with the marionette backend
+}
+
+// NewGameResponse is the Response for /new-game
+type NewGameResponse struct {
+	Response
+	Site  string `json:"site"`
+	Steps int    `json:"steps"` // steps completed, not counting skipped optional ones
+}
+
+// clickSelectorScript clicks the first element matching arguments[0],
+// returning whether one was found
+const clickSelectorScript = `
+const el = document.querySelector(arguments[0]);
+if (!el) { return false; }
+el.click();
+return true;`
+
+// defaultSequence names the sequence used for sites without their own
+const defaultSequence = "default"
+
+// loadSequenceFile reads a JSON object mapping names to step lists,
+// checking every step
+func loadSequenceFile(path string) (map[string][]sequenceStep, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var sequences map[string][]sequenceStep
+	if err := json.Unmarshal(data, &sequences); err != nil {
+		return nil, err
+	}
+	for name, steps := range sequences {
+		for i, step := range steps {
+			if err := step.validate(); err != nil {
+				return nil, fmt.Errorf("%s step %d: %v", name, i+1, err)
+			}
+		}
+	}
+	return sequences, nil
+}
+
+// loadNewGameSequences reads the -new-game-file JSON object mapping site
+// names, or "default", to their step lists
+func loadNewGameSequences(path string) (map[string][]sequenceStep, error) {
+	sequences, err := loadSequenceFile(path)
+	if err != nil {
+		return nil, err
+	}
+	for site := range sequences {
+		if site != defaultSequence && siteByName(site) == nil {
+			return nil, fmt.Errorf("unknown site %q", site)
+		}
+	}
+	return sequences, nil
+}
+
+func (s sequenceStep) validate() error {
+	switch s.Action {
+	case stepClick:
+		targets := 0
+		if s.X != nil || s.Y != nil {
+			if s.X == nil || s.Y == nil {
+				return fmt.Errorf("click needs both x and y")
+			}
+			targets++
+		}
+		if s.Square != "" {
+			if !squarePattern.MatchString(s.Square) {
+				return fmt.Errorf("invalid square %q", s.Square)
+			}
+			targets++
+		}
+		if s.Selector != "" {
+			targets++
+		}
+		if targets != 1 {
+			return fmt.Errorf("click needs exactly one of x and y, square or selector")
+		}
+	case stepKey:
+		if s.Key == "" {
+			return fmt.Errorf("key needs a key")
+		}
+		if _, err := parseChord(s.Key); err != nil {
+			return err
+		}
+	case stepWait:
+		if s.Ms <= 0 || time.Duration(s.Ms)*time.Millisecond > maxStepWait {
+			return fmt.Errorf("wait needs ms between 1 and %d", maxStepWait.Milliseconds())
+		}
+	default:
+		return fmt.Errorf("unknown action %q; use %s, %s or %s", s.Action, stepClick, stepKey, stepWait)
+	}
+	return nil
+}
+
+// runSequence performs steps in order, skipping failed optional steps, and
+// returns how many were performed
+func (c *Controller) runSequence(ctx context.Context, steps []sequenceStep) (int, error) {
+	completed := 0
+	for i, step := range steps {
+		if err := c.runStep(ctx, step); err != nil {
+			if step.Optional && ctx.Err() == nil {
+				continue
+			}
+			return completed, withCode(errorCode(err), fmt.Errorf("step %d (%s): %v", i+1, step.Action, err))
+		}
+		completed++
+	}
+	return completed, nil
+}
+
+// runStep performs one sequence step
+func (c *Controller) runStep(ctx context.Context, s sequenceStep) error {
+	switch s.Action {
+	case stepClick:
+		if s.Selector != "" {
+			if c.marionette == nil {
+				return fmt.Errorf("clicking a selector requires the marionette backend")
+			}
+			var found bool
+			if err := c.marionette.ExecuteScript(ctx, clickSelectorScript, []interface{}{s.Selector}, &found); err != nil {
+				return err
+			}
+			if !found {
+				return fmt.Errorf("no element matches %q", s.Selector)
+			}
+			return nil
+		}
+		p := point{}
+		if s.Square != "" {
+			cal, ok := c.calibration()
+			if !ok {
+				return withCode(codeCalibrationMissing, fmt.Errorf("clicking a square needs a calibrated board"))
+			}
+			var err error
+			if p, err = cal.squareCenter(s.Square); err != nil {
+				return err
+			}
+		} else {
+			p = point{X: *s.X, Y: *s.Y}
+		}
+		return mouseClick(ctx, p, buttonLeft)
+	case stepKey:
+		return pressKey(ctx, s.Key)
+	case stepWait:
+		select {
+		case <-time.After(time.Duration(s.Ms) * time.Millisecond):
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return fmt.Errorf("unknown action %q", s.Action)
+}
+
+// requestSite returns the site a request names or, when it names none, the
+// site of the current page with the marionette backend
+func (c *Controller) requestSite(ctx context.Context, name string) string {
+	if name == "" && c.marionette != nil {
+		if profile, _, err := c.currentSite(ctx); err == nil && profile != nil {
+			return profile.Name
+		}
+	}
+	return name
+}
+
+// handleNewGame runs the configured new-game sequence for the current site
+func (c *Controller) handleNewGame(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "Only POST method is allowed")
+		return
+	}
+
+	var req NewGameRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid JSON payload")
+			return
+		}
+	}
+	if len(c.cfg.NewGame) == 0 {
+		writeError(w, http.StatusNotImplemented, "No new-game sequences are configured; set -new-game-file")
+		return
+	}
+
+	site := c.requestSite(r.Context(), req.Site)
+	steps, ok := c.cfg.NewGame[site]
+	if !ok {
+		if steps, ok = c.cfg.NewGame[defaultSequence]; !ok {
+			names := make([]string, 0, len(c.cfg.NewGame))
+			for name := range c.cfg.NewGame {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("No new-game sequence for site %q; configured: %s", site, strings.Join(names, ", ")))
+			return
+		}
+		site = defaultSequence
+	}
+
+	completed := 0
+	err := c.focusCommand(r, func() error {
+		if err := focusFirefox(r.Context()); err != nil {
+			return err
+		}
+		var err error
+		completed, err = c.runSequence(r.Context(), steps)
+		return err
+	})
+	if err != nil {
+		writeJSON(w, commandStatus(err), NewGameResponse{
+			Response: Response{
+				Success:   false,
+				Message:   fmt.Sprintf("New game sequence for %s stopped: %v", site, err),
+				ErrorCode: errorCode(err),
+			},
+			Site:  site,
+			Steps: completed,
+		})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, NewGameResponse{
+		Response: Response{
+			Success: true,
+			Message: fmt.Sprintf("Ran the new game sequence for %s", site),
+		},
+		Site:  site,
+		Steps: completed,
+	})
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// OCRResponse is the Response for /ocr
+type OCRResponse struct {
+	Response
+	Text       string  `json:"text"`
+	Confidence float64 `json:"confidence"` // mean word confidence reported by tesseract, 0-100
+	Note       string  `json:"note"`
+}
+
+const ocrNote = "OCR output is approximate; verify moves before relying on them"
+
+// runTesseract recognizes the text in a PNG image, returning the text and
+// the mean word confidence
+func (c *Controller) runTesseract(ctx context.Context, img []byte) (string, float64, error) {
+	if _, err := lookPath(c.cfg.TesseractBin); err != nil {
+		return "", 0, fmt.Errorf("tesseract not found at %q: %v", c.cfg.TesseractBin, err)
+	}
+
+	// "stdin" and "stdout" make tesseract read the image from and write TSV to pipes
+	cmd := newCommand(ctx, c.cfg.TesseractBin, "stdin", "stdout", "--psm", "6", "tsv")
+	cmd.Stdin = bytes.NewReader(img)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return "", 0, fmt.Errorf("tesseract failed: %v %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return parseTesseractTSV(string(output))
+}
+
+// parseTesseractTSV rebuilds the recognized lines from tesseract's TSV output
+func parseTesseractTSV(tsv string) (string, float64, error) {
+	var lines []string
+	var line []string
+	lineKey := ""
+	var confSum float64
+	words := 0
+
+	for i, row := range strings.Split(tsv, "\n") {
+		fields := strings.Split(row, "\t")
+		// Skip the header and anything that isn't a word (level 5)
+		if i == 0 || len(fields) < 12 || fields[0] != "5" {
+			continue
+		}
+		text := strings.TrimSpace(fields[11])
+		if text == "" {
+			continue
+		}
+		key := fields[2] + "." + fields[3] + "." + fields[4]
+		if key != lineKey && len(line) > 0 {
+			lines = append(lines, strings.Join(line, " "))
+			line = nil
+		}
+		lineKey = key
+		line = append(line, text)
+
+		if conf, err := strconv.ParseFloat(fields[10], 64); err == nil && conf >= 0 {
+			confSum += conf
+			words++
+		}
+	}
+	if len(line) > 0 {
+		lines = append(lines, strings.Join(line, " "))
+	}
+
+	var conf float64
+	if words > 0 {
+		conf = confSum / float64(words)
+	}
+	return strings.Join(lines, "\n"), conf, nil
+}
+
+// handleOCR recognizes the text in the move-list region of a screenshot.
+// The region comes from -ocr-region, or the region query parameter ("x,y,width,height").
+func (c *Controller) handleOCR(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "Only GET method is allowed")
+		return
+	}
+
+	region := c.cfg.OCRRegion
+	if q := r.URL.Query().Get("region"); q != "" {
+		var err error
+		if region, err = parseRect(q); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("Invalid region: %v", err))
+			return
+		}
+	}
+	if region.empty() {
+		writeError(w, http.StatusConflict, "Move-list region is not calibrated; set -ocr-region or pass region=x,y,width,height")
+		return
+	}
+
+	var shot []byte
+	err := c.command(r, func() error {
+		var err error
+		shot, err = captureScreen(r.Context())
+		return err
+	})
+	if err != nil {
+		writeCommandError(w, err, err.Error())
+		return
+	}
+	crop, err := cropPNG(shot, region)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	text, conf, err := c.runTesseract(r.Context(), crop)
+	if err != nil {
+		writeErrorCode(w, http.StatusServiceUnavailable, errorCode(err), err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, OCRResponse{
+		Response: Response{
+			Success: true,
+			Message: fmt.Sprintf("Recognized %d characters from region %v", len(text), region),
+		},
+		Text:       text,
+		Confidence: conf,
+		Note:       ocrNote,
+	})
+}
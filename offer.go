@@ -0,0 +1,210 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Offers /offer-response can answer
+const (
+	offerDraw    = "draw"
+	offerRematch = "rematch"
+)
+
+// offerControls locates an opponent's offer on a site's page
+type offerControls struct {
+	Prompt  string // matches the offer while it is open
+	Accept  string // the accept control, looked for inside Prompt first
+	Decline string // the decline control, likewise
+}
+
+// nativeOffer locates an offer on screen for the native backend: it is open
+// while Region averages Color, and answered by clicking Accept or Decline
+type nativeOffer struct {
+	Region    rect   `json:"region"`
+	Color     string `json:"color"`
+	Tolerance int    `json:"tolerance,omitempty"` // per channel; defaults to 24
+	Accept    *point `json:"accept,omitempty"`
+	Decline   *point `json:"decline,omitempty"`
+}
+
+// loadOffers reads the -offer-file JSON object mapping "draw" and "rematch"
+// to their native screen regions
+func loadOffers(path string) (map[string]nativeOffer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var offers map[string]nativeOffer
+	if err := json.Unmarshal(data, &offers); err != nil {
+		return nil, err
+	}
+	for name, o := range offers {
+		if name != offerDraw && name != offerRematch {
+			return nil, fmt.Errorf("unknown offer %q; use %s or %s", name, offerDraw, offerRematch)
+		}
+		if o.Region.empty() {
+			return nil, fmt.Errorf("%s needs a region", name)
+		}
+		if _, err := parseHexColor(o.Color); err != nil {
+			return nil, fmt.Errorf("%s: invalid color: %v", name, err)
+		}
+		if o.Accept == nil && o.Decline == nil {
+			return nil, fmt.Errorf("%s needs an accept or decline point", name)
+		}
+	}
+	return offers, nil
+}
+
+// OfferResponseRequest represents the JSON payload for /offer-response
+type OfferResponseRequest struct {
+	Offer  string `json:"offer"`  // "draw" or "rematch"
+	Action string `json:"action"` // "accept" or "decline"
+}
+
+// OfferResponseResponse is the Response for /offer-response
+type OfferResponseResponse struct {
+	Response
+	Present bool `json:"present"` // an offer was open to act on
+	Clicked bool `json:"clicked"`
+}
+
+// offerResponseScript clicks the control matching arguments[1] if an offer
+// matching arguments[0] is open. The control may be the offer itself, as
+// with a glowing rematch button.
+const offerResponseScript = `
+const offer = document.querySelector(arguments[0]);
+if (!offer) { return {present: false, clicked: false}; }
+const control = offer.matches(arguments[1]) ? offer : offer.querySelector(arguments[1]) || document.querySelector(arguments[1]);
+if (!control) { return {present: true, clicked: false}; }
+control.click();
+return {present: true, clicked: true};`
+
+// handleOfferResponse accepts or declines the opponent's draw or rematch
+// offer, if one is open. With the marionette backend the offer is found by
+// the site profile's selectors; natively by the color of its -offer-file
+// region, answered by clicking the configured point.
+func (c *Controller) handleOfferResponse(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "Only POST method is allowed")
+		return
+	}
+
+	var req OfferResponseRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid JSON payload")
+		return
+	}
+	if req.Offer != offerDraw && req.Offer != offerRematch {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("Invalid offer %q; use %s or %s", req.Offer, offerDraw, offerRematch))
+		return
+	}
+	if req.Action != "accept" && req.Action != "decline" {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("Invalid action %q; use accept or decline", req.Action))
+		return
+	}
+
+	var result struct {
+		Present bool `json:"present"`
+		Clicked bool `json:"clicked"`
+	}
+
+	if c.marionette != nil {
+		site, current, err := c.currentSite(r.Context())
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if site == nil || len(site.Offers) == 0 {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("Unsupported site: %s", current))
+			return
+		}
+		controls, ok := site.Offers[req.Offer]
+		if !ok {
+			names := make([]string, 0, len(site.Offers))
+			for name := range site.Offers {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("No %s offers on %s; available: %s", req.Offer, site.Name, strings.Join(names, ", ")))
+			return
+		}
+		selector := controls.Accept
+		if req.Action == "decline" {
+			selector = controls.Decline
+		}
+		if selector == "" {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("%s has no way to %s a %s offer", site.Name, req.Action, req.Offer))
+			return
+		}
+		err = c.command(r, func() error {
+			return c.marionette.ExecuteScript(r.Context(), offerResponseScript, []interface{}{controls.Prompt, selector}, &result)
+		})
+		if err != nil {
+			writeCommandError(w, err, fmt.Sprintf("Failed to %s the %s offer: %v", req.Action, req.Offer, err))
+			return
+		}
+	} else {
+		offer, ok := c.cfg.Offers[req.Offer]
+		if !ok {
+			writeError(w, http.StatusConflict, fmt.Sprintf("Detection of %s offers is not configured; set -offer-file", req.Offer))
+			return
+		}
+		target := offer.Accept
+		if req.Action == "decline" {
+			target = offer.Decline
+		}
+		if target == nil {
+			writeError(w, http.StatusConflict, fmt.Sprintf("No %s point is configured for %s offers in -offer-file", req.Action, req.Offer))
+			return
+		}
+		want, _ := parseHexColor(offer.Color)
+		tolerance := offer.Tolerance
+		if tolerance == 0 {
+			tolerance = 24
+		}
+		err := c.focusCommand(r, func() error {
+			shot, err := captureScreen(r.Context())
+			if err != nil {
+				return err
+			}
+			got, err := averageColor(shot, offer.Region)
+			if err != nil {
+				return err
+			}
+			if !colorsClose(got, want, tolerance) {
+				return nil
+			}
+			result.Present = true
+			if err := focusFirefox(r.Context()); err != nil {
+				return err
+			}
+			if err := mouseClick(r.Context(), *target, buttonLeft); err != nil {
+				return err
+			}
+			result.Clicked = true
+			return nil
+		})
+		if err != nil {
+			writeCommandError(w, err, fmt.Sprintf("Failed to %s the %s offer: %v", req.Action, req.Offer, err))
+			return
+		}
+	}
+
+	message := fmt.Sprintf("No %s offer present", req.Offer)
+	switch {
+	case result.Clicked:
+		message = fmt.Sprintf("Clicked %s on the %s offer", req.Action, req.Offer)
+	case result.Present:
+		message = fmt.Sprintf("A %s offer is open but no %s control was found", req.Offer, req.Action)
+	}
+	writeJSON(w, http.StatusOK, OfferResponseResponse{
+		Response: Response{Success: !result.Present || result.Clicked, Message: message},
+		Present:  result.Present,
+		Clicked:  result.Clicked,
+	})
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+)
+
+// What /move does when the page shows the board from the other side than
+// the calibration, for -orientation-check
+const (
+	orientationCheckOff     = "off"
+	orientationCheckCorrect = "correct" // switch the stored orientation to the page's
+	orientationCheckError   = "error"   // fail with ORIENTATION_MISMATCH
+)
+
+// shownOrientationScript reports whether the site's flipped selector matches,
+// or null when there is no board on the page
+const shownOrientationScript = `
+if (!document.querySelector(arguments[0])) { return null; }
+return document.querySelector(arguments[1]) !== null;`
+
+// OrientationRequest represents the JSON payload for /orientation
+type OrientationRequest struct {
+	Orientation string `json:"orientation"`
+}
+
+// OrientationResponse is the Response for /orientation
+type OrientationResponse struct {
+	Response
+	Orientation string `json:"orientation"`
+}
+
+// handleOrientation reads (GET) or sets (POST) which side the board is shown from
+func (c *Controller) handleOrientation(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		cal, ok := c.calibration()
+		if !ok {
+			writeErrorCode(w, http.StatusConflict, codeCalibrationMissing, "Board is not calibrated")
+			return
+		}
+		c.saveCalibration()
+		writeJSON(w, http.StatusOK, OrientationResponse{
+			Response:    Response{Success: true, Message: fmt.Sprintf("Board is shown from %s's side", cal.Orientation)},
+			Orientation: cal.Orientation,
+		})
+
+	case http.MethodPost:
+		var req OrientationRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid JSON payload")
+			return
+		}
+		if req.Orientation != orientationWhite && req.Orientation != orientationBlack {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("Orientation must be %q or %q", orientationWhite, orientationBlack))
+			return
+		}
+		if !c.state.setOrientation(req.Orientation) {
+			writeErrorCode(w, http.StatusConflict, codeCalibrationMissing, "Board is not calibrated")
+			return
+		}
+		c.saveCalibration()
+		writeJSON(w, http.StatusOK, OrientationResponse{
+			Response:    Response{Success: true, Message: fmt.Sprintf("Orientation set to %s", req.Orientation)},
+			Orientation: req.Orientation,
+		})
+
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "Only GET and POST methods are allowed")
+	}
+}
+
+// checkOrientation compares the calibrated orientation with the side the
+// page shows the board from, before /move turns squares into points: a board
+// flipped by the site, such as on entering analysis, would otherwise have
+// every move played mirrored. Per -orientation-check a mismatch is corrected
+// in the stored calibration or returned as ORIENTATION_MISMATCH. It needs the
+// marionette backend and a site with a flipped selector; otherwise nothing
+// is checked.
+func (c *Controller) checkOrientation(ctx context.Context) (corrected bool, err error) {
+	mode := c.cfg.OrientationCheck
+	if mode == orientationCheckOff || c.marionette == nil {
+		return false, nil
+	}
+	cal, ok := c.calibration()
+	if !ok {
+		return false, nil
+	}
+	site, _, err := c.currentSite(ctx)
+	if err != nil {
+		return false, err
+	}
+	if site == nil || site.BoardSelector == "" || site.FlippedSelector == "" {
+		return false, nil
+	}
+	var flipped *bool
+	if err := c.marionette.ExecuteScript(ctx, shownOrientationScript, []interface{}{site.BoardSelector, site.FlippedSelector}, &flipped); err != nil {
+		return false, err
+	}
+	if flipped == nil {
+		return false, nil
+	}
+	shown := orientationWhite
+	if *flipped {
+		shown = orientationBlack
+	}
+	if shown == cal.Orientation {
+		return false, nil
+	}
+	if mode == orientationCheckError {
+		return false, withCode(codeOrientationMismatch, fmt.Errorf("the board is calibrated from %s's side but %s shows it from %s's", cal.Orientation, site.Name, shown))
+	}
+	log.Printf("orientation-check: %s flipped the board to %s's side; updating the calibration", site.Name, shown)
+	c.state.setOrientation(shown)
+	c.saveCalibration()
+	return true, nil
+}
+
+// writeOrientationError writes the Response for an error from checkOrientation
+func writeOrientationError(w http.ResponseWriter, err error) {
+	if errorCode(err) == codeOrientationMismatch {
+		writeErrorCode(w, http.StatusConflict, codeOrientationMismatch, fmt.Sprintf("Orientation mismatch: %v", err))
+		return
+	}
+	writeCommandError(w, err, fmt.Sprintf("Failed to check the board orientation: %v", err))
+}
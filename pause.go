@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// pauseState is set while /pause holds the command mutex for an operator
+// working on the rig's desktop
+type pauseState struct {
+	mu      sync.Mutex
+	pausing bool      // a /pause is waiting for the running command
+	since   time.Time // zero when not paused
+	reason  string
+}
+
+// paused reports whether commands are paused, since when and why
+func (p *pauseState) paused() (bool, time.Time, string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return !p.since.IsZero(), p.since, p.reason
+}
+
+// PauseRequest represents the optional JSON payload for /pause
+type PauseRequest struct {
+	Reason string `json:"reason"` // shown in /status and /health
+}
+
+// PauseResponse is the Response for /pause and /resume
+type PauseResponse struct {
+	Response
+	PausedAt *time.Time `json:"paused_at,omitempty"`
+	PausedMs int64      `json:"paused_ms,omitempty"` // how long /resume found commands paused
+	Waiting  int        `json:"waiting"`             // commands queued for the command mutex
+}
+
+// handlePause stops command processing without dropping anything: once the
+// running command finishes, /pause holds the command mutex until /resume, so
+// later commands queue for it as they do behind a long command. Queued
+// requests still time out, so callers expecting a long pause should send a
+// callback_url to be answered 202 and run once resumed.
+func (c *Controller) handlePause(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "Only POST method is allowed")
+		return
+	}
+
+	// Batches, macros and /rpc hold the mutex for all their steps
+	if r.Context().Value(lockHeldKey{}) != nil {
+		writeError(w, http.StatusConflict, "Pause cannot run inside a batch, macro or RPC call")
+		return
+	}
+
+	var req PauseRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid JSON payload")
+			return
+		}
+	}
+
+	p := &c.pause
+	p.mu.Lock()
+	if p.pausing || !p.since.IsZero() {
+		p.mu.Unlock()
+		writeError(w, http.StatusConflict, "Commands are already paused")
+		return
+	}
+	p.pausing = true
+	p.mu.Unlock()
+
+	err := c.lock(r.Context(), "paused")
+	p.mu.Lock()
+	p.pausing = false
+	if err == nil {
+		p.since, p.reason = time.Now(), req.Reason
+	}
+	since := p.since
+	p.mu.Unlock()
+	if err != nil {
+		if err == context.DeadlineExceeded {
+			err = errCommandTimeout
+		}
+		writeCommandError(w, err, fmt.Sprintf("Failed to pause while waiting for the running command: %v", err))
+		return
+	}
+
+	log.Printf("commands paused: %s", req.Reason)
+	c.queue.mu.Lock()
+	waiting := c.queue.waiting
+	c.queue.mu.Unlock()
+	writeJSON(w, http.StatusOK, PauseResponse{
+		Response: Response{Success: true, Message: "Commands paused; POST /resume to continue"},
+		PausedAt: &since,
+		Waiting:  waiting,
+	})
+}
+
+// handleResume releases the command mutex /pause holds, so queued commands
+// run in the order they arrived
+func (c *Controller) handleResume(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "Only POST method is allowed")
+		return
+	}
+
+	p := &c.pause
+	p.mu.Lock()
+	since := p.since
+	if since.IsZero() {
+		p.mu.Unlock()
+		writeError(w, http.StatusConflict, "Commands are not paused")
+		return
+	}
+	p.since, p.reason = time.Time{}, ""
+	p.mu.Unlock()
+
+	c.queue.mu.Lock()
+	waiting := c.queue.waiting
+	c.queue.mu.Unlock()
+	// The pause isn't a command, so it stays out of /queue-status's averages
+	c.queue.idle()
+	<-c.cmdLock
+
+	paused := time.Since(since)
+	log.Printf("commands resumed after %v", paused.Round(time.Second))
+	writeJSON(w, http.StatusOK, PauseResponse{
+		Response: Response{Success: true, Message: fmt.Sprintf("Commands resumed after %v; %d queued", paused.Round(time.Second), waiting)},
+		PausedAt: &since,
+		PausedMs: paused.Milliseconds(),
+		Waiting:  waiting,
+	})
+}
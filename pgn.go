@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// PGNResponse is the Response for /pgn
+type PGNResponse struct {
+	Response
+	Site string `json:"site"`
+	PGN  string `json:"pgn"`
+}
+
+// pgnScript resolves to the PGN in the field matching arguments[0]. If the
+// field isn't shown it clicks each selector of arguments[1] in turn, waiting
+// for the page to react, and resolves to null when the field never appears.
+const pgnScript = `
+const read = () => {
+	const el = document.querySelector(arguments[0]);
+	if (!el) { return null; }
+	const text = ('value' in el ? el.value : el.textContent).trim();
+	return text.length > 0 ? text : null;
+};
+const waitFor = (fn, ms) => new Promise(resolve => {
+	const deadline = Date.now() + ms;
+	const poll = () => {
+		const v = fn();
+		if (v || Date.now() > deadline) { resolve(v); } else { setTimeout(poll, 100); }
+	};
+	poll();
+});
+return (async () => {
+	let pgn = read();
+	for (const selector of arguments[1]) {
+		if (pgn) { break; }
+		const control = await waitFor(() => document.querySelector(selector), 2000);
+		if (!control) { continue; }
+		control.click();
+		pgn = await waitFor(read, 1000);
+	}
+	return pgn || await waitFor(read, 1000);
+})();`
+
+// handlePGN returns the PGN of the game on the current page, opening the
+// site's export panel if needed
+func (c *Controller) handlePGN(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "Only GET method is allowed")
+		return
+	}
+	if c.marionette == nil {
+		writeError(w, http.StatusNotImplemented, "Reading the PGN requires the marionette backend")
+		return
+	}
+
+	site, current, err := c.currentSite(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if site == nil || site.PGNSelector == "" {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("Unsupported site: %s", current))
+		return
+	}
+
+	var pgn *string
+	err = c.command(r, func() error {
+		return c.marionette.ExecuteScript(r.Context(), pgnScript, []interface{}{site.PGNSelector, site.PGNOpenSelectors}, &pgn)
+	})
+	if err != nil {
+		writeCommandError(w, err, fmt.Sprintf("Failed to read PGN: %v", err))
+		return
+	}
+	if pgn == nil {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("No PGN export found on %s", site.Name))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, PGNResponse{
+		Response: Response{
+			Success: true,
+			Message: fmt.Sprintf("Read PGN from %s", site.Name),
+		},
+		Site: site.Name,
+		PGN:  *pgn,
+	})
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"net/url"
+	"path"
+	"strings"
+)
+
+// parseLooseURL parses a URL that may lack a scheme, like normalizeURL accepts
+func parseLooseURL(raw string) (*url.URL, error) {
+	if !strings.Contains(raw, "://") {
+		raw = "//" + raw
+	}
+	return url.Parse(raw)
+}
+
+// matchesPin reports whether target is -pin-url or under it: the same host,
+// the same scheme unless either leaves it out, and a path equal to the pin's
+// or below it. A pin with a query string only matches that exact query.
+// Paths are compared unescaped and cleaned, as the browser resolves them, so
+// /tv/../account and /tv/%2e%2e/account are not under /tv.
+func matchesPin(target, pin string) bool {
+	t, err := parseLooseURL(target)
+	if err != nil {
+		return false
+	}
+	p, err := parseLooseURL(pin)
+	if err != nil {
+		return false
+	}
+	if !strings.EqualFold(t.Host, p.Host) {
+		return false
+	}
+	if t.Scheme != "" && p.Scheme != "" && !strings.EqualFold(t.Scheme, p.Scheme) {
+		return false
+	}
+	if p.RawQuery != "" && t.RawQuery != p.RawQuery {
+		return false
+	}
+	base, under := pinPath(p), pinPath(t)
+	return base == "" || under == base || strings.HasPrefix(under, base+"/")
+}
+
+// pinPath is u's path with its dot segments resolved and no trailing slash.
+// Backslashes count as slashes, as they do in browsers for http URLs.
+func pinPath(u *url.URL) string {
+	return strings.TrimSuffix(path.Clean("/"+strings.ReplaceAll(u.Path, `\`, "/")), "/")
+}
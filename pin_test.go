@@ -0,0 +1,42 @@
+package main
+
+import "testing"
+
+func TestMatchesPin(t *testing.T) {
+	tests := []struct {
+		target, pin string
+		want        bool
+	}{
+		{"https://lichess.org/tv", "https://lichess.org/tv", true},
+		{"https://lichess.org/tv/", "https://lichess.org/tv", true},
+		{"https://lichess.org/tv/blitz", "https://lichess.org/tv", true},
+		{"lichess.org/tv/blitz", "https://lichess.org/tv/", true},
+		{"https://LICHESS.org/tv", "lichess.org/tv", true},
+		{"https://lichess.org/anything", "https://lichess.org/", true},
+		{"https://lichess.org/anything", "https://lichess.org", true},
+		{"https://lichess.org/tvx", "https://lichess.org/tv", false},
+		{"http://lichess.org/tv", "https://lichess.org/tv", false},
+		{"https://lichess.org.evil.com/tv", "https://lichess.org/tv", false},
+		{"https://lichess.org:8443/tv", "https://lichess.org/tv", false},
+		// Dot segments resolve before matching, escaped or not
+		{"https://lichess.org/tv/../@/someone", "https://lichess.org/tv", false},
+		{"https://lichess.org/tv/%2e%2e/account", "https://lichess.org/tv", false},
+		{"https://lichess.org/tv/%2E%2E/account", "https://lichess.org/tv", false},
+		{`https://lichess.org/tv\..\account`, "https://lichess.org/tv", false},
+		{"https://lichess.org/tv/./blitz", "https://lichess.org/tv", true},
+		{"https://lichess.org/tv/x/../blitz", "https://lichess.org/tv", true},
+		{"https://lichess.org/other/../tv/blitz", "https://lichess.org/tv", true},
+		{"https://lichess.org/%74v", "https://lichess.org/tv", true},
+		// A pinned query must match exactly
+		{"https://lichess.org/tv?channel=blitz", "https://lichess.org/tv?channel=blitz", true},
+		{"https://lichess.org/tv?channel=bullet", "https://lichess.org/tv?channel=blitz", false},
+		{"https://lichess.org/tv", "https://lichess.org/tv?channel=blitz", false},
+		{"https://lichess.org/tv?channel=bullet", "https://lichess.org/tv", true},
+		{"https://lichess.org/%zz", "https://lichess.org/tv", false},
+	}
+	for _, tt := range tests {
+		if got := matchesPin(tt.target, tt.pin); got != tt.want {
+			t.Errorf("matchesPin(%q, %q) = %v, want %v", tt.target, tt.pin, got, tt.want)
+		}
+	}
+}
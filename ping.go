@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// PingResponse is the Response for /ping
+type PingResponse struct {
+	Response
+	DurationMs float64 `json:"duration_ms"`
+	Title      string  `json:"title"`
+}
+
+// handlePing times the cheapest real round-trip to the browser: reading the
+// window title (native) or the tab title (marionette)
+func (c *Controller) handlePing(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "Only GET method is allowed")
+		return
+	}
+
+	var title string
+	var elapsed time.Duration
+	err := c.command(r, func() error {
+		start := time.Now()
+		var err error
+		if c.marionette != nil {
+			title, err = c.marionette.Title(r.Context())
+		} else {
+			title, err = firefoxWindowTitle(r.Context())
+		}
+		elapsed = time.Since(start)
+		return err
+	})
+	if err != nil {
+		writeCommandError(w, err, fmt.Sprintf("Ping failed: %v", err))
+		return
+	}
+
+	ms := float64(elapsed.Microseconds()) / 1000
+	writeJSON(w, http.StatusOK, PingResponse{
+		Response: Response{
+			Success: true,
+			Message: fmt.Sprintf("Browser responded in %.1fms", ms),
+		},
+		DurationMs: ms,
+		Title:      title,
+	})
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"log"
+)
+
+// checkPlayingColor accepts "", white or black
+func checkPlayingColor(color string) error {
+	switch color {
+	case "", orientationWhite, orientationBlack:
+		return nil
+	}
+	return fmt.Errorf("use %s or %s", orientationWhite, orientationBlack)
+}
+
+// playingColor returns the side the controller plays: the playing_color of
+// the last /setup or else -playing-color, empty when unknown
+func (c *Controller) playingColor() string {
+	if color := c.state.playingColor(); color != "" {
+		return color
+	}
+	return c.cfg.PlayingColor
+}
+
+// defaultOrientation is the orientation a calibration that gives none gets:
+// the playing color's side at the bottom, as sites show it, or White's
+func (c *Controller) defaultOrientation() string {
+	if color := c.playingColor(); color != "" {
+		return color
+	}
+	return orientationWhite
+}
+
+// orientationWarning returns a warning when a board read from the page
+// doesn't show the playing color at the bottom, which means either the
+// playing color or the game opened is wrong. The page's orientation is kept,
+// since it is what the squares are clicked by.
+func (c *Controller) orientationWarning(site string, cal *Calibration) string {
+	color := c.playingColor()
+	if color == "" || cal.Orientation == color {
+		return ""
+	}
+	warning := fmt.Sprintf("the %s board shows %s at the bottom, but the controller is playing %s", site, cal.Orientation, color)
+	log.Printf("warning: %s", warning)
+	return warning
+}
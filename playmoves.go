@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// PlayMovesRequest represents the JSON payload for /play-moves
+type PlayMovesRequest struct {
+	Moves      []string `json:"moves"`       // UCI moves played in order, e.g. ["e2e4", "e7e5", "g1f3"]
+	DelayMs    *int     `json:"delay_ms"`    // pause between moves; defaults to -play-moves-delay
+	WaitStable bool     `json:"wait_stable"` // wait for the board to stop animating after each move, as /wait-for-board-stable does
+	Verify     bool     `json:"verify"`      // check each destination square changed, retrying the move if not
+	Retries    *int     `json:"retries"`     // defaults to -move-retries
+	MoveStyle  string   `json:"move_style"`  // "drag", "click" or "keyboard", defaulting to -move-style for the site
+}
+
+// PlayMovesResponse is the Response for /play-moves
+type PlayMovesResponse struct {
+	Response
+	Played []string `json:"played"` // the moves entered, in order
+	// Failed is the move that stopped the sequence, at FailedIndex in moves;
+	// it is also in played when it was entered but the board didn't settle
+	Failed      string `json:"failed,omitempty"`
+	FailedIndex *int   `json:"failed_index,omitempty"`
+	// OrientationCorrected is set when -orientation-check found the board
+	// flipped and updated the calibration first
+	OrientationCorrected bool `json:"orientation_corrected,omitempty"`
+}
+
+// handlePlayMoves plays a sequence of UCI moves on the calibrated board in
+// one command, such as the moves reaching a position on an analysis board.
+// Both sides' moves are entered, so the board must accept them, and the
+// sequence stops at the first move that fails or, with verify, doesn't
+// register.
+func (c *Controller) handlePlayMoves(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "Only POST method is allowed")
+		return
+	}
+
+	var req PlayMovesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid JSON payload")
+		return
+	}
+	if len(req.Moves) == 0 {
+		writeError(w, http.StatusBadRequest, "moves must list at least one move")
+		return
+	}
+	for i, move := range req.Moves {
+		if _, _, _, err := parseUCIMove(move); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("Invalid move %d: %v", i+1, err))
+			return
+		}
+	}
+	delay := c.cfg.PlayMovesDelay
+	if req.DelayMs != nil {
+		if *req.DelayMs < 0 {
+			writeError(w, http.StatusBadRequest, "delay_ms cannot be negative")
+			return
+		}
+		delay = time.Duration(*req.DelayMs) * time.Millisecond
+	}
+	retries := c.cfg.MoveRetries
+	if req.Retries != nil {
+		retries = *req.Retries
+	}
+	if retries < 0 {
+		writeError(w, http.StatusBadRequest, "retries cannot be negative")
+		return
+	}
+	if !req.Verify {
+		retries = 0
+	}
+	style := req.MoveStyle
+	if style == "" {
+		style = c.moveStyle(r.Context())
+	} else if err := checkMoveStyle(style); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("Invalid move_style: %v", err))
+		return
+	}
+	if style == moveStyleKeyboard {
+		if err := c.checkMoveInput(r.Context()); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("Cannot type the moves: %v", err))
+			return
+		}
+	}
+	confirm := c.confirmMode(r.Context())
+
+	corrected, err := c.checkOrientation(r.Context())
+	if err != nil {
+		writeOrientationError(w, err)
+		return
+	}
+	cal, ok := c.calibration()
+	if !ok {
+		writeErrorCode(w, http.StatusConflict, codeCalibrationMissing, "Board is not calibrated")
+		return
+	}
+	plans := make([]movePlan, len(req.Moves))
+	for i, move := range req.Moves {
+		plans[i], _ = planMove(cal, move, style, confirm)
+	}
+	board := rect{X: cal.X, Y: cal.Y, Width: cal.Width, Height: cal.Height}
+
+	played := []string{}
+	attempts, failedAt := 0, -1
+	err = c.focusCommand(r, func() error {
+		ctx := r.Context()
+		if err := focusFirefox(ctx); err != nil {
+			return err
+		}
+		for i, plan := range plans {
+			failedAt = i
+			if i > 0 && delay > 0 {
+				select {
+				case <-time.After(delay):
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}
+			var err error
+			if attempts, err = c.playMove(ctx, plan, req.Verify, retries); err != nil {
+				return err
+			}
+			played = append(played, plan.move)
+			if req.WaitStable {
+				done := timeStep(ctx, "stable")
+				if _, err := waitBoardStable(ctx, board, c.cfg.BoardStable, c.cfg.BoardChangeThreshold); err != nil {
+					return fmt.Errorf("board did not settle after %s: %v", plan.move, err)
+				}
+				done()
+			}
+		}
+		failedAt = -1
+		return nil
+	})
+	if err != nil {
+		failed := PlayMovesResponse{Played: played, OrientationCorrected: corrected}
+		if failedAt >= 0 {
+			failed.Failed, failed.FailedIndex = req.Moves[failedAt], &failedAt
+		}
+		status, code := commandStatus(err), errorCode(err)
+		message := fmt.Sprintf("Stopped after %d of %d moves: %v", len(played), len(req.Moves), err)
+		if err == errMoveNotRegistered {
+			status, code = http.StatusUnprocessableEntity, codeMoveNotRegistered
+			message = fmt.Sprintf("Move %s did not register after %d attempts; played %d of %d moves", failed.Failed, attempts, len(played), len(req.Moves))
+		}
+		failed.Response = Response{Success: false, Message: message, ErrorCode: code}
+		writeJSON(w, status, failed)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, PlayMovesResponse{
+		Response:             Response{Success: true, Message: fmt.Sprintf("Played %d moves", len(played))},
+		Played:               played,
+		OrientationCorrected: corrected,
+	})
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// automationPrefs are the Firefox preferences -automation-prefs sets: no
+// form or password autofill popups over the board, no smooth scrolling or
+// hardware acceleration changing what screenshots see, and no first-run,
+// default-browser or session-restore pages in front of the game
+var automationPrefs = map[string]string{
+	"browser.formfill.enable":                     "false",
+	"extensions.formautofill.addresses.enabled":   "false",
+	"extensions.formautofill.creditCards.enabled": "false",
+	"signon.rememberSignons":                      "false",
+	"general.smoothScroll":                        "false",
+	"layers.acceleration.disabled":                "true",
+	"browser.sessionstore.resume_from_crash":      "false",
+	"browser.shell.checkDefaultBrowser":           "false",
+	"browser.aboutwelcome.enabled":                "false",
+	"datareporting.policy.dataSubmissionEnabled":  "false",
+	"toolkit.telemetry.reportingpolicy.firstRun":  "false",
+	"browser.tabs.warnOnClose":                    "false",
+	"browser.warnOnQuit":                          "false",
+	"browser.startup.homepage_override.mstone":    `"ignore"`,
+}
+
+// loadPrefs reads a -prefs-file JSON object of preference names to
+// booleans, integers or strings, returning each value as a user.js literal
+func loadPrefs(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var raw map[string]interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	prefs := make(map[string]string, len(raw))
+	for name, v := range raw {
+		if name == "" || strings.ContainsAny(name, "\"\\\n") {
+			return nil, fmt.Errorf("invalid preference name %q", name)
+		}
+		switch v := v.(type) {
+		case bool:
+			prefs[name] = strconv.FormatBool(v)
+		case float64:
+			// Firefox preferences are 32-bit integers; other numbers must be strings
+			if v != math.Trunc(v) || v < math.MinInt32 || v > math.MaxInt32 {
+				return nil, fmt.Errorf("%s: %v is not a 32-bit integer; write other numbers as strings", name, v)
+			}
+			prefs[name] = strconv.FormatInt(int64(v), 10)
+		case string:
+			quoted, _ := json.Marshal(v)
+			prefs[name] = string(quoted)
+		default:
+			return nil, fmt.Errorf("%s: value must be a boolean, integer or string", name)
+		}
+	}
+	return prefs, nil
+}
+
+// userPrefPattern matches a user.js line setting a preference, capturing its name
+var userPrefPattern = regexp.MustCompile(`^\s*user_pref\(\s*"([^"]+)"`)
+
+// writeUserPrefs sets prefs in the user.js of the profile in dir, which
+// Firefox applies over prefs.js at every start. Lines setting other
+// preferences are kept; earlier lines for these ones are replaced.
+func writeUserPrefs(dir string, prefs map[string]string) error {
+	path := filepath.Join(dir, "user.js")
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read %s: %v", path, err)
+	}
+	var out bytes.Buffer
+	for _, line := range strings.SplitAfter(string(data), "\n") {
+		if m := userPrefPattern.FindStringSubmatch(line); m != nil {
+			if _, ok := prefs[m[1]]; ok {
+				continue
+			}
+		}
+		out.WriteString(line)
+	}
+	if out.Len() > 0 && !bytes.HasSuffix(out.Bytes(), []byte("\n")) {
+		out.WriteByte('\n')
+	}
+	names := make([]string, 0, len(prefs))
+	for name := range prefs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(&out, "user_pref(%q, %s);\n", name, prefs[name])
+	}
+	if err := os.WriteFile(path, out.Bytes(), 0o600); err != nil {
+		return fmt.Errorf("failed to write %s: %v", path, err)
+	}
+	return nil
+}
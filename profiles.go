@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// FirefoxProfile is one profile listed in profiles.ini
+type FirefoxProfile struct {
+	Name    string `json:"name"`
+	Path    string `json:"path"`
+	Default bool   `json:"default"`
+}
+
+// ProfilesResponse is the Response for /profiles
+type ProfilesResponse struct {
+	Response
+	ProfilesINI string           `json:"profiles_ini,omitempty"`
+	Profiles    []FirefoxProfile `json:"profiles"`
+	Selected    string           `json:"selected,omitempty"` // profile future launches use
+}
+
+// SelectProfileRequest represents the JSON payload for POST /profiles
+type SelectProfileRequest struct {
+	Name string `json:"name"` // empty goes back to -profile
+}
+
+// firefoxProfileRoots returns the directories that may hold Firefox's
+// profiles.ini on this OS, most likely first
+func firefoxProfileRoots() []string {
+	home, _ := os.UserHomeDir()
+	switch runtime.GOOS {
+	case "linux":
+		return []string{
+			filepath.Join(home, ".mozilla", "firefox"),
+			filepath.Join(home, "snap", "firefox", "common", ".mozilla", "firefox"),
+			filepath.Join(home, ".var", "app", "org.mozilla.firefox", ".mozilla", "firefox"),
+		}
+	case "darwin":
+		return []string{filepath.Join(home, "Library", "Application Support", "Firefox")}
+	case "windows":
+		return []string{filepath.Join(os.Getenv("APPDATA"), "Mozilla", "Firefox")}
+	}
+	return nil
+}
+
+// parseProfilesINI returns the profiles in a profiles.ini whose relative
+// paths are under root. The default is the profile an install section names,
+// as current Firefox uses, or in older files the one marked Default=1.
+func parseProfilesINI(data []byte, root string) []FirefoxProfile {
+	var profiles []FirefoxProfile
+	installDefaults := map[string]bool{}
+	var section string
+	fields := map[string]string{}
+	flush := func() {
+		switch {
+		case strings.HasPrefix(section, "Profile") && fields["Name"] != "":
+			path := filepath.FromSlash(fields["Path"])
+			if fields["IsRelative"] == "1" {
+				path = filepath.Join(root, path)
+			}
+			profiles = append(profiles, FirefoxProfile{
+				Name:    fields["Name"],
+				Path:    path,
+				Default: fields["Default"] == "1",
+			})
+		case strings.HasPrefix(section, "Install") && fields["Default"] != "":
+			installDefaults[filepath.Join(root, filepath.FromSlash(fields["Default"]))] = true
+		}
+		fields = map[string]string{}
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == ';' || line[0] == '#' {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			flush()
+			section = line[1 : len(line)-1]
+			continue
+		}
+		if key, value, ok := strings.Cut(line, "="); ok {
+			fields[strings.TrimSpace(key)] = strings.TrimSpace(value)
+		}
+	}
+	flush()
+
+	if len(installDefaults) > 0 {
+		for i := range profiles {
+			profiles[i].Default = installDefaults[profiles[i].Path]
+		}
+	}
+	return profiles
+}
+
+// firefoxProfiles finds profiles.ini and returns its path and profiles
+func firefoxProfiles() (string, []FirefoxProfile, error) {
+	for _, root := range firefoxProfileRoots() {
+		path := filepath.Join(root, "profiles.ini")
+		data, err := os.ReadFile(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return path, nil, err
+		}
+		return path, parseProfilesINI(data, root), nil
+	}
+	return "", nil, fmt.Errorf("no profiles.ini found in %s", strings.Join(firefoxProfileRoots(), ", "))
+}
+
+// handleProfiles lists the Firefox profiles on this machine (GET) or selects
+// the one future launches use (POST)
+func (c *Controller) handleProfiles(w http.ResponseWriter, r *http.Request) {
+	if targetBrowser.chromium {
+		writeError(w, http.StatusNotImplemented, fmt.Sprintf("Profiles are only listed for Firefox; select a %s profile directory with -profile", targetBrowser.app))
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		path, profiles, err := firefoxProfiles()
+		if err != nil {
+			writeError(w, http.StatusNotFound, fmt.Sprintf("Failed to read Firefox profiles: %v", err))
+			return
+		}
+		if profiles == nil {
+			profiles = []FirefoxProfile{}
+		}
+		selected := c.state.launchProfile()
+		if selected == "" {
+			selected = c.cfg.Profile
+		}
+		writeJSON(w, http.StatusOK, ProfilesResponse{
+			Response:    Response{Success: true, Message: fmt.Sprintf("Found %d profiles", len(profiles))},
+			ProfilesINI: path,
+			Profiles:    profiles,
+			Selected:    selected,
+		})
+
+	case http.MethodPost:
+		var req SelectProfileRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid JSON payload")
+			return
+		}
+		if c.cfg.ProfileDir != "" {
+			writeError(w, http.StatusConflict, "Profile selection is overridden by -profile-dir")
+			return
+		}
+		if req.Name != "" {
+			_, profiles, err := firefoxProfiles()
+			if err != nil {
+				writeError(w, http.StatusNotFound, fmt.Sprintf("Failed to read Firefox profiles: %v", err))
+				return
+			}
+			found := false
+			for _, p := range profiles {
+				found = found || p.Name == req.Name
+			}
+			if !found {
+				writeError(w, http.StatusNotFound, fmt.Sprintf("No Firefox profile named %s", req.Name))
+				return
+			}
+		}
+		c.state.setLaunchProfile(req.Name)
+
+		message := fmt.Sprintf("Future launches use profile %s", req.Name)
+		if req.Name == "" {
+			message = "Future launches use the -profile setting"
+		}
+		if firefoxRunning(r.Context()) {
+			message += "; Firefox is running and must be restarted to switch"
+		}
+		writeJSON(w, http.StatusOK, Response{Success: true, Message: message})
+
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "Only GET and POST methods are allowed")
+	}
+}
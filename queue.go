@@ -0,0 +1,112 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// queueWindow is how far back /queue-status counts completed commands
+const queueWindow = time.Minute
+
+// queueStats tracks who holds and who waits for the command mutex
+type queueStats struct {
+	mu        sync.Mutex
+	waiting   int
+	current   string // what holds the mutex, empty when idle
+	started   time.Time
+	completed []time.Duration // durations of commands finished within queueWindow
+	finished  []time.Time     // completion times, parallel to completed
+}
+
+// QueueStatusResponse is the Response for /queue-status
+type QueueStatusResponse struct {
+	Response
+	Waiting             int     `json:"waiting"`
+	InFlight            string  `json:"in_flight,omitempty"` // the endpoint or task holding the command mutex
+	RunningMs           int64   `json:"running_ms"`
+	CompletedLastMinute int     `json:"completed_last_minute"`
+	AvgMs               float64 `json:"avg_ms"` // mean duration of the commands completed in the last minute
+}
+
+func (q *queueStats) wait() {
+	q.mu.Lock()
+	q.waiting++
+	q.mu.Unlock()
+}
+
+func (q *queueStats) acquired(name string, waited bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if waited {
+		q.waiting--
+	}
+	q.current = name
+	q.started = time.Now()
+}
+
+func (q *queueStats) gaveUp() {
+	q.mu.Lock()
+	q.waiting--
+	q.mu.Unlock()
+}
+
+func (q *queueStats) released() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	now := time.Now()
+	q.completed = append(q.completed, now.Sub(q.started))
+	q.finished = append(q.finished, now)
+	q.current = ""
+	q.prune(now)
+}
+
+// idle marks the mutex free without counting what held it as a command
+func (q *queueStats) idle() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.current = ""
+}
+
+// prune drops completions older than queueWindow; q.mu must be held
+func (q *queueStats) prune(now time.Time) {
+	i := 0
+	for i < len(q.finished) && now.Sub(q.finished[i]) > queueWindow {
+		i++
+	}
+	q.completed = q.completed[i:]
+	q.finished = q.finished[i:]
+}
+
+// handleQueueStatus reports backpressure on the command mutex
+func (c *Controller) handleQueueStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "Only GET method is allowed")
+		return
+	}
+
+	q := &c.queue
+	q.mu.Lock()
+	now := time.Now()
+	q.prune(now)
+	resp := QueueStatusResponse{
+		Response:            Response{Success: true, Message: "Idle"},
+		Waiting:             q.waiting,
+		InFlight:            q.current,
+		CompletedLastMinute: len(q.completed),
+	}
+	if q.current != "" {
+		resp.RunningMs = now.Sub(q.started).Milliseconds()
+		resp.Message = "Running " + q.current
+	}
+	var total time.Duration
+	for _, d := range q.completed {
+		total += d
+	}
+	if len(q.completed) > 0 {
+		resp.AvgMs = float64(total.Milliseconds()) / float64(len(q.completed))
+	}
+	q.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"sync"
+)
+
+// readiness tracks the startup launch of -launch-on-start
+type readiness struct {
+	mu       sync.Mutex
+	starting bool   // the startup launch hasn't finished
+	failure  string // why the startup launch failed, empty if it succeeded
+}
+
+// ReadyResponse is the Response for /ready
+type ReadyResponse struct {
+	Response
+	Ready bool `json:"ready"`
+}
+
+// launchOnStart launches Firefox on -start-url at startup, or if it is
+// already running waits for its window and then opens -start-url. Until it
+// finishes /ready reports 503 and, with -ready-gate, mutating requests are
+// refused; newController marks the launch as starting so no request gets in
+// before it begins.
+func (c *Controller) launchOnStart() {
+	ctx, cancel := context.WithTimeout(c.baseContext(), c.cfg.LaunchTimeout)
+	wasRunning := false
+	err := c.lock(ctx, "launch-on-start")
+	if err == nil {
+		if err = c.launchFirefox(ctx, c.cfg.StartURL, ""); err == errFirefoxRunning {
+			wasRunning = true
+			err = c.waitForFirefoxReady(ctx, c.cfg.LaunchTimeout)
+		}
+		c.unlock()
+	}
+	cancel()
+
+	c.readiness.mu.Lock()
+	c.readiness.starting = false
+	if err != nil {
+		c.readiness.failure = err.Error()
+	}
+	c.readiness.mu.Unlock()
+	if err != nil {
+		log.Printf("warning: Firefox was not ready at startup: %v", err)
+		return
+	}
+	log.Printf("Firefox is ready")
+
+	if wasRunning && c.cfg.StartURL != "" {
+		c.openStartURL()
+	}
+}
+
+// startupPending reports whether the -launch-on-start launch is still running
+func (c *Controller) startupPending() bool {
+	c.readiness.mu.Lock()
+	defer c.readiness.mu.Unlock()
+	return c.readiness.starting
+}
+
+// withReadyGate refuses requests other than GET with 503 while the startup
+// launch runs, so a first /open doesn't race it. /launch and
+// /restart-browser still pass.
+func (c *Controller) withReadyGate(h http.Handler) http.Handler {
+	if !c.cfg.ReadyGate {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.URL.Path != "/launch" && r.URL.Path != "/restart-browser" && c.startupPending() {
+			writeErrorCode(w, http.StatusServiceUnavailable, codeNotReady, "Firefox is still starting; wait for /ready")
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// handleReady reports 200 once Firefox can take input: its window can be
+// activated and, with the marionette backend, marionette accepts
+// connections. With -launch-on-start it stays 503 until the startup launch
+// is done. Like /health it needs no API key, so orchestration can poll it.
+func (c *Controller) handleReady(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "Only GET method is allowed")
+		return
+	}
+
+	c.readiness.mu.Lock()
+	starting, failure := c.readiness.starting, c.readiness.failure
+	c.readiness.mu.Unlock()
+
+	message := ""
+	switch {
+	case starting:
+		message = "Firefox is still starting"
+	case !c.firefoxReady(r.Context()):
+		message = "Firefox is not ready for input"
+		if failure != "" {
+			message += "; the startup launch failed: " + failure
+		}
+	}
+	if message != "" {
+		writeJSON(w, http.StatusServiceUnavailable, ReadyResponse{
+			Response: Response{Success: false, Message: message, ErrorCode: codeNotReady},
+		})
+		return
+	}
+	writeJSON(w, http.StatusOK, ReadyResponse{
+		Response: Response{Success: true, Message: "Ready"},
+		Ready:    true,
+	})
+}
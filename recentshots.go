@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// With -recent-screenshots the controller keeps the board as it looked
+// after each of the last N actions, so a bad move can be looked into after
+// the board has moved on. Nothing is written to disk.
+
+// recentScreenshot is a board screenshot taken after an action
+type recentScreenshot struct {
+	taken  time.Time
+	action string
+	png    []byte
+}
+
+// screenshotRing holds the last -recent-screenshots screenshots, oldest first
+type screenshotRing struct {
+	mu    sync.Mutex
+	shots []recentScreenshot
+}
+
+// add appends shot, dropping the oldest beyond size
+func (s *screenshotRing) add(shot recentScreenshot, size int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.shots = append(s.shots, shot)
+	if len(s.shots) > size {
+		s.shots = append(s.shots[:0], s.shots[len(s.shots)-size:]...)
+	}
+}
+
+// list returns the screenshots, oldest first
+func (s *screenshotRing) list() []recentScreenshot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]recentScreenshot(nil), s.shots...)
+}
+
+// RecentScreenshot is one entry of /recent-screenshots
+type RecentScreenshot struct {
+	Time   time.Time `json:"time"`
+	Action string    `json:"action"`         // the request that preceded the screenshot, such as "POST /move"
+	PNG    string    `json:"png,omitempty"`  // base64
+	JPEG   string    `json:"jpeg,omitempty"` // base64, instead of PNG with ?format=jpeg
+}
+
+// RecentScreenshotsResponse is the Response for /recent-screenshots
+type RecentScreenshotsResponse struct {
+	Response
+	Screenshots []RecentScreenshot `json:"screenshots"`
+}
+
+// withRecentScreenshots captures the board after each successful POST while
+// -recent-screenshots is set. The capture runs after the response, so it
+// adds no latency; a 202 for an asynchronous job is skipped, as the action
+// hasn't run yet.
+func (c *Controller) withRecentScreenshots(h http.Handler) http.Handler {
+	if c.cfg.RecentScreenshots <= 0 {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		h.ServeHTTP(sw, r)
+		if r.Method != http.MethodPost || sw.status != http.StatusOK {
+			return
+		}
+		action := r.Method + " " + r.URL.Path
+		// Keep the request's values, such as its display, but not its deadline
+		ctx := context.WithoutCancel(r.Context())
+		go func() {
+			ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+			defer cancel()
+			shot, err := c.boardScreenshot(ctx)
+			if err != nil {
+				log.Printf("recent-screenshots: failed to capture after %s: %v", action, err)
+				return
+			}
+			c.recentShots.add(recentScreenshot{taken: time.Now(), action: action, png: shot}, c.cfg.RecentScreenshots)
+		}()
+	})
+}
+
+// handleRecentScreenshots returns the retained screenshots, newest first,
+// converted to ?format= when given
+func (c *Controller) handleRecentScreenshots(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "Only GET method is allowed")
+		return
+	}
+	if c.cfg.RecentScreenshots <= 0 {
+		writeError(w, http.StatusNotImplemented, "Recent screenshots are not kept; start the server with -recent-screenshots")
+		return
+	}
+
+	format, err := queryImageFormat(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("Invalid image format: %v", err))
+		return
+	}
+
+	shots := c.recentShots.list()
+	resp := RecentScreenshotsResponse{Screenshots: make([]RecentScreenshot, 0, len(shots))}
+	for i := len(shots) - 1; i >= 0; i-- {
+		data, err := format.encode(shots[i].png)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		shot := RecentScreenshot{Time: shots[i].taken, Action: shots[i].action}
+		if format.name == formatJPEG {
+			shot.JPEG = base64.StdEncoding.EncodeToString(data)
+		} else {
+			shot.PNG = base64.StdEncoding.EncodeToString(data)
+		}
+		resp.Screenshots = append(resp.Screenshots, shot)
+	}
+	resp.Response = Response{Success: true, Message: fmt.Sprintf("Kept %d screenshots (up to %d)", len(shots), c.cfg.RecentScreenshots)}
+	writeJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"runtime/debug"
+)
+
+// recoveryWriter notes whether a handler has started its response, and
+// passes flushes through for /events
+type recoveryWriter struct {
+	http.ResponseWriter
+	wrote bool
+}
+
+func (rw *recoveryWriter) WriteHeader(status int) {
+	rw.wrote = true
+	rw.ResponseWriter.WriteHeader(status)
+}
+
+func (rw *recoveryWriter) Write(p []byte) (int, error) {
+	rw.wrote = true
+	return rw.ResponseWriter.Write(p)
+}
+
+func (rw *recoveryWriter) Flush() {
+	if f, ok := rw.ResponseWriter.(http.Flusher); ok {
+		rw.wrote = true
+		f.Flush()
+	}
+}
+
+// withRecovery turns a panicking handler into a logged stack trace and a
+// 500 INTERNAL Response, instead of net/http's dropped connection. A
+// response already under way is left as it is.
+func (c *Controller) withRecovery(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rw := &recoveryWriter{ResponseWriter: w}
+		defer func() {
+			v := recover()
+			if v == nil {
+				return
+			}
+			if v == http.ErrAbortHandler {
+				panic(v)
+			}
+			log.Printf("panic serving %s %s: %v\n%s", r.Method, r.URL.Path, v, debug.Stack())
+			if !rw.wrote {
+				writeErrorCode(rw, http.StatusInternalServerError, codeInternal, fmt.Sprintf("Internal error: %v", v))
+			}
+		}()
+		h.ServeHTTP(rw, r)
+	})
+}
+
+// handleNotFound answers paths no route matches
+func (c *Controller) handleNotFound(w http.ResponseWriter, r *http.Request) {
+	writeError(w, http.StatusNotFound, fmt.Sprintf("Unknown endpoint %s; see /capabilities for what this controller serves", r.URL.Path))
+}
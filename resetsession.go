@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// ResetSessionRequest represents the JSON payload for /reset-session
+type ResetSessionRequest struct {
+	URL  string `json:"url,omitempty"`  // the lobby to finish on; defaults to the site profile's
+	Site string `json:"site,omitempty"` // site profile name; defaults to the one serving the page
+}
+
+// ResetStep is what one /reset-session step did
+type ResetStep struct {
+	Step    string `json:"step"` // "close_tabs", "dismiss_dialog", "clear_selection", "navigate" or "reset_zoom"
+	Done    bool   `json:"done"`
+	Skipped string `json:"skipped,omitempty"` // why the step didn't run
+	Message string `json:"message,omitempty"`
+}
+
+// ResetSessionResponse is the Response for /reset-session
+type ResetSessionResponse struct {
+	Response
+	Site  string      `json:"site,omitempty"`
+	Steps []ResetStep `json:"steps"`
+}
+
+// closeOtherTabs closes every tab but the current one, returning how many
+// were closed
+func (c *Controller) closeOtherTabs(ctx context.Context) (int, error) {
+	keep, err := c.marionette.CurrentTab(ctx)
+	if err != nil {
+		return 0, err
+	}
+	handles, err := c.marionette.TabHandles(ctx)
+	if err != nil {
+		return 0, err
+	}
+	closed := 0
+	for _, handle := range handles {
+		if handle == keep {
+			continue
+		}
+		if err := c.marionette.SwitchToTab(ctx, handle); err != nil {
+			return closed, err
+		}
+		if err := c.marionette.CloseTab(ctx); err != nil {
+			return closed, err
+		}
+		closed++
+	}
+	if err := c.marionette.SwitchToTab(ctx, keep); err != nil {
+		return closed, err
+	}
+	c.state.setActiveTab(keep)
+	return closed, nil
+}
+
+// handleResetSession puts the browser back in a known state between games,
+// under one hold of the command mutex: extra tabs closed, a game-over
+// dialog dismissed, any selected piece or premove dropped as /abort-move
+// does, the lobby opened and the page zoom reset to 100%, in that order.
+// Steps that don't apply, such as closing tabs natively or dismissing a
+// dialog that isn't configured, are skipped, so it is safe to repeat. A
+// failing step stops the reset.
+func (c *Controller) handleResetSession(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "Only POST method is allowed")
+		return
+	}
+
+	var req ResetSessionRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid JSON payload")
+			return
+		}
+	}
+	var site *siteProfile
+	if req.Site != "" {
+		if site = siteByName(req.Site); site == nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("Unknown site %q", req.Site))
+			return
+		}
+	}
+
+	resp := ResetSessionResponse{Steps: []ResetStep{}}
+	failedStatus := 0
+	// dispatch runs one step through its endpoint. Refusals meaning the
+	// step isn't available here skip it; other failures stop the reset.
+	dispatch := func(step, method, path string, body []byte) (bool, error) {
+		rec, err := c.dispatchLockedMethod(r.Context(), method, path, body)
+		if err != nil {
+			return false, err
+		}
+		var result Response
+		json.Unmarshal(rec.body.Bytes(), &result)
+		switch {
+		case rec.status >= 200 && rec.status <= 299 && result.Success:
+			resp.Steps = append(resp.Steps, ResetStep{Step: step, Done: true, Message: result.Message})
+			return true, nil
+		case rec.status == http.StatusBadRequest || rec.status == http.StatusConflict || rec.status == http.StatusNotImplemented:
+			resp.Steps = append(resp.Steps, ResetStep{Step: step, Skipped: result.Message})
+			return true, nil
+		}
+		resp.Steps = append(resp.Steps, ResetStep{Step: step, Message: result.Message})
+		resp.ErrorCode = result.ErrorCode
+		failedStatus = rec.status
+		if failedStatus < 400 {
+			failedStatus = http.StatusUnprocessableEntity
+		}
+		return false, nil
+	}
+
+	err := c.command(r, func() error {
+		if site == nil {
+			if c.marionette != nil {
+				site, _, _ = c.currentSite(r.Context())
+			} else {
+				site = c.siteFor(c.gameURL())
+			}
+		}
+
+		if c.marionette == nil {
+			resp.Steps = append(resp.Steps, ResetStep{Step: "close_tabs", Skipped: "Closing tabs requires the marionette backend"})
+		} else {
+			closed, err := c.closeOtherTabs(r.Context())
+			if err != nil {
+				return fmt.Errorf("failed to close tabs: %v", err)
+			}
+			resp.Steps = append(resp.Steps, ResetStep{Step: "close_tabs", Done: true, Message: fmt.Sprintf("Closed %d tabs", closed)})
+		}
+
+		if ok, err := dispatch("dismiss_dialog", http.MethodPost, "/dismiss-dialog", nil); !ok || err != nil {
+			return err
+		}
+		if ok, err := dispatch("clear_selection", http.MethodPost, "/abort-move", nil); !ok || err != nil {
+			return err
+		}
+
+		lobby := req.URL
+		if lobby == "" && site != nil {
+			lobby = site.LobbyURL
+		}
+		if lobby == "" {
+			resp.Steps = append(resp.Steps, ResetStep{Step: "navigate", Skipped: "No lobby URL given and no site profile to take one from"})
+		} else {
+			body, _ := json.Marshal(URLRequest{URL: lobby})
+			if ok, err := dispatch("navigate", http.MethodPost, "/open", body); !ok || err != nil {
+				return err
+			}
+		}
+
+		// Firefox keeps the zoom per site, so it is reset on the lobby the
+		// next game starts from
+		_, err := dispatch("reset_zoom", http.MethodPost, "/zoom", nil)
+		return err
+	})
+	if site != nil {
+		resp.Site = site.Name
+	}
+	if err != nil {
+		resp.Response = Response{Success: false, Message: fmt.Sprintf("Reset failed: %v", err), ErrorCode: errorCode(err)}
+		writeJSON(w, commandStatus(err), resp)
+		return
+	}
+	if failedStatus != 0 {
+		last := resp.Steps[len(resp.Steps)-1]
+		resp.Response = Response{Success: false, Message: fmt.Sprintf("Reset stopped at %s: %s", last.Step, last.Message), ErrorCode: resp.ErrorCode}
+		writeJSON(w, failedStatus, resp)
+		return
+	}
+
+	done := 0
+	for _, step := range resp.Steps {
+		if step.Done {
+			done++
+		}
+	}
+	resp.Response = Response{Success: true, Message: fmt.Sprintf("Reset the session: %d of %d steps done, the rest skipped", done, len(resp.Steps))}
+	writeJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// RestartPhase is the outcome of one step of /restart-browser
+type RestartPhase struct {
+	Name       string `json:"name"`
+	Success    bool   `json:"success"`
+	Message    string `json:"message"`
+	DurationMs int64  `json:"duration_ms"`
+}
+
+// RestartResponse is the Response for /restart-browser
+type RestartResponse struct {
+	Response
+	Phases []RestartPhase `json:"phases"`
+}
+
+// stopFirefox asks Firefox to quit, or kills it when force is set
+func stopFirefox(ctx context.Context, force bool) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "linux":
+		signal := "-TERM"
+		if force {
+			signal = "-KILL"
+		}
+		cmd = newCommand(ctx, "pkill", append([]string{signal}, firefoxMatch(ctx)...)...)
+	case "darwin":
+		if force {
+			cmd = newCommand(ctx, "pkill", append([]string{"-KILL"}, firefoxMatch(ctx)...)...)
+		} else if ctx.Value(profileDirKey{}) != nil {
+			// quitting the application would stop every instance
+			cmd = newCommand(ctx, "pkill", append([]string{"-TERM"}, firefoxMatch(ctx)...)...)
+		} else {
+			cmd = newCommand(ctx, "osascript", "-e", `tell application "`+targetBrowser.app+`" to quit`)
+		}
+	case "windows":
+		if force {
+			cmd = newCommand(ctx, "taskkill", "/F", "/T", "/IM", targetBrowser.exe())
+		} else {
+			cmd = newCommand(ctx, "taskkill", "/IM", targetBrowser.exe())
+		}
+	default:
+		return fmt.Errorf("unsupported operating system: %s", runtime.GOOS)
+	}
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to stop Firefox: %v %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// waitForFirefoxExit polls until no Firefox process is left, timeout elapses or ctx is done
+func waitForFirefoxExit(ctx context.Context, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	for firefoxRunning(ctx) {
+		select {
+		case <-time.After(250 * time.Millisecond):
+		case <-ctx.Done():
+			return fmt.Errorf("firefox still running after %v", timeout)
+		}
+	}
+	return nil
+}
+
+// handleRestartBrowser stops Firefox, gracefully and then by force, and
+// starts it again on -start-url, returning once its window exists
+func (c *Controller) handleRestartBrowser(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "Only POST method is allowed")
+		return
+	}
+
+	var phases []RestartPhase
+	phase := func(name string, fn func() error) error {
+		start := time.Now()
+		err := fn()
+		p := RestartPhase{Name: name, Success: err == nil, Message: "ok", DurationMs: time.Since(start).Milliseconds()}
+		if err != nil {
+			p.Message = err.Error()
+		}
+		phases = append(phases, p)
+		return err
+	}
+
+	err := c.command(r, func() error {
+		ctx := r.Context()
+		if firefoxRunning(ctx) {
+			graceful := phase("stop", func() error {
+				if err := stopFirefox(ctx, false); err != nil {
+					return err
+				}
+				return waitForFirefoxExit(ctx, c.cfg.RestartGrace)
+			})
+			if graceful != nil {
+				err := phase("kill", func() error {
+					if err := stopFirefox(ctx, true); err != nil {
+						return err
+					}
+					return waitForFirefoxExit(ctx, c.cfg.RestartGrace)
+				})
+				if err != nil {
+					return err
+				}
+			}
+		}
+		if c.marionette != nil {
+			c.marionette.reset()
+		}
+
+		if err := phase("launch", func() error {
+			return c.launchFirefox(ctx, c.cfg.StartURL, "")
+		}); err != nil {
+			return err
+		}
+		return phase("window", func() error {
+			return c.waitForFirefoxReady(ctx, c.cfg.LaunchTimeout)
+		})
+	})
+	if err != nil {
+		writeJSON(w, commandStatus(err), RestartResponse{
+			Response: Response{Success: false, Message: fmt.Sprintf("Failed to restart Firefox: %v", err), ErrorCode: errorCode(err)},
+			Phases:   phases,
+		})
+		return
+	}
+	c.watchdog.reset()
+	c.state.resetBrowser()
+
+	writeJSON(w, http.StatusOK, RestartResponse{
+		Response: Response{Success: true, Message: "Firefox restarted"},
+		Phases:   phases,
+	})
+}
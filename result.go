@@ -0,0 +1,200 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Game results reported by /result
+const (
+	resultWhiteWins = "white_wins"
+	resultBlackWins = "black_wins"
+	resultDraw      = "draw"
+)
+
+// resultReasons maps words in a game-over banner to the reason reported,
+// in the order they are looked for: "stalemate" before "mate", and
+// "agreement" before the "draw" any drawn game mentions
+var resultReasons = []struct{ word, reason string }{
+	{"stalemate", "stalemate"},
+	{"checkmate", "checkmate"},
+	{"mate", "checkmate"},
+	{"resign", "resignation"},
+	{"time", "timeout"},
+	{"flag", "timeout"},
+	{"agree", "agreement"},
+	{"repetition", "repetition"},
+	{"insufficient", "insufficient_material"},
+	{"50", "fifty_moves"},
+	{"fifty", "fifty_moves"},
+	{"abandon", "abandonment"},
+	{"left the game", "abandonment"},
+	{"abort", "aborted"},
+}
+
+// ResultResponse is the Response for /result
+type ResultResponse struct {
+	Response
+	Over bool `json:"over"`
+	// Result is "white_wins", "black_wins" or "draw"; empty when the game
+	// was aborted or the native backend can't read the banner
+	Result string `json:"result,omitempty"`
+	Reason string `json:"reason,omitempty"` // such as "checkmate", "resignation" or "timeout"
+	Text   string `json:"text,omitempty"`   // the banner text the result was read from
+	Site   string `json:"site,omitempty"`
+}
+
+// resultScript reads the text of the game-over result arguments[0] and
+// status arguments[1], null when the game isn't over
+const resultScript = `
+const text = selector => {
+	const el = selector && document.querySelector(selector);
+	return el ? el.textContent.trim() : null;
+};
+return {result: text(arguments[0]), status: text(arguments[1])};`
+
+// parseGameResult reads the result and reason from a game-over banner, such
+// as "1-0", "0-1" or "½-½" with "Checkmate • White is victorious", or
+// chess.com's "You Won!" with "by resignation". A "you" banner needs the
+// playing color to say who won.
+func parseGameResult(text, playing string) (result, reason string) {
+	lower := strings.ToLower(text)
+	for _, r := range resultReasons {
+		if strings.Contains(lower, r.word) {
+			reason = r.reason
+			break
+		}
+	}
+	switch {
+	case strings.Contains(lower, "1-0"):
+		result = resultWhiteWins
+	case strings.Contains(lower, "0-1"):
+		result = resultBlackWins
+	case strings.Contains(lower, "½-½"), strings.Contains(lower, "1/2-1/2"), strings.Contains(lower, "draw"), reason == "stalemate":
+		result = resultDraw
+	case strings.Contains(lower, "white won"), strings.Contains(lower, "white wins"), strings.Contains(lower, "white is victorious"):
+		result = resultWhiteWins
+	case strings.Contains(lower, "black won"), strings.Contains(lower, "black wins"), strings.Contains(lower, "black is victorious"):
+		result = resultBlackWins
+	case playing != "" && (strings.Contains(lower, "you won") || strings.Contains(lower, "you win")):
+		result = resultWhiteWins
+		if playing == orientationBlack {
+			result = resultBlackWins
+		}
+	case playing != "" && (strings.Contains(lower, "you lost") || strings.Contains(lower, "you lose")):
+		result = resultBlackWins
+		if playing == orientationBlack {
+			result = resultWhiteWins
+		}
+	}
+	if reason == "aborted" {
+		result = ""
+	}
+	return result, reason
+}
+
+// resultMessage describes a finished game's result for the Response
+func resultMessage(result, reason string) string {
+	if reason == "aborted" {
+		return "Game aborted"
+	}
+	message := "Game over"
+	switch result {
+	case resultWhiteWins:
+		message = "White won"
+	case resultBlackWins:
+		message = "Black won"
+	case resultDraw:
+		message = "Drawn"
+	}
+	if reason != "" {
+		message += " by " + strings.ReplaceAll(reason, "_", " ")
+	}
+	return message
+}
+
+// handleResult reports whether the game on the page is over and who won.
+// With the marionette backend the site profile's game-over banner is read;
+// natively the game-over dialog is detected by the color of -dialog-region,
+// as /dismiss-dialog does, and its text read with tesseract when it is
+// installed. Without it the native result only says the game is over.
+func (c *Controller) handleResult(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "Only GET method is allowed")
+		return
+	}
+
+	resp := ResultResponse{}
+	if c.marionette != nil {
+		site, current, err := c.currentSite(r.Context())
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if site == nil || site.ResultSelector == "" {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("Unsupported site: %s", current))
+			return
+		}
+		var banner struct {
+			Result *string `json:"result"`
+			Status *string `json:"status"`
+		}
+		if err := c.marionette.ExecuteScript(r.Context(), resultScript, []interface{}{site.ResultSelector, site.StatusSelector}, &banner); err != nil {
+			writeError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to read the result: %v", err))
+			return
+		}
+		resp.Site = site.Name
+		if banner.Result != nil {
+			resp.Over = true
+			resp.Text = *banner.Result
+			if banner.Status != nil {
+				resp.Text = strings.TrimSpace(resp.Text + " " + *banner.Status)
+			}
+		}
+	} else {
+		if c.cfg.DialogRegion.empty() || c.cfg.DialogColor == "" {
+			writeError(w, http.StatusConflict, "Game-over detection is not configured; set -dialog-region and -dialog-color")
+			return
+		}
+		want, err := parseHexColor(c.cfg.DialogColor)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, fmt.Sprintf("Invalid -dialog-color: %v", err))
+			return
+		}
+		var shot []byte
+		err = c.command(r, func() error {
+			var err error
+			shot, err = captureScreen(r.Context())
+			return err
+		})
+		if err != nil {
+			writeCommandError(w, err, err.Error())
+			return
+		}
+		got, err := averageColor(shot, c.cfg.DialogRegion)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		resp.Over = colorsClose(got, want, c.cfg.DialogTolerance)
+		if resp.Over && haveTool(c.cfg.TesseractBin) {
+			crop, err := cropPNG(shot, c.cfg.DialogRegion)
+			if err == nil {
+				resp.Text, _, err = c.runTesseract(r.Context(), crop)
+			}
+			if err != nil {
+				writeErrorCode(w, http.StatusServiceUnavailable, errorCode(err), fmt.Sprintf("Game over, but reading the dialog failed: %v", err))
+				return
+			}
+		}
+	}
+
+	message := "Game in progress"
+	if resp.Over {
+		resp.Result, resp.Reason = parseGameResult(resp.Text, c.playingColor())
+		message = resultMessage(resp.Result, resp.Reason)
+	}
+	resp.Response = Response{Success: true, Message: message}
+	writeJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// JSON-RPC 2.0 error codes
+const (
+	rpcParseError     = -32700
+	rpcInvalidRequest = -32600
+	rpcMethodNotFound = -32601
+	rpcInvalidParams  = -32602
+	rpcServerError    = -32000
+)
+
+// rpcEndpoint is the REST endpoint an RPC method is served by
+type rpcEndpoint struct {
+	Method string
+	Path   string
+}
+
+// rpcMethods maps JSON-RPC method names to REST endpoints. "click" and
+// "screenshot" have no endpoint of their own and are handled in rpcCall.
+var rpcMethods = map[string]rpcEndpoint{
+	"navigate":           {http.MethodPost, "/open"},
+	"launch":             {http.MethodPost, "/launch"},
+	"profiles":           {http.MethodGet, "/profiles"},
+	"select-profile":     {http.MethodPost, "/profiles"},
+	"site-profiles":      {http.MethodGet, "/profiles/sites"},
+	"select-site":        {http.MethodPost, "/profiles/sites"},
+	"move":               {http.MethodPost, "/move"},
+	"human-move":         {http.MethodPost, "/human-move"},
+	"abort-move":         {http.MethodPost, "/abort-move"},
+	"play-moves":         {http.MethodPost, "/play-moves"},
+	"drag-square":        {http.MethodPost, "/drag-square"},
+	"move-by-pixels":     {http.MethodPost, "/move-by-pixels"},
+	"hover":              {http.MethodPost, "/hover"},
+	"key":                {http.MethodPost, "/key"},
+	"set-addressbar":     {http.MethodPost, "/set-addressbar"},
+	"get-addressbar":     {http.MethodGet, "/get-addressbar"},
+	"fill":               {http.MethodPost, "/fill"},
+	"dismiss-dialog":     {http.MethodPost, "/dismiss-dialog"},
+	"offer-response":     {http.MethodPost, "/offer-response"},
+	"new-game":           {http.MethodPost, "/new-game"},
+	"set-time-control":   {http.MethodPost, "/set-time-control"},
+	"set-window-bounds":  {http.MethodPost, "/set-window-bounds"},
+	"calibrate":          {http.MethodPost, "/calibrate"},
+	"auto-calibrate":     {http.MethodPost, "/auto-calibrate"},
+	"setup":              {http.MethodPost, "/setup"},
+	"orientation":        {http.MethodPost, "/orientation"},
+	"clear-calibration":  {http.MethodPost, "/clear-calibration"},
+	"zoom":               {http.MethodGet, "/zoom"},
+	"display_info":       {http.MethodGet, "/display-info"},
+	"reset-zoom":         {http.MethodPost, "/zoom"},
+	"move-list":          {http.MethodGet, "/move-list"},
+	"check-challenge":    {http.MethodGet, "/check-challenge"},
+	"clock":              {http.MethodGet, "/clock"},
+	"turn":               {http.MethodGet, "/turn"},
+	"result":             {http.MethodGet, "/result"},
+	"board-state":        {http.MethodGet, "/board-state"},
+	"pgn":                {http.MethodGet, "/pgn"},
+	"last-move":          {http.MethodGet, "/last-move"},
+	"recent-screenshots": {http.MethodGet, "/recent-screenshots"},
+	"wait-board-stable":  {http.MethodGet, "/wait-for-board-stable"},
+	"save-screenshot":    {http.MethodPost, "/save-screenshot"},
+	"status":             {http.MethodGet, "/status"},
+	"clipboard-check":    {http.MethodPost, "/clipboard-check"},
+	"reset-session":      {http.MethodPost, "/reset-session"},
+	"config":             {http.MethodGet, "/config"},
+}
+
+type rpcRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params"`
+	ID      json.RawMessage `json:"id"` // absent for notifications
+}
+
+type rpcError struct {
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+type rpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+	ID      json.RawMessage `json:"id"`
+}
+
+// rpcScreenshotParams are the optional params of the "screenshot" method
+type rpcScreenshotParams struct {
+	Format  string `json:"format"`
+	Quality int    `json:"quality"`
+	// BoardOnly fails instead of falling back to the whole screen when the
+	// board isn't calibrated, so the image is always the board
+	BoardOnly bool `json:"board_only"`
+}
+
+// rpcClickParams are the params of the "click" method
+type rpcClickParams struct {
+	X      *int   `json:"x"`
+	Y      *int   `json:"y"`
+	Square string `json:"square"`
+	Button int    `json:"button"`
+}
+
+// rpcCall runs one request; the caller holds the command mutex
+func (c *Controller) rpcCall(r *http.Request, req rpcRequest) *rpcResponse {
+	resp := &rpcResponse{JSONRPC: "2.0", ID: req.ID}
+	if resp.ID == nil {
+		resp.ID = json.RawMessage("null")
+	}
+	fail := func(code int, message string, data interface{}) *rpcResponse {
+		resp.Error = &rpcError{Code: code, Message: message, Data: data}
+		return resp
+	}
+	if req.JSONRPC != "2.0" || req.Method == "" {
+		return fail(rpcInvalidRequest, "Invalid Request", nil)
+	}
+
+	var result interface{}
+	switch req.Method {
+	case "screenshot":
+		var p rpcScreenshotParams
+		if len(req.Params) > 0 {
+			if err := json.Unmarshal(req.Params, &p); err != nil {
+				return fail(rpcInvalidParams, "Invalid params", nil)
+			}
+		}
+		format, err := parseImageFormat(p.Format, p.Quality)
+		if err != nil {
+			return fail(rpcInvalidParams, fmt.Sprintf("Invalid image format: %v", err), nil)
+		}
+		if _, ok := c.calibration(); p.BoardOnly && !ok {
+			return fail(rpcServerError, "Board is not calibrated", map[string]interface{}{"status": http.StatusConflict, "error_code": codeCalibrationMissing})
+		}
+		shot, err := c.boardScreenshot(r.Context())
+		if err == nil {
+			shot, err = format.encode(shot)
+		}
+		if err != nil {
+			return fail(rpcServerError, fmt.Sprintf("Failed to take screenshot: %v", err), nil)
+		}
+		result = map[string]string{"screenshot": base64.StdEncoding.EncodeToString(shot), "format": format.name}
+
+	case "click":
+		var p rpcClickParams
+		if len(req.Params) > 0 {
+			if err := json.Unmarshal(req.Params, &p); err != nil {
+				return fail(rpcInvalidParams, "Invalid params", nil)
+			}
+		}
+		target, err := c.rpcClickTarget(p)
+		if err != nil {
+			return fail(rpcInvalidParams, err.Error(), nil)
+		}
+		if p.Button == 0 {
+			p.Button = buttonLeft
+		}
+		err = c.focusCommand(r, func() error {
+			if err := focusFirefox(r.Context()); err != nil {
+				return err
+			}
+			return mouseClick(r.Context(), target, p.Button)
+		})
+		if err != nil {
+			return fail(rpcServerError, fmt.Sprintf("Failed to click: %v", err), nil)
+		}
+		result = HoverResponse{
+			Response: Response{Success: true, Message: fmt.Sprintf("Clicked at %d,%d", target.X, target.Y)},
+			Point:    target,
+		}
+
+	default:
+		endpoint, ok := rpcMethods[req.Method]
+		if !ok {
+			return fail(rpcMethodNotFound, "Method not found", req.Method)
+		}
+		body := []byte(req.Params)
+		if len(body) == 0 || bytes.Equal(body, []byte("null")) {
+			body = []byte("{}")
+		}
+		rec, err := c.dispatchLockedMethod(r.Context(), endpoint.Method, endpoint.Path, body)
+		if err != nil {
+			return fail(rpcServerError, err.Error(), nil)
+		}
+		if rec.status < 200 || rec.status > 299 {
+			var failed Response
+			json.Unmarshal(rec.body.Bytes(), &failed)
+			code := rpcServerError
+			if rec.status == http.StatusBadRequest {
+				code = rpcInvalidParams
+			}
+			return fail(code, failed.Message, map[string]interface{}{"status": rec.status, "error_code": failed.ErrorCode})
+		}
+		result = json.RawMessage(rec.body.Bytes())
+	}
+
+	resp.Result = result
+	return resp
+}
+
+// rpcClickTarget resolves the point a "click" call targets
+func (c *Controller) rpcClickTarget(p rpcClickParams) (point, error) {
+	if p.Button < 0 || p.Button > buttonRight {
+		return point{}, fmt.Errorf("invalid button %d", p.Button)
+	}
+	if p.Square != "" {
+		cal, ok := c.calibration()
+		if !ok {
+			return point{}, fmt.Errorf("board is not calibrated")
+		}
+		return cal.squareCenter(p.Square)
+	}
+	if p.X == nil || p.Y == nil {
+		return point{}, fmt.Errorf("either square or x and y are required")
+	}
+	return point{X: *p.X, Y: *p.Y}, nil
+}
+
+// handleRPC serves JSON-RPC 2.0 single and batch requests over the same
+// handlers as the REST endpoints. A batch runs in order with the command
+// mutex held throughout.
+func (c *Controller) handleRPC(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "Only POST method is allowed")
+		return
+	}
+
+	var raw json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&raw); err != nil {
+		writeJSON(w, http.StatusOK, rpcResponse{
+			JSONRPC: "2.0",
+			Error:   &rpcError{Code: rpcParseError, Message: "Parse error"},
+			ID:      json.RawMessage("null"),
+		})
+		return
+	}
+
+	batch := len(bytes.TrimSpace(raw)) > 0 && bytes.TrimSpace(raw)[0] == '['
+	var reqs []json.RawMessage
+	if batch {
+		if err := json.Unmarshal(raw, &reqs); err != nil || len(reqs) == 0 {
+			writeJSON(w, http.StatusOK, rpcResponse{
+				JSONRPC: "2.0",
+				Error:   &rpcError{Code: rpcInvalidRequest, Message: "Invalid Request"},
+				ID:      json.RawMessage("null"),
+			})
+			return
+		}
+	} else {
+		reqs = []json.RawMessage{raw}
+	}
+
+	if err := c.lock(r.Context(), "/rpc"); err != nil {
+		writeError(w, http.StatusServiceUnavailable, fmt.Sprintf("Failed to acquire command lock: %v", err))
+		return
+	}
+	locked := r.WithContext(context.WithValue(r.Context(), lockHeldKey{}, true))
+	responses := []*rpcResponse{}
+	for _, item := range reqs {
+		var req rpcRequest
+		if err := json.Unmarshal(item, &req); err != nil {
+			responses = append(responses, &rpcResponse{
+				JSONRPC: "2.0",
+				Error:   &rpcError{Code: rpcInvalidRequest, Message: "Invalid Request"},
+				ID:      json.RawMessage("null"),
+			})
+			continue
+		}
+		resp := c.rpcCall(locked, req)
+		if req.ID != nil {
+			responses = append(responses, resp)
+		}
+	}
+	c.unlock()
+
+	switch {
+	case len(responses) == 0:
+		w.WriteHeader(http.StatusNoContent)
+	case batch:
+		writeJSON(w, http.StatusOK, responses)
+	default:
+		writeJSON(w, http.StatusOK, responses[0])
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultScreenshotName is the filename template used when a request gives
+// none; the format's extension is added
+const defaultScreenshotName = "{timestamp}"
+
+// SaveScreenshotRequest represents the optional JSON payload for /save-screenshot
+type SaveScreenshotRequest struct {
+	// Filename is a path under -screenshot-dir. {timestamp} is replaced by
+	// the capture time and {move} by Move or, with the marionette backend,
+	// the number of moves in the game's move list.
+	Filename string `json:"filename"`
+	Move     *int   `json:"move"`
+	Region   string `json:"region"` // "x,y,width,height" to save only part of the screen
+	Board    bool   `json:"board"`  // save only the calibrated board
+	Format   string `json:"format"` // "png", the default, or "jpeg"
+	Quality  int    `json:"quality"`
+}
+
+// SaveScreenshotResponse is the Response for /save-screenshot
+type SaveScreenshotResponse struct {
+	Response
+	Path  string `json:"path"`
+	Bytes int    `json:"bytes"`
+}
+
+// screenshotPath expands the filename template and returns the absolute
+// path it names under dir, ending in ext, rejecting paths that would leave dir
+func screenshotPath(dir, template, ext string, now time.Time, move int) (string, error) {
+	name := strings.NewReplacer(
+		"{timestamp}", now.Format("20060102-150405.000"),
+		"{move}", strconv.Itoa(move),
+	).Replace(template)
+	if filepath.IsAbs(name) {
+		return "", fmt.Errorf("filename must be relative to the screenshot directory")
+	}
+	if !strings.EqualFold(filepath.Ext(name), ext) {
+		name += ext
+	}
+	base, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(base, name)
+	rel, err := filepath.Rel(base, path)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("filename %q is outside the screenshot directory", template)
+	}
+	return path, nil
+}
+
+// moveCount returns the number of moves in the current page's move list
+func (c *Controller) moveCount(ctx context.Context) (int, error) {
+	if c.marionette == nil {
+		return 0, fmt.Errorf("{move} needs a move number or the marionette backend")
+	}
+	site, current, err := c.currentSite(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if site == nil {
+		return 0, fmt.Errorf("unsupported site %s for {move}", current)
+	}
+	var moves []string
+	if err := c.marionette.ExecuteScript(ctx, moveListScript, []interface{}{site.MoveListSelector}, &moves); err != nil {
+		return 0, fmt.Errorf("failed to read move list: %v", err)
+	}
+	return len(moves), nil
+}
+
+// handleSaveScreenshot captures the screen, or part of it, to a PNG or JPEG
+// under -screenshot-dir and returns its path rather than the image
+func (c *Controller) handleSaveScreenshot(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "Only POST method is allowed")
+		return
+	}
+
+	var req SaveScreenshotRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid JSON payload")
+			return
+		}
+	}
+	if req.Filename == "" {
+		req.Filename = defaultScreenshotName
+	}
+	format, err := parseImageFormat(req.Format, req.Quality)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("Invalid image format: %v", err))
+		return
+	}
+	region, err := parseRect(req.Region)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("Invalid region: %v", err))
+		return
+	}
+	if req.Board {
+		if !region.empty() {
+			writeError(w, http.StatusBadRequest, "Use either region or board, not both")
+			return
+		}
+		cal, ok := c.calibration()
+		if !ok {
+			writeErrorCode(w, http.StatusConflict, codeCalibrationMissing, "Board is not calibrated")
+			return
+		}
+		region = rect{X: cal.X, Y: cal.Y, Width: cal.Width, Height: cal.Height}
+	}
+
+	move := 0
+	if req.Move != nil {
+		move = *req.Move
+	} else if strings.Contains(req.Filename, "{move}") {
+		if move, err = c.moveCount(r.Context()); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("Cannot fill in {move}: %v", err))
+			return
+		}
+	}
+	path, err := screenshotPath(c.cfg.ScreenshotDir, req.Filename, format.ext(), time.Now(), move)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("Invalid filename: %v", err))
+		return
+	}
+
+	var shot []byte
+	err = c.command(r, func() error {
+		var err error
+		if shot, err = captureScreen(r.Context()); err != nil {
+			return err
+		}
+		if !region.empty() {
+			if shot, err = cropPNG(shot, region); err != nil {
+				return err
+			}
+		}
+		shot, err = format.encode(shot)
+		return err
+	})
+	if err != nil {
+		writeCommandError(w, err, err.Error())
+		return
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to create %s: %v", filepath.Dir(path), err))
+		return
+	}
+	if err := os.WriteFile(path, shot, 0o644); err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to save screenshot: %v", err))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, SaveScreenshotResponse{
+		Response: Response{
+			Success: true,
+			Message: fmt.Sprintf("Saved screenshot to %s", path),
+		},
+		Path:  path,
+		Bytes: len(shot),
+	})
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestScreenshotPath(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Date(2026, 3, 4, 5, 6, 7, 890_000_000, time.UTC)
+	tests := []struct {
+		template, ext string
+		want          string // relative to dir; "" for an error
+	}{
+		{"{timestamp}", ".png", "20260304-050607.890.png"},
+		{"game-{move}", ".png", "game-12.png"},
+		{"shot.png", ".png", "shot.png"},
+		{"shot.PNG", ".png", "shot.PNG"},
+		{"shot.jpg", ".png", "shot.jpg.png"},
+		{"games/{move}/board", ".jpeg", filepath.Join("games", "12", "board.jpeg")},
+		{"a/../b", ".png", "b.png"},
+		{"./c", ".png", "c.png"},
+		{"..", ".png", "...png"},
+		{"../escape", ".png", ""},
+		{"a/../../escape", ".png", ""},
+		{"../" + filepath.Base(dir) + "x/escape", ".png", ""},
+		{"/etc/passwd", ".png", ""},
+		{filepath.Join(dir, "abs"), ".png", ""},
+	}
+	for _, tt := range tests {
+		got, err := screenshotPath(dir, tt.template, tt.ext, now, 12)
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("screenshotPath(%q) = %q, want an error", tt.template, got)
+			}
+			continue
+		}
+		if want := filepath.Join(dir, tt.want); err != nil || got != want {
+			t.Errorf("screenshotPath(%q) = %q, %v, want %q", tt.template, got, err, want)
+		}
+	}
+}
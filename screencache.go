@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// screenshotInterval is the least time between two screen captures for the
+// same display, from -screenshot-min-interval. Within it, callers are
+// served the last capture, and callers arriving during a capture wait for
+// it, so pollers such as /wait-for-board-stable and the screenshot buffer share one
+// scrot or screencapture run instead of each starting their own.
+var screenshotInterval time.Duration
+
+// sharedCaptureTimeout bounds a capture that other requests may be waiting on
+const sharedCaptureTimeout = 30 * time.Second
+
+// screenCapture is a capture of one display, in flight until done closes
+type screenCapture struct {
+	done  chan struct{}
+	data  []byte
+	err   error
+	taken time.Time
+}
+
+// screenCache holds the latest capture per display, keyed by DISPLAY
+var screenCache = struct {
+	sync.Mutex
+	captures map[string]*screenCapture
+}{captures: map[string]*screenCapture{}}
+
+// Capture counters for /metrics
+var (
+	screenCaptures    atomic.Int64 // captures actually taken
+	screenCacheHits   atomic.Int64 // requests served a capture taken less than -screenshot-min-interval earlier
+	screenCacheShared atomic.Int64 // requests that waited for a capture already in flight
+)
+
+// commandDisplay returns the DISPLAY a request's commands run with, or ""
+// for the controller's own
+func commandDisplay(ctx context.Context) string {
+	display := ""
+	vars, _ := ctx.Value(commandEnvKey{}).([]string)
+	for _, v := range vars {
+		if d, ok := strings.CutPrefix(v, "DISPLAY="); ok {
+			display = d
+		}
+	}
+	return display
+}
+
+// captureScreen takes a PNG screenshot of the whole screen, or of
+// the -monitor when it is set, through the capture cache when
+// -screenshot-min-interval is set
+func captureScreen(ctx context.Context) ([]byte, error) {
+	if screenshotInterval <= 0 {
+		screenCaptures.Add(1)
+		return captureScreenNow(ctx)
+	}
+	key := commandDisplay(ctx)
+
+	screenCache.Lock()
+	if prev := screenCache.captures[key]; prev != nil {
+		select {
+		case <-prev.done:
+			if prev.err == nil && time.Since(prev.taken) < screenshotInterval {
+				screenCache.Unlock()
+				screenCacheHits.Add(1)
+				return prev.data, nil
+			}
+		default:
+			screenCache.Unlock()
+			screenCacheShared.Add(1)
+			select {
+			case <-prev.done:
+				return prev.data, prev.err
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+	}
+	capture := &screenCapture{done: make(chan struct{})}
+	screenCache.captures[key] = capture
+	screenCache.Unlock()
+
+	// The capture runs on its own context so that a waiting request isn't
+	// failed by the cancellation of the one that started it
+	captureCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), sharedCaptureTimeout)
+	capture.data, capture.err = captureScreenNow(captureCtx)
+	cancel()
+	capture.taken = time.Now()
+	screenCaptures.Add(1)
+	close(capture.done)
+	if capture.err != nil {
+		screenCache.Lock()
+		if screenCache.captures[key] == capture {
+			delete(screenCache.captures, key)
+		}
+		screenCache.Unlock()
+	}
+	return capture.data, capture.err
+}
+
+// invalidateScreenCache forgets every capture, including those still in
+// flight, after synthesized input, so the screenshot that checks a click or
+// a move shows its effect
+func invalidateScreenCache() {
+	if screenshotInterval <= 0 {
+		return
+	}
+	screenCache.Lock()
+	clear(screenCache.captures)
+	screenCache.Unlock()
+}
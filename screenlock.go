@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// screenLockCheckTimeout bounds the screen-lock check in /health
+const screenLockCheckTimeout = 2 * time.Second
+
+// screenWakeSettle is how long a woken screen gets before it is checked again
+const screenWakeSettle = 500 * time.Millisecond
+
+// screenState is what the screen-lock check found
+type screenState struct {
+	Locked  bool   `json:"locked"`           // a lock screen wants a password
+	Blanked bool   `json:"blanked"`          // a screensaver or display power saving is on, which input dismisses
+	Source  string `json:"source,omitempty"` // the tool that reported it
+}
+
+func (s screenState) String() string {
+	switch {
+	case s.Locked:
+		return "the screen is locked (" + s.Source + ")"
+	case s.Blanked:
+		return "the screensaver is on (" + s.Source + ")"
+	}
+	return "the screen is unlocked"
+}
+
+// screenLockError is returned when input would go to a lock screen or
+// screensaver instead of the browser
+type screenLockError struct {
+	state screenState
+}
+
+func (e *screenLockError) Error() string {
+	return e.state.String() + "; input would not reach the browser"
+}
+
+// macScreenLockScript reads CGSSessionScreenIsLocked from the session
+// dictionary and whether the screensaver is running
+const macScreenLockScript = `
+ObjC.import('CoreGraphics');
+ObjC.bindFunction('CGSessionCopyCurrentDictionary', ['id', []]);
+var session = ObjC.deepUnwrap($.CGSessionCopyCurrentDictionary()) || {};
+var saver = Application('System Events').processes.whose({name: 'ScreenSaverEngine'}).length > 0;
+JSON.stringify({locked: !!session.CGSSessionScreenIsLocked, blanked: saver});`
+
+// windowsScreenLockScript prints locked while the lock screen's LogonUI
+// runs, or blanked while a .scr screensaver does
+const windowsScreenLockScript = `
+if (Get-Process LogonUI -ErrorAction SilentlyContinue) { 'locked' }
+elseif (Get-Process | Where-Object { $_.Path -like '*.scr' }) { 'blanked' }
+else { 'unlocked' }`
+
+// detectScreenLock reports whether the screen is locked or blanked. known
+// is false when no tool on this machine can tell.
+func detectScreenLock(ctx context.Context) (state screenState, known bool, err error) {
+	switch runtime.GOOS {
+	case "linux":
+		return linuxScreenLock(ctx)
+	case "darwin":
+		output, err := newCommand(ctx, "osascript", "-l", "JavaScript", "-e", macScreenLockScript).Output()
+		if err != nil {
+			return state, false, fmt.Errorf("osascript failed: %v", err)
+		}
+		var s struct {
+			Locked  bool `json:"locked"`
+			Blanked bool `json:"blanked"`
+		}
+		if err := json.Unmarshal(output, &s); err != nil {
+			return state, false, fmt.Errorf("unexpected osascript output %q", strings.TrimSpace(string(output)))
+		}
+		return screenState{Locked: s.Locked, Blanked: s.Blanked, Source: "CGSessionCopyCurrentDictionary"}, true, nil
+	case "windows":
+		output, err := newCommand(ctx, "powershell", "-Command", windowsScreenLockScript).Output()
+		if err != nil {
+			return state, false, fmt.Errorf("powershell failed: %v", err)
+		}
+		out := strings.TrimSpace(string(output))
+		return screenState{Locked: out == "locked", Blanked: out == "blanked", Source: "LogonUI"}, true, nil
+	}
+	return state, false, fmt.Errorf("unsupported operating system: %s", runtime.GOOS)
+}
+
+// linuxScreenLock asks, in order, logind's LockedHint, GNOME's and
+// xscreensaver's screensavers, and the X server's display power state,
+// stopping at the first that finds the screen locked or blanked
+func linuxScreenLock(ctx context.Context) (screenState, bool, error) {
+	known := false
+	if haveTool("loginctl") {
+		session := os.Getenv("XDG_SESSION_ID")
+		if session == "" {
+			session = "auto"
+		}
+		if output, err := newCommand(ctx, "loginctl", "show-session", session, "-p", "LockedHint", "--value").Output(); err == nil {
+			known = true
+			if strings.TrimSpace(string(output)) == "yes" {
+				return screenState{Locked: true, Source: "loginctl"}, true, nil
+			}
+		}
+	}
+	if haveTool("gnome-screensaver-command") {
+		if output, err := newCommand(ctx, "gnome-screensaver-command", "-q").Output(); err == nil {
+			known = true
+			// GNOME locks the screen whenever its screensaver is on
+			if strings.Contains(string(output), "is active") {
+				return screenState{Locked: true, Source: "gnome-screensaver"}, true, nil
+			}
+		}
+	}
+	if haveTool("xscreensaver-command") {
+		if output, err := newCommand(ctx, "xscreensaver-command", "-time").Output(); err == nil {
+			known = true
+			switch out := string(output); {
+			case strings.Contains(out, "screen locked"):
+				return screenState{Locked: true, Source: "xscreensaver"}, true, nil
+			case strings.Contains(out, "screen blanked"):
+				return screenState{Blanked: true, Source: "xscreensaver"}, true, nil
+			}
+		}
+	}
+	if haveTool("xset") {
+		if output, err := newCommand(ctx, "xset", "q").Output(); err == nil {
+			known = true
+			for _, mode := range []string{"Monitor is Off", "Monitor is in Standby", "Monitor is in Suspend"} {
+				if strings.Contains(string(output), mode) {
+					return screenState{Blanked: true, Source: "xset"}, true, nil
+				}
+			}
+		}
+	}
+	return screenState{}, known, nil
+}
+
+// wakeScreen dismisses a screensaver and turns the display back on. It
+// can't get past a lock screen's password.
+func wakeScreen(ctx context.Context) error {
+	switch runtime.GOOS {
+	case "linux":
+		var cmds [][]string
+		if haveTool("xscreensaver-command") {
+			cmds = append(cmds, []string{"xscreensaver-command", "-deactivate"})
+		}
+		if haveTool("xdg-screensaver") {
+			cmds = append(cmds, []string{"xdg-screensaver", "reset"})
+		}
+		if haveTool("xset") {
+			cmds = append(cmds, []string{"xset", "s", "reset"}, []string{"xset", "dpms", "force", "on"})
+		}
+		if len(cmds) == 0 {
+			return fmt.Errorf("no tool to wake the screen; install xdg-utils or xset")
+		}
+		for _, args := range cmds {
+			if err := newCommand(ctx, args[0], args[1:]...).Run(); err != nil {
+				return fmt.Errorf("%s failed: %v", args[0], err)
+			}
+		}
+		return nil
+	case "darwin":
+		// caffeinate -u declares the user active, which wakes the display
+		if err := newCommand(ctx, "caffeinate", "-u", "-t", "1").Run(); err != nil {
+			return fmt.Errorf("caffeinate failed: %v", err)
+		}
+		return nil
+	case "windows":
+		// F15 exists on no keyboard, so it ends the screensaver without typing anything
+		if err := newCommand(ctx, "powershell", "-Command", `(New-Object -ComObject WScript.Shell).SendKeys('{F15}')`).Run(); err != nil {
+			return fmt.Errorf("powershell failed: %v", err)
+		}
+		return nil
+	}
+	return fmt.Errorf("unsupported operating system: %s", runtime.GOOS)
+}
+
+// checkScreenLock returns a *screenLockError if the screen is locked or,
+// unless -wake-screen wakes it, blanked. A screen whose state can't be read
+// is logged rather than blocking the action that asked.
+func (c *Controller) checkScreenLock(ctx context.Context) error {
+	state, _, err := detectScreenLock(ctx)
+	if err != nil {
+		log.Printf("check-screen-lock: %v", err)
+		return nil
+	}
+	if state.Blanked && c.cfg.WakeScreen {
+		if err := wakeScreen(ctx); err != nil {
+			log.Printf("wake-screen: %v", err)
+		} else {
+			select {
+			case <-time.After(screenWakeSettle):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			if state, _, err = detectScreenLock(ctx); err != nil {
+				log.Printf("check-screen-lock: %v", err)
+				return nil
+			}
+		}
+	}
+	if state.Locked || state.Blanked {
+		return &screenLockError{state: state}
+	}
+	return nil
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// rect is a screen rectangle in pixels
+type rect struct {
+	X      int `json:"x"`
+	Y      int `json:"y"`
+	Width  int `json:"width"`
+	Height int `json:"height"`
+}
+
+func (r rect) empty() bool {
+	return r.Width <= 0 || r.Height <= 0
+}
+
+func (r rect) String() string {
+	return fmt.Sprintf("%d,%d,%d,%d", r.X, r.Y, r.Width, r.Height)
+}
+
+// parseRect parses an "x,y,width,height" string; an empty string is the empty rect
+func parseRect(s string) (rect, error) {
+	if s == "" {
+		return rect{}, nil
+	}
+	parts := strings.Split(s, ",")
+	if len(parts) != 4 {
+		return rect{}, fmt.Errorf("expected x,y,width,height, got %q", s)
+	}
+	var v [4]int
+	for i, p := range parts {
+		n, err := strconv.Atoi(strings.TrimSpace(p))
+		if err != nil {
+			return rect{}, fmt.Errorf("invalid number %q in %q", p, s)
+		}
+		v[i] = n
+	}
+	return rect{X: v[0], Y: v[1], Width: v[2], Height: v[3]}, nil
+}
+
+// parsePoint parses an "x,y" string
+func parsePoint(s string) (point, error) {
+	x, y, ok := strings.Cut(s, ",")
+	if !ok {
+		return point{}, fmt.Errorf("expected x,y, got %q", s)
+	}
+	px, err := strconv.Atoi(strings.TrimSpace(x))
+	if err != nil {
+		return point{}, fmt.Errorf("invalid number %q in %q", x, s)
+	}
+	py, err := strconv.Atoi(strings.TrimSpace(y))
+	if err != nil {
+		return point{}, fmt.Errorf("invalid number %q in %q", y, s)
+	}
+	return point{X: px, Y: py}, nil
+}
+
+// parseHexColor parses a "#rrggbb" color
+func parseHexColor(s string) (color.RGBA, error) {
+	s = strings.TrimPrefix(s, "#")
+	if len(s) != 6 {
+		return color.RGBA{}, fmt.Errorf("expected #rrggbb, got %q", s)
+	}
+	v, err := strconv.ParseUint(s, 16, 32)
+	if err != nil {
+		return color.RGBA{}, fmt.Errorf("expected #rrggbb, got %q", s)
+	}
+	return color.RGBA{R: uint8(v >> 16), G: uint8(v >> 8), B: uint8(v), A: 0xff}, nil
+}
+
+// averageColor returns the mean color of region r of a PNG image
+func averageColor(data []byte, r rect) (color.RGBA, error) {
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		return color.RGBA{}, fmt.Errorf("failed to decode screenshot: %v", err)
+	}
+	region := image.Rect(r.X, r.Y, r.X+r.Width, r.Y+r.Height).Intersect(img.Bounds())
+	if region.Empty() {
+		return color.RGBA{}, fmt.Errorf("region %v is outside the %dx%d screen", r, img.Bounds().Dx(), img.Bounds().Dy())
+	}
+	return meanColor(img, region), nil
+}
+
+// meanColor returns the mean color of a non-empty region of img
+func meanColor(img image.Image, region image.Rectangle) color.RGBA {
+	var sr, sg, sb, n uint64
+	for y := region.Min.Y; y < region.Max.Y; y++ {
+		for x := region.Min.X; x < region.Max.X; x++ {
+			cr, cg, cb, _ := img.At(x, y).RGBA()
+			sr += uint64(cr >> 8)
+			sg += uint64(cg >> 8)
+			sb += uint64(cb >> 8)
+			n++
+		}
+	}
+	return color.RGBA{R: uint8(sr / n), G: uint8(sg / n), B: uint8(sb / n), A: 0xff}
+}
+
+// colorsClose reports whether each channel of a and b differs by at most tolerance
+func colorsClose(a, b color.RGBA, tolerance int) bool {
+	diff := func(x, y uint8) int {
+		d := int(x) - int(y)
+		if d < 0 {
+			return -d
+		}
+		return d
+	}
+	return diff(a.R, b.R) <= tolerance && diff(a.G, b.G) <= tolerance && diff(a.B, b.B) <= tolerance
+}
+
+// changedFraction returns the fraction of pixels in region r that differ
+// by more than tolerance on any channel between two PNG screenshots
+func changedFraction(before, after []byte, r rect, tolerance int) (float64, error) {
+	changed, total, err := changedPixels(before, after, r, tolerance)
+	if err != nil {
+		return 0, err
+	}
+	return float64(changed) / float64(total), nil
+}
+
+// changedPixels counts the pixels in region r that differ by more than
+// tolerance on any channel between two PNG screenshots, out of total
+func changedPixels(before, after []byte, r rect, tolerance int) (changed, total int, err error) {
+	a, err := png.Decode(bytes.NewReader(before))
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to decode screenshot: %v", err)
+	}
+	b, err := png.Decode(bytes.NewReader(after))
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to decode screenshot: %v", err)
+	}
+	region := image.Rect(r.X, r.Y, r.X+r.Width, r.Y+r.Height).Intersect(a.Bounds()).Intersect(b.Bounds())
+	if region.Empty() {
+		return 0, 0, fmt.Errorf("region %v is outside the %dx%d screen", r, a.Bounds().Dx(), a.Bounds().Dy())
+	}
+	for y := region.Min.Y; y < region.Max.Y; y++ {
+		for x := region.Min.X; x < region.Max.X; x++ {
+			ca := color.RGBAModel.Convert(a.At(x, y)).(color.RGBA)
+			cb := color.RGBAModel.Convert(b.At(x, y)).(color.RGBA)
+			if !colorsClose(ca, cb, tolerance) {
+				changed++
+			}
+			total++
+		}
+	}
+	return changed, total, nil
+}
+
+// drawCrosshair returns a PNG image with a red crosshair drawn at p
+func drawCrosshair(data []byte, p point) ([]byte, error) {
+	src, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode screenshot: %v", err)
+	}
+	img := image.NewRGBA(src.Bounds())
+	draw.Draw(img, img.Bounds(), src, src.Bounds().Min, draw.Src)
+
+	const arm, gap, thickness = 16, 3, 1
+	red := color.RGBA{R: 0xff, A: 0xff}
+	for d := gap; d <= arm; d++ {
+		for t := -thickness; t <= thickness; t++ {
+			img.Set(p.X+d, p.Y+t, red)
+			img.Set(p.X-d, p.Y+t, red)
+			img.Set(p.X+t, p.Y+d, red)
+			img.Set(p.X+t, p.Y-d, red)
+		}
+	}
+	img.Set(p.X, p.Y, red)
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// captureScreenNow takes a PNG screenshot of the whole screen, or of
+// the -monitor when it is set, bypassing the capture cache
+func captureScreenNow(ctx context.Context) ([]byte, error) {
+	monitor := activeMonitor(ctx)
+	dir, err := os.MkdirTemp("", "browser-controller-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "screen.png")
+
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "linux":
+		tool := linuxScreenshot(ctx)
+		cmd = newCommand(ctx, tool.name, tool.command(file)...)
+	case "darwin":
+		args := []string{"-x", "-t", "png"}
+		if monitor != nil {
+			// screencapture numbers displays from 1
+			args = append(args, "-D", strconv.Itoa(monitor.Index+1))
+		}
+		cmd = newCommand(ctx, "screencapture", append(args, file)...)
+	case "windows":
+		bounds := "[System.Windows.Forms.SystemInformation]::VirtualScreen"
+		if m := monitor; m != nil {
+			bounds = fmt.Sprintf("New-Object System.Drawing.Rectangle %d, %d, %d, %d", m.Bounds.X, m.Bounds.Y, m.Bounds.Width, m.Bounds.Height)
+		}
+		cmd = newCommand(ctx, "powershell", "-Command", fmt.Sprintf(`
+			Add-Type -AssemblyName System.Windows.Forms,System.Drawing
+			$bounds = %s
+			$bitmap = New-Object System.Drawing.Bitmap $bounds.Width, $bounds.Height
+			$graphics = [System.Drawing.Graphics]::FromImage($bitmap)
+			$graphics.CopyFromScreen($bounds.Left, $bounds.Top, 0, 0, $bitmap.Size)
+			$bitmap.Save('%s', [System.Drawing.Imaging.ImageFormat]::Png)`, bounds, strings.ReplaceAll(file, "'", "''")))
+	default:
+		return nil, fmt.Errorf("unsupported operating system: %s", runtime.GOOS)
+	}
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("failed to capture screen: %v %s", err, strings.TrimSpace(string(output)))
+	}
+	data, err := os.ReadFile(file)
+	// The Linux tools capture the root window, which spans every monitor
+	if err == nil && runtime.GOOS == "linux" && monitor != nil {
+		return cropPNG(data, monitor.Bounds)
+	}
+	return data, err
+}
+
+// cropPNG returns the region r of a PNG image, re-encoded as PNG
+func cropPNG(data []byte, r rect) ([]byte, error) {
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode screenshot: %v", err)
+	}
+	region := image.Rect(r.X, r.Y, r.X+r.Width, r.Y+r.Height).Intersect(img.Bounds())
+	if region.Empty() {
+		return nil, fmt.Errorf("region %v is outside the %dx%d screen", r, img.Bounds().Dx(), img.Bounds().Dy())
+	}
+	sub, ok := img.(interface {
+		SubImage(image.Rectangle) image.Image
+	})
+	if !ok {
+		return nil, fmt.Errorf("screenshot image type %T cannot be cropped", img)
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, sub.SubImage(region)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
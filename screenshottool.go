@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// screenshotFilePlaceholder marks where a screenshot command takes its output file
+const screenshotFilePlaceholder = "{file}"
+
+// screenshotTool is a Linux command that writes a full-screen PNG
+type screenshotTool struct {
+	name string
+	args []string // may contain screenshotFilePlaceholder
+}
+
+// command returns the arguments to capture the screen to file
+func (t screenshotTool) command(file string) []string {
+	args := make([]string, len(t.args))
+	for i, arg := range t.args {
+		args[i] = strings.ReplaceAll(arg, screenshotFilePlaceholder, file)
+	}
+	return args
+}
+
+// screenshotTools are the supported Linux screenshot tools by name
+var screenshotTools = map[string]screenshotTool{
+	"import":           {name: "import", args: []string{"-window", "root", screenshotFilePlaceholder}},
+	"scrot":            {name: "scrot", args: []string{screenshotFilePlaceholder}},
+	"maim":             {name: "maim", args: []string{screenshotFilePlaceholder}},
+	"gnome-screenshot": {name: "gnome-screenshot", args: []string{"-f", screenshotFilePlaceholder}},
+	"grim":             {name: "grim", args: []string{screenshotFilePlaceholder}},
+}
+
+// parseScreenshotCommand parses a custom screenshot command line. The output
+// file goes where {file} appears, or at the end if it doesn't.
+func parseScreenshotCommand(s string) (screenshotTool, error) {
+	args, err := splitArgs(s)
+	if err != nil {
+		return screenshotTool{}, err
+	}
+	if len(args) == 0 {
+		return screenshotTool{}, fmt.Errorf("empty command")
+	}
+	tool := screenshotTool{name: args[0], args: args[1:]}
+	if !strings.Contains(s, screenshotFilePlaceholder) {
+		tool.args = append(tool.args, screenshotFilePlaceholder)
+	}
+	return tool, nil
+}
+
+// selectScreenshotTool picks the first installed tool in order, trying grim
+// first on Wayland where the X tools capture only a black screen
+func selectScreenshotTool(order []string) (screenshotTool, error) {
+	if os.Getenv("XDG_SESSION_TYPE") == "wayland" {
+		preferred := []string{"grim"}
+		for _, name := range order {
+			if name != "grim" {
+				preferred = append(preferred, name)
+			}
+		}
+		order = preferred
+	}
+
+	var failures []string
+	for _, name := range order {
+		tool, ok := screenshotTools[name]
+		if !ok {
+			failures = append(failures, fmt.Sprintf("%s: unknown tool", name))
+			continue
+		}
+		if _, err := exec.LookPath(name); err != nil {
+			failures = append(failures, fmt.Sprintf("%s: not installed", name))
+			continue
+		}
+		return tool, nil
+	}
+	return screenshotTool{}, fmt.Errorf("no usable screenshot tool (%s)", strings.Join(failures, "; "))
+}
+
+// chooseScreenshotTool selects the screenshot tool from -screenshot-command or
+// -screenshot-tools and logs the choice. If none is installed it keeps
+// import so errors name the expected tool.
+func (c *Controller) chooseScreenshotTool() {
+	if c.cfg.ScreenshotCommand.name != "" {
+		c.dev.screenshot = c.cfg.ScreenshotCommand
+		log.Printf("using %s for screenshots", c.dev.screenshot.name)
+		return
+	}
+	tool, err := selectScreenshotTool(c.cfg.ScreenshotTools)
+	if err != nil {
+		log.Printf("warning: %v; falling back to import", err)
+		return
+	}
+	c.dev.screenshot = tool
+	log.Printf("using %s for screenshots", tool.name)
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"runtime"
+	"time"
+)
+
+// selfTestResult is the outcome of one startup capability check
+type selfTestResult struct {
+	Name     string
+	Required bool
+	Err      error
+	Skipped  string // reason the check did not run, if it was skipped
+}
+
+// runSelfTest exercises each capability the command path depends on, in order
+func (c *Controller) runSelfTest() []selfTestResult {
+	var results []selfTestResult
+	check := func(name string, required bool, fn func(ctx context.Context) error) {
+		ctx, cancel := context.WithTimeout(c.baseContext(), 10*time.Second)
+		defer cancel()
+		results = append(results, selfTestResult{Name: name, Required: required, Err: fn(ctx)})
+	}
+	skip := func(name, reason string) {
+		results = append(results, selfTestResult{Name: name, Skipped: reason})
+	}
+
+	for _, tool := range c.requiredTools() {
+		check("tool "+tool, true, func(context.Context) error {
+			_, err := exec.LookPath(tool)
+			return err
+		})
+	}
+
+	if runtime.GOOS == "linux" {
+		check("display", true, func(context.Context) error {
+			if c.cfg.Display == "" && os.Getenv("DISPLAY") == "" {
+				return fmt.Errorf("DISPLAY is not set")
+			}
+			return nil
+		})
+	}
+
+	if firefoxRunning(c.baseContext()) {
+		check("focus", true, focusFirefox)
+		check("title", false, func(ctx context.Context) error {
+			title, err := firefoxWindowTitle(ctx)
+			if err == nil && title == "" {
+				return fmt.Errorf("window title is empty")
+			}
+			return err
+		})
+		check("key", true, sendNoopKey)
+	} else {
+		for _, name := range []string{"focus", "title", "key"} {
+			skip(name, "Firefox is not running")
+		}
+	}
+
+	if c.marionette != nil {
+		check("marionette", true, func(ctx context.Context) error {
+			_, err := c.marionette.CurrentURL(ctx)
+			return err
+		})
+	}
+
+	return results
+}
+
+// logSelfTest logs each result and reports whether any required check failed
+func logSelfTest(results []selfTestResult) bool {
+	failed := false
+	for _, res := range results {
+		switch {
+		case res.Skipped != "":
+			log.Printf("self-test %-16s SKIP (%s)", res.Name, res.Skipped)
+		case res.Err == nil:
+			log.Printf("self-test %-16s PASS", res.Name)
+		case res.Required:
+			failed = true
+			log.Printf("self-test %-16s FAIL: %v", res.Name, res.Err)
+		default:
+			log.Printf("self-test %-16s WARN: %v", res.Name, res.Err)
+		}
+	}
+	return failed
+}
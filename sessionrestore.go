@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// After a crash Firefox can open on about:sessionrestore instead of the
+// requested page. Its window title is "Restore Session" in English builds.
+const (
+	sessionRestoreURL   = "about:sessionrestore"
+	sessionRestoreTitle = "Restore Session"
+)
+
+// sessionRestorePref stops Firefox offering to restore the session after a crash
+const sessionRestorePref = `user_pref("browser.sessionstore.resume_from_crash", false);`
+
+// preventSessionRestore adds sessionRestorePref to the user.js of the
+// profile in dir, keeping the prefs already there
+func preventSessionRestore(dir string) error {
+	path := filepath.Join(dir, "user.js")
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read %s: %v", path, err)
+	}
+	if bytes.Contains(data, []byte(sessionRestorePref)) {
+		return nil
+	}
+	if len(data) > 0 && data[len(data)-1] != '\n' {
+		data = append(data, '\n')
+	}
+	data = append(data, sessionRestorePref+"\n"...)
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write %s: %v", path, err)
+	}
+	return nil
+}
+
+// sessionRestoreShown reports whether Firefox is showing the restore page,
+// from the current tab's URL with the marionette backend or otherwise from
+// the window titles. Chromium browsers restore tabs without a page of their own.
+func (c *Controller) sessionRestoreShown(ctx context.Context) bool {
+	if targetBrowser.chromium {
+		return false
+	}
+	if c.marionette != nil {
+		if current, err := c.marionette.CurrentURL(ctx); err == nil {
+			return strings.HasPrefix(current, sessionRestoreURL)
+		}
+	}
+	windows, err := listBrowserWindows(ctx)
+	if err != nil {
+		return false
+	}
+	for _, win := range windows {
+		if win.Browser == "firefox" && strings.Contains(win.Title, sessionRestoreTitle) {
+			return true
+		}
+	}
+	return false
+}
+
+// dismissSessionRestore starts a new session when Firefox opened on the
+// restore page, by navigating that tab to url (or about:blank), so the
+// first navigation isn't typed into the restore page. It only logs failures:
+// navigation afterwards reports its own errors.
+func (c *Controller) dismissSessionRestore(ctx context.Context, url string) {
+	if !c.sessionRestoreShown(ctx) {
+		return
+	}
+	if url == "" {
+		url = "about:blank"
+	}
+	log.Printf("Firefox opened on the session restore page; starting a new session on %s", redact(url))
+
+	var err error
+	if c.marionette != nil {
+		err = c.marionette.Navigate(ctx, url)
+	}
+	if c.marionette == nil || err != nil {
+		err = c.updateFirefoxURL(ctx, url, "")
+	}
+	if err != nil {
+		log.Printf("warning: failed to leave the session restore page: %v", err)
+		return
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for c.sessionRestoreShown(ctx) {
+		if time.Now().After(deadline) {
+			log.Printf("warning: the session restore page is still shown")
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(250 * time.Millisecond):
+		}
+	}
+}
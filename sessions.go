@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// maxSessionPeek bounds how much of a request body is read to find its session field
+const maxSessionPeek = 1 << 20
+
+var sessionNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// sessionSpec is one -sessions entry
+type sessionSpec struct {
+	Name    string
+	Display string // X display for the session's browser; empty uses -display
+}
+
+// SessionInfo describes one session in /sessions
+type SessionInfo struct {
+	Name           string `json:"name"`
+	Display        string `json:"display,omitempty"`
+	ProfileDir     string `json:"profile_dir"`
+	MarionetteAddr string `json:"marionette_addr,omitempty"`
+	FirefoxRunning bool   `json:"firefox_running"`
+	Calibrated     bool   `json:"calibrated"`
+	Waiting        int    `json:"waiting"`
+	InFlight       string `json:"in_flight,omitempty"`
+}
+
+// SessionsResponse is the Response for /sessions
+type SessionsResponse struct {
+	Response
+	Sessions []SessionInfo `json:"sessions"`
+}
+
+// parseSessions parses -sessions: comma-separated names, each optionally
+// followed by @display, such as "alpha@:1,beta@:2"
+func parseSessions(s string) ([]sessionSpec, error) {
+	var specs []sessionSpec
+	seen := map[string]bool{}
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, display, _ := strings.Cut(part, "@")
+		if !sessionNamePattern.MatchString(name) {
+			return nil, fmt.Errorf("session name %q must contain only letters, digits, '-' and '_'", name)
+		}
+		if display != "" && !displayPattern.MatchString(display) {
+			return nil, fmt.Errorf("invalid display %q for session %s", display, name)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("duplicate session %q", name)
+		}
+		seen[name] = true
+		specs = append(specs, sessionSpec{Name: name, Display: display})
+	}
+	return specs, nil
+}
+
+// sessionConfig derives the configuration of the i-th session from the
+// server's: its own profile directory under -profile-dir (or "sessions"),
+// its display, and with the marionette backend its own Marionette port
+func sessionConfig(cfg *Config, i int, spec sessionSpec) (*Config, error) {
+	sc := *cfg
+	sc.Sessions = nil
+	base := cfg.ProfileDir
+	if base == "" {
+		base = "sessions"
+	}
+	dir, err := filepath.Abs(filepath.Join(base, spec.Name))
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	sc.ProfileDir = dir
+	if spec.Display != "" {
+		sc.Display = spec.Display
+	}
+	// Each session's board is in its own place, so it gets its own calibration file
+	if cfg.CalibrationFile != "" {
+		ext := filepath.Ext(cfg.CalibrationFile)
+		sc.CalibrationFile = strings.TrimSuffix(cfg.CalibrationFile, ext) + "." + spec.Name + ext
+	}
+
+	if cfg.Backend == backendMarionette {
+		host, port, err := net.SplitHostPort(cfg.MarionetteAddr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -marionette-addr: %v", err)
+		}
+		n, err := strconv.Atoi(port)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -marionette-addr port %q", port)
+		}
+		n += i
+		sc.MarionetteAddr = net.JoinHostPort(host, strconv.Itoa(n))
+		// Firefox reads the Marionette port from the profile
+		pref := fmt.Sprintf("user_pref(\"marionette.port\", %d);\n", n)
+		if err := os.WriteFile(filepath.Join(dir, "user.js"), []byte(pref), 0o600); err != nil {
+			return nil, err
+		}
+	}
+	return &sc, nil
+}
+
+// sessionRouter sends each request to the controller of its session, named
+// by a /s/<name>/ path prefix, a "session" query parameter or a "session"
+// field in the JSON body. Requests naming no session go to the first one.
+type sessionRouter struct {
+	names    []string
+	sessions map[string]*Controller
+	list     http.Handler
+}
+
+func newSessionRouter(cfg *Config) (*sessionRouter, error) {
+	sr := &sessionRouter{sessions: make(map[string]*Controller)}
+	for i, spec := range cfg.Sessions {
+		sc, err := sessionConfig(cfg, i, spec)
+		if err != nil {
+			return nil, fmt.Errorf("session %s: %v", spec.Name, err)
+		}
+		sr.names = append(sr.names, spec.Name)
+		sr.sessions[spec.Name] = newController(sc)
+	}
+	first := sr.sessions[sr.names[0]]
+	sr.list = first.withAuth(http.HandlerFunc(sr.handleSessions))
+	return sr, nil
+}
+
+// controllers returns the session controllers in -sessions order
+func (sr *sessionRouter) controllers() []*Controller {
+	cs := make([]*Controller, len(sr.names))
+	for i, name := range sr.names {
+		cs[i] = sr.sessions[name]
+	}
+	return cs
+}
+
+func (sr *sessionRouter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/sessions" {
+		sr.list.ServeHTTP(w, r)
+		return
+	}
+
+	name := r.URL.Query().Get("session")
+	if rest, ok := strings.CutPrefix(r.URL.Path, "/s/"); ok {
+		name, rest, _ = strings.Cut(rest, "/")
+		r = r.Clone(r.Context())
+		r.URL.Path = "/" + rest
+		r.URL.RawPath = ""
+	} else if name == "" && r.Method == http.MethodPost && r.Body != nil {
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxSessionPeek))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "Failed to read request body")
+			return
+		}
+		r.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), r.Body))
+		var field struct {
+			Session string `json:"session"`
+		}
+		json.Unmarshal(body, &field)
+		name = field.Session
+	}
+	if name == "" {
+		name = sr.names[0]
+	}
+
+	c, ok := sr.sessions[name]
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("Unknown session %q; sessions: %s", name, strings.Join(sr.names, ", ")))
+		return
+	}
+	c.mux.ServeHTTP(w, r)
+}
+
+// handleSessions lists the sessions with what each is doing
+func (sr *sessionRouter) handleSessions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "Only GET method is allowed")
+		return
+	}
+
+	infos := make([]SessionInfo, 0, len(sr.names))
+	for _, name := range sr.names {
+		c := sr.sessions[name]
+		info := SessionInfo{
+			Name:           name,
+			Display:        c.cfg.Display,
+			ProfileDir:     c.cfg.ProfileDir,
+			FirefoxRunning: firefoxRunning(c.baseContext()),
+		}
+		if c.marionette != nil {
+			info.MarionetteAddr = c.cfg.MarionetteAddr
+		}
+		_, info.Calibrated = c.calibration()
+		c.queue.mu.Lock()
+		info.Waiting, info.InFlight = c.queue.waiting, c.queue.current
+		c.queue.mu.Unlock()
+		infos = append(infos, info)
+	}
+
+	writeJSON(w, http.StatusOK, SessionsResponse{
+		Response: Response{
+			Success: true,
+			Message: fmt.Sprintf("%d sessions", len(infos)),
+		},
+		Sessions: infos,
+	})
+}
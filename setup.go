@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// SetupRequest represents the JSON payload for /setup
+type SetupRequest struct {
+	URL     string `json:"url"`
+	Site    string `json:"site,omitempty"`    // site profile name; defaults to the one serving url
+	Profile string `json:"profile,omitempty"` // as for /open
+	// PlayingColor is the side the controller plays in this game, white or
+	// black; it replaces -playing-color until the next /setup that gives one
+	PlayingColor string `json:"playing_color,omitempty"`
+}
+
+// SetupResponse is the Response for /setup
+type SetupResponse struct {
+	Response
+	Site        string          `json:"site,omitempty"`
+	Calibration *Calibration    `json:"calibration,omitempty"`
+	Open        json.RawMessage `json:"open,omitempty"` // the /open response, when navigation failed
+	// Warning is set when the board's orientation contradicts the playing color
+	Warning string `json:"warning,omitempty"`
+}
+
+// setupBoardPoll is how often /setup looks for the board after navigating
+const setupBoardPoll = 250 * time.Millisecond
+
+// handleSetup opens a game URL, waits for the site's board to appear and
+// calibrates from it, orientation included, all under one hold of the
+// command mutex. It replaces the usual /open, wait, /auto-calibrate start.
+func (c *Controller) handleSetup(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "Only POST method is allowed")
+		return
+	}
+	if c.marionette == nil {
+		writeError(w, http.StatusNotImplemented, "Setup requires the marionette backend to calibrate from the board")
+		return
+	}
+
+	var req SetupRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid JSON payload")
+		return
+	}
+	if req.URL == "" {
+		writeError(w, http.StatusBadRequest, "URL cannot be empty")
+		return
+	}
+	if err := checkPlayingColor(req.PlayingColor); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("Invalid playing_color %q: %v", req.PlayingColor, err))
+		return
+	}
+	site := c.siteFor(req.URL)
+	if req.Site != "" {
+		if site = siteByName(req.Site); site == nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("Unknown site %q", req.Site))
+			return
+		}
+	}
+	if site == nil || site.BoardSelector == "" {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("Unsupported site: %s", req.URL))
+		return
+	}
+
+	if req.PlayingColor != "" {
+		c.state.setPlayingColor(req.PlayingColor)
+	}
+
+	var open *bufferedResponse
+	var cal *Calibration
+	err := c.command(r, func() error {
+		body, _ := json.Marshal(URLRequest{URL: req.URL, Profile: req.Profile})
+		var err error
+		if open, err = c.dispatchLocked(r.Context(), "/open", body); err != nil {
+			return err
+		}
+		if open.status < 200 || open.status > 299 {
+			return nil
+		}
+
+		// The board is rendered some time after the page loads
+		defer timeStep(r.Context(), "board")()
+		for {
+			found, err := c.readBoardCalibration(r.Context(), site)
+			if err != nil {
+				return err
+			}
+			if found != nil && found.validate() == nil {
+				cal = found
+				break
+			}
+			select {
+			case <-time.After(setupBoardPoll):
+			case <-r.Context().Done():
+				return fmt.Errorf("no usable %s board appeared: %v", site.Name, r.Context().Err())
+			}
+		}
+		c.state.setCalibration(*cal)
+		c.saveCalibration()
+		return nil
+	})
+	if err != nil {
+		writeCommandError(w, err, fmt.Sprintf("Setup failed: %v", err))
+		return
+	}
+	if cal == nil {
+		var failed Response
+		json.Unmarshal(open.body.Bytes(), &failed)
+		writeJSON(w, open.status, SetupResponse{
+			Response: Response{Success: false, Message: "Setup failed to open the URL: " + failed.Message, ErrorCode: failed.ErrorCode},
+			Site:     site.Name,
+			Open:     json.RawMessage(open.body.Bytes()),
+		})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, SetupResponse{
+		Response: Response{
+			Success: true,
+			Message: fmt.Sprintf("Opened %s and calibrated from the %s board (%s at the bottom)", req.URL, site.Name, cal.Orientation),
+		},
+		Site:        site.Name,
+		Calibration: cal,
+		Warning:     c.orientationWarning(site.Name, cal),
+	})
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// jobCancelGrace is how long cancelled async jobs get to return at shutdown
+const jobCancelGrace = 2 * time.Second
+
+// activeRequests counts the HTTP requests being served, for the shutdown log
+var activeRequests atomic.Int64
+
+// countRequests keeps activeRequests up to date
+func countRequests(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		activeRequests.Add(1)
+		defer activeRequests.Add(-1)
+		h.ServeHTTP(w, r)
+	})
+}
+
+// jobTracker keeps the async jobs running in the background, so shutdown
+// can wait for them and cancel those that outlast -shutdown-timeout
+type jobTracker struct {
+	mu      sync.Mutex
+	wg      sync.WaitGroup
+	cancels map[string]context.CancelFunc
+	started int // jobs ever started
+}
+
+// start records a job that cancel stops
+func (t *jobTracker) start(id string, cancel context.CancelFunc) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.cancels == nil {
+		t.cancels = make(map[string]context.CancelFunc)
+	}
+	t.cancels[id] = cancel
+	t.started++
+	t.wg.Add(1)
+}
+
+// done records that a job finished
+func (t *jobTracker) done(id string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.cancels, id)
+	t.wg.Done()
+}
+
+// counts returns the number of jobs not yet finished and ever started
+func (t *jobTracker) counts() (running, started int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.cancels), t.started
+}
+
+// cancelAll cancels every running job, returning how many there were
+func (t *jobTracker) cancelAll() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, cancel := range t.cancels {
+		cancel()
+	}
+	return len(t.cancels)
+}
+
+// wait waits for every job to finish, reporting false if ctx ends first
+func (t *jobTracker) wait(ctx context.Context) bool {
+	finished := make(chan struct{})
+	go func() {
+		t.wg.Wait()
+		close(finished)
+	}()
+	select {
+	case <-finished:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// shutdown stops srv within timeout, in order: event streams are closed
+// first, as they never end by themselves; then the server stops accepting
+// connections while the requests in flight, including those queued for the
+// command mutex, finish; then async jobs get what is left of the timeout.
+// Whatever is still running at the deadline is cancelled through its
+// context, and the log reports what was drained and what was cancelled.
+func shutdown(srv *http.Server, controllers []*Controller, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	streams, queued, jobs, startedBefore := 0, 0, 0, 0
+	for _, c := range controllers {
+		streams += c.events.closeStreams()
+		c.queue.mu.Lock()
+		queued += c.queue.waiting
+		c.queue.mu.Unlock()
+		running, started := c.jobs.counts()
+		jobs += running
+		startedBefore += started
+	}
+	// The closed streams are still counted until their handlers return
+	requests := int(activeRequests.Load()) - streams
+	log.Printf("shutting down: waiting up to %v for %d requests (%d queued for the command mutex) and %d async jobs; closed %d event streams",
+		timeout, requests, queued, jobs, streams)
+
+	cancelledRequests := 0
+	if err := srv.Shutdown(ctx); err != nil {
+		// Closing the connections cancels the requests' contexts
+		cancelledRequests = int(activeRequests.Load())
+		srv.Close()
+	}
+
+	// Requests still being drained may have started jobs of their own
+	for _, c := range controllers {
+		_, started := c.jobs.counts()
+		jobs += started
+	}
+	jobs -= startedBefore
+
+	cancelledJobs := 0
+	for _, c := range controllers {
+		if !c.jobs.wait(ctx) {
+			cancelledJobs += c.jobs.cancelAll()
+		}
+	}
+	if cancelledJobs > 0 {
+		grace, cancel := context.WithTimeout(context.Background(), jobCancelGrace)
+		defer cancel()
+		for _, c := range controllers {
+			if !c.jobs.wait(grace) {
+				running, _ := c.jobs.counts()
+				log.Printf("shutdown: %d cancelled async jobs did not return within %v", running, jobCancelGrace)
+			}
+		}
+	}
+
+	log.Printf("shutdown: drained %d requests and %d async jobs; cancelled %d requests and %d async jobs",
+		max(requests-cancelledRequests, 0), jobs-cancelledJobs, cancelledRequests, cancelledJobs)
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+)
+
+// SiteProfileInfo describes one built-in site profile for /profiles/sites
+type SiteProfileInfo struct {
+	Name  string   `json:"name"`
+	Hosts []string `json:"hosts"`
+	// Features lists the endpoints the profile has selectors or sequences
+	// for, by their /capabilities names
+	Features    []string `json:"features"`
+	ConfirmMode string   `json:"confirm_mode,omitempty"` // from -confirm-moves, if set for the site
+	MoveStyle   string   `json:"move_style,omitempty"`   // from -move-style, if set for the site
+	// PreferredMoveStyle is the profile's own move style, used when
+	// -move-style sets none
+	PreferredMoveStyle string `json:"preferred_move_style,omitempty"`
+}
+
+// SiteProfilesResponse is the Response for GET /profiles/sites
+type SiteProfilesResponse struct {
+	Response
+	Sites []SiteProfileInfo `json:"sites"`
+	// Selected is the profile chosen with POST /profiles/sites, which every
+	// page is treated as; Detected is the one serving the current page
+	Selected string `json:"selected,omitempty"`
+	Detected string `json:"detected,omitempty"`
+	URL      string `json:"url,omitempty"`
+}
+
+// SelectSiteRequest represents the JSON payload for POST /profiles/sites
+type SelectSiteRequest struct {
+	Name string `json:"name"` // empty goes back to detecting the site from the URL
+}
+
+// siteFeatures returns the capabilities a site profile supports
+func (c *Controller) siteFeatures(site *siteProfile) []string {
+	features := []string{}
+	add := func(name string, ok bool) {
+		if ok {
+			features = append(features, name)
+		}
+	}
+	add("auto_calibrate", site.BoardSelector != "")
+	add("orientation_check", site.FlippedSelector != "")
+	add("move_list", site.MoveListSelector != "")
+	add("last_move", site.LastMoveSelector != "")
+	add("square_info", site.PieceSelector != "")
+	add("dismiss_dialog", site.DialogSelector != "")
+	add("offer_response", len(site.Offers) > 0)
+	add("clock", site.WhiteClockSelector != "" && site.BlackClockSelector != "")
+	add("turn", site.WhiteTurnSelector != "" && site.BlackTurnSelector != "")
+	add("pgn", site.PGNSelector != "")
+	add("lobby", site.LobbyURL != "")
+	_, ok := c.cfg.NewGame[site.Name]
+	add("new_game", ok)
+	_, ok = c.cfg.AfterNavigate[site.Name]
+	add("after_navigate", ok)
+	sort.Strings(features)
+	return features
+}
+
+// handleSiteProfiles lists the built-in site profiles and what each
+// supports, and selects one to use in place of detecting the site from the
+// current URL, for pages whose detection is wrong
+func (c *Controller) handleSiteProfiles(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		sites := make([]SiteProfileInfo, len(siteProfiles))
+		for i, site := range siteProfiles {
+			sites[i] = SiteProfileInfo{
+				Name:               site.Name,
+				Hosts:              site.Hosts,
+				Features:           c.siteFeatures(site),
+				ConfirmMode:        c.cfg.ConfirmMoves[site.Name],
+				MoveStyle:          c.cfg.MoveStyles[site.Name],
+				PreferredMoveStyle: site.MoveStyle,
+			}
+		}
+		resp := SiteProfilesResponse{Sites: sites, Selected: c.state.siteOverride()}
+		if c.marionette != nil {
+			err := c.command(r, func() error {
+				current, err := c.marionette.CurrentURL(r.Context())
+				if err != nil {
+					return fmt.Errorf("failed to read current URL: %v", err)
+				}
+				resp.URL = current
+				if site := siteForURL(current); site != nil {
+					resp.Detected = site.Name
+				}
+				return nil
+			})
+			if err != nil {
+				writeCommandError(w, err, err.Error())
+				return
+			}
+		}
+
+		message := fmt.Sprintf("%d site profiles", len(sites))
+		switch {
+		case resp.Selected != "":
+			message += fmt.Sprintf("; %s is selected", resp.Selected)
+		case resp.Detected != "":
+			message += fmt.Sprintf("; the current page is %s", resp.Detected)
+		}
+		resp.Response = Response{Success: true, Message: message}
+		writeJSON(w, http.StatusOK, resp)
+
+	case http.MethodPost:
+		var req SelectSiteRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid JSON payload")
+			return
+		}
+		if req.Name != "" && siteByName(req.Name) == nil {
+			writeError(w, http.StatusNotFound, fmt.Sprintf("No site profile named %s; see GET /profiles/sites", req.Name))
+			return
+		}
+		c.state.setSiteOverride(req.Name)
+
+		message := fmt.Sprintf("Every page is treated as %s", req.Name)
+		if req.Name == "" {
+			message = "Sites are detected from the current URL"
+		}
+		writeJSON(w, http.StatusOK, Response{Success: true, Message: message})
+
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "Only GET and POST methods are allowed")
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// siteProfile describes how to read game state from a supported chess site
+type siteProfile struct {
+	Name  string
+	Hosts []string // the site's domain; subdomains match too
+
+	// MoveListSelector matches each move of the game in order
+	MoveListSelector string
+	// BoardSelector matches the 8x8 board element
+	BoardSelector string
+	// FlippedSelector matches an element only when the board is shown from Black's side
+	FlippedSelector string
+	// LastMoveSelector matches the highlights on the last move's two squares
+	LastMoveSelector string
+	// PieceSelector matches each piece on the board
+	PieceSelector string
+	// MoveInputSelector matches the box moves can be typed into, if the site has one
+	MoveInputSelector string
+	// MoveStyle is the move style the site takes most reliably, used when
+	// -move-style sets none; empty is drag
+	MoveStyle string
+	// DialogSelector matches the modal shown after a game ends
+	DialogSelector string
+	// ResultSelector matches the game's result once it is over, such as
+	// "1-0", and StatusSelector the text saying how it ended
+	ResultSelector string
+	StatusSelector string
+	// DialogButtons maps button names accepted by /dismiss-dialog to selectors
+	DialogButtons map[string]string
+	// Offers maps the offers accepted by /offer-response, "draw" and "rematch", to their controls
+	Offers map[string]offerControls
+	// WhiteClockSelector and BlackClockSelector match each side's clock display
+	WhiteClockSelector string
+	BlackClockSelector string
+	// WhiteTurnSelector and BlackTurnSelector match an element only while that side's clock is running
+	WhiteTurnSelector string
+	BlackTurnSelector string
+	// PGNSelector matches the field holding the game's PGN export
+	PGNSelector string
+	// PGNOpenSelectors are clicked in order to reveal the PGN field when it isn't shown
+	PGNOpenSelectors []string
+	// LobbyURL is where /reset-session leaves the browser between games
+	LobbyURL string
+}
+
+// siteProfiles are the built-in chess site profiles
+var siteProfiles = []*siteProfile{
+	{
+		Name:             "lichess",
+		Hosts:            []string{"lichess.org"},
+		MoveListSelector: "l4x kwdb, .tview2 move san",
+		BoardSelector:    "cg-board",
+		FlippedSelector:  ".cg-wrap.orientation-black",
+		LastMoveSelector: "cg-board square.last-move",
+		PieceSelector:    "cg-board piece",
+		// Shown once keyboard input is turned on in the display preferences
+		MoveInputSelector: ".keyboard-move input",
+		// Typed moves can't miss a square, and premoves still click
+		MoveStyle:      moveStyleKeyboard,
+		DialogSelector: "#modal-wrap, dialog[open]",
+		ResultSelector: ".result-wrap .result",
+		StatusSelector: ".result-wrap .status",
+		DialogButtons: map[string]string{
+			"close":  "#modal-wrap .close, dialog[open] .close-button",
+			"cancel": "#modal-wrap .cancel, dialog[open] .cancel",
+		},
+		Offers: map[string]offerControls{
+			offerDraw:    {Prompt: ".rcontrols .negotiation:not(.rematch)", Accept: ".negotiation .accept", Decline: ".negotiation .decline"},
+			offerRematch: {Prompt: ".rcontrols .rematch.glowing", Accept: ".rcontrols .rematch.glowing", Decline: ".rcontrols .rematch-decline"},
+		},
+		WhiteClockSelector: ".rclock-white .time",
+		BlackClockSelector: ".rclock-black .time",
+		WhiteTurnSelector:  ".rclock-white.running",
+		BlackTurnSelector:  ".rclock-black.running",
+		PGNSelector:        ".copyables .pgn textarea, .pgn textarea",
+		PGNOpenSelectors:   []string{".analyse__underboard__menu [data-panel=\"fen-pgn\"]"},
+		LobbyURL:           "https://lichess.org/",
+	},
+	{
+		Name:             "chess.com",
+		Hosts:            []string{"chess.com"},
+		MoveListSelector: "wc-simple-move-list .node-highlight-content, .move-list .node-highlight-content",
+		BoardSelector:    "wc-chess-board, chess-board",
+		FlippedSelector:  "wc-chess-board.flipped, chess-board.flipped",
+		LastMoveSelector: "wc-chess-board .highlight, chess-board .highlight",
+		PieceSelector:    "wc-chess-board .piece, chess-board .piece",
+		DialogSelector:   ".board-modal-container-container, .game-over-modal-content",
+		ResultSelector:   ".game-over-modal-content .header-title-component, .game-over-header-component .header-title-component",
+		StatusSelector:   ".game-over-modal-content .header-subtitle-component, .game-over-header-component .header-subtitle-component",
+		DialogButtons: map[string]string{
+			"close":  ".board-modal-header-close, [aria-label=\"Close\"]",
+			"cancel": ".game-over-modal-content .cc-button-secondary",
+		},
+		Offers: map[string]offerControls{
+			offerDraw:    {Prompt: ".draw-offer-component", Accept: "[aria-label=\"Accept\"]", Decline: "[aria-label=\"Decline\"]"},
+			offerRematch: {Prompt: ".game-over-modal-content .rematch-offer-component", Accept: "[aria-label=\"Accept\"]", Decline: "[aria-label=\"Decline\"]"},
+		},
+		WhiteClockSelector: ".clock-white .clock-time-monospace, .clock-white",
+		BlackClockSelector: ".clock-black .clock-time-monospace, .clock-black",
+		WhiteTurnSelector:  ".clock-white.clock-player-turn",
+		BlackTurnSelector:  ".clock-black.clock-player-turn",
+		PGNSelector:        ".share-menu-tab-pgn-textarea, textarea[aria-label=\"PGN\"]",
+		PGNOpenSelectors: []string{
+			"button[aria-label=\"Share\"], .share-button-component",
+			".share-menu-tab-selector-component [data-tab=\"pgn\"], #tab-pgn",
+		},
+		LobbyURL: "https://www.chess.com/play/online",
+	},
+}
+
+// siteForURL returns the profile for the site serving rawURL, or nil if it isn't supported
+func siteForURL(rawURL string) *siteProfile {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil
+	}
+	host := strings.ToLower(u.Hostname())
+	for _, site := range siteProfiles {
+		for _, h := range site.Hosts {
+			if host == h || strings.HasSuffix(host, "."+h) {
+				return site
+			}
+		}
+	}
+	return nil
+}
+
+// siteFor returns the profile selected with POST /profiles/sites, if any,
+// or else the one serving rawURL
+func (c *Controller) siteFor(rawURL string) *siteProfile {
+	if name := c.state.siteOverride(); name != "" {
+		return siteByName(name)
+	}
+	return siteForURL(rawURL)
+}
+
+// currentSite returns the profile for the page open in the browser.
+// It requires the marionette backend.
+func (c *Controller) currentSite(ctx context.Context) (*siteProfile, string, error) {
+	current, err := c.marionette.CurrentURL(ctx)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read current URL: %v", err)
+	}
+	return c.siteFor(current), current, nil
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// SquareInfoResponse is the Response for /square-info
+type SquareInfoResponse struct {
+	Response
+	Square   string `json:"square"`
+	Occupied bool   `json:"occupied"`
+	Color    string `json:"color,omitempty"` // "white" or "black", when the piece's classes tell
+	Piece    string `json:"piece,omitempty"` // such as "knight", likewise
+}
+
+// squareInfoScript returns the class names of the piece on square
+// arguments[3], or null when it is empty, finding each piece's square from
+// its position on the board like lastMoveScript. It returns false if there
+// is no board.
+const squareInfoScript = `
+const board = document.querySelector(arguments[0]);
+if (!board) { return false; }
+const b = board.getBoundingClientRect();
+const flipped = arguments[2] ? document.querySelector(arguments[2]) !== null : false;
+const squareOf = el => {
+	const r = el.getBoundingClientRect();
+	const col = Math.floor((r.left + r.width / 2 - b.left) / (b.width / 8));
+	const row = Math.floor((r.top + r.height / 2 - b.top) / (b.height / 8));
+	if (col < 0 || col > 7 || row < 0 || row > 7) { return null; }
+	return flipped ? String.fromCharCode(104 - col) + (row + 1) : String.fromCharCode(97 + col) + (8 - row);
+};
+const piece = Array.from(document.querySelectorAll(arguments[1])).find(el => squareOf(el) === arguments[3]);
+return piece ? Array.from(piece.classList) : null;`
+
+// pieceNames maps the piece letters of piece class names, such as
+// chess.com's "wn", to piece names
+var pieceNames = map[byte]string{'p': "pawn", 'n': "knight", 'b': "bishop", 'r': "rook", 'q': "queen", 'k': "king"}
+
+// pieceFromClasses reads a piece's color and type from its class names:
+// lichess writes them out ("white knight"), chess.com abbreviates them ("wn")
+func pieceFromClasses(classes []string) (color, piece string) {
+	for _, class := range classes {
+		switch class {
+		case "white", "black":
+			color = class
+		case "pawn", "knight", "bishop", "rook", "queen", "king":
+			piece = class
+		}
+		if len(class) == 2 && pieceNames[class[1]] != "" {
+			switch class[0] {
+			case 'w':
+				color, piece = "white", pieceNames[class[1]]
+			case 'b':
+				color, piece = "black", pieceNames[class[1]]
+			}
+		}
+	}
+	return color, piece
+}
+
+// handleSquareInfo reports whether ?square= holds a piece, and which, read
+// from the board of a recognized site
+func (c *Controller) handleSquareInfo(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "Only GET method is allowed")
+		return
+	}
+	if c.marionette == nil {
+		writeError(w, http.StatusNotImplemented, "Square info requires the marionette backend to read the board")
+		return
+	}
+	square := r.URL.Query().Get("square")
+	if !squarePattern.MatchString(square) {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("Invalid square %q", square))
+		return
+	}
+
+	site, current, err := c.currentSite(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if site == nil || site.PieceSelector == "" {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("Unsupported site: %s", current))
+		return
+	}
+
+	var result interface{}
+	if err := c.marionette.ExecuteScript(r.Context(), squareInfoScript, []interface{}{site.BoardSelector, site.PieceSelector, site.FlippedSelector, square}, &result); err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to read the board: %v", err))
+		return
+	}
+	if result == false {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("No board found on %s", site.Name))
+		return
+	}
+
+	resp := SquareInfoResponse{Square: square}
+	message := fmt.Sprintf("%s is empty", square)
+	if list, ok := result.([]interface{}); ok {
+		classes := make([]string, 0, len(list))
+		for _, v := range list {
+			if s, ok := v.(string); ok {
+				classes = append(classes, s)
+			}
+		}
+		resp.Occupied = true
+		resp.Color, resp.Piece = pieceFromClasses(classes)
+		message = fmt.Sprintf("%s holds a piece", square)
+		if desc := strings.TrimSpace(resp.Color + " " + resp.Piece); desc != "" {
+			message = fmt.Sprintf("%s holds a %s", square, desc)
+		}
+	}
+	resp.Response = Response{Success: true, Message: message}
+	writeJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// stablePollInterval is how often /wait-for-board-stable screenshots the board
+const stablePollInterval = 100 * time.Millisecond
+
+// BoardStableResponse is the Response for /wait-for-board-stable
+type BoardStableResponse struct {
+	Response
+	WaitedMs int64 `json:"waited_ms"`
+	Frames   int   `json:"frames"` // screenshots compared
+}
+
+// handleWaitForBoardStable waits until the calibrated board has stayed
+// visually unchanged for the stability window, so a read that follows
+// doesn't catch a piece mid-animation. The window and change threshold
+// come from the stable_ms and threshold query parameters, defaulting to
+// -board-stable and -board-change-threshold; the request timeout bounds
+// the wait.
+func (c *Controller) handleWaitForBoardStable(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "Only GET and POST methods are allowed")
+		return
+	}
+
+	window := c.cfg.BoardStable
+	if q := r.URL.Query().Get("stable_ms"); q != "" {
+		ms, err := strconv.Atoi(q)
+		if err != nil || ms <= 0 {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("Invalid stable_ms %q", q))
+			return
+		}
+		window = time.Duration(ms) * time.Millisecond
+	}
+	threshold := c.cfg.BoardChangeThreshold
+	if q := r.URL.Query().Get("threshold"); q != "" {
+		v, err := strconv.ParseFloat(q, 64)
+		if err != nil || v < 0 || v > 1 {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("Invalid threshold %q; it is a fraction of the board from 0 to 1", q))
+			return
+		}
+		threshold = v
+	}
+
+	cal, ok := c.calibration()
+	if !ok {
+		writeErrorCode(w, http.StatusConflict, codeCalibrationMissing, "Board is not calibrated")
+		return
+	}
+	board := rect{X: cal.X, Y: cal.Y, Width: cal.Width, Height: cal.Height}
+
+	start := time.Now()
+	frames, err := waitBoardStable(r.Context(), board, window, threshold)
+	if err == context.DeadlineExceeded {
+		writeErrorCode(w, http.StatusGatewayTimeout, codeTimeout, fmt.Sprintf("Board did not settle within %v", time.Since(start).Round(time.Millisecond)))
+		return
+	}
+	if err != nil {
+		writeCommandError(w, err, fmt.Sprintf("Failed to wait for the board: %v", err))
+		return
+	}
+	writeJSON(w, http.StatusOK, BoardStableResponse{
+		Response: Response{
+			Success: true,
+			Message: fmt.Sprintf("Board stable for %v", window),
+		},
+		WaitedMs: time.Since(start).Milliseconds(),
+		Frames:   frames,
+	})
+}
+
+// waitBoardStable screenshots board until no more than threshold of it has
+// changed for window, returning the number of screenshots compared. It
+// returns ctx's error when the context ends first.
+func waitBoardStable(ctx context.Context, board rect, window time.Duration, threshold float64) (frames int, err error) {
+	var previous []byte
+	var stableSince time.Time
+	for {
+		shot, err := captureScreen(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return frames, ctx.Err()
+			}
+			return frames, fmt.Errorf("failed to capture screen: %v", err)
+		}
+		now := time.Now()
+		if previous != nil {
+			frames++
+			changed, total, err := changedPixels(previous, shot, board, moveColorTolerance)
+			if err != nil {
+				return frames, fmt.Errorf("failed to compare screenshots: %v", err)
+			}
+			if float64(changed) > threshold*float64(total) {
+				stableSince = now
+			}
+		} else {
+			stableSince = now
+		}
+		previous = shot
+
+		if now.Sub(stableSince) >= window {
+			return frames, nil
+		}
+
+		select {
+		case <-time.After(stablePollInterval):
+		case <-ctx.Done():
+			return frames, ctx.Err()
+		}
+	}
+}
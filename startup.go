@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+)
+
+// openStartURL navigates to -start-url once. It runs after the listener is
+// bound and only logs failures, so a later /open can retry.
+func (c *Controller) openStartURL() {
+	ctx, cancel := context.WithTimeout(c.baseContext(), c.cfg.LaunchTimeout+c.timeoutFor(timeoutNavigation))
+	defer cancel()
+
+	if !firefoxRunning(ctx) {
+		log.Printf("firefox is not running; launching it for start URL %s", redact(c.cfg.StartURL))
+	}
+
+	body, err := json.Marshal(URLRequest{URL: c.cfg.StartURL})
+	if err != nil {
+		log.Printf("warning: failed to open start URL %s: %v", redact(c.cfg.StartURL), err)
+		return
+	}
+	if err := c.lock(ctx, "start-url"); err != nil {
+		log.Printf("warning: failed to open start URL %s: %v", redact(c.cfg.StartURL), err)
+		return
+	}
+	defer c.unlock()
+
+	rec, err := c.dispatchLocked(ctx, "/open", body)
+	if err != nil {
+		log.Printf("warning: failed to open start URL %s: %v", redact(c.cfg.StartURL), err)
+		return
+	}
+	var resp Response
+	json.Unmarshal(rec.body.Bytes(), &resp)
+	if rec.status < 200 || rec.status > 299 {
+		log.Printf("warning: failed to open start URL %s (status %d): %s", redact(c.cfg.StartURL), rec.status, redact(resp.Message))
+		return
+	}
+	log.Printf("opened start URL: %s", redact(resp.Message))
+}
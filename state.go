@@ -0,0 +1,149 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// stateStore holds the controller state that request goroutines share: the
+// calibration, the last selected tab and the last navigation. Every access
+// goes through its methods, so a /move reading the geometry can't race a
+// /calibrate writing it.
+type stateStore struct {
+	mu          sync.RWMutex
+	cal         *Calibration
+	activeTab   string // tab last selected with /switch-tab
+	lastURL     string // target of the last /open
+	navigatedAt time.Time
+	profile     string // profile selected with POST /profiles for future launches
+	site        string // site profile selected with POST /profiles/sites
+	color       string // playing_color of the last /setup
+}
+
+// StateSnapshot is a consistent copy of the shared state, reported by /status
+type StateSnapshot struct {
+	Calibration *Calibration `json:"calibration,omitempty"`
+	ActiveTab   string       `json:"active_tab,omitempty"`
+	LastURL     string       `json:"last_url,omitempty"`
+	NavigatedAt *time.Time   `json:"navigated_at,omitempty"`
+	Profile     string       `json:"profile,omitempty"`
+	Site        string       `json:"site,omitempty"`
+	Color       string       `json:"playing_color,omitempty"`
+}
+
+// calibration returns the current calibration, if the board has been calibrated
+func (s *stateStore) calibration() (Calibration, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.cal == nil {
+		return Calibration{}, false
+	}
+	return *s.cal, true
+}
+
+func (s *stateStore) setCalibration(cal Calibration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cal = &cal
+}
+
+// clearCalibration forgets the calibration
+func (s *stateStore) clearCalibration() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cal = nil
+}
+
+// setOrientation changes only the orientation of the stored calibration
+func (s *stateStore) setOrientation(orientation string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cal == nil {
+		return false
+	}
+	s.cal.Orientation = orientation
+	return true
+}
+
+// setActiveTab records the tab selected by /switch-tab
+func (s *stateStore) setActiveTab(tab string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.activeTab = tab
+}
+
+// launchProfile returns the profile selected for future launches, if any
+func (s *stateStore) launchProfile() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.profile
+}
+
+// setLaunchProfile selects the profile future launches use; empty goes back to -profile
+func (s *stateStore) setLaunchProfile(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.profile = name
+}
+
+// siteOverride returns the site profile selected in place of the one
+// detected from the URL, if any
+func (s *stateStore) siteOverride() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.site
+}
+
+// setSiteOverride selects the site profile every page is treated as; empty
+// goes back to detecting it from the URL
+func (s *stateStore) setSiteOverride(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.site = name
+}
+
+// playingColor returns the side set by /setup, if any
+func (s *stateStore) playingColor() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.color
+}
+
+func (s *stateStore) setPlayingColor(color string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.color = color
+}
+
+// navigated records a successful navigation to url
+func (s *stateStore) navigated(url string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastURL = url
+	s.navigatedAt = time.Now()
+}
+
+// resetBrowser forgets the state tied to the running browser, after a restart
+func (s *stateStore) resetBrowser() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.activeTab = ""
+	s.lastURL = ""
+	s.navigatedAt = time.Time{}
+}
+
+// snapshot returns a copy of the whole state taken under one lock
+func (s *stateStore) snapshot() StateSnapshot {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	snap := StateSnapshot{ActiveTab: s.activeTab, LastURL: s.lastURL, Profile: s.profile, Site: s.site, Color: s.color}
+	if s.cal != nil {
+		cal := *s.cal
+		snap.Calibration = &cal
+	}
+	if !s.navigatedAt.IsZero() {
+		at := s.navigatedAt
+		snap.NavigatedAt = &at
+	}
+	return snap
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"net/http"
+	"runtime"
+	"time"
+)
+
+// StatusResponse is the Response for /status
+type StatusResponse struct {
+	Response
+	OS             string        `json:"os"`
+	Backend        string        `json:"backend"`
+	InputTool      string        `json:"input_tool,omitempty"`      // Linux only
+	ScreenshotTool string        `json:"screenshot_tool,omitempty"` // Linux only
+	FirefoxRunning bool          `json:"firefox_running"`
+	Calibrated     bool          `json:"calibrated"`
+	Recording      bool          `json:"recording"`
+	Monitors       []Monitor     `json:"monitors,omitempty"`
+	Monitor        *Monitor      `json:"monitor,omitempty"` // the -monitor in use
+	State          StateSnapshot `json:"state"`
+	Paused         bool          `json:"paused"`
+	PausedAt       *time.Time    `json:"paused_at,omitempty"`
+	PauseReason    string        `json:"pause_reason,omitempty"`
+}
+
+// handleStatus reports how the controller is set up and what it is doing
+func (c *Controller) handleStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "Only GET method is allowed")
+		return
+	}
+
+	resp := StatusResponse{
+		Response:       Response{Success: true, Message: "Controller is running"},
+		OS:             runtime.GOOS,
+		Backend:        c.cfg.Backend,
+		FirefoxRunning: firefoxRunning(r.Context()),
+	}
+	if runtime.GOOS == "linux" {
+		resp.InputTool = c.dev.input.name()
+		resp.ScreenshotTool = c.dev.screenshot.name
+	}
+	resp.Monitors, _ = listMonitors(r.Context())
+	resp.Monitor = c.dev.monitor
+	resp.State = c.state.snapshot()
+	resp.Calibrated = resp.State.Calibration != nil
+	if paused, since, reason := c.pause.paused(); paused {
+		resp.Paused, resp.PausedAt, resp.PauseReason = true, &since, reason
+		resp.Message = "Controller is running; commands are paused"
+	}
+	c.recorder.mu.Lock()
+	resp.Recording = c.recorder.active
+	c.recorder.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, resp)
+}
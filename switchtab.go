@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// maxDirectTab is the highest tab the Ctrl+<n> shortcuts reach; Ctrl+9 jumps to the last tab
+const maxDirectTab = 8
+
+// SwitchTabRequest represents the JSON payload for /switch-tab
+type SwitchTabRequest struct {
+	Index int    `json:"index"` // 1-based; 9 means the last tab with the native backend
+	ID    string `json:"id"`    // tab handle, marionette backend only
+}
+
+// sendTabShortcut presses Ctrl+<n> (Cmd+<n> on macOS) in Firefox
+func sendTabShortcut(ctx context.Context, n int) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "linux":
+		return linuxInput(ctx).key(ctx, fmt.Sprintf("ctrl+%d", n))
+	case "darwin":
+		cmd = newCommand(ctx, "osascript", "-e", fmt.Sprintf(`tell application "System Events" to keystroke "%d" using command down`, n))
+	case "windows":
+		cmd = newCommand(ctx, "powershell", "-Command", psWindowType+psForegroundGuard+fmt.Sprintf(`
+			Add-Type -AssemblyName System.Windows.Forms
+			$firefox = Get-Process `+targetBrowser.process+` | Where-Object {$_.MainWindowHandle -ne 0} | Select-Object -First 1
+			if (-not $firefox) { exit 1 }
+			Assert-Foreground $firefox.MainWindowHandle
+			[System.Windows.Forms.SendKeys]::SendWait("^%d")`, n))
+	default:
+		return fmt.Errorf("unsupported operating system: %s", runtime.GOOS)
+	}
+	if output, err := cmd.CombinedOutput(); err != nil {
+		if checkForegroundExit(err) == errFocusStolen {
+			return errFocusStolen
+		}
+		return fmt.Errorf("failed to send tab shortcut: %v %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// handleSwitchTab selects a tab by position, or by handle with the marionette backend
+func (c *Controller) handleSwitchTab(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "Only POST method is allowed")
+		return
+	}
+
+	var req SwitchTabRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid JSON payload")
+		return
+	}
+	if (req.Index == 0) == (req.ID == "") {
+		writeError(w, http.StatusBadRequest, "Exactly one of index and id is required")
+		return
+	}
+
+	if c.marionette != nil {
+		if req.Index < 0 {
+			writeError(w, http.StatusBadRequest, "Index must be at least 1")
+			return
+		}
+		var message string
+		err := c.command(r, func() error {
+			handle := req.ID
+			if handle == "" {
+				handles, err := c.marionette.TabHandles(r.Context())
+				if err != nil {
+					return err
+				}
+				if req.Index > len(handles) {
+					return fmt.Errorf("tab %d does not exist; %d tabs are open", req.Index, len(handles))
+				}
+				handle = handles[req.Index-1]
+			}
+			message = fmt.Sprintf("Switched to tab %s", handle)
+			if err := c.marionette.SwitchToTab(r.Context(), handle); err != nil {
+				return err
+			}
+			c.state.setActiveTab(handle)
+			return nil
+		})
+		if err != nil {
+			writeCommandError(w, err, fmt.Sprintf("Failed to switch tab: %v", err))
+			return
+		}
+		writeJSON(w, http.StatusOK, Response{Success: true, Message: message})
+		return
+	}
+
+	if req.ID != "" {
+		writeError(w, http.StatusNotImplemented, "Switching tabs by id requires the marionette backend")
+		return
+	}
+	if req.Index < 1 || req.Index > maxDirectTab+1 {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("Index must be 1-%d, or %d for the last tab; browsers can't jump directly past tab %d", maxDirectTab, maxDirectTab+1, maxDirectTab))
+		return
+	}
+	err := c.focusCommand(r, func() error {
+		if err := focusFirefox(r.Context()); err != nil {
+			return err
+		}
+		return sendTabShortcut(r.Context(), req.Index)
+	})
+	if err != nil {
+		writeCommandError(w, err, fmt.Sprintf("Failed to switch tab: %v", err))
+		return
+	}
+
+	message := fmt.Sprintf("Switched to tab %d", req.Index)
+	tab := strconv.Itoa(req.Index)
+	if req.Index == maxDirectTab+1 {
+		message = "Switched to the last tab"
+		tab = "last"
+	}
+	c.state.setActiveTab(tab)
+	writeJSON(w, http.StatusOK, Response{Success: true, Message: message})
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// testSquareSettle lets the site draw its selection before the screenshot
+const testSquareSettle = 300 * time.Millisecond
+
+// handleTestSquare clicks ?square= and returns a PNG, or the ?format=
+// asked for, of the board with a crosshair where the click landed, to check
+// the calibration visually
+func (c *Controller) handleTestSquare(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "Only POST method is allowed")
+		return
+	}
+
+	square := r.URL.Query().Get("square")
+	cal, ok := c.calibration()
+	if !ok {
+		writeErrorCode(w, http.StatusConflict, codeCalibrationMissing, "Board is not calibrated")
+		return
+	}
+	target, err := cal.squareCenter(square)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("Invalid square: %v", err))
+		return
+	}
+	format, err := queryImageFormat(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("Invalid image format: %v", err))
+		return
+	}
+
+	var annotated []byte
+	err = c.focusCommand(r, func() error {
+		ctx := r.Context()
+		if err := focusFirefox(ctx); err != nil {
+			return err
+		}
+		if err := mouseClick(ctx, target, buttonLeft); err != nil {
+			return err
+		}
+		select {
+		case <-time.After(testSquareSettle):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		shot, err := captureScreen(ctx)
+		if err != nil {
+			return err
+		}
+		if shot, err = drawCrosshair(shot, target); err != nil {
+			return err
+		}
+		if annotated, err = cropPNG(shot, rect{X: cal.X, Y: cal.Y, Width: cal.Width, Height: cal.Height}); err != nil {
+			return err
+		}
+		annotated, err = format.encode(annotated)
+		return err
+	})
+	if err != nil {
+		writeCommandError(w, err, fmt.Sprintf("Failed to test square %s: %v", square, err))
+		return
+	}
+
+	w.Header().Set("Content-Type", format.contentType())
+	w.Header().Set("X-Click-Point", fmt.Sprintf("%d,%d", target.X, target.Y))
+	w.Write(annotated)
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// timeControlPattern matches a time control key such as "3+2" or "0.5+0"
+var timeControlPattern = regexp.MustCompile(`^[0-9]+(\.[0-9]+)?\+[0-9]+$`)
+
+// SetTimeControlRequest represents the JSON payload for /set-time-control
+type SetTimeControlRequest struct {
+	BaseMinutes float64 `json:"base_minutes"`
+	Increment   int     `json:"increment"` // seconds added per move
+	Site        string  `json:"site"`      // detected from the page with the marionette backend
+}
+
+// SetTimeControlResponse is the Response for /set-time-control
+type SetTimeControlResponse struct {
+	Response
+	Site        string `json:"site"`
+	TimeControl string `json:"time_control"`
+	Steps       int    `json:"steps"` // steps completed, not counting skipped optional ones
+}
+
+// lichessPools are the time controls of lichess's quick pairing buttons
+var lichessPools = []string{"1+0", "2+1", "3+0", "3+2", "5+0", "5+3", "10+0", "10+5", "15+10", "30+0", "30+20"}
+
+// builtinTimeControls returns the sequences that pick each time control a
+// site offers without configuration
+func builtinTimeControls(site string) map[string][]sequenceStep {
+	controls := map[string][]sequenceStep{}
+	if site == "lichess" {
+		for _, tc := range lichessPools {
+			controls[tc] = []sequenceStep{{Action: stepClick, Selector: fmt.Sprintf(".lpools [data-id=%q]", tc)}}
+		}
+	}
+	return controls
+}
+
+// loadTimeControls reads the -time-control-file JSON object mapping site
+// names to time controls such as "3+2" to the steps that start such a game
+func loadTimeControls(path string) (map[string]map[string][]sequenceStep, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var controls map[string]map[string][]sequenceStep
+	if err := json.Unmarshal(data, &controls); err != nil {
+		return nil, err
+	}
+	for site, bySite := range controls {
+		if siteByName(site) == nil {
+			return nil, fmt.Errorf("unknown site %q", site)
+		}
+		for tc, steps := range bySite {
+			if !timeControlPattern.MatchString(tc) {
+				return nil, fmt.Errorf("%s: invalid time control %q; use minutes+increment such as \"3+2\"", site, tc)
+			}
+			for i, step := range steps {
+				if err := step.validate(); err != nil {
+					return nil, fmt.Errorf("%s %s step %d: %v", site, tc, i+1, err)
+				}
+			}
+		}
+	}
+	return controls, nil
+}
+
+// timeControls returns the time controls available on site, configured
+// sequences taking precedence over built-in ones. The built-in ones click
+// selectors, so they need the marionette backend.
+func (c *Controller) timeControls(site string) map[string][]sequenceStep {
+	controls := map[string][]sequenceStep{}
+	if c.marionette != nil {
+		controls = builtinTimeControls(site)
+	}
+	for tc, steps := range c.cfg.TimeControls[site] {
+		controls[tc] = steps
+	}
+	return controls
+}
+
+// handleSetTimeControl starts a game with the requested time control by
+// running the site's sequence for it
+func (c *Controller) handleSetTimeControl(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "Only POST method is allowed")
+		return
+	}
+
+	var req SetTimeControlRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid JSON payload")
+		return
+	}
+	if req.BaseMinutes < 0 || req.Increment < 0 || (req.BaseMinutes == 0 && req.Increment == 0) {
+		writeError(w, http.StatusBadRequest, "base_minutes and increment cannot be negative or both zero")
+		return
+	}
+	tc := strconv.FormatFloat(req.BaseMinutes, 'f', -1, 64) + "+" + strconv.Itoa(req.Increment)
+
+	site := c.requestSite(r.Context(), req.Site)
+	if site == "" {
+		writeError(w, http.StatusBadRequest, "Site is required without the marionette backend")
+		return
+	}
+	if siteByName(site) == nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("Unsupported site: %s", site))
+		return
+	}
+	controls := c.timeControls(site)
+	steps, ok := controls[tc]
+	if !ok {
+		offered := make([]string, 0, len(controls))
+		for name := range controls {
+			offered = append(offered, name)
+		}
+		sort.Strings(offered)
+		message := fmt.Sprintf("No %s time control is available on %s", tc, site)
+		if len(offered) > 0 {
+			message += "; offered: " + strings.Join(offered, ", ")
+		} else {
+			message += "; configure its time controls with -time-control-file"
+		}
+		writeError(w, http.StatusBadRequest, message)
+		return
+	}
+
+	completed := 0
+	err := c.focusCommand(r, func() error {
+		if err := focusFirefox(r.Context()); err != nil {
+			return err
+		}
+		var err error
+		completed, err = c.runSequence(r.Context(), steps)
+		return err
+	})
+	if err != nil {
+		writeJSON(w, commandStatus(err), SetTimeControlResponse{
+			Response: Response{
+				Success:   false,
+				Message:   fmt.Sprintf("Setting %s on %s stopped: %v", tc, site, err),
+				ErrorCode: errorCode(err),
+			},
+			Site:        site,
+			TimeControl: tc,
+			Steps:       completed,
+		})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, SetTimeControlResponse{
+		Response: Response{
+			Success: true,
+			Message: fmt.Sprintf("Started a %s game on %s", tc, site),
+		},
+		Site:        site,
+		TimeControl: tc,
+		Steps:       completed,
+	})
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// stepTimings adds up the time spent in each named step of one ?timing=1 request
+type stepTimings struct {
+	mu    sync.Mutex
+	start time.Time
+	steps map[string]time.Duration
+}
+
+type stepTimingsKey struct{}
+
+// timeStep starts timing the named step of the request in ctx and returns
+// the function that ends it. Repeated steps, such as retried drags, add up.
+// Traced requests also get a child span for the step. It does nothing unless
+// the request asked for ?timing=1 or is traced.
+func timeStep(ctx context.Context, name string) func() {
+	t, _ := ctx.Value(stepTimingsKey{}).(*stepTimings)
+	_, s := startSpan(ctx, name)
+	if t == nil && s == nil {
+		return func() {}
+	}
+	start := time.Now()
+	return func() {
+		s.end()
+		if t == nil {
+			return
+		}
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		t.steps[name] += time.Since(start)
+	}
+}
+
+// roundMs returns d in milliseconds to a tenth
+func roundMs(d time.Duration) float64 {
+	return math.Round(float64(d)/float64(time.Millisecond)*10) / 10
+}
+
+// withTiming adds a "timing" field mapping step names to milliseconds, plus
+// "total", to JSON responses of ?timing=1 requests. Only the steps an
+// endpoint times appear; /move times focus, drag, confirmation and
+// verification separately.
+func (c *Controller) withTiming(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("timing") != "1" || r.URL.Path == "/events" {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		t := &stepTimings{start: time.Now(), steps: map[string]time.Duration{}}
+		rec := &bufferedResponse{header: http.Header{}, status: http.StatusOK}
+		h.ServeHTTP(rec, r.WithContext(context.WithValue(r.Context(), stepTimingsKey{}, t)))
+
+		t.mu.Lock()
+		ms := map[string]float64{"total": roundMs(time.Since(t.start))}
+		for name, d := range t.steps {
+			ms[name] = roundMs(d)
+		}
+		t.mu.Unlock()
+		data, _ := json.Marshal(ms)
+
+		for k, v := range rec.header {
+			w.Header()[k] = v
+		}
+		body, _ := addJSONField(rec, "timing", data)
+		w.Header().Del("Content-Length")
+		w.WriteHeader(rec.status)
+		w.Write(body)
+	})
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"slices"
+)
+
+// serverTLSConfig returns the TLS configuration for -tls-cert, or nil to
+// serve plain HTTP. With -tls-client-ca every connection must present a
+// client certificate signed by that CA, and with -tls-client-cns its common
+// name must be one of them. Client certificates are checked in the
+// handshake, so unlike -api-key they also cover /health and /ready.
+func serverTLSConfig(cfg *Config) (*tls.Config, error) {
+	if cfg.TLSCert == "" {
+		return nil, nil
+	}
+	cert, err := tls.LoadX509KeyPair(cfg.TLSCert, cfg.TLSKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load -tls-cert and -tls-key: %v", err)
+	}
+	tlsCfg := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if cfg.TLSClientCA == "" {
+		return tlsCfg, nil
+	}
+
+	pem, err := os.ReadFile(cfg.TLSClientCA)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read -tls-client-ca: %v", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("-tls-client-ca %s has no PEM certificates", cfg.TLSClientCA)
+	}
+	tlsCfg.ClientCAs = pool
+	tlsCfg.ClientAuth = tls.RequireAndVerifyClientCert
+	if len(cfg.TLSClientCNs) > 0 {
+		// Runs after the chain is verified, so the leaf is a CA-signed
+		// certificate; net/http logs the rejection as a handshake error
+		tlsCfg.VerifyConnection = func(cs tls.ConnectionState) error {
+			cn := cs.PeerCertificates[0].Subject.CommonName
+			if !slices.Contains(cfg.TLSClientCNs, cn) {
+				return fmt.Errorf("client certificate CN %q is not allowed", cn)
+			}
+			return nil
+		}
+	}
+	return tlsCfg, nil
+}
@@ -0,0 +1,405 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OpenTelemetry tracing, configured with the standard OTEL_* environment
+// variables. Spans are sent to an OTLP/HTTP collector in its JSON encoding,
+// which collectors accept on the same /v1/traces path as protobuf.
+//
+// Each request is a server span, continuing the trace of an incoming W3C
+// traceparent header. The steps timeStep measures, such as lock_wait,
+// navigate, focus and drag, are child spans, and every command the server
+// runs is an "exec" event on the span that ran it.
+
+// Span kinds and status codes from the OTLP trace protocol
+const (
+	spanKindInternal = 1
+	spanKindServer   = 2
+	spanStatusError  = 2
+)
+
+// otlpValue is an OTLP attribute value; ints are strings in the JSON encoding
+type otlpValue struct {
+	StringValue *string `json:"stringValue,omitempty"`
+	IntValue    *string `json:"intValue,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+func stringAttr(key, value string) otlpKeyValue {
+	return otlpKeyValue{Key: key, Value: otlpValue{StringValue: &value}}
+}
+
+func intAttr(key string, value int) otlpKeyValue {
+	s := strconv.Itoa(value)
+	return otlpKeyValue{Key: key, Value: otlpValue{IntValue: &s}}
+}
+
+type otlpEvent struct {
+	TimeUnixNano string         `json:"timeUnixNano"`
+	Name         string         `json:"name"`
+	Attributes   []otlpKeyValue `json:"attributes,omitempty"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              int            `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Events            []otlpEvent    `json:"events,omitempty"`
+	Status            otlpStatus     `json:"status"`
+}
+
+func unixNano(t time.Time) string { return strconv.FormatInt(t.UnixNano(), 10) }
+
+// span is one traced operation. Async handlers keep working after the
+// request span ends, so it has its own lock and ignores changes once ended.
+type span struct {
+	mu      sync.Mutex
+	traceID string
+	id      string
+	data    otlpSpan
+	ended   bool
+}
+
+type spanKey struct{}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// startSpan starts a child span of the one in ctx, or returns ctx and nil
+// when the request isn't traced. A nil span ignores every method.
+func startSpan(ctx context.Context, name string) (context.Context, *span) {
+	parent, _ := ctx.Value(spanKey{}).(*span)
+	if parent == nil {
+		return ctx, nil
+	}
+	s := newSpan(parent.traceID, parent.id, name, spanKindInternal)
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+func newSpan(traceID, parentID, name string, kind int) *span {
+	s := &span{traceID: traceID, id: randomHex(8)}
+	s.data = otlpSpan{
+		TraceID:           traceID,
+		SpanID:            s.id,
+		ParentSpanID:      parentID,
+		Name:              name,
+		Kind:              kind,
+		StartTimeUnixNano: unixNano(time.Now()),
+	}
+	return s
+}
+
+// setAttr sets attributes on the span
+func (s *span) setAttr(attrs ...otlpKeyValue) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.ended {
+		s.data.Attributes = append(s.data.Attributes, attrs...)
+	}
+}
+
+// setError marks the span as failed
+func (s *span) setError(message string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Status = otlpStatus{Code: spanStatusError, Message: message}
+}
+
+// end finishes the span and queues it for export
+func (s *span) end() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.data.EndTimeUnixNano = unixNano(time.Now())
+	data := s.data
+	s.mu.Unlock()
+	tracer.add(data)
+}
+
+// spanAttr sets attributes on the span of the request in ctx, if it is traced
+func spanAttr(ctx context.Context, attrs ...otlpKeyValue) {
+	s, _ := ctx.Value(spanKey{}).(*span)
+	s.setAttr(attrs...)
+}
+
+// spanEvent adds an event to the span of the request in ctx, if it is traced
+func spanEvent(ctx context.Context, name string, attrs ...otlpKeyValue) {
+	s, _ := ctx.Value(spanKey{}).(*span)
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.ended {
+		s.data.Events = append(s.data.Events, otlpEvent{TimeUnixNano: unixNano(time.Now()), Name: name, Attributes: attrs})
+	}
+}
+
+// otlpExporter batches ended spans and posts them to the collector
+type otlpExporter struct {
+	endpoint string
+	headers  map[string]string
+	resource []otlpKeyValue
+	client   *http.Client
+
+	mu    sync.Mutex
+	spans []otlpSpan
+}
+
+// Batching limits, the OpenTelemetry batch span processor defaults
+const (
+	traceBatchDelay = 5 * time.Second
+	traceBatchSize  = 512
+	traceQueueSize  = 2048
+)
+
+// tracer is the exporter set up by configureTracing; nil disables tracing
+var tracer *otlpExporter
+
+// configureTracing enables tracing when OTEL_EXPORTER_OTLP_TRACES_ENDPOINT or
+// OTEL_EXPORTER_OTLP_ENDPOINT is set, unless OTEL_TRACES_EXPORTER or
+// OTEL_SDK_DISABLED turns it off. OTEL_EXPORTER_OTLP_HEADERS,
+// OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES are honored too.
+func configureTracing() error {
+	if os.Getenv("OTEL_SDK_DISABLED") == "true" {
+		return nil
+	}
+	if exporter := os.Getenv("OTEL_TRACES_EXPORTER"); exporter != "" && exporter != "otlp" {
+		if exporter != "none" {
+			log.Printf("warning: OTEL_TRACES_EXPORTER %s is not supported; tracing is off", exporter)
+		}
+		return nil
+	}
+	endpoint := envOr("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "")
+	if endpoint == "" {
+		base := envOr("OTEL_EXPORTER_OTLP_ENDPOINT", "")
+		if base == "" {
+			return nil
+		}
+		endpoint = strings.TrimSuffix(base, "/") + "/v1/traces"
+	}
+	if _, err := url.ParseRequestURI(endpoint); err != nil {
+		return fmt.Errorf("invalid OTLP traces endpoint %q: %v", endpoint, err)
+	}
+	protocol := envOr("OTEL_EXPORTER_OTLP_TRACES_PROTOCOL", envOr("OTEL_EXPORTER_OTLP_PROTOCOL", ""))
+	if protocol != "" && protocol != "http/json" {
+		log.Printf("warning: OTLP protocol %s is not supported; sending http/json", protocol)
+	}
+
+	headers, err := parseOTelList(envOr("OTEL_EXPORTER_OTLP_TRACES_HEADERS", envOr("OTEL_EXPORTER_OTLP_HEADERS", "")))
+	if err != nil {
+		return fmt.Errorf("invalid OTEL_EXPORTER_OTLP_HEADERS: %v", err)
+	}
+	attrs, err := parseOTelList(os.Getenv("OTEL_RESOURCE_ATTRIBUTES"))
+	if err != nil {
+		return fmt.Errorf("invalid OTEL_RESOURCE_ATTRIBUTES: %v", err)
+	}
+	if name := os.Getenv("OTEL_SERVICE_NAME"); name != "" {
+		attrs["service.name"] = name
+	}
+	if attrs["service.name"] == "" {
+		attrs["service.name"] = "browser-controller"
+	}
+	attrs["os.type"] = runtime.GOOS
+	resource := []otlpKeyValue{intAttr("process.pid", os.Getpid())}
+	for k, v := range attrs {
+		resource = append(resource, stringAttr(k, v))
+	}
+
+	tracer = &otlpExporter{
+		endpoint: endpoint,
+		headers:  headers,
+		resource: resource,
+		client:   &http.Client{Timeout: 10 * time.Second},
+	}
+	go tracer.run()
+	log.Printf("sending traces to %s", endpoint)
+	return nil
+}
+
+// parseOTelList parses the "key=value,key2=value2" lists of the OTEL_*
+// variables, whose values are URL-encoded
+func parseOTelList(s string) (map[string]string, error) {
+	m := map[string]string{}
+	for _, item := range strings.Split(s, ",") {
+		if strings.TrimSpace(item) == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(item, "=")
+		if !ok {
+			return nil, fmt.Errorf("%q is not key=value", item)
+		}
+		decoded, err := url.QueryUnescape(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("%q: %v", item, err)
+		}
+		m[strings.TrimSpace(key)] = decoded
+	}
+	return m, nil
+}
+
+func (e *otlpExporter) add(s otlpSpan) {
+	if e == nil {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if len(e.spans) >= traceQueueSize {
+		return
+	}
+	e.spans = append(e.spans, s)
+}
+
+// run exports the queued spans every traceBatchDelay
+func (e *otlpExporter) run() {
+	for range time.Tick(traceBatchDelay) {
+		for e.flush() {
+		}
+	}
+}
+
+// flush exports up to traceBatchSize queued spans and reports whether more remain
+func (e *otlpExporter) flush() bool {
+	e.mu.Lock()
+	n := min(len(e.spans), traceBatchSize)
+	batch := e.spans[:n:n]
+	e.spans = e.spans[n:]
+	more := len(e.spans) > 0
+	e.mu.Unlock()
+	if n == 0 {
+		return false
+	}
+
+	payload := map[string]interface{}{
+		"resourceSpans": []interface{}{map[string]interface{}{
+			"resource": map[string]interface{}{"attributes": e.resource},
+			"scopeSpans": []interface{}{map[string]interface{}{
+				"scope": map[string]string{"name": "browser-controller"},
+				"spans": batch,
+			}},
+		}},
+	}
+	body, _ := json.Marshal(payload)
+	req, err := http.NewRequest(http.MethodPost, e.endpoint, bytes.NewReader(body))
+	if err != nil {
+		log.Printf("warning: failed to export %d spans: %v", n, err)
+		return more
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range e.headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := e.client.Do(req)
+	if err != nil {
+		log.Printf("warning: failed to export %d spans: %v", n, err)
+		return more
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		log.Printf("warning: failed to export %d spans: collector returned %s", n, resp.Status)
+	}
+	return more
+}
+
+// parseTraceparent returns the trace and parent span ids of a W3C
+// traceparent header such as "00-<32 hex>-<16 hex>-01"
+func parseTraceparent(h string) (traceID, parentID string, ok bool) {
+	parts := strings.Split(strings.TrimSpace(h), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || len(parts[1]) != 32 || len(parts[2]) != 16 {
+		return "", "", false
+	}
+	for _, id := range parts[1:3] {
+		if _, err := hex.DecodeString(id); err != nil || strings.Trim(id, "0") == "" {
+			return "", "", false
+		}
+	}
+	return strings.ToLower(parts[1]), strings.ToLower(parts[2]), true
+}
+
+// withTracing makes each request a server span when tracing is configured,
+// replying with its traceparent so callers can find the trace. /events
+// streams for as long as the client listens, so it isn't traced.
+func (c *Controller) withTracing(h http.Handler) http.Handler {
+	if tracer == nil {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/events" {
+			h.ServeHTTP(w, r)
+			return
+		}
+		traceID, parentID, ok := parseTraceparent(r.Header.Get("traceparent"))
+		if !ok {
+			traceID, parentID = randomHex(16), ""
+		}
+		s := newSpan(traceID, parentID, r.Method+" "+r.URL.Path, spanKindServer)
+		s.setAttr(
+			stringAttr("http.request.method", r.Method),
+			stringAttr("url.path", r.URL.Path),
+			stringAttr("browser", "firefox"),
+			stringAttr("backend", c.cfg.Backend),
+			stringAttr("os.type", runtime.GOOS),
+		)
+		w.Header().Set("traceparent", "00-"+traceID+"-"+s.id+"-01")
+
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		h.ServeHTTP(sw, r.WithContext(context.WithValue(r.Context(), spanKey{}, s)))
+
+		status := sw.status
+		outcome := "success"
+		if status >= 400 {
+			outcome = "error"
+		}
+		s.setAttr(intAttr("http.response.status_code", status), stringAttr("outcome", outcome))
+		// Client errors are the caller's, so only 5xx fail the span
+		if status >= 500 {
+			s.setError(http.StatusText(status))
+		}
+		s.end()
+	})
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// turnNone is reported when neither side's clock is running, such as before
+// the first move, after the game ends or in untimed games
+const turnNone = "none"
+
+// TurnResponse is the Response for /turn
+type TurnResponse struct {
+	Response
+	Site string `json:"site"`
+	Turn string `json:"turn"` // "white", "black" or "none"
+	// Side is "yours" or "theirs" when the board is calibrated, taking the
+	// side shown at the bottom as the one the controller plays
+	Side string `json:"side,omitempty"`
+}
+
+// turnScript reports which of the selectors arguments[0] (White) and
+// arguments[1] (Black) matches an element
+const turnScript = `
+return [arguments[0], arguments[1]].map(selector => document.querySelector(selector) !== null);`
+
+// handleTurn reports whose move it is on the current page from the site's
+// running-clock indicator
+func (c *Controller) handleTurn(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "Only GET method is allowed")
+		return
+	}
+	if c.marionette == nil {
+		writeError(w, http.StatusNotImplemented, "Detecting the turn requires the marionette backend")
+		return
+	}
+
+	site, current, err := c.currentSite(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if site == nil || site.WhiteTurnSelector == "" {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("Unsupported site: %s", current))
+		return
+	}
+
+	var running []bool
+	if err := c.marionette.ExecuteScript(r.Context(), turnScript, []interface{}{site.WhiteTurnSelector, site.BlackTurnSelector}, &running); err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to read the turn: %v", err))
+		return
+	}
+
+	turn := turnNone
+	if len(running) == 2 && running[0] != running[1] {
+		turn = orientationBlack
+		if running[0] {
+			turn = orientationWhite
+		}
+	}
+
+	message := "Neither side's clock is running"
+	side := ""
+	if turn != turnNone {
+		message = fmt.Sprintf("%s to move", titleSide(turn))
+		if cal, ok := c.calibration(); ok {
+			side = "theirs"
+			if cal.Orientation == turn {
+				side = "yours"
+			}
+			message += fmt.Sprintf(" (%s)", side)
+		}
+	}
+
+	writeJSON(w, http.StatusOK, TurnResponse{
+		Response: Response{Success: true, Message: message},
+		Site:     site.Name,
+		Turn:     turn,
+		Side:     side,
+	})
+}
+
+// titleSide capitalizes "white" or "black" for messages
+func titleSide(side string) string {
+	if side == orientationBlack {
+		return "Black"
+	}
+	return "White"
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Ways xdotool enters text, chosen with -type-mode
+const (
+	typeModeType   = "type"   // xdotool type
+	typeModeKeysym = "keysym" // xdotool key with an explicit keysym per character
+	typeModeAuto   = "auto"   // keysym when the keyboard layout isn't US
+)
+
+// urlKeysyms names the keysyms of the characters common in URLs
+var urlKeysyms = map[rune]string{
+	' ': "space", '!': "exclam", '"': "quotedbl", '#': "numbersign", '$': "dollar",
+	'%': "percent", '&': "ampersand", '\'': "apostrophe", '(': "parenleft", ')': "parenright",
+	'*': "asterisk", '+': "plus", ',': "comma", '-': "minus", '.': "period", '/': "slash",
+	':': "colon", ';': "semicolon", '<': "less", '=': "equal", '>': "greater", '?': "question",
+	'@': "at", '[': "bracketleft", '\\': "backslash", ']': "bracketright", '^': "asciicircum",
+	'_': "underscore", '`': "grave", '{': "braceleft", '|': "bar", '}': "braceright", '~': "asciitilde",
+}
+
+// textKeysyms returns the keysym for each character of text: letters and
+// digits below 0x80 are their own keysym, the rest are named or Unicode keysyms
+func textKeysyms(text string) []string {
+	syms := make([]string, 0, len(text))
+	for _, r := range text {
+		switch {
+		case r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)):
+			syms = append(syms, string(r))
+		case urlKeysyms[r] != "":
+			syms = append(syms, urlKeysyms[r])
+		default:
+			syms = append(syms, fmt.Sprintf("U%04X", r))
+		}
+	}
+	return syms
+}
+
+// keyboardLayout returns the X keyboard layouts from setxkbmap, such as "us" or "de,us"
+func keyboardLayout(ctx context.Context) (string, error) {
+	output, err := newCommand(ctx, "setxkbmap", "-query").Output()
+	if err != nil {
+		return "", fmt.Errorf("setxkbmap failed: %v", err)
+	}
+	for _, line := range strings.Split(string(output), "\n") {
+		if layout, ok := strings.CutPrefix(line, "layout:"); ok {
+			return strings.TrimSpace(layout), nil
+		}
+	}
+	return "", fmt.Errorf("setxkbmap reported no layout")
+}
+
+// chooseTypeMode applies -type-mode to xdotool typing, detecting the
+// layout for auto and warning when plain typing meets a non-US layout.
+// xdotool type picks keycodes for symbols as if the layout were US, so on
+// layouts such as German "/" or ":" can come out as other characters.
+func (c *Controller) chooseTypeMode() {
+	if c.dev.input.name() != "xdotool" {
+		return
+	}
+	ctx, cancel := context.WithTimeout(c.baseContext(), 5*time.Second)
+	defer cancel()
+	layout, err := keyboardLayout(ctx)
+	usLayout := err == nil && strings.Split(layout, ",")[0] == "us"
+
+	switch c.cfg.TypeMode {
+	case typeModeKeysym:
+		c.dev.keysyms = true
+	case typeModeAuto:
+		if err != nil {
+			log.Printf("warning: cannot detect the keyboard layout (%v); typing with keysyms", err)
+			c.dev.keysyms = true
+		} else if !usLayout {
+			log.Printf("keyboard layout is %s; typing with keysyms", layout)
+			c.dev.keysyms = true
+		}
+	case typeModeType:
+		if err == nil && !usLayout {
+			log.Printf("warning: keyboard layout is %s and xdotool type may enter the wrong symbols in URLs; consider -type-mode keysym", layout)
+		}
+	}
+}
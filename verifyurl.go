@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// verifyURLPoll is how often the current URL is read while waiting for a navigation
+const verifyURLPoll = 200 * time.Millisecond
+
+// urlPath returns the path of target without its trailing slash
+func urlPath(target string) string {
+	toParse := target
+	if !strings.Contains(target, "://") {
+		toParse = "//" + target
+	}
+	u, err := url.Parse(toParse)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSuffix(u.EscapedPath(), "/")
+}
+
+// urlsMatch reports whether the browser at got is on the page typed as want.
+// Only the host, ignoring "www.", and the path are compared, so a scheme
+// upgrade or added query string still matches.
+func urlsMatch(want, got string) bool {
+	wantHost, gotHost := urlHost(want), urlHost(got)
+	if wantHost == "" {
+		return want == got
+	}
+	return strings.TrimPrefix(wantHost, "www.") == strings.TrimPrefix(gotHost, "www.") &&
+		urlPath(want) == urlPath(got)
+}
+
+// waitForURL polls the current URL until it matches target or the
+// -verify-url-wait expires, returning the last URL seen
+func (c *Controller) waitForURL(ctx context.Context, target string) (string, bool) {
+	deadline := time.Now().Add(c.cfg.VerifyURLWait)
+	var current string
+	for {
+		if u, err := c.marionette.CurrentURL(ctx); err == nil {
+			current = u
+			if urlsMatch(target, current) {
+				return current, true
+			}
+		}
+		if time.Now().After(deadline) {
+			return current, false
+		}
+		select {
+		case <-time.After(verifyURLPoll):
+		case <-ctx.Done():
+			return current, false
+		}
+	}
+}
+
+// navigateVerified types target into the address bar and, with
+// -verify-url-retries set, reads the URL back and retypes it when dropped
+// keystrokes sent the browser somewhere else
+func (c *Controller) navigateVerified(ctx context.Context, target, profile string) error {
+	if err := c.updateFirefoxURL(ctx, target, profile); err != nil {
+		return err
+	}
+	if c.cfg.VerifyURLRetries == 0 {
+		return nil
+	}
+	for attempt := 0; ; attempt++ {
+		current, ok := c.waitForURL(ctx, target)
+		if ok {
+			return nil
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if attempt == c.cfg.VerifyURLRetries {
+			return withCode(codeURLMismatch, fmt.Errorf("browser is at %q instead of %s after %d retries", current, target, attempt))
+		}
+		log.Printf("browser is at %q instead of %s; retyping", redact(current), redact(target))
+		if err := c.updateFirefoxURL(ctx, target, profile); err != nil {
+			return err
+		}
+	}
+}
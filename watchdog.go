@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// watchdog notices a frozen browser: after a navigation the window title
+// should change, and if it stays the same past the staleness threshold the
+// browser is reported unhealthy
+type watchdog struct {
+	mu        sync.Mutex
+	title     string    // last title seen
+	lastURL   string    // target of the last navigation
+	pending   bool      // a navigation hasn't changed the title yet
+	since     time.Time // when the pending navigation happened
+	before    string    // title at the time of the pending navigation
+	unhealthy string    // reason the browser looks frozen, empty when healthy
+}
+
+// HealthResponse is the Response for /health
+type HealthResponse struct {
+	Response
+	Healthy bool `json:"healthy"`
+	Paused  bool `json:"paused,omitempty"` // commands are held by /pause
+	// Screen is left out when no tool on this machine can tell
+	Screen *screenState `json:"screen,omitempty"`
+	// Probes are the active checks run for ?deep=1
+	Probes []HealthProbe `json:"probes,omitempty"`
+}
+
+// navigated records that the browser was sent to url and should update
+func (wd *watchdog) navigated(url string) {
+	wd.mu.Lock()
+	defer wd.mu.Unlock()
+	// Reloading the same page needn't change the title
+	if url == wd.lastURL {
+		return
+	}
+	wd.lastURL = url
+	if !wd.pending {
+		wd.pending = true
+		wd.since = time.Now()
+		wd.before = wd.title
+	}
+}
+
+// reset forgets the pending navigation and any freeze, after a restart
+func (wd *watchdog) reset() {
+	wd.mu.Lock()
+	defer wd.mu.Unlock()
+	wd.pending = false
+	wd.unhealthy = ""
+	wd.lastURL = ""
+}
+
+// observe records the current title and reports a newly detected freeze
+func (wd *watchdog) observe(title string, stale time.Duration) (frozen bool) {
+	wd.mu.Lock()
+	defer wd.mu.Unlock()
+	wd.title = title
+	if !wd.pending {
+		return false
+	}
+	if title != wd.before {
+		wd.pending = false
+		if wd.unhealthy != "" {
+			log.Printf("watchdog: browser is responding again")
+		}
+		wd.unhealthy = ""
+		return false
+	}
+	if wd.unhealthy == "" && time.Since(wd.since) > stale {
+		wd.unhealthy = "window title has not changed for " + time.Since(wd.since).Round(time.Second).String() + " after navigating to " + wd.lastURL
+		return true
+	}
+	return false
+}
+
+// runWatchdog polls the window title every -watchdog-interval until ctx is done
+func (c *Controller) runWatchdog(ctx context.Context) {
+	ticker := time.NewTicker(c.cfg.WatchdogInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+
+		var title string
+		var err error
+		if c.marionette != nil {
+			title, err = c.marionette.Title(ctx)
+		} else {
+			tctx, cancel := context.WithTimeout(ctx, c.cfg.WatchdogInterval)
+			title, err = firefoxWindowTitle(tctx)
+			cancel()
+		}
+		if err != nil {
+			// Not running is not frozen; /open will launch it
+			continue
+		}
+		if c.watchdog.observe(title, c.cfg.WatchdogStale) {
+			c.watchdog.mu.Lock()
+			reason := c.watchdog.unhealthy
+			c.watchdog.mu.Unlock()
+			log.Printf("watchdog ALERT: browser looks frozen: %s", reason)
+		}
+	}
+}
+
+// handleHealth reports 503 while the screen is locked or the watchdog
+// considers the browser frozen. It only reads cached state, so it is cheap to
+// poll; ?deep=1 also runs active probes, see handleDeepHealth.
+func (c *Controller) handleHealth(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "Only GET method is allowed")
+		return
+	}
+
+	c.watchdog.mu.Lock()
+	reason := c.watchdog.unhealthy
+	c.watchdog.mu.Unlock()
+
+	// A locked screen gets the input meant for the browser
+	var screen *screenState
+	ctx, cancel := context.WithTimeout(r.Context(), screenLockCheckTimeout)
+	state, known, err := detectScreenLock(ctx)
+	cancel()
+	if err == nil && known {
+		screen = &state
+		if state.Locked {
+			writeJSON(w, http.StatusServiceUnavailable, HealthResponse{
+				Response: Response{Success: false, Message: "Input is blocked: " + state.String(), ErrorCode: codeScreenLocked},
+				Screen:   screen,
+			})
+			return
+		}
+	}
+
+	if reason != "" {
+		writeJSON(w, http.StatusServiceUnavailable, HealthResponse{
+			Response: Response{Success: false, Message: "Browser looks frozen: " + reason, ErrorCode: codeUnavailable},
+			Screen:   screen,
+		})
+		return
+	}
+	resp := HealthResponse{
+		Response: Response{Success: true, Message: "Healthy"},
+		Healthy:  true,
+		Screen:   screen,
+	}
+	if screen != nil && screen.Blanked {
+		resp.Message = "Healthy; " + screen.String()
+	}
+	if paused, since, _ := c.pause.paused(); paused {
+		resp.Paused = true
+		resp.Message = fmt.Sprintf("Healthy; commands paused for %v", time.Since(since).Round(time.Second))
+	}
+	if deepHealthRequested(r) {
+		c.handleDeepHealth(w, r, resp)
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
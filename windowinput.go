@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// xdotoolWindowArgs returns the --window arguments for xdotool key and
+// type: the window ctx's controller found by its last focusFirefox, or
+// nothing when keys go to the focused window
+func xdotoolWindowArgs(ctx context.Context) []string {
+	id := ctxDevices(ctx).window.get()
+	if id == "" {
+		return nil
+	}
+	return []string{"--window", id}
+}
+
+// firefoxWindowID returns the X window id of the visible Firefox window,
+// the first one when there are several, as windowactivate would pick
+func firefoxWindowID(ctx context.Context) (string, error) {
+	output, err := newCommand(ctx, "xdotool", "search", "--onlyvisible", "--class", targetBrowser.class).Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to find the Firefox window: %v", err)
+	}
+	id, _, _ := strings.Cut(strings.TrimSpace(string(output)), "\n")
+	if id == "" {
+		return "", fmt.Errorf("no visible Firefox window")
+	}
+	return id, nil
+}
+
+// chooseWindowInput applies -window-input, falling back to activating the
+// window when this session can't target one.
+//
+// With it, on Linux with xdotool, keys and typed text go straight to
+// the Firefox window with --window, and focusFirefox only looks the window
+// up instead of activating it, so a person can keep working in another
+// window while the bot plays.
+//
+// xdotool sends these keystrokes with XSendEvent rather than XTEST, and
+// cases where that doesn't work are:
+//   - Wayland sessions, where xdotool can't reach native Wayland windows
+//   - ydotool and xte, which can't target a window; they keep activating it
+//   - macOS and Windows, which always activate Firefox
+//   - mouse input, which still goes to the screen position, so the board must
+//     be visible and a click-to-focus window manager may focus Firefox anyway
+//   - pages that ignore keys while the document doesn't have focus
+//   - Firefox's own dialogs and pop-ups, which are separate windows
+func (c *Controller) chooseWindowInput() {
+	if !c.cfg.WindowInput {
+		return
+	}
+	switch {
+	case runtime.GOOS != "linux":
+		log.Printf("warning: -window-input is only supported on Linux; activating Firefox instead")
+	case c.dev.input.name() != "xdotool":
+		log.Printf("warning: -window-input needs xdotool for input, not %s; activating Firefox instead", c.dev.input.name())
+	case os.Getenv("XDG_SESSION_TYPE") == "wayland":
+		log.Printf("warning: -window-input does not work on Wayland; activating Firefox instead")
+	default:
+		c.dev.windowInput = true
+		ctx, cancel := context.WithTimeout(c.baseContext(), 5*time.Second)
+		defer cancel()
+		if id, err := firefoxWindowID(ctx); err == nil {
+			c.dev.window.set(id)
+		}
+		log.Printf("sending keys to the Firefox window without activating it")
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// gameWindow is the browser window a controller's input goes to with
+// -match-window: the one showing its game, or else the one it last used
+type gameWindow struct {
+	mu sync.Mutex
+	id string // the window id activateWindow takes; empty to search by class
+}
+
+func (g *gameWindow) get() string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.id
+}
+
+func (g *gameWindow) set(id string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.id = id
+}
+
+type gameWindowKey struct{}
+
+// withGameWindow returns a copy of ctx whose focusFirefox activates the
+// window g names
+func withGameWindow(ctx context.Context, g *gameWindow) context.Context {
+	return context.WithValue(ctx, gameWindowKey{}, g)
+}
+
+// sameGame reports whether a tab's URL shows the game at target: the same
+// host, and the same path or one under it, such as lichess's /abcd1234/white
+// for /abcd1234. The query and fragment are ignored.
+func sameGame(current, target string) bool {
+	a, err := url.Parse(current)
+	if err != nil {
+		return false
+	}
+	b, err := url.Parse(target)
+	if err != nil || b.Host == "" {
+		return false
+	}
+	if !strings.EqualFold(strings.TrimPrefix(a.Host, "www."), strings.TrimPrefix(b.Host, "www.")) {
+		return false
+	}
+	pa, pb := strings.TrimSuffix(a.Path, "/"), strings.TrimSuffix(b.Path, "/")
+	return pa == pb || strings.HasPrefix(pa, pb+"/") || strings.HasPrefix(pb, pa+"/")
+}
+
+// gameURL is the URL of this controller's game: the last /open, or -pin-url
+func (c *Controller) gameURL() string {
+	if last := c.state.snapshot().LastURL; last != "" {
+		return last
+	}
+	return c.cfg.PinURL
+}
+
+// selectGameTab makes the tab showing target the current one, returning its
+// title. The current tab is checked first, so nothing switches when it is
+// already showing the game; when no tab is, the current one is kept.
+func (c *Controller) selectGameTab(ctx context.Context, target string) (string, error) {
+	current, err := c.marionette.CurrentTab(ctx)
+	if err != nil {
+		return "", err
+	}
+	if u, err := c.marionette.CurrentURL(ctx); err == nil && sameGame(u, target) {
+		return c.marionette.Title(ctx)
+	}
+	handles, err := c.marionette.TabHandles(ctx)
+	if err != nil {
+		return "", err
+	}
+	for _, handle := range handles {
+		if handle == current {
+			continue
+		}
+		if err := c.marionette.SwitchToTab(ctx, handle); err != nil {
+			return "", err
+		}
+		if u, err := c.marionette.CurrentURL(ctx); err == nil && sameGame(u, target) {
+			c.state.setActiveTab(handle)
+			return c.marionette.Title(ctx)
+		}
+	}
+	if err := c.marionette.SwitchToTab(ctx, current); err != nil {
+		return "", err
+	}
+	return "", fmt.Errorf("no tab is showing %s", target)
+}
+
+// matchGameWindow picks the window focusFirefox activates for a command,
+// with -match-window. -window-id wins; with the marionette backend the tab
+// showing the game is selected and its window found by the tab's title;
+// otherwise the window last activated is used again. It runs holding the
+// command mutex.
+func (c *Controller) matchGameWindow(ctx context.Context) {
+	if c.cfg.WindowID != "" {
+		c.window.set(c.cfg.WindowID)
+		return
+	}
+	target := c.gameURL()
+	if c.marionette == nil || target == "" {
+		return
+	}
+	title, err := c.selectGameTab(ctx, target)
+	if err != nil {
+		log.Printf("match-window: %v; using the window last focused", err)
+		return
+	}
+	if title == "" {
+		return
+	}
+	windows, err := listBrowserWindows(ctx)
+	if err != nil {
+		log.Printf("match-window: %v", err)
+		return
+	}
+	for _, win := range windows {
+		// Browsers title the window after its selected tab
+		if win.Browser == targetBrowser.name && strings.HasPrefix(win.Title, title) {
+			c.window.set(win.ID)
+			return
+		}
+	}
+	log.Printf("match-window: no %s window is titled %q; using the window last focused", targetBrowser.name, title)
+}
+
+// focusGameWindow activates the window ctx names with -match-window,
+// reporting false when there is none, or it is gone, so focusFirefox
+// searches by class instead. macOS activates applications, not windows,
+// so it is never used there.
+func focusGameWindow(ctx context.Context) bool {
+	g, _ := ctx.Value(gameWindowKey{}).(*gameWindow)
+	if g == nil || runtime.GOOS == "darwin" || (runtime.GOOS == "linux" && !haveWindowTool()) {
+		return false
+	}
+	id := g.get()
+	if id == "" {
+		return false
+	}
+	if dev := ctxDevices(ctx); runtime.GOOS == "linux" && dev.windowInput {
+		dev.window.set(id)
+		return true
+	}
+	if err := activateWindow(ctx, id); err != nil {
+		log.Printf("match-window: %v; searching for the window instead", err)
+		g.set("")
+		return false
+	}
+	return true
+}
+
+// rememberGameWindow records the window focusFirefox found by class as the
+// one to use again, once there is none to match
+func rememberGameWindow(ctx context.Context) {
+	g, _ := ctx.Value(gameWindowKey{}).(*gameWindow)
+	if g == nil || runtime.GOOS == "darwin" || g.get() != "" {
+		return
+	}
+	if id, err := activeWindow(ctx); err == nil {
+		g.set(id)
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"runtime"
+)
+
+// zoomScript returns the page's device pixel ratio, which scales with the zoom level
+const zoomScript = `return window.devicePixelRatio;`
+
+// ZoomResponse is the Response for /zoom
+type ZoomResponse struct {
+	Response
+	Zoom             float64 `json:"zoom,omitempty"` // 1 is 100%
+	DevicePixelRatio float64 `json:"device_pixel_ratio,omitempty"`
+}
+
+// resetZoom presses the shortcut that sets the page zoom back to 100%
+func resetZoom(ctx context.Context) error {
+	if runtime.GOOS == "darwin" {
+		return pressKey(ctx, "cmd+0")
+	}
+	return pressKey(ctx, "ctrl+0")
+}
+
+// readZoom returns the page zoom and device pixel ratio of the current tab.
+// The zoom is the ratio over -base-pixel-ratio, the ratio at 100%.
+func (c *Controller) readZoom(ctx context.Context) (zoom, ratio float64, err error) {
+	if err := c.marionette.ExecuteScript(ctx, zoomScript, nil, &ratio); err != nil {
+		return 0, 0, fmt.Errorf("failed to read the zoom level: %v", err)
+	}
+	zoom = math.Round(ratio/c.cfg.BasePixelRatio*100) / 100
+	return zoom, ratio, nil
+}
+
+// handleZoom reads the page zoom (GET, marionette backend only) or resets it
+// to 100% with the keyboard shortcut (POST). Board calibration is only valid
+// at the zoom it was made at.
+func (c *Controller) handleZoom(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		if c.marionette == nil {
+			writeError(w, http.StatusNotImplemented, "Reading the zoom level requires the marionette backend")
+			return
+		}
+		var zoom, ratio float64
+		err := c.command(r, func() error {
+			var err error
+			zoom, ratio, err = c.readZoom(r.Context())
+			return err
+		})
+		if err != nil {
+			writeCommandError(w, err, err.Error())
+			return
+		}
+		writeJSON(w, http.StatusOK, ZoomResponse{
+			Response:         Response{Success: true, Message: fmt.Sprintf("Page zoom is %.0f%%", zoom*100)},
+			Zoom:             zoom,
+			DevicePixelRatio: ratio,
+		})
+
+	case http.MethodPost:
+		err := c.focusCommand(r, func() error {
+			if err := focusFirefox(r.Context()); err != nil {
+				return err
+			}
+			return resetZoom(r.Context())
+		})
+		if err != nil {
+			writeCommandError(w, err, fmt.Sprintf("Failed to reset the zoom level: %v", err))
+			return
+		}
+		resp := ZoomResponse{Response: Response{Success: true, Message: "Reset page zoom to 100%"}}
+		if c.marionette != nil {
+			if zoom, ratio, err := c.readZoom(r.Context()); err == nil {
+				resp.Zoom, resp.DevicePixelRatio = zoom, ratio
+			}
+		}
+		writeJSON(w, http.StatusOK, resp)
+
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "Only GET and POST methods are allowed")
+	}
+}